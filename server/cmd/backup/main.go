@@ -0,0 +1,113 @@
+package main
+
+import (
+	"VyacheslavKuchumov/test-backend/config"
+	"VyacheslavKuchumov/test-backend/db"
+	"VyacheslavKuchumov/test-backend/service/backup"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "export":
+		runExport(os.Args[2:])
+	case "restore":
+		runRestore(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	fmt.Fprintln(os.Stderr, "  backup export [-o file.zip] [-with-password-hashes]")
+	fmt.Fprintln(os.Stderr, "  backup restore file.zip")
+	os.Exit(2)
+}
+
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String("o", fmt.Sprintf("ultralive-backup-%s.zip", time.Now().Format("20060102-150405")), "output archive path")
+	withHashes := fs.Bool("with-password-hashes", false, "include bcrypt password hashes of users")
+	fs.Parse(args)
+
+	conn, err := db.NewPostgresStorage(config.Envs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	archive, err := backup.Export(context.Background(), conn, backup.ExportOptions{IncludePasswordHashes: *withHashes})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := archive.WriteTo(file); err != nil {
+		file.Close()
+		log.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Exported backup to %s", *output)
+	for table, count := range archive.Manifest.Counts {
+		log.Printf("  %s: %d", table, count)
+	}
+}
+
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	archive, err := backup.ReadArchive(file, info.Size())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !archive.Manifest.IncludesPasswordHashes {
+		log.Printf("Warning: archive has no password hashes, restored users must reset their passwords")
+	}
+
+	conn, err := db.NewPostgresStorage(config.Envs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	report, err := backup.Restore(context.Background(), conn, archive)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Restored backup from %s (created %s)", fs.Arg(0), archive.Manifest.CreatedAt.Format(time.RFC3339))
+	for table, count := range report.Counts {
+		log.Printf("  %s: %d", table, count)
+	}
+}
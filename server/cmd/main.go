@@ -5,6 +5,9 @@ import (
 	"VyacheslavKuchumov/test-backend/config"
 	"VyacheslavKuchumov/test-backend/db"
 	_ "VyacheslavKuchumov/test-backend/docs"
+	"VyacheslavKuchumov/test-backend/service/logging"
+	"VyacheslavKuchumov/test-backend/service/tracing"
+	"context"
 	"log"
 )
 
@@ -17,10 +20,24 @@ import (
 // @in header
 // @name Authorization
 func main() {
+	logging.Setup(config.Envs.LogLevel)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:      config.Envs.TracingExporter,
+		OTLPEndpoint:  config.Envs.TracingOTLPEndpoint,
+		OTLPInsecure:  config.Envs.TracingOTLPInsecure,
+		SamplePercent: config.Envs.TracingSamplePercent,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdownTracing(context.Background())
+
 	db, err := db.NewPostgresStorage(config.Envs)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer db.Close()
 
 	srv := server.NewServer(config.Envs.Port, db)
 	if err := srv.Run(); err != nil {
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS inbound_reviews;
+DROP TABLE IF EXISTS inbound_webhook_deliveries;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS inbound_webhook_deliveries (
+  id BIGSERIAL PRIMARY KEY,
+  source TEXT NOT NULL,
+  delivery_id TEXT NOT NULL,
+  event_type TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT 'processing' CHECK (status IN ('processing', 'processed', 'queued', 'failed')),
+  attempts INT NOT NULL DEFAULT 1,
+  error TEXT,
+  received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  processed_at TIMESTAMPTZ,
+  UNIQUE (source, delivery_id)
+);
+
+CREATE TABLE IF NOT EXISTS inbound_reviews (
+  review_id BIGSERIAL PRIMARY KEY,
+  source TEXT NOT NULL,
+  external_id TEXT NOT NULL,
+  delivery_id TEXT NOT NULL,
+  reason TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'imported', 'dismissed')),
+  project_id BIGINT REFERENCES projects(project_id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  resolved_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_inbound_reviews_pending ON inbound_reviews(source, external_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_inbound_reviews_status ON inbound_reviews(status, created_at DESC);
@@ -0,0 +1,7 @@
+ALTER TABLE drafts DROP COLUMN IF EXISTS version;
+ALTER TABLE projects DROP COLUMN IF EXISTS version;
+ALTER TABLE equipment DROP COLUMN IF EXISTS version;
+ALTER TABLE equipment_sets DROP COLUMN IF EXISTS version;
+ALTER TABLE warehouses DROP COLUMN IF EXISTS version;
+ALTER TABLE project_types DROP COLUMN IF EXISTS version;
+ALTER TABLE set_types DROP COLUMN IF EXISTS version;
@@ -0,0 +1,15 @@
+-- Without deleted_at the trash would come back to life; purge it instead.
+DELETE FROM drafts WHERE deleted_at IS NOT NULL;
+DELETE FROM projects WHERE deleted_at IS NOT NULL;
+DELETE FROM equipment WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_drafts_draft_name;
+ALTER TABLE drafts ADD CONSTRAINT drafts_draft_name_key UNIQUE (draft_name);
+
+DROP INDEX IF EXISTS idx_drafts_deleted_at;
+DROP INDEX IF EXISTS idx_projects_deleted_at;
+DROP INDEX IF EXISTS idx_equipment_deleted_at;
+
+ALTER TABLE drafts DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE projects DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE equipment DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,11 @@
+ALTER TABLE equipment ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE drafts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_equipment_deleted_at ON equipment(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_projects_deleted_at ON projects(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_drafts_deleted_at ON drafts(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- A draft in the trash must not block its name.
+ALTER TABLE drafts DROP CONSTRAINT IF EXISTS drafts_draft_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_drafts_draft_name ON drafts(draft_name) WHERE deleted_at IS NULL;
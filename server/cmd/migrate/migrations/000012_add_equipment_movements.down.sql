@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS equipment_movements;
+DROP TABLE IF EXISTS warehouse_transfer_items;
+DROP TABLE IF EXISTS warehouse_transfers;
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS warehouse_transfers (
+  transfer_id BIGSERIAL PRIMARY KEY,
+  from_warehouse_id BIGINT REFERENCES warehouses(warehouse_id) ON DELETE SET NULL,
+  to_warehouse_id BIGINT REFERENCES warehouses(warehouse_id) ON DELETE SET NULL,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'in_transit', 'received', 'cancelled')),
+  reason TEXT,
+  requested_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  shipped_at TIMESTAMPTZ,
+  received_at TIMESTAMPTZ,
+  cancelled_at TIMESTAMPTZ,
+  version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS idx_warehouse_transfers_open ON warehouse_transfers(status) WHERE status IN ('pending', 'in_transit');
+
+CREATE TABLE IF NOT EXISTS warehouse_transfer_items (
+  transfer_id BIGINT NOT NULL REFERENCES warehouse_transfers(transfer_id) ON DELETE CASCADE,
+  equipment_id BIGINT NOT NULL REFERENCES equipment(equipment_id) ON DELETE CASCADE,
+  PRIMARY KEY (transfer_id, equipment_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_warehouse_transfer_items_equipment ON warehouse_transfer_items(equipment_id);
+
+-- Warehouse references are cleared rather than blocking the delete of a
+-- warehouse that only appears in history.
+CREATE TABLE IF NOT EXISTS equipment_movements (
+  movement_id BIGSERIAL PRIMARY KEY,
+  equipment_id BIGINT NOT NULL REFERENCES equipment(equipment_id) ON DELETE CASCADE,
+  from_warehouse_id BIGINT REFERENCES warehouses(warehouse_id) ON DELETE SET NULL,
+  to_warehouse_id BIGINT REFERENCES warehouses(warehouse_id) ON DELETE SET NULL,
+  moved_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+  reason TEXT,
+  transfer_id BIGINT REFERENCES warehouse_transfers(transfer_id) ON DELETE SET NULL,
+  moved_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_equipment_movements_equipment ON equipment_movements(equipment_id, moved_at);
+
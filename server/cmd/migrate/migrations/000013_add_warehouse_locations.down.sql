@@ -0,0 +1,10 @@
+ALTER TABLE equipment ADD COLUMN IF NOT EXISTS current_storage TEXT;
+
+UPDATE equipment e
+SET current_storage = p.path
+FROM warehouse_location_paths p
+WHERE p.location_id = e.location_id;
+
+ALTER TABLE equipment DROP COLUMN IF EXISTS location_id;
+DROP VIEW IF EXISTS warehouse_location_paths;
+DROP TABLE IF EXISTS warehouse_locations;
@@ -0,0 +1,117 @@
+CREATE TABLE IF NOT EXISTS warehouse_locations (
+  location_id BIGSERIAL PRIMARY KEY,
+  warehouse_id BIGINT NOT NULL REFERENCES warehouses(warehouse_id) ON DELETE CASCADE,
+  parent_id BIGINT REFERENCES warehouse_locations(location_id),
+  kind TEXT NOT NULL CHECK (kind IN ('zone', 'rack', 'shelf', 'bin')),
+  location_name TEXT NOT NULL,
+  version INTEGER NOT NULL DEFAULT 1,
+  CHECK (parent_id <> location_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_warehouse_locations_name
+  ON warehouse_locations(warehouse_id, COALESCE(parent_id, 0), kind, LOWER(location_name));
+CREATE INDEX IF NOT EXISTS idx_warehouse_locations_parent ON warehouse_locations(parent_id);
+
+-- Path spells out a location and its parents, outermost first, e.g.
+-- "zone A / rack 2 / shelf 3".
+CREATE OR REPLACE VIEW warehouse_location_paths AS
+WITH RECURSIVE tree AS (
+  SELECT location_id, kind || ' ' || location_name AS path
+  FROM warehouse_locations
+  WHERE parent_id IS NULL
+  UNION ALL
+  SELECT l.location_id, tree.path || ' / ' || l.kind || ' ' || l.location_name
+  FROM warehouse_locations l
+  JOIN tree ON l.parent_id = tree.location_id
+)
+SELECT location_id, path FROM tree;
+
+ALTER TABLE equipment ADD COLUMN IF NOT EXISTS location_id BIGINT REFERENCES warehouse_locations(location_id);
+CREATE INDEX IF NOT EXISTS idx_equipment_location_id ON equipment(location_id);
+
+-- Turn the free-text current_storage into locations. A value is read as a
+-- list of "<kind> <name>" segments separated by "/", "," or ">", such as
+-- "Shelf-3", "стеллаж 3" or "Zone A / Rack 2 / Shelf 3", where every segment
+-- is a deeper kind than the one before. The name follows the kind after a
+-- separator or directly as a number, so "Binoculars" is not read as a bin.
+-- Anything else becomes a zone named after the original text, so nothing is
+-- lost and it can be tidied up later.
+DO $$
+DECLARE
+  item RECORD;
+  segment TEXT;
+  parsed TEXT[];
+  kinds TEXT[];
+  names TEXT[];
+  segment_kind TEXT;
+  segment_rank INT;
+  last_rank INT;
+  parent BIGINT;
+  location BIGINT;
+  i INT;
+BEGIN
+  FOR item IN
+    SELECT DISTINCT storage_id, BTRIM(current_storage) AS raw
+    FROM equipment
+    WHERE NULLIF(BTRIM(current_storage), '') IS NOT NULL
+  LOOP
+    kinds := ARRAY[]::TEXT[];
+    names := ARRAY[]::TEXT[];
+    last_rank := 0;
+
+    FOREACH segment IN ARRAY REGEXP_SPLIT_TO_ARRAY(item.raw, '\s*[/,>]\s*') LOOP
+      parsed := REGEXP_MATCH(BTRIM(segment), '^(zone|зона|rack|стойка|shelf|полка|стеллаж|bin|box|ячейка|ящик|коробка)(?:[\s._#№:-]+|(?=\d))(\S.*)$', 'i');
+      IF parsed IS NULL THEN
+        kinds := NULL;
+        EXIT;
+      END IF;
+      segment_kind := CASE LOWER(parsed[1])
+        WHEN 'зона' THEN 'zone'
+        WHEN 'стойка' THEN 'rack'
+        WHEN 'полка' THEN 'shelf'
+        WHEN 'стеллаж' THEN 'shelf'
+        WHEN 'box' THEN 'bin'
+        WHEN 'ячейка' THEN 'bin'
+        WHEN 'ящик' THEN 'bin'
+        WHEN 'коробка' THEN 'bin'
+        ELSE LOWER(parsed[1])
+      END;
+      segment_rank := ARRAY_POSITION(ARRAY['zone', 'rack', 'shelf', 'bin'], segment_kind);
+      IF segment_rank <= last_rank THEN
+        kinds := NULL;
+        EXIT;
+      END IF;
+      last_rank := segment_rank;
+      kinds := kinds || segment_kind;
+      names := names || BTRIM(parsed[2]);
+    END LOOP;
+
+    IF kinds IS NULL THEN
+      kinds := ARRAY['zone'];
+      names := ARRAY[item.raw];
+    END IF;
+
+    parent := NULL;
+    FOR i IN 1 .. ARRAY_LENGTH(kinds, 1) LOOP
+      SELECT location_id INTO location
+      FROM warehouse_locations
+      WHERE warehouse_id = item.storage_id
+        AND parent_id IS NOT DISTINCT FROM parent
+        AND kind = kinds[i]
+        AND LOWER(location_name) = LOWER(names[i]);
+      IF location IS NULL THEN
+        INSERT INTO warehouse_locations (warehouse_id, parent_id, kind, location_name)
+        VALUES (item.storage_id, parent, kinds[i], names[i])
+        RETURNING location_id INTO location;
+      END IF;
+      parent := location;
+      location := NULL;
+    END LOOP;
+
+    UPDATE equipment
+    SET location_id = parent
+    WHERE storage_id = item.storage_id AND BTRIM(current_storage) = item.raw;
+  END LOOP;
+END $$;
+
+ALTER TABLE equipment DROP COLUMN IF EXISTS current_storage;
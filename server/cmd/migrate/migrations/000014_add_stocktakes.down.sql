@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS stocktake_scans;
+DROP TABLE IF EXISTS stocktakes;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS stocktakes (
+  stocktake_id BIGSERIAL PRIMARY KEY,
+  warehouse_id BIGINT REFERENCES warehouses(warehouse_id) ON DELETE SET NULL,
+  status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'closed', 'applied')),
+  started_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+  started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  closed_at TIMESTAMPTZ,
+  applied_at TIMESTAMPTZ,
+  version INTEGER NOT NULL DEFAULT 1
+);
+
+-- A warehouse is counted by one session at a time.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stocktakes_open ON stocktakes(warehouse_id) WHERE status = 'open';
+
+-- A scan names either a known item or, for a serial number that matched
+-- nothing, keeps the scanned code for the report.
+CREATE TABLE IF NOT EXISTS stocktake_scans (
+  scan_id BIGSERIAL PRIMARY KEY,
+  stocktake_id BIGINT NOT NULL REFERENCES stocktakes(stocktake_id) ON DELETE CASCADE,
+  equipment_id BIGINT REFERENCES equipment(equipment_id) ON DELETE CASCADE,
+  code TEXT,
+  scanned_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+  scanned_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CHECK (equipment_id IS NOT NULL OR code IS NOT NULL)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stocktake_scans_equipment
+  ON stocktake_scans(stocktake_id, equipment_id) WHERE equipment_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stocktake_scans_code
+  ON stocktake_scans(stocktake_id, LOWER(code)) WHERE equipment_id IS NULL;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS stock_in_draft;
+DROP TABLE IF EXISTS stock_in_project;
+DROP TABLE IF EXISTS stock_levels;
+DROP TABLE IF EXISTS stock_items;
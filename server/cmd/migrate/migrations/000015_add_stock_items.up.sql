@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS stock_items (
+  stock_item_id BIGSERIAL PRIMARY KEY,
+  stock_item_name TEXT NOT NULL,
+  unit TEXT NOT NULL DEFAULT 'pcs',
+  description TEXT,
+  version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stock_items_name ON stock_items(LOWER(stock_item_name));
+
+-- On-hand count of a stock item in a warehouse.
+CREATE TABLE IF NOT EXISTS stock_levels (
+  stock_item_id BIGINT NOT NULL REFERENCES stock_items(stock_item_id) ON DELETE CASCADE,
+  warehouse_id BIGINT NOT NULL REFERENCES warehouses(warehouse_id) ON DELETE CASCADE,
+  quantity INTEGER NOT NULL CHECK (quantity >= 0),
+  PRIMARY KEY (stock_item_id, warehouse_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_levels_warehouse ON stock_levels(warehouse_id);
+
+-- A reservation holds stock for the project's shooting dates until the
+-- project's stock is returned; consumed is what did not come back.
+CREATE TABLE IF NOT EXISTS stock_in_project (
+  project_id BIGINT NOT NULL REFERENCES projects(project_id) ON DELETE CASCADE,
+  stock_item_id BIGINT NOT NULL REFERENCES stock_items(stock_item_id) ON DELETE CASCADE,
+  quantity INTEGER NOT NULL CHECK (quantity > 0),
+  consumed INTEGER NOT NULL DEFAULT 0 CHECK (consumed >= 0 AND consumed <= quantity),
+  returned_at TIMESTAMPTZ,
+  PRIMARY KEY (project_id, stock_item_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_in_project_item ON stock_in_project(stock_item_id) WHERE returned_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS stock_in_draft (
+  draft_id BIGINT NOT NULL REFERENCES drafts(draft_id) ON DELETE CASCADE,
+  stock_item_id BIGINT NOT NULL REFERENCES stock_items(stock_item_id) ON DELETE CASCADE,
+  quantity INTEGER NOT NULL CHECK (quantity > 0),
+  PRIMARY KEY (draft_id, stock_item_id)
+);
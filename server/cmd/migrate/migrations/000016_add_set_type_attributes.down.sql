@@ -0,0 +1,2 @@
+ALTER TABLE equipment DROP COLUMN IF EXISTS attributes;
+ALTER TABLE set_types DROP COLUMN IF EXISTS attributes;
@@ -0,0 +1,7 @@
+-- Attribute schema of a set type: a JSON array of
+-- {"key", "label", "type", "options", "required"} definitions, where type is
+-- string, number, enum or boolean.
+ALTER TABLE set_types ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '[]';
+
+-- Attribute values of an item as a JSON object keyed by attribute key.
+ALTER TABLE equipment ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
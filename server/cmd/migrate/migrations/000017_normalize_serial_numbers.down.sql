@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_equipment_serial_key;
+ALTER TABLE equipment DROP COLUMN IF EXISTS serial_exempt;
+ALTER TABLE equipment DROP COLUMN IF EXISTS serial_key;
@@ -0,0 +1,24 @@
+-- Serial number with whitespace removed and lowercased, so "SN 001" and
+-- "sn001" count as the same serial.
+ALTER TABLE equipment ADD COLUMN IF NOT EXISTS serial_key TEXT
+    GENERATED ALWAYS AS (LOWER(REGEXP_REPLACE(serial_number, '\s', '', 'g'))) STORED;
+
+-- Set on items that already collided with an older item of the same set when
+-- uniqueness came in. They stay out of the unique index until they are merged
+-- or their serial number changes; GET /equipment/duplicates lists them.
+ALTER TABLE equipment ADD COLUMN IF NOT EXISTS serial_exempt BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE equipment e
+SET serial_exempt = TRUE
+WHERE e.deleted_at IS NULL
+  AND EXISTS (
+    SELECT 1 FROM equipment o
+    WHERE o.deleted_at IS NULL
+      AND o.equipment_set_id = e.equipment_set_id
+      AND o.serial_key = e.serial_key
+      AND o.equipment_id < e.equipment_id
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_equipment_serial_key
+    ON equipment (equipment_set_id, serial_key)
+    WHERE deleted_at IS NULL AND NOT serial_exempt;
@@ -0,0 +1,4 @@
+ALTER TABLE set_types DROP CONSTRAINT IF EXISTS set_types_useful_life_required;
+ALTER TABLE set_types DROP COLUMN IF EXISTS salvage_percent;
+ALTER TABLE set_types DROP COLUMN IF EXISTS useful_life_months;
+ALTER TABLE set_types DROP COLUMN IF EXISTS depreciation_method;
@@ -0,0 +1,11 @@
+-- How equipment of a set type loses value: not at all, straight-line or
+-- declining balance over useful_life_months, down to salvage_percent of the
+-- purchase cost.
+ALTER TABLE set_types ADD COLUMN IF NOT EXISTS depreciation_method TEXT NOT NULL DEFAULT 'none'
+    CHECK (depreciation_method IN ('none', 'straight_line', 'declining_balance'));
+ALTER TABLE set_types ADD COLUMN IF NOT EXISTS useful_life_months INTEGER
+    CHECK (useful_life_months > 0);
+ALTER TABLE set_types ADD COLUMN IF NOT EXISTS salvage_percent NUMERIC(5, 2) NOT NULL DEFAULT 0
+    CHECK (salvage_percent BETWEEN 0 AND 100);
+ALTER TABLE set_types ADD CONSTRAINT set_types_useful_life_required
+    CHECK (depreciation_method = 'none' OR useful_life_months IS NOT NULL);
@@ -0,0 +1,39 @@
+-- The reconciliation of a stocktake, saved when it closes so its report
+-- keeps showing what was counted after equipment moves on. moved marks the
+-- unexpected items that applying the stocktake brought into the warehouse.
+CREATE TABLE IF NOT EXISTS stocktake_results (
+  stocktake_id BIGINT NOT NULL REFERENCES stocktakes(stocktake_id) ON DELETE CASCADE,
+  equipment_id BIGINT NOT NULL REFERENCES equipment(equipment_id) ON DELETE CASCADE,
+  outcome TEXT NOT NULL CHECK (outcome IN ('found', 'missing', 'unexpected')),
+  moved BOOLEAN NOT NULL DEFAULT FALSE,
+  PRIMARY KEY (stocktake_id, equipment_id)
+);
+
+-- Stocktakes closed before now are reconciled against current storage, the
+-- same way their report was computed until now. Items an applied stocktake
+-- moved were unexpected when it closed.
+INSERT INTO stocktake_results (stocktake_id, equipment_id, outcome, moved)
+SELECT
+  st.stocktake_id,
+  e.equipment_id,
+  CASE WHEN m.equipment_id IS NULL AND e.storage_id = st.warehouse_id THEN 'found' ELSE 'unexpected' END,
+  m.equipment_id IS NOT NULL
+FROM stocktakes st
+JOIN stocktake_scans sc ON sc.stocktake_id = st.stocktake_id
+JOIN equipment e ON e.equipment_id = sc.equipment_id AND e.deleted_at IS NULL
+LEFT JOIN (
+  SELECT DISTINCT equipment_id, reason FROM equipment_movements WHERE reason LIKE 'stocktake %'
+) m ON m.equipment_id = e.equipment_id AND m.reason = 'stocktake ' || st.stocktake_id
+WHERE st.status IN ('closed', 'applied')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO stocktake_results (stocktake_id, equipment_id, outcome)
+SELECT st.stocktake_id, e.equipment_id, 'missing'
+FROM stocktakes st
+JOIN equipment e ON e.storage_id = st.warehouse_id AND e.deleted_at IS NULL
+WHERE st.status IN ('closed', 'applied')
+  AND NOT EXISTS (
+    SELECT 1 FROM stocktake_scans sc
+    WHERE sc.stocktake_id = st.stocktake_id AND sc.equipment_id = e.equipment_id
+  )
+ON CONFLICT DO NOTHING;
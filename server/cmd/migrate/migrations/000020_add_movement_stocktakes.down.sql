@@ -0,0 +1,5 @@
+UPDATE equipment_movements
+SET reason = 'stocktake ' || stocktake_id
+WHERE stocktake_id IS NOT NULL;
+
+ALTER TABLE equipment_movements DROP COLUMN IF EXISTS stocktake_id;
@@ -0,0 +1,9 @@
+-- Moves made by applying a stocktake point at it, the way transfer moves
+-- point at their transfer, instead of naming it in the free-text reason.
+ALTER TABLE equipment_movements
+  ADD COLUMN IF NOT EXISTS stocktake_id BIGINT REFERENCES stocktakes(stocktake_id) ON DELETE SET NULL;
+
+UPDATE equipment_movements m
+SET stocktake_id = st.stocktake_id, reason = NULL
+FROM stocktakes st
+WHERE m.reason = 'stocktake ' || st.stocktake_id;
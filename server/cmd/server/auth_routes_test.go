@@ -33,6 +33,10 @@ func TestProtectedEndpointsRequireAuthorization(t *testing.T) {
 		{name: "list drafts", method: http.MethodGet, path: "/api/v1/drafts"},
 		{name: "equipment in project", method: http.MethodGet, path: "/api/v1/equipment_in_project/1"},
 		{name: "equipment in draft", method: http.MethodGet, path: "/api/v1/equipment_in_draft/1"},
+		{name: "list webhooks", method: http.MethodGet, path: "/api/v1/webhooks"},
+		{name: "neaktor sync", method: http.MethodPost, path: "/api/v1/neaktor/sync"},
+		{name: "inbound reviews", method: http.MethodGet, path: "/api/v1/inbound/reviews"},
+		{name: "event stream", method: http.MethodGet, path: "/api/v1/events"},
 	}
 
 	for _, tc := range protectedCases {
@@ -50,7 +54,7 @@ func TestProtectedEndpointsRequireAuthorization(t *testing.T) {
 	}
 }
 
-func TestLoginAndRegisterArePublic(t *testing.T) {
+func TestPublicEndpointsSkipAuthorization(t *testing.T) {
 	srv := NewServer(":0", nil)
 	handler := srv.router()
 
@@ -60,6 +64,7 @@ func TestLoginAndRegisterArePublic(t *testing.T) {
 	}{
 		{name: "login", path: "/api/v1/login"},
 		{name: "register", path: "/api/v1/register"},
+		{name: "neaktor webhook", path: "/api/v1/neaktor/webhook"},
 	}
 
 	for _, tc := range cases {
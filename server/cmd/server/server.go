@@ -1,52 +1,143 @@
 package server
 
 import (
+	"VyacheslavKuchumov/test-backend/config"
+	"VyacheslavKuchumov/test-backend/db"
 	"VyacheslavKuchumov/test-backend/service/auth"
+	"VyacheslavKuchumov/test-backend/service/crmhttp"
 	"VyacheslavKuchumov/test-backend/service/draft"
 	"VyacheslavKuchumov/test-backend/service/equipment"
 	"VyacheslavKuchumov/test-backend/service/equipmentindraft"
 	"VyacheslavKuchumov/test-backend/service/equipmentinproject"
 	"VyacheslavKuchumov/test-backend/service/equipmentset"
+	"VyacheslavKuchumov/test-backend/service/events"
+	"VyacheslavKuchumov/test-backend/service/health"
+	"VyacheslavKuchumov/test-backend/service/idempotency"
+	"VyacheslavKuchumov/test-backend/service/inbound"
+	"VyacheslavKuchumov/test-backend/service/logging"
+	"VyacheslavKuchumov/test-backend/service/metrics"
+	"VyacheslavKuchumov/test-backend/service/neaktor"
 	"VyacheslavKuchumov/test-backend/service/project"
 	"VyacheslavKuchumov/test-backend/service/projecttype"
 	"VyacheslavKuchumov/test-backend/service/settype"
+	"VyacheslavKuchumov/test-backend/service/stock"
+	"VyacheslavKuchumov/test-backend/service/stocktake"
+	"VyacheslavKuchumov/test-backend/service/stream"
+	"VyacheslavKuchumov/test-backend/service/tracing"
 	"VyacheslavKuchumov/test-backend/service/tracker"
+	"VyacheslavKuchumov/test-backend/service/transfer"
+	"VyacheslavKuchumov/test-backend/service/trash"
 	"VyacheslavKuchumov/test-backend/service/user"
+	"VyacheslavKuchumov/test-backend/service/valuation"
 	"VyacheslavKuchumov/test-backend/service/warehouse"
+	"VyacheslavKuchumov/test-backend/service/webhook"
+	"context"
 	"database/sql"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 )
 
 type Server struct {
-	addr string
-	db   *sql.DB
+	addr   string
+	db     *sql.DB
+	events *events.Bus
+	// workers are background loops registered while wiring the router and
+	// started by Run.
+	workers []func(ctx context.Context)
+	// onShutdown hooks run when graceful shutdown starts, before in-flight
+	// requests are awaited.
+	onShutdown []func()
 }
 
 func NewServer(addr string, db *sql.DB) *Server {
 	return &Server{
-		addr: addr,
-		db:   db,
+		addr:   addr,
+		db:     db,
+		events: events.NewBus(),
 	}
 }
 
+// Run serves HTTP until SIGINT or SIGTERM, then stops accepting connections,
+// waits up to the shutdown timeout for in-flight requests and stops the
+// background workers.
 func (s *Server) Run() error {
-	log.Println("Listening on", s.addr)
-	return http.ListenAndServe(s.addr, s.router())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	httpServer := &http.Server{
+		Addr:              s.addr,
+		Handler:           s.router(),
+		ReadHeaderTimeout: seconds(config.Envs.HTTPReadTimeoutSeconds),
+		ReadTimeout:       seconds(config.Envs.HTTPReadTimeoutSeconds),
+		WriteTimeout:      seconds(config.Envs.HTTPWriteTimeoutSeconds),
+		IdleTimeout:       seconds(config.Envs.HTTPIdleTimeoutSeconds),
+	}
+	for _, hook := range s.onShutdown {
+		httpServer.RegisterOnShutdown(hook)
+	}
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	for _, worker := range s.workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			worker(workerCtx)
+		}()
+	}
+	defer func() {
+		stopWorkers()
+		workers.Wait()
+	}()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "addr", s.addr)
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down", "timeout", seconds(config.Envs.HTTPShutdownTimeoutSeconds).String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), seconds(config.Envs.HTTPShutdownTimeoutSeconds))
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("graceful shutdown failed: %w", err)
+	}
+	return nil
+}
+
+func seconds(value int64) time.Duration {
+	return time.Duration(value) * time.Second
 }
 
 func (s *Server) router() http.Handler {
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	registry := metrics.NewRegistry(s.db)
+	httpMetrics := metrics.NewHTTPMetrics(registry)
+	r.Use(tracing.Middleware)
+	r.Use(logging.Middleware)
+	r.Use(httpMetrics.Middleware)
 
 	userStore := user.NewStore(s.db)
 	userHandler := user.NewHandler(userStore)
 
 	trackerStore := tracker.NewStore(s.db)
+	trackerStore.SetPublisher(s.events)
+	registry.MustRegister(metrics.NewDomainCollector(trackerStore))
 	setTypeService := settype.NewService(trackerStore)
 	projectTypeService := projecttype.NewService(trackerStore)
 	warehouseService := warehouse.NewService(trackerStore)
@@ -56,28 +147,106 @@ func (s *Server) router() http.Handler {
 	draftService := draft.NewService(trackerStore)
 	equipmentInProjectService := equipmentinproject.NewService(trackerStore)
 	equipmentInDraftService := equipmentindraft.NewService(trackerStore)
+	transferService := transfer.NewService(trackerStore)
+	stocktakeService := stocktake.NewService(trackerStore)
+	stockService := stock.NewService(trackerStore)
+	valuationService := valuation.NewService(trackerStore)
+	trashService := trash.NewService(trackerStore)
+	if config.Envs.TrashRetentionDays > 0 {
+		retention := time.Duration(config.Envs.TrashRetentionDays) * 24 * time.Hour
+		s.workers = append(s.workers, func(ctx context.Context) {
+			trashService.RunPurge(ctx, retention, time.Hour)
+		})
+	}
+	webhookStore := webhook.NewStore(s.db)
+	webhookEnqueuer := webhook.NewEnqueuer(webhookStore)
+	s.events.Subscribe(webhookEnqueuer.HandleEvent)
+	webhookService := webhook.NewService(webhookStore, config.Envs.WebhookAllowPrivateTargets)
+	webhookDispatcher := webhook.NewDispatcher(webhookStore, webhook.DispatcherConfig{
+		PollInterval:        time.Duration(config.Envs.WebhookPollIntervalSeconds) * time.Second,
+		Timeout:             time.Duration(config.Envs.WebhookTimeoutSeconds) * time.Second,
+		MaxAttempts:         int(config.Envs.WebhookMaxAttempts),
+		AllowPrivateTargets: config.Envs.WebhookAllowPrivateTargets,
+	})
+	s.workers = append(s.workers, webhookEnqueuer.Run, webhookDispatcher.Run)
+	neaktorSyncer := newNeaktorSyncer(trackerStore)
+	inboundStore := inbound.NewStore(s.db)
+	inboundService := inbound.NewService(inboundStore)
+	if neaktorSyncer != nil {
+		inboundService.RegisterImporter(neaktor.Source, neaktorSyncer)
+	}
+	neaktorService := neaktor.NewService(neaktorSyncer, inboundStore, config.Envs.NeaktorWebhookSecret)
+	if neaktorSyncer != nil && config.Envs.NeaktorSyncIntervalMinutes > 0 {
+		interval := time.Duration(config.Envs.NeaktorSyncIntervalMinutes) * time.Minute
+		s.workers = append(s.workers, func(ctx context.Context) {
+			neaktorSyncer.RunScheduler(ctx, interval)
+		})
+	}
+	idempotencyKeys := idempotency.NewMiddleware(idempotency.NewStore(s.db), time.Duration(config.Envs.IdempotencyTTLHours)*time.Hour)
+	s.workers = append(s.workers, func(ctx context.Context) {
+		idempotencyKeys.RunCleanup(ctx, time.Hour)
+	})
+	streamService := stream.NewService(s.events)
+	healthService := health.NewService(s.db, func(ctx context.Context) (int, bool, error) {
+		return db.SchemaVersion(ctx, s.db)
+	}, db.RequiredSchemaVersion)
+	s.onShutdown = append(s.onShutdown, healthService.Drain, streamService.Shutdown)
 	authMiddleware := auth.JWTAuthMiddleware(userStore)
 	apiAuthMiddleware := auth.JWTAuthMiddlewareWithExclusions(
 		userStore,
 		"/api/v1/login",
 		"/api/v1/register",
+		"/api/v1/neaktor/webhook",
 	)
 
 	r.With(authMiddleware).Handle("/swagger/*", httpSwagger.Handler())
+	r.Handle("/metrics", metrics.Handler(registry, config.Envs.MetricsToken))
+	health.RegisterRoutes(r, healthService)
 
 	r.Route("/api/v1", func(api chi.Router) {
 		api.Use(apiAuthMiddleware)
-		user.RegisterRoutes(api, userHandler)
-		settype.RegisterRoutes(api, setTypeService)
-		projecttype.RegisterRoutes(api, projectTypeService)
-		warehouse.RegisterRoutes(api, warehouseService)
-		equipmentset.RegisterRoutes(api, equipmentSetService)
-		equipment.RegisterRoutes(api, equipmentService)
-		project.RegisterRoutes(api, projectService)
-		draft.RegisterRoutes(api, draftService)
-		equipmentinproject.RegisterRoutes(api, equipmentInProjectService)
-		equipmentindraft.RegisterRoutes(api, equipmentInDraftService)
+		api.Group(func(api chi.Router) {
+			api.Use(crmhttp.QueryTimeout(time.Duration(config.Envs.DBQueryTimeoutSeconds) * time.Second))
+			api.Use(crmhttp.ConditionalGet)
+			api.Use(idempotencyKeys.Handler)
+			user.RegisterRoutes(api, userHandler)
+			settype.RegisterRoutes(api, setTypeService)
+			projecttype.RegisterRoutes(api, projectTypeService)
+			warehouse.RegisterRoutes(api, warehouseService)
+			equipmentset.RegisterRoutes(api, equipmentSetService)
+			equipment.RegisterRoutes(api, equipmentService)
+			project.RegisterRoutes(api, projectService)
+			draft.RegisterRoutes(api, draftService)
+			equipmentinproject.RegisterRoutes(api, equipmentInProjectService)
+			equipmentindraft.RegisterRoutes(api, equipmentInDraftService)
+			transfer.RegisterRoutes(api, transferService)
+			stocktake.RegisterRoutes(api, stocktakeService)
+			stock.RegisterRoutes(api, stockService)
+			valuation.RegisterRoutes(api, valuationService)
+			trash.RegisterRoutes(api, trashService)
+			webhook.RegisterRoutes(api, webhookService)
+			inbound.RegisterRoutes(api, inboundService)
+		})
+		// A manual Neaktor sync walks every task and the event stream stays
+		// open, so neither runs under the query timeout.
+		neaktor.RegisterRoutes(api, neaktorService)
+		stream.RegisterRoutes(api, streamService)
 	})
 
 	return r
 }
+
+// newNeaktorSyncer returns nil when NEAKTOR_BASE_URL is not set, which
+// disables the integration.
+func newNeaktorSyncer(store *tracker.Store) *neaktor.Syncer {
+	if config.Envs.NeaktorBaseURL == "" {
+		return nil
+	}
+	client := neaktor.NewClient(config.Envs.NeaktorBaseURL, config.Envs.NeaktorAPIToken)
+	return neaktor.NewSyncer(client, store, neaktor.Mapping{
+		StartDateField:     config.Envs.NeaktorStartDateField,
+		EndDateField:       config.Envs.NeaktorEndDateField,
+		ChiefEngineerField: config.Envs.NeaktorChiefEngineerField,
+		ArchivedStatuses:   neaktor.ParseStatuses(config.Envs.NeaktorArchivedStatuses),
+	})
+}
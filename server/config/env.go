@@ -23,6 +23,50 @@ type Config struct {
 	DBSSLMode              string
 	JWTExpirationInSeconds int64
 	JWTSecret              string
+	// Startup connection retries; the delay doubles after each attempt
+	DBConnectAttempts       int64
+	DBConnectBackoffSeconds int64
+	// Connection pool limits; zero leaves the database/sql default
+	DBMaxOpenConns           int64
+	DBMaxIdleConns           int64
+	DBConnMaxLifetimeSeconds int64
+	DBConnMaxIdleTimeSeconds int64
+	// Deadline for the queries of one API request; zero disables it
+	DBQueryTimeoutSeconds int64
+	// HTTP server timeouts and the grace period for in-flight requests on
+	// shutdown
+	HTTPReadTimeoutSeconds     int64
+	HTTPWriteTimeoutSeconds    int64
+	HTTPIdleTimeoutSeconds     int64
+	HTTPShutdownTimeoutSeconds int64
+	// Webhook delivery settings
+	WebhookPollIntervalSeconds int64
+	WebhookTimeoutSeconds      int64
+	WebhookMaxAttempts         int64
+	WebhookAllowPrivateTargets bool
+	// How long Idempotency-Key responses are kept for replay
+	IdempotencyTTLHours int64
+	// Days deleted equipment, projects and drafts stay restorable; 0 keeps
+	// them forever
+	TrashRetentionDays int64
+	// Neaktor task tracker integration
+	NeaktorBaseURL             string
+	NeaktorAPIToken            string
+	NeaktorSyncIntervalMinutes int64
+	NeaktorStartDateField      string
+	NeaktorEndDateField        string
+	NeaktorChiefEngineerField  string
+	NeaktorArchivedStatuses    string
+	NeaktorWebhookSecret       string
+	// Bearer token required on /metrics; empty leaves it open
+	MetricsToken string
+	// debug, info, warn or error
+	LogLevel string
+	// OpenTelemetry tracing: exporter is none, stdout or otlp
+	TracingExporter      string
+	TracingOTLPEndpoint  string
+	TracingOTLPInsecure  bool
+	TracingSamplePercent int64
 }
 
 func initConfig() Config {
@@ -30,16 +74,47 @@ func initConfig() Config {
 	loadEnvFromProjectRoot()
 
 	return Config{
-		PublicHost:             getEnv("PUBLIC_HOST", "http://localhost"),
-		Port:                   getEnv("PORT", ":8000"),
-		DBUser:                 getEnv("DB_USER", "postgres"),
-		DBPassword:             getEnv("DB_PASSWORD", "postgres"),
-		DBHost:                 getEnv("DB_HOST", "127.0.0.1"),
-		DBPort:                 getEnv("DB_PORT", "5433"),
-		DBName:                 getEnv("DB_NAME", "ultralive_crm"),
-		DBSSLMode:              getEnv("DB_SSLMODE", "disable"),
-		JWTExpirationInSeconds: getEnvAsInt("JWT_EXP", 3600*24*7),
-		JWTSecret:              getEnv("JWT_SECRET", "CHANGE_ME"),
+		PublicHost:                 getEnv("PUBLIC_HOST", "http://localhost"),
+		Port:                       getEnv("PORT", ":8000"),
+		DBUser:                     getEnv("DB_USER", "postgres"),
+		DBPassword:                 getEnv("DB_PASSWORD", "postgres"),
+		DBHost:                     getEnv("DB_HOST", "127.0.0.1"),
+		DBPort:                     getEnv("DB_PORT", "5433"),
+		DBName:                     getEnv("DB_NAME", "ultralive_crm"),
+		DBSSLMode:                  getEnv("DB_SSLMODE", "disable"),
+		JWTExpirationInSeconds:     getEnvAsInt("JWT_EXP", 3600*24*7),
+		JWTSecret:                  getEnv("JWT_SECRET", "CHANGE_ME"),
+		DBConnectAttempts:          getEnvAsInt("DB_CONNECT_ATTEMPTS", 10),
+		DBConnectBackoffSeconds:    getEnvAsInt("DB_CONNECT_BACKOFF", 1),
+		DBMaxOpenConns:             getEnvAsInt("DB_MAX_OPEN_CONNS", 25),
+		DBMaxIdleConns:             getEnvAsInt("DB_MAX_IDLE_CONNS", 10),
+		DBConnMaxLifetimeSeconds:   getEnvAsInt("DB_CONN_MAX_LIFETIME", 1800),
+		DBConnMaxIdleTimeSeconds:   getEnvAsInt("DB_CONN_MAX_IDLE_TIME", 300),
+		DBQueryTimeoutSeconds:      getEnvAsInt("DB_QUERY_TIMEOUT", 15),
+		HTTPReadTimeoutSeconds:     getEnvAsInt("HTTP_READ_TIMEOUT", 15),
+		HTTPWriteTimeoutSeconds:    getEnvAsInt("HTTP_WRITE_TIMEOUT", 30),
+		HTTPIdleTimeoutSeconds:     getEnvAsInt("HTTP_IDLE_TIMEOUT", 60),
+		HTTPShutdownTimeoutSeconds: getEnvAsInt("HTTP_SHUTDOWN_TIMEOUT", 20),
+		WebhookPollIntervalSeconds: getEnvAsInt("WEBHOOK_POLL_INTERVAL", 5),
+		WebhookTimeoutSeconds:      getEnvAsInt("WEBHOOK_TIMEOUT", 10),
+		WebhookMaxAttempts:         getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookAllowPrivateTargets: getEnvAsBool("WEBHOOK_ALLOW_PRIVATE_TARGETS", false),
+		IdempotencyTTLHours:        getEnvAsInt("IDEMPOTENCY_TTL_HOURS", 24),
+		TrashRetentionDays:         getEnvAsInt("TRASH_RETENTION_DAYS", 30),
+		NeaktorBaseURL:             getEnv("NEAKTOR_BASE_URL", ""),
+		NeaktorAPIToken:            getEnv("NEAKTOR_API_TOKEN", ""),
+		NeaktorSyncIntervalMinutes: getEnvAsInt("NEAKTOR_SYNC_INTERVAL", 15),
+		NeaktorStartDateField:      getEnv("NEAKTOR_START_DATE_FIELD", ""),
+		NeaktorEndDateField:        getEnv("NEAKTOR_END_DATE_FIELD", ""),
+		NeaktorChiefEngineerField:  getEnv("NEAKTOR_CHIEF_ENGINEER_FIELD", ""),
+		NeaktorArchivedStatuses:    getEnv("NEAKTOR_ARCHIVED_STATUSES", ""),
+		NeaktorWebhookSecret:       getEnv("NEAKTOR_WEBHOOK_SECRET", ""),
+		MetricsToken:               getEnv("METRICS_TOKEN", ""),
+		LogLevel:                   getEnv("LOG_LEVEL", "info"),
+		TracingExporter:            getEnv("TRACING_EXPORTER", "none"),
+		TracingOTLPEndpoint:        getEnv("TRACING_OTLP_ENDPOINT", "localhost:4318"),
+		TracingOTLPInsecure:        getEnvAsBool("TRACING_OTLP_INSECURE", true),
+		TracingSamplePercent:       getEnvAsInt("TRACING_SAMPLE_PERCENT", 100),
 	}
 }
 
@@ -134,3 +209,18 @@ func getEnvAsInt(key string, fallback int64) int64 {
 
 	return fallback
 }
+
+func getEnvAsBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+
+	if ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fallback
+		}
+
+		return b
+	}
+
+	return fallback
+}
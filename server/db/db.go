@@ -2,13 +2,18 @@ package db
 
 import (
 	"VyacheslavKuchumov/test-backend/config"
+	"context"
 	"database/sql"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/url"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
+const maxConnectBackoff = 30 * time.Second
+
 func NewPostgresStorage(cfg config.Config) (*sql.DB, error) {
 	dsn := (&url.URL{
 		Scheme: "postgres",
@@ -19,12 +24,47 @@ func NewPostgresStorage(cfg config.Config) (*sql.DB, error) {
 
 	db, err := sql.Open("pgx", dsn)
 	if err != nil {
-		log.Fatal("Failed to open PostgreSQL connection:", err)
+		return nil, fmt.Errorf("failed to open PostgreSQL connection: %w", err)
 	}
+	db.SetMaxOpenConns(int(cfg.DBMaxOpenConns))
+	db.SetMaxIdleConns(int(cfg.DBMaxIdleConns))
+	db.SetConnMaxLifetime(time.Duration(cfg.DBConnMaxLifetimeSeconds) * time.Second)
+	db.SetConnMaxIdleTime(time.Duration(cfg.DBConnMaxIdleTimeSeconds) * time.Second)
 
-	if err := db.Ping(); err != nil {
+	backoff := time.Duration(cfg.DBConnectBackoffSeconds) * time.Second
+	if err := pingWithRetry(db, int(cfg.DBConnectAttempts), backoff); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
+
+// pingWithRetry waits for the database to accept connections, doubling the
+// delay between attempts up to maxConnectBackoff. It lets the API start
+// while PostgreSQL is still booting or briefly unreachable.
+func pingWithRetry(db *sql.DB, attempts int, backoff time.Duration) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = ping(db, backoff); err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
+		slog.Warn("PostgreSQL is not reachable, retrying", "attempt", attempt, "attempts", attempts, "retry_in", backoff.String(), "error", err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxConnectBackoff)
+	}
+	return fmt.Errorf("PostgreSQL is not reachable after %d attempts: %w", attempts, err)
+}
+
+func ping(db *sql.DB, backoff time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), max(backoff, 5*time.Second))
+	defer cancel()
+	return db.PingContext(ctx)
+}
@@ -0,0 +1,22 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// RequiredSchemaVersion is the newest migration in cmd/migrate/migrations.
+// Bump it together with every new migration so /readyz reports instances
+// running against an outdated schema.
+const RequiredSchemaVersion = 20
+
+// SchemaVersion reads the version golang-migrate recorded. A database that
+// was never migrated reports version 0.
+func SchemaVersion(ctx context.Context, db *sql.DB) (version int, dirty bool, err error) {
+	err = db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
@@ -2,11 +2,12 @@ package auth
 
 import (
 	"VyacheslavKuchumov/test-backend/config"
+	"VyacheslavKuchumov/test-backend/service/logging"
 	"VyacheslavKuchumov/test-backend/types"
 	"VyacheslavKuchumov/test-backend/utils"
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
@@ -54,12 +55,13 @@ func JWTAuthMiddleware(store types.UserStore) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			userID, err := getUserIDFromRequest(r, store)
 			if err != nil {
-				log.Printf("Failed to authorize request: %v", err)
-				permissionDenied(w)
+				slog.WarnContext(r.Context(), "failed to authorize request", "path", r.URL.Path, "error", err)
+				permissionDenied(w, r)
 				return
 			}
 
 			ctx := r.Context()
+			logging.SetUserID(ctx, userID)
 			ctx = context.WithValue(ctx, UserKey, userID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -99,20 +101,20 @@ func getUserIDFromRequest(r *http.Request, store types.UserStore) (int, error) {
 	}
 
 	if !token.Valid {
-		return 0, fmt.Errorf("invalid token")
+		return 0, utils.Errorf("invalid token")
 	}
 
 	claims := token.Claims.(jwt.MapClaims)
 	str, ok := claims["userID"].(string)
 	if !ok {
-		return 0, fmt.Errorf("missing userID claim")
+		return 0, utils.Errorf("missing userID claim")
 	}
 	userID, err := strconv.Atoi(str)
 	if err != nil {
 		return 0, err
 	}
 
-	u, err := store.GetUserByID(userID)
+	u, err := store.GetUserByID(r.Context(), userID)
 	if err != nil {
 		return 0, err
 	}
@@ -141,15 +143,15 @@ func getTokenFromRequest(r *http.Request) string {
 func validateToken(t string) (*jwt.Token, error) {
 	return jwt.Parse(t, func(t *jwt.Token) (any, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", t.Header["alg"])
+			return nil, utils.Errorf("unexpected signing method: %v", t.Header["alg"])
 		}
 
 		return []byte(config.Envs.JWTSecret), nil
 	})
 }
 
-func permissionDenied(w http.ResponseWriter) {
-	utils.WriteError(w, http.StatusForbidden, fmt.Errorf("Permission denied"))
+func permissionDenied(w http.ResponseWriter, r *http.Request) {
+	utils.WriteError(w, r, http.StatusForbidden, fmt.Errorf("Permission denied"))
 }
 
 func GetUserIDFromContext(ctx context.Context) int {
@@ -0,0 +1,663 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const FormatVersion = 5
+
+// minFormatVersion is the oldest archive format that can be restored. Newer
+// formats only add tables, which older archives restore as empty.
+const minFormatVersion = 2
+
+const manifestFile = "manifest.json"
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported backup format version")
+	ErrChecksumMismatch   = errors.New("backup checksum mismatch")
+	ErrIntegrity          = errors.New("backup integrity check failed")
+)
+
+type Manifest struct {
+	FormatVersion          int               `json:"format_version"`
+	CreatedAt              time.Time         `json:"created_at"`
+	IncludesPasswordHashes bool              `json:"includes_password_hashes"`
+	Counts                 map[string]int    `json:"counts"`
+	Checksums              map[string]string `json:"checksums"`
+}
+
+type User struct {
+	ID           int       `json:"id"`
+	FirstName    string    `json:"first_name"`
+	LastName     string    `json:"last_name"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"password_hash,omitempty"`
+	Role         string    `json:"role"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type SetType struct {
+	ID                 int             `json:"id"`
+	Name               string          `json:"name"`
+	Attributes         json.RawMessage `json:"attributes,omitempty"`
+	DepreciationMethod string          `json:"depreciation_method,omitempty"`
+	UsefulLifeMonths   *int            `json:"useful_life_months,omitempty"`
+	SalvagePercent     *string         `json:"salvage_percent,omitempty"`
+}
+
+type ProjectType struct {
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	NeaktorID *string `json:"neaktor_id,omitempty"`
+}
+
+type Warehouse struct {
+	ID     int     `json:"id"`
+	Name   string  `json:"name"`
+	Adress *string `json:"adress,omitempty"`
+}
+
+type Location struct {
+	ID          int    `json:"id"`
+	WarehouseID int    `json:"warehouse_id"`
+	ParentID    *int   `json:"parent_id,omitempty"`
+	Kind        string `json:"kind"`
+	Name        string `json:"name"`
+}
+
+type EquipmentSet struct {
+	ID          int     `json:"id"`
+	Name        string  `json:"name"`
+	Description *string `json:"description,omitempty"`
+	SetTypeID   int     `json:"set_type_id"`
+}
+
+type Equipment struct {
+	ID               int             `json:"id"`
+	EquipmentSetID   int             `json:"equipment_set_id"`
+	Name             string          `json:"name"`
+	Description      *string         `json:"description,omitempty"`
+	SerialNumber     string          `json:"serial_number"`
+	StorageID        int             `json:"storage_id"`
+	LocationID       *int            `json:"location_id,omitempty"`
+	NeedsMaintenance bool            `json:"needs_maintenance"`
+	DateOfPurchase   *string         `json:"date_of_purchase,omitempty"`
+	CostOfPurchase   *string         `json:"cost_of_purchase,omitempty"`
+	Attributes       json.RawMessage `json:"attributes,omitempty"`
+	DeletedAt        *time.Time      `json:"deleted_at,omitempty"`
+}
+
+type Project struct {
+	ID                int        `json:"id"`
+	NeaktorID         *string    `json:"neaktor_id,omitempty"`
+	Name              string     `json:"name"`
+	Archived          bool       `json:"archived"`
+	ProjectTypeID     int        `json:"project_type_id"`
+	ShootingStartDate string     `json:"shooting_start_date"`
+	ShootingEndDate   string     `json:"shooting_end_date"`
+	ChiefEngineerID   int        `json:"chief_engineer_id"`
+	DeletedAt         *time.Time `json:"deleted_at,omitempty"`
+}
+
+type Draft struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type EquipmentInProject struct {
+	ProjectID   int `json:"project_id"`
+	EquipmentID int `json:"equipment_id"`
+}
+
+type EquipmentInDraft struct {
+	DraftID     int `json:"draft_id"`
+	EquipmentID int `json:"equipment_id"`
+}
+
+type Transfer struct {
+	ID              int        `json:"id"`
+	FromWarehouseID *int       `json:"from_warehouse_id,omitempty"`
+	ToWarehouseID   *int       `json:"to_warehouse_id,omitempty"`
+	Status          string     `json:"status"`
+	Reason          *string    `json:"reason,omitempty"`
+	RequestedBy     *int       `json:"requested_by,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ShippedAt       *time.Time `json:"shipped_at,omitempty"`
+	ReceivedAt      *time.Time `json:"received_at,omitempty"`
+	CancelledAt     *time.Time `json:"cancelled_at,omitempty"`
+}
+
+type TransferItem struct {
+	TransferID  int `json:"transfer_id"`
+	EquipmentID int `json:"equipment_id"`
+}
+
+type Movement struct {
+	ID              int       `json:"id"`
+	EquipmentID     int       `json:"equipment_id"`
+	FromWarehouseID *int      `json:"from_warehouse_id,omitempty"`
+	ToWarehouseID   *int      `json:"to_warehouse_id,omitempty"`
+	MovedBy         *int      `json:"moved_by,omitempty"`
+	Reason          *string   `json:"reason,omitempty"`
+	TransferID      *int      `json:"transfer_id,omitempty"`
+	StocktakeID     *int      `json:"stocktake_id,omitempty"`
+	MovedAt         time.Time `json:"moved_at"`
+}
+
+type StockItem struct {
+	ID          int     `json:"id"`
+	Name        string  `json:"name"`
+	Unit        string  `json:"unit"`
+	Description *string `json:"description,omitempty"`
+}
+
+type StockLevel struct {
+	StockItemID int `json:"stock_item_id"`
+	WarehouseID int `json:"warehouse_id"`
+	Quantity    int `json:"quantity"`
+}
+
+type StockInProject struct {
+	ProjectID   int        `json:"project_id"`
+	StockItemID int        `json:"stock_item_id"`
+	Quantity    int        `json:"quantity"`
+	Consumed    int        `json:"consumed"`
+	ReturnedAt  *time.Time `json:"returned_at,omitempty"`
+}
+
+type StockInDraft struct {
+	DraftID     int `json:"draft_id"`
+	StockItemID int `json:"stock_item_id"`
+	Quantity    int `json:"quantity"`
+}
+
+type Stocktake struct {
+	ID          int        `json:"id"`
+	WarehouseID *int       `json:"warehouse_id,omitempty"`
+	Status      string     `json:"status"`
+	StartedBy   *int       `json:"started_by,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+	Version     int        `json:"version"`
+}
+
+type StocktakeResult struct {
+	StocktakeID int    `json:"stocktake_id"`
+	EquipmentID int    `json:"equipment_id"`
+	Outcome     string `json:"outcome"`
+	Moved       bool   `json:"moved"`
+}
+
+type StocktakeScan struct {
+	ID          int       `json:"id"`
+	StocktakeID int       `json:"stocktake_id"`
+	EquipmentID *int      `json:"equipment_id,omitempty"`
+	Code        *string   `json:"code,omitempty"`
+	ScannedBy   *int      `json:"scanned_by,omitempty"`
+	ScannedAt   time.Time `json:"scanned_at"`
+}
+
+// Archive is the in-memory form of a backup. Entities are listed in the
+// order they have to be restored in.
+type Archive struct {
+	Manifest           Manifest
+	Users              []User
+	SetTypes           []SetType
+	ProjectTypes       []ProjectType
+	Warehouses         []Warehouse
+	Locations          []Location
+	EquipmentSets      []EquipmentSet
+	Equipment          []Equipment
+	Projects           []Project
+	Drafts             []Draft
+	EquipmentInProject []EquipmentInProject
+	EquipmentInDraft   []EquipmentInDraft
+	Stocktakes         []Stocktake
+	StocktakeScans     []StocktakeScan
+	StocktakeResults   []StocktakeResult
+	StockItems         []StockItem
+	StockLevels        []StockLevel
+	StockInProject     []StockInProject
+	StockInDraft       []StockInDraft
+	Transfers          []Transfer
+	TransferItems      []TransferItem
+	Movements          []Movement
+}
+
+type section struct {
+	name  string
+	value any
+	count func() int
+	// since is the format version that added the table.
+	since int
+}
+
+func (a *Archive) sections() []section {
+	return []section{
+		{"users", &a.Users, func() int { return len(a.Users) }, 1},
+		{"set_types", &a.SetTypes, func() int { return len(a.SetTypes) }, 1},
+		{"project_types", &a.ProjectTypes, func() int { return len(a.ProjectTypes) }, 1},
+		{"warehouses", &a.Warehouses, func() int { return len(a.Warehouses) }, 1},
+		{"warehouse_locations", &a.Locations, func() int { return len(a.Locations) }, 2},
+		{"equipment_sets", &a.EquipmentSets, func() int { return len(a.EquipmentSets) }, 1},
+		{"equipment", &a.Equipment, func() int { return len(a.Equipment) }, 1},
+		{"projects", &a.Projects, func() int { return len(a.Projects) }, 1},
+		{"drafts", &a.Drafts, func() int { return len(a.Drafts) }, 1},
+		{"equipment_in_project", &a.EquipmentInProject, func() int { return len(a.EquipmentInProject) }, 1},
+		{"equipment_in_draft", &a.EquipmentInDraft, func() int { return len(a.EquipmentInDraft) }, 1},
+		{"stocktakes", &a.Stocktakes, func() int { return len(a.Stocktakes) }, 3},
+		{"stocktake_scans", &a.StocktakeScans, func() int { return len(a.StocktakeScans) }, 3},
+		{"stocktake_results", &a.StocktakeResults, func() int { return len(a.StocktakeResults) }, 4},
+		{"stock_items", &a.StockItems, func() int { return len(a.StockItems) }, 4},
+		{"stock_levels", &a.StockLevels, func() int { return len(a.StockLevels) }, 4},
+		{"stock_in_project", &a.StockInProject, func() int { return len(a.StockInProject) }, 4},
+		{"stock_in_draft", &a.StockInDraft, func() int { return len(a.StockInDraft) }, 4},
+		{"warehouse_transfers", &a.Transfers, func() int { return len(a.Transfers) }, 4},
+		{"warehouse_transfer_items", &a.TransferItems, func() int { return len(a.TransferItems) }, 4},
+		{"equipment_movements", &a.Movements, func() int { return len(a.Movements) }, 4},
+	}
+}
+
+// WriteTo serializes the archive as a ZIP file with one JSON document per
+// table and a manifest holding row counts and SHA-256 checksums.
+func (a *Archive) WriteTo(w io.Writer) (int64, error) {
+	counter := &countingWriter{w: w}
+	zw := zip.NewWriter(counter)
+
+	a.Manifest.FormatVersion = FormatVersion
+	a.Manifest.Counts = map[string]int{}
+	a.Manifest.Checksums = map[string]string{}
+
+	for _, sec := range a.sections() {
+		data, err := json.MarshalIndent(sec.value, "", "  ")
+		if err != nil {
+			return counter.n, err
+		}
+		if err := writeZipFile(zw, sec.name+".json", data); err != nil {
+			return counter.n, err
+		}
+		sum := sha256.Sum256(data)
+		a.Manifest.Counts[sec.name] = sec.count()
+		a.Manifest.Checksums[sec.name] = hex.EncodeToString(sum[:])
+	}
+
+	manifest, err := json.MarshalIndent(a.Manifest, "", "  ")
+	if err != nil {
+		return counter.n, err
+	}
+	if err := writeZipFile(zw, manifestFile, manifest); err != nil {
+		return counter.n, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return counter.n, err
+	}
+	return counter.n, nil
+}
+
+// ReadArchive parses a ZIP archive produced by WriteTo and verifies the
+// format version, checksums and row counts. Tables added after the archive's
+// format version are left empty. Referential integrity is checked
+// separately by Validate.
+func ReadArchive(r io.ReaderAt, size int64) (*Archive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[f.Name] = data
+	}
+
+	manifestData, ok := files[manifestFile]
+	if !ok {
+		return nil, fmt.Errorf("%w: missing %s", ErrIntegrity, manifestFile)
+	}
+
+	archive := new(Archive)
+	if err := json.Unmarshal(manifestData, &archive.Manifest); err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	version := archive.Manifest.FormatVersion
+	if version < minFormatVersion || version > FormatVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	for _, sec := range archive.sections() {
+		data, ok := files[sec.name+".json"]
+		if !ok && version < sec.since {
+			continue
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: missing %s.json", ErrIntegrity, sec.name)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != archive.Manifest.Checksums[sec.name] {
+			return nil, fmt.Errorf("%w: %s.json", ErrChecksumMismatch, sec.name)
+		}
+		if err := json.Unmarshal(data, sec.value); err != nil {
+			return nil, fmt.Errorf("read %s.json: %w", sec.name, err)
+		}
+		if sec.count() != archive.Manifest.Counts[sec.name] {
+			return nil, fmt.Errorf("%w: %s has %d rows, manifest says %d", ErrIntegrity, sec.name, sec.count(), archive.Manifest.Counts[sec.name])
+		}
+	}
+
+	return archive, nil
+}
+
+// Validate checks that IDs are unique within each table and that every
+// reference points at a row contained in the archive.
+func (a *Archive) Validate() error {
+	users, err := idSet("users", a.Users, func(v User) int { return v.ID })
+	if err != nil {
+		return err
+	}
+	setTypes, err := idSet("set_types", a.SetTypes, func(v SetType) int { return v.ID })
+	if err != nil {
+		return err
+	}
+	projectTypes, err := idSet("project_types", a.ProjectTypes, func(v ProjectType) int { return v.ID })
+	if err != nil {
+		return err
+	}
+	warehouses, err := idSet("warehouses", a.Warehouses, func(v Warehouse) int { return v.ID })
+	if err != nil {
+		return err
+	}
+	locations, err := idSet("warehouse_locations", a.Locations, func(v Location) int { return v.ID })
+	if err != nil {
+		return err
+	}
+	equipmentSets, err := idSet("equipment_sets", a.EquipmentSets, func(v EquipmentSet) int { return v.ID })
+	if err != nil {
+		return err
+	}
+	equipment, err := idSet("equipment", a.Equipment, func(v Equipment) int { return v.ID })
+	if err != nil {
+		return err
+	}
+	projects, err := idSet("projects", a.Projects, func(v Project) int { return v.ID })
+	if err != nil {
+		return err
+	}
+	drafts, err := idSet("drafts", a.Drafts, func(v Draft) int { return v.ID })
+	if err != nil {
+		return err
+	}
+	stocktakes, err := idSet("stocktakes", a.Stocktakes, func(v Stocktake) int { return v.ID })
+	if err != nil {
+		return err
+	}
+	if _, err := idSet("stocktake_scans", a.StocktakeScans, func(v StocktakeScan) int { return v.ID }); err != nil {
+		return err
+	}
+	stockItems, err := idSet("stock_items", a.StockItems, func(v StockItem) int { return v.ID })
+	if err != nil {
+		return err
+	}
+	transfers, err := idSet("warehouse_transfers", a.Transfers, func(v Transfer) int { return v.ID })
+	if err != nil {
+		return err
+	}
+	if _, err := idSet("equipment_movements", a.Movements, func(v Movement) int { return v.ID }); err != nil {
+		return err
+	}
+
+	locationWarehouses := make(map[int]int, len(a.Locations))
+	for _, item := range a.Locations {
+		if err := requireRef(warehouses, "warehouse_locations", item.ID, "warehouse_id", item.WarehouseID); err != nil {
+			return err
+		}
+		locationWarehouses[item.ID] = item.WarehouseID
+	}
+	for _, item := range a.Locations {
+		if item.ParentID == nil {
+			continue
+		}
+		if err := requireRef(locations, "warehouse_locations", item.ID, "parent_id", *item.ParentID); err != nil {
+			return err
+		}
+		if locationWarehouses[*item.ParentID] != item.WarehouseID {
+			return fmt.Errorf("%w: warehouse_locations row %d is in another warehouse than its parent %d", ErrIntegrity, item.ID, *item.ParentID)
+		}
+	}
+	if _, err := locationsParentsFirst(a.Locations); err != nil {
+		return err
+	}
+	for _, item := range a.EquipmentSets {
+		if err := requireRef(setTypes, "equipment_sets", item.ID, "set_type_id", item.SetTypeID); err != nil {
+			return err
+		}
+	}
+	for _, item := range a.Equipment {
+		if err := requireRef(equipmentSets, "equipment", item.ID, "equipment_set_id", item.EquipmentSetID); err != nil {
+			return err
+		}
+		if err := requireRef(warehouses, "equipment", item.ID, "storage_id", item.StorageID); err != nil {
+			return err
+		}
+		if item.LocationID != nil {
+			if err := requireRef(locations, "equipment", item.ID, "location_id", *item.LocationID); err != nil {
+				return err
+			}
+			if locationWarehouses[*item.LocationID] != item.StorageID {
+				return fmt.Errorf("%w: equipment row %d is placed in location %d of another warehouse", ErrIntegrity, item.ID, *item.LocationID)
+			}
+		}
+	}
+	for _, item := range a.Projects {
+		if err := requireRef(projectTypes, "projects", item.ID, "project_type_id", item.ProjectTypeID); err != nil {
+			return err
+		}
+		if err := requireRef(users, "projects", item.ID, "chief_engineer_id", item.ChiefEngineerID); err != nil {
+			return err
+		}
+	}
+	for _, item := range a.EquipmentInProject {
+		if err := requireRef(projects, "equipment_in_project", item.ProjectID, "project_id", item.ProjectID); err != nil {
+			return err
+		}
+		if err := requireRef(equipment, "equipment_in_project", item.ProjectID, "equipment_id", item.EquipmentID); err != nil {
+			return err
+		}
+	}
+	for _, item := range a.EquipmentInDraft {
+		if err := requireRef(drafts, "equipment_in_draft", item.DraftID, "draft_id", item.DraftID); err != nil {
+			return err
+		}
+		if err := requireRef(equipment, "equipment_in_draft", item.DraftID, "equipment_id", item.EquipmentID); err != nil {
+			return err
+		}
+	}
+	for _, item := range a.Stocktakes {
+		if err := requireOptionalRef(warehouses, "stocktakes", item.ID, "warehouse_id", item.WarehouseID); err != nil {
+			return err
+		}
+		if err := requireOptionalRef(users, "stocktakes", item.ID, "started_by", item.StartedBy); err != nil {
+			return err
+		}
+	}
+	for _, item := range a.StocktakeScans {
+		if err := requireRef(stocktakes, "stocktake_scans", item.ID, "stocktake_id", item.StocktakeID); err != nil {
+			return err
+		}
+		if item.EquipmentID == nil && item.Code == nil {
+			return fmt.Errorf("%w: stocktake_scans row %d names neither equipment nor a code", ErrIntegrity, item.ID)
+		}
+		if err := requireOptionalRef(equipment, "stocktake_scans", item.ID, "equipment_id", item.EquipmentID); err != nil {
+			return err
+		}
+		if err := requireOptionalRef(users, "stocktake_scans", item.ID, "scanned_by", item.ScannedBy); err != nil {
+			return err
+		}
+	}
+	for _, item := range a.StocktakeResults {
+		if err := requireRef(stocktakes, "stocktake_results", item.StocktakeID, "stocktake_id", item.StocktakeID); err != nil {
+			return err
+		}
+		if err := requireRef(equipment, "stocktake_results", item.StocktakeID, "equipment_id", item.EquipmentID); err != nil {
+			return err
+		}
+	}
+	for _, item := range a.StockLevels {
+		if err := requireRef(stockItems, "stock_levels", item.StockItemID, "stock_item_id", item.StockItemID); err != nil {
+			return err
+		}
+		if err := requireRef(warehouses, "stock_levels", item.StockItemID, "warehouse_id", item.WarehouseID); err != nil {
+			return err
+		}
+	}
+	for _, item := range a.StockInProject {
+		if err := requireRef(projects, "stock_in_project", item.ProjectID, "project_id", item.ProjectID); err != nil {
+			return err
+		}
+		if err := requireRef(stockItems, "stock_in_project", item.ProjectID, "stock_item_id", item.StockItemID); err != nil {
+			return err
+		}
+	}
+	for _, item := range a.StockInDraft {
+		if err := requireRef(drafts, "stock_in_draft", item.DraftID, "draft_id", item.DraftID); err != nil {
+			return err
+		}
+		if err := requireRef(stockItems, "stock_in_draft", item.DraftID, "stock_item_id", item.StockItemID); err != nil {
+			return err
+		}
+	}
+	for _, item := range a.Transfers {
+		if err := requireOptionalRef(warehouses, "warehouse_transfers", item.ID, "from_warehouse_id", item.FromWarehouseID); err != nil {
+			return err
+		}
+		if err := requireOptionalRef(warehouses, "warehouse_transfers", item.ID, "to_warehouse_id", item.ToWarehouseID); err != nil {
+			return err
+		}
+		if err := requireOptionalRef(users, "warehouse_transfers", item.ID, "requested_by", item.RequestedBy); err != nil {
+			return err
+		}
+	}
+	for _, item := range a.TransferItems {
+		if err := requireRef(transfers, "warehouse_transfer_items", item.TransferID, "transfer_id", item.TransferID); err != nil {
+			return err
+		}
+		if err := requireRef(equipment, "warehouse_transfer_items", item.TransferID, "equipment_id", item.EquipmentID); err != nil {
+			return err
+		}
+	}
+	for _, item := range a.Movements {
+		if err := requireRef(equipment, "equipment_movements", item.ID, "equipment_id", item.EquipmentID); err != nil {
+			return err
+		}
+		if err := requireOptionalRef(warehouses, "equipment_movements", item.ID, "from_warehouse_id", item.FromWarehouseID); err != nil {
+			return err
+		}
+		if err := requireOptionalRef(warehouses, "equipment_movements", item.ID, "to_warehouse_id", item.ToWarehouseID); err != nil {
+			return err
+		}
+		if err := requireOptionalRef(users, "equipment_movements", item.ID, "moved_by", item.MovedBy); err != nil {
+			return err
+		}
+		if err := requireOptionalRef(transfers, "equipment_movements", item.ID, "transfer_id", item.TransferID); err != nil {
+			return err
+		}
+		if err := requireOptionalRef(stocktakes, "equipment_movements", item.ID, "stocktake_id", item.StocktakeID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func idSet[T any](table string, items []T, id func(T) int) (map[int]struct{}, error) {
+	ids := make(map[int]struct{}, len(items))
+	for _, item := range items {
+		key := id(item)
+		if _, ok := ids[key]; ok {
+			return nil, fmt.Errorf("%w: duplicate id %d in %s", ErrIntegrity, key, table)
+		}
+		ids[key] = struct{}{}
+	}
+	return ids, nil
+}
+
+// locationsParentsFirst orders locations so that every parent comes before
+// its children, which is the order they can be inserted in. It fails when
+// the parents form a cycle.
+func locationsParentsFirst(items []Location) ([]Location, error) {
+	result := make([]Location, 0, len(items))
+	placed := make(map[int]struct{}, len(items))
+	pending := items
+	for len(pending) > 0 {
+		var next []Location
+		for _, item := range pending {
+			if item.ParentID != nil {
+				if _, ok := placed[*item.ParentID]; !ok {
+					next = append(next, item)
+					continue
+				}
+			}
+			placed[item.ID] = struct{}{}
+			result = append(result, item)
+		}
+		if len(next) == len(pending) {
+			return nil, fmt.Errorf("%w: warehouse_locations row %d is part of a parent cycle", ErrIntegrity, next[0].ID)
+		}
+		pending = next
+	}
+	return result, nil
+}
+
+func requireRef(ids map[int]struct{}, table string, rowID int, column string, ref int) error {
+	if _, ok := ids[ref]; !ok {
+		return fmt.Errorf("%w: %s row %d references missing %s %d", ErrIntegrity, table, rowID, column, ref)
+	}
+	return nil
+}
+
+// requireOptionalRef is requireRef for nullable references.
+func requireOptionalRef(ids map[int]struct{}, table string, rowID int, column string, ref *int) error {
+	if ref == nil {
+		return nil
+	}
+	return requireRef(ids, table, rowID, column, *ref)
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, bytes.NewReader(data))
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
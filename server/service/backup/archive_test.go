@@ -0,0 +1,243 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func sampleArchive() *Archive {
+	return &Archive{
+		Manifest:           Manifest{CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		Users:              []User{{ID: 7, FirstName: "Ivan", LastName: "Petrov", Name: "Ivan Petrov", Email: "ivan@example.com", Role: "user"}},
+		SetTypes:           []SetType{{ID: 3, Name: "Cameras"}},
+		ProjectTypes:       []ProjectType{{ID: 4, Name: "Concert"}},
+		Warehouses:         []Warehouse{{ID: 5, Name: "Main"}, {ID: 15, Name: "Annex"}},
+		Locations:          []Location{{ID: 12, WarehouseID: 5, ParentID: intPtr(11), Kind: "shelf", Name: "3"}, {ID: 11, WarehouseID: 5, Kind: "rack", Name: "2"}},
+		EquipmentSets:      []EquipmentSet{{ID: 6, Name: "Camera kit", SetTypeID: 3}},
+		Equipment:          []Equipment{{ID: 8, EquipmentSetID: 6, Name: "FX6", SerialNumber: "SN-1", StorageID: 5, LocationID: intPtr(12)}},
+		Projects:           []Project{{ID: 9, Name: "Show", ProjectTypeID: 4, ShootingStartDate: "2026-02-01", ShootingEndDate: "2026-02-02", ChiefEngineerID: 7}},
+		Drafts:             []Draft{{ID: 10, Name: "Default kit"}},
+		EquipmentInProject: []EquipmentInProject{{ProjectID: 9, EquipmentID: 8}},
+		EquipmentInDraft:   []EquipmentInDraft{{DraftID: 10, EquipmentID: 8}},
+		Stocktakes:         []Stocktake{{ID: 17, WarehouseID: intPtr(15), Status: "applied", StartedBy: intPtr(7), Version: 3}},
+		StocktakeScans:     []StocktakeScan{{ID: 18, StocktakeID: 17, EquipmentID: intPtr(8), ScannedBy: intPtr(7)}, {ID: 19, StocktakeID: 17, Code: stringPtr("SN-404")}},
+		StocktakeResults:   []StocktakeResult{{StocktakeID: 17, EquipmentID: 8, Outcome: "unexpected", Moved: true}},
+		StockItems:         []StockItem{{ID: 13, Name: "XLR 5 m", Unit: "pcs"}},
+		StockLevels:        []StockLevel{{StockItemID: 13, WarehouseID: 5, Quantity: 40}},
+		StockInProject:     []StockInProject{{ProjectID: 9, StockItemID: 13, Quantity: 10}},
+		StockInDraft:       []StockInDraft{{DraftID: 10, StockItemID: 13, Quantity: 4}},
+		Transfers:          []Transfer{{ID: 14, FromWarehouseID: intPtr(15), ToWarehouseID: intPtr(5), Status: "received", RequestedBy: intPtr(7)}},
+		TransferItems:      []TransferItem{{TransferID: 14, EquipmentID: 8}},
+		Movements:          []Movement{{ID: 16, EquipmentID: 8, FromWarehouseID: intPtr(15), ToWarehouseID: intPtr(5), MovedBy: intPtr(7), TransferID: intPtr(14)}},
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func stringPtr(v string) *string {
+	return &v
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := sampleArchive().WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := ReadArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Validate(); err != nil {
+		t.Fatalf("expected valid archive, got %v", err)
+	}
+	if archive.Manifest.Counts["equipment"] != 1 || archive.Equipment[0].SerialNumber != "SN-1" {
+		t.Fatalf("unexpected equipment after round trip: %+v", archive.Equipment)
+	}
+	if archive.Manifest.Counts["stocktake_scans"] != 2 || *archive.StocktakeScans[1].Code != "SN-404" || !archive.StocktakeResults[0].Moved {
+		t.Fatalf("unexpected stocktakes after round trip: %+v %+v", archive.StocktakeScans, archive.StocktakeResults)
+	}
+	if archive.Manifest.Counts["stock_in_project"] != 1 || archive.StockLevels[0].Quantity != 40 {
+		t.Fatalf("unexpected stock after round trip: %+v %+v", archive.StockLevels, archive.StockInProject)
+	}
+	if archive.Manifest.Counts["equipment_movements"] != 1 || *archive.Movements[0].TransferID != 14 {
+		t.Fatalf("unexpected movements after round trip: %+v", archive.Movements)
+	}
+	ordered, err := locationsParentsFirst(archive.Locations)
+	if err != nil || ordered[0].ID != 11 || ordered[1].ID != 12 {
+		t.Fatalf("expected rack 11 before shelf 12, got %+v (%v)", ordered, err)
+	}
+}
+
+// rewriteArchive writes the sample archive and copies it file by file
+// through edit, which can change a file or drop it by returning nil.
+func rewriteArchive(t *testing.T, edit func(name string, data []byte) []byte) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := sampleArchive().WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rewritten bytes.Buffer
+	zw := zip.NewWriter(&rewritten)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if data = edit(f.Name, data); data == nil {
+			continue
+		}
+		if err := writeZipFile(zw, f.Name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zw.Close()
+	return bytes.NewReader(rewritten.Bytes())
+}
+
+func TestReadArchiveRejectsTamperedFile(t *testing.T) {
+	tampered := rewriteArchive(t, func(name string, data []byte) []byte {
+		if name == "equipment.json" {
+			return bytes.Replace(data, []byte("SN-1"), []byte("SN-2"), 1)
+		}
+		return data
+	})
+
+	_, err := ReadArchive(tampered, tampered.Size())
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestReadArchiveLeavesNewerTablesOfOlderFormatsEmpty(t *testing.T) {
+	added := map[string]bool{}
+	for _, sec := range (&Archive{}).sections() {
+		if sec.since > 2 {
+			added[sec.name+".json"] = true
+		}
+	}
+	older := rewriteArchive(t, func(name string, data []byte) []byte {
+		switch {
+		case name == manifestFile:
+			return bytes.Replace(data, []byte(fmt.Sprintf(`"format_version": %d`, FormatVersion)), []byte(`"format_version": 2`), 1)
+		case added[name]:
+			return nil
+		}
+		return data
+	})
+
+	archive, err := ReadArchive(older, older.Size())
+	if err != nil {
+		t.Fatalf("expected a version 2 archive to be read, got %v", err)
+	}
+	if len(archive.Stocktakes) != 0 || len(archive.StockItems) != 0 || len(archive.Movements) != 0 || len(archive.Equipment) != 1 {
+		t.Fatalf("expected equipment without stocktakes, stock or movements, got %+v", archive)
+	}
+
+	missing := rewriteArchive(t, func(name string, data []byte) []byte {
+		if name == "stock_items.json" {
+			return nil
+		}
+		return data
+	})
+	if _, err := ReadArchive(missing, missing.Size()); !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("expected a current archive without stock_items.json to be rejected, got %v", err)
+	}
+}
+
+func TestValidateDetectsBrokenReferences(t *testing.T) {
+	testCases := []struct {
+		name   string
+		mutate func(a *Archive)
+	}{
+		{
+			name:   "missing warehouse",
+			mutate: func(a *Archive) { a.Equipment[0].StorageID = 99 },
+		},
+		{
+			name:   "missing chief engineer",
+			mutate: func(a *Archive) { a.Projects[0].ChiefEngineerID = 99 },
+		},
+		{
+			name:   "missing equipment in draft link",
+			mutate: func(a *Archive) { a.EquipmentInDraft[0].EquipmentID = 99 },
+		},
+		{
+			name:   "equipment in another warehouse's location",
+			mutate: func(a *Archive) { a.Equipment[0].StorageID = 15 },
+		},
+		{
+			name:   "stock level in a missing warehouse",
+			mutate: func(a *Archive) { a.StockLevels[0].WarehouseID = 99 },
+		},
+		{
+			name:   "missing stock item in project reservation",
+			mutate: func(a *Archive) { a.StockInProject[0].StockItemID = 99 },
+		},
+		{
+			name:   "movement of missing equipment",
+			mutate: func(a *Archive) { a.Movements[0].EquipmentID = 99 },
+		},
+		{
+			name:   "movement by a missing user",
+			mutate: func(a *Archive) { a.Movements[0].MovedBy = intPtr(99) },
+		},
+		{
+			name:   "movement of a missing stocktake",
+			mutate: func(a *Archive) { a.Movements[0].StocktakeID = intPtr(99) },
+		},
+		{
+			name:   "missing transfer in transfer items",
+			mutate: func(a *Archive) { a.TransferItems[0].TransferID = 99 },
+		},
+		{
+			name:   "location parent in another warehouse",
+			mutate: func(a *Archive) { a.Locations[1].WarehouseID = 15 },
+		},
+		{
+			name:   "location parent cycle",
+			mutate: func(a *Archive) { a.Locations[1].ParentID = intPtr(12) },
+		},
+		{
+			name:   "scan of a missing stocktake",
+			mutate: func(a *Archive) { a.StocktakeScans[0].StocktakeID = 99 },
+		},
+		{
+			name:   "scan without equipment or code",
+			mutate: func(a *Archive) { a.StocktakeScans[1].Code = nil },
+		},
+		{
+			name:   "stocktake result of missing equipment",
+			mutate: func(a *Archive) { a.StocktakeResults[0].EquipmentID = 99 },
+		},
+		{
+			name:   "duplicate id",
+			mutate: func(a *Archive) { a.SetTypes = append(a.SetTypes, SetType{ID: 3, Name: "Other"}) },
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			archive := sampleArchive()
+			tc.mutate(archive)
+			if err := archive.Validate(); !errors.Is(err, ErrIntegrity) {
+				t.Fatalf("expected integrity error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+type ExportOptions struct {
+	IncludePasswordHashes bool
+}
+
+// Export reads every CRM table inside a single repeatable-read transaction so
+// the archive is a consistent snapshot even while the API is serving writes.
+func Export(ctx context.Context, db *sql.DB, opts ExportOptions) (*Archive, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	archive := &Archive{
+		Manifest: Manifest{
+			CreatedAt:              time.Now().UTC(),
+			IncludesPasswordHashes: opts.IncludePasswordHashes,
+		},
+	}
+
+	archive.Users, err = queryAll(ctx, tx, `
+		SELECT id, first_name, last_name, name, email, password, role, created_at
+		FROM users ORDER BY id
+	`, func(rows *sql.Rows) (User, error) {
+		var item User
+		err := rows.Scan(&item.ID, &item.FirstName, &item.LastName, &item.Name, &item.Email, &item.PasswordHash, &item.Role, &item.CreatedAt)
+		if !opts.IncludePasswordHashes {
+			item.PasswordHash = ""
+		}
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.SetTypes, err = queryAll(ctx, tx, `
+		SELECT set_type_id, set_type_name, attributes::TEXT, depreciation_method, useful_life_months, salvage_percent::TEXT
+		FROM set_types ORDER BY set_type_id
+	`, func(rows *sql.Rows) (SetType, error) {
+		var item SetType
+		var attributes string
+		err := rows.Scan(&item.ID, &item.Name, &attributes, &item.DepreciationMethod, &item.UsefulLifeMonths, &item.SalvagePercent)
+		item.Attributes = json.RawMessage(attributes)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.ProjectTypes, err = queryAll(ctx, tx, `
+		SELECT project_type_id, project_type_name, neaktor_id FROM project_types ORDER BY project_type_id
+	`, func(rows *sql.Rows) (ProjectType, error) {
+		var item ProjectType
+		err := rows.Scan(&item.ID, &item.Name, &item.NeaktorID)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.Warehouses, err = queryAll(ctx, tx, `
+		SELECT warehouse_id, warehouse_name, warehouse_adress FROM warehouses ORDER BY warehouse_id
+	`, func(rows *sql.Rows) (Warehouse, error) {
+		var item Warehouse
+		err := rows.Scan(&item.ID, &item.Name, &item.Adress)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.Locations, err = queryAll(ctx, tx, `
+		SELECT location_id, warehouse_id, parent_id, kind, location_name
+		FROM warehouse_locations ORDER BY location_id
+	`, func(rows *sql.Rows) (Location, error) {
+		var item Location
+		err := rows.Scan(&item.ID, &item.WarehouseID, &item.ParentID, &item.Kind, &item.Name)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.EquipmentSets, err = queryAll(ctx, tx, `
+		SELECT equipment_set_id, equipment_set_name, description, set_type_id
+		FROM equipment_sets ORDER BY equipment_set_id
+	`, func(rows *sql.Rows) (EquipmentSet, error) {
+		var item EquipmentSet
+		err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.SetTypeID)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.Equipment, err = queryAll(ctx, tx, `
+		SELECT
+			equipment_id,
+			equipment_set_id,
+			equipment_name,
+			description,
+			serial_number,
+			storage_id,
+			location_id,
+			needs_maintenance,
+			TO_CHAR(date_of_purchase, 'YYYY-MM-DD'),
+			cost_of_purchase::TEXT,
+			attributes::TEXT,
+			deleted_at
+		FROM equipment ORDER BY equipment_id
+	`, func(rows *sql.Rows) (Equipment, error) {
+		var item Equipment
+		var attributes string
+		err := rows.Scan(
+			&item.ID,
+			&item.EquipmentSetID,
+			&item.Name,
+			&item.Description,
+			&item.SerialNumber,
+			&item.StorageID,
+			&item.LocationID,
+			&item.NeedsMaintenance,
+			&item.DateOfPurchase,
+			&item.CostOfPurchase,
+			&attributes,
+			&item.DeletedAt,
+		)
+		item.Attributes = json.RawMessage(attributes)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.Projects, err = queryAll(ctx, tx, `
+		SELECT
+			project_id,
+			neaktor_id,
+			project_name,
+			archived,
+			project_type_id,
+			TO_CHAR(shooting_start_date, 'YYYY-MM-DD'),
+			TO_CHAR(shooting_end_date, 'YYYY-MM-DD'),
+			chief_engineer_id,
+			deleted_at
+		FROM projects ORDER BY project_id
+	`, func(rows *sql.Rows) (Project, error) {
+		var item Project
+		err := rows.Scan(
+			&item.ID,
+			&item.NeaktorID,
+			&item.Name,
+			&item.Archived,
+			&item.ProjectTypeID,
+			&item.ShootingStartDate,
+			&item.ShootingEndDate,
+			&item.ChiefEngineerID,
+			&item.DeletedAt,
+		)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.Drafts, err = queryAll(ctx, tx, `
+		SELECT draft_id, draft_name, deleted_at FROM drafts ORDER BY draft_id
+	`, func(rows *sql.Rows) (Draft, error) {
+		var item Draft
+		err := rows.Scan(&item.ID, &item.Name, &item.DeletedAt)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.EquipmentInProject, err = queryAll(ctx, tx, `
+		SELECT project_id, equipment_id FROM equipment_in_project ORDER BY project_id, equipment_id
+	`, func(rows *sql.Rows) (EquipmentInProject, error) {
+		var item EquipmentInProject
+		err := rows.Scan(&item.ProjectID, &item.EquipmentID)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.EquipmentInDraft, err = queryAll(ctx, tx, `
+		SELECT draft_id, equipment_id FROM equipment_in_draft ORDER BY draft_id, equipment_id
+	`, func(rows *sql.Rows) (EquipmentInDraft, error) {
+		var item EquipmentInDraft
+		err := rows.Scan(&item.DraftID, &item.EquipmentID)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.Stocktakes, err = queryAll(ctx, tx, `
+		SELECT stocktake_id, warehouse_id, status, started_by, started_at, closed_at, applied_at, version
+		FROM stocktakes ORDER BY stocktake_id
+	`, func(rows *sql.Rows) (Stocktake, error) {
+		var item Stocktake
+		err := rows.Scan(&item.ID, &item.WarehouseID, &item.Status, &item.StartedBy, &item.StartedAt, &item.ClosedAt, &item.AppliedAt, &item.Version)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.StocktakeScans, err = queryAll(ctx, tx, `
+		SELECT scan_id, stocktake_id, equipment_id, code, scanned_by, scanned_at
+		FROM stocktake_scans ORDER BY scan_id
+	`, func(rows *sql.Rows) (StocktakeScan, error) {
+		var item StocktakeScan
+		err := rows.Scan(&item.ID, &item.StocktakeID, &item.EquipmentID, &item.Code, &item.ScannedBy, &item.ScannedAt)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.StocktakeResults, err = queryAll(ctx, tx, `
+		SELECT stocktake_id, equipment_id, outcome, moved
+		FROM stocktake_results ORDER BY stocktake_id, equipment_id
+	`, func(rows *sql.Rows) (StocktakeResult, error) {
+		var item StocktakeResult
+		err := rows.Scan(&item.StocktakeID, &item.EquipmentID, &item.Outcome, &item.Moved)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.StockItems, err = queryAll(ctx, tx, `
+		SELECT stock_item_id, stock_item_name, unit, description FROM stock_items ORDER BY stock_item_id
+	`, func(rows *sql.Rows) (StockItem, error) {
+		var item StockItem
+		err := rows.Scan(&item.ID, &item.Name, &item.Unit, &item.Description)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.StockLevels, err = queryAll(ctx, tx, `
+		SELECT stock_item_id, warehouse_id, quantity FROM stock_levels ORDER BY stock_item_id, warehouse_id
+	`, func(rows *sql.Rows) (StockLevel, error) {
+		var item StockLevel
+		err := rows.Scan(&item.StockItemID, &item.WarehouseID, &item.Quantity)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.StockInProject, err = queryAll(ctx, tx, `
+		SELECT project_id, stock_item_id, quantity, consumed, returned_at
+		FROM stock_in_project ORDER BY project_id, stock_item_id
+	`, func(rows *sql.Rows) (StockInProject, error) {
+		var item StockInProject
+		err := rows.Scan(&item.ProjectID, &item.StockItemID, &item.Quantity, &item.Consumed, &item.ReturnedAt)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.StockInDraft, err = queryAll(ctx, tx, `
+		SELECT draft_id, stock_item_id, quantity FROM stock_in_draft ORDER BY draft_id, stock_item_id
+	`, func(rows *sql.Rows) (StockInDraft, error) {
+		var item StockInDraft
+		err := rows.Scan(&item.DraftID, &item.StockItemID, &item.Quantity)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.Transfers, err = queryAll(ctx, tx, `
+		SELECT
+			transfer_id,
+			from_warehouse_id,
+			to_warehouse_id,
+			status,
+			reason,
+			requested_by,
+			created_at,
+			shipped_at,
+			received_at,
+			cancelled_at
+		FROM warehouse_transfers ORDER BY transfer_id
+	`, func(rows *sql.Rows) (Transfer, error) {
+		var item Transfer
+		err := rows.Scan(
+			&item.ID,
+			&item.FromWarehouseID,
+			&item.ToWarehouseID,
+			&item.Status,
+			&item.Reason,
+			&item.RequestedBy,
+			&item.CreatedAt,
+			&item.ShippedAt,
+			&item.ReceivedAt,
+			&item.CancelledAt,
+		)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.TransferItems, err = queryAll(ctx, tx, `
+		SELECT transfer_id, equipment_id FROM warehouse_transfer_items ORDER BY transfer_id, equipment_id
+	`, func(rows *sql.Rows) (TransferItem, error) {
+		var item TransferItem
+		err := rows.Scan(&item.TransferID, &item.EquipmentID)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archive.Movements, err = queryAll(ctx, tx, `
+		SELECT movement_id, equipment_id, from_warehouse_id, to_warehouse_id, moved_by, reason, transfer_id, stocktake_id, moved_at
+		FROM equipment_movements ORDER BY movement_id
+	`, func(rows *sql.Rows) (Movement, error) {
+		var item Movement
+		err := rows.Scan(&item.ID, &item.EquipmentID, &item.FromWarehouseID, &item.ToWarehouseID, &item.MovedBy, &item.Reason, &item.TransferID, &item.StocktakeID, &item.MovedAt)
+		return item, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return archive, tx.Commit()
+}
+
+func queryAll[T any](ctx context.Context, tx *sql.Tx, query string, scan func(*sql.Rows) (T, error)) ([]T, error) {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]T, 0)
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,400 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var ErrDatabaseNotEmpty = errors.New("target database is not empty")
+
+// disabledPassword matches the placeholder the user migration assigns to
+// legacy accounts: it is not a valid bcrypt hash, so such users have to
+// reset their password before they can log in.
+const disabledPassword = "!"
+
+type RestoreReport struct {
+	Counts map[string]int `json:"counts"`
+	// IDMap maps archive IDs to the IDs assigned by the target database.
+	IDMap map[string]map[int]int `json:"id_map"`
+}
+
+// Restore validates the archive and inserts it into an empty database inside
+// one transaction. Rows get fresh IDs from the target sequences; references
+// are rewritten through the resulting ID map.
+func Restore(ctx context.Context, db *sql.DB, archive *Archive) (*RestoreReport, error) {
+	if err := archive.Validate(); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := ensureEmpty(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	report := &RestoreReport{Counts: map[string]int{}, IDMap: map[string]map[int]int{}}
+	remap := func(table string) map[int]int {
+		ids := map[int]int{}
+		report.IDMap[table] = ids
+		return ids
+	}
+
+	users := remap("users")
+	for _, item := range archive.Users {
+		password := item.PasswordHash
+		if password == "" {
+			password = disabledPassword
+		}
+		if err := insertReturningID(ctx, tx, users, item.ID, `
+			INSERT INTO users (first_name, last_name, name, email, password, role, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id
+		`, item.FirstName, item.LastName, item.Name, item.Email, password, item.Role, item.CreatedAt); err != nil {
+			return nil, fmt.Errorf("restore user %d: %w", item.ID, err)
+		}
+	}
+
+	setTypes := remap("set_types")
+	for _, item := range archive.SetTypes {
+		if err := insertReturningID(ctx, tx, setTypes, item.ID, `
+			INSERT INTO set_types (set_type_name, attributes, depreciation_method, useful_life_months, salvage_percent)
+			VALUES ($1, COALESCE(NULLIF($2, '')::JSONB, '[]'), COALESCE(NULLIF($3, ''), 'none'), $4, COALESCE($5::NUMERIC, 0))
+			RETURNING set_type_id
+		`, item.Name, string(item.Attributes), item.DepreciationMethod, item.UsefulLifeMonths, item.SalvagePercent); err != nil {
+			return nil, fmt.Errorf("restore set type %d: %w", item.ID, err)
+		}
+	}
+
+	projectTypes := remap("project_types")
+	for _, item := range archive.ProjectTypes {
+		if err := insertReturningID(ctx, tx, projectTypes, item.ID, `
+			INSERT INTO project_types (project_type_name, neaktor_id) VALUES ($1, $2) RETURNING project_type_id
+		`, item.Name, item.NeaktorID); err != nil {
+			return nil, fmt.Errorf("restore project type %d: %w", item.ID, err)
+		}
+	}
+
+	warehouses := remap("warehouses")
+	for _, item := range archive.Warehouses {
+		if err := insertReturningID(ctx, tx, warehouses, item.ID, `
+			INSERT INTO warehouses (warehouse_name, warehouse_adress) VALUES ($1, $2) RETURNING warehouse_id
+		`, item.Name, item.Adress); err != nil {
+			return nil, fmt.Errorf("restore warehouse %d: %w", item.ID, err)
+		}
+	}
+
+	// Validate has ruled out parent cycles, so this cannot fail.
+	orderedLocations, _ := locationsParentsFirst(archive.Locations)
+	locations := remap("warehouse_locations")
+	for _, item := range orderedLocations {
+		if err := insertReturningID(ctx, tx, locations, item.ID, `
+			INSERT INTO warehouse_locations (warehouse_id, parent_id, kind, location_name)
+			VALUES ($1, $2, $3, $4)
+			RETURNING location_id
+		`, warehouses[item.WarehouseID], optionalRef(locations, item.ParentID), item.Kind, item.Name); err != nil {
+			return nil, fmt.Errorf("restore location %d: %w", item.ID, err)
+		}
+	}
+
+	equipmentSets := remap("equipment_sets")
+	for _, item := range archive.EquipmentSets {
+		if err := insertReturningID(ctx, tx, equipmentSets, item.ID, `
+			INSERT INTO equipment_sets (equipment_set_name, description, set_type_id)
+			VALUES ($1, $2, $3)
+			RETURNING equipment_set_id
+		`, item.Name, item.Description, setTypes[item.SetTypeID]); err != nil {
+			return nil, fmt.Errorf("restore equipment set %d: %w", item.ID, err)
+		}
+	}
+
+	// Live items whose serial number collides with an earlier one of their
+	// set come back exempt from uniqueness, as the migration that added it
+	// left them, so archives taken before it still restore.
+	equipment := remap("equipment")
+	for _, item := range archive.Equipment {
+		if err := insertReturningID(ctx, tx, equipment, item.ID, `
+			INSERT INTO equipment (
+				equipment_set_id,
+				equipment_name,
+				description,
+				serial_number,
+				storage_id,
+				location_id,
+				needs_maintenance,
+				date_of_purchase,
+				cost_of_purchase,
+				attributes,
+				deleted_at,
+				serial_exempt
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8::DATE, $9::NUMERIC, COALESCE(NULLIF($10, '')::JSONB, '{}'), $11,
+				$11::TIMESTAMPTZ IS NULL AND EXISTS (
+					SELECT 1 FROM equipment o
+					WHERE o.deleted_at IS NULL AND o.equipment_set_id = $1
+					  AND o.serial_key = LOWER(REGEXP_REPLACE($4, '\s', '', 'g'))
+				))
+			RETURNING equipment_id
+		`,
+			equipmentSets[item.EquipmentSetID],
+			item.Name,
+			item.Description,
+			item.SerialNumber,
+			warehouses[item.StorageID],
+			optionalRef(locations, item.LocationID),
+			item.NeedsMaintenance,
+			item.DateOfPurchase,
+			item.CostOfPurchase,
+			string(item.Attributes),
+			item.DeletedAt,
+		); err != nil {
+			return nil, fmt.Errorf("restore equipment %d: %w", item.ID, err)
+		}
+	}
+
+	projects := remap("projects")
+	for _, item := range archive.Projects {
+		if err := insertReturningID(ctx, tx, projects, item.ID, `
+			INSERT INTO projects (
+				neaktor_id,
+				project_name,
+				archived,
+				project_type_id,
+				shooting_start_date,
+				shooting_end_date,
+				chief_engineer_id,
+				deleted_at
+			)
+			VALUES ($1, $2, $3, $4, $5::DATE, $6::DATE, $7, $8)
+			RETURNING project_id
+		`,
+			item.NeaktorID,
+			item.Name,
+			item.Archived,
+			projectTypes[item.ProjectTypeID],
+			item.ShootingStartDate,
+			item.ShootingEndDate,
+			users[item.ChiefEngineerID],
+			item.DeletedAt,
+		); err != nil {
+			return nil, fmt.Errorf("restore project %d: %w", item.ID, err)
+		}
+	}
+
+	drafts := remap("drafts")
+	for _, item := range archive.Drafts {
+		if err := insertReturningID(ctx, tx, drafts, item.ID, `
+			INSERT INTO drafts (draft_name, deleted_at) VALUES ($1, $2) RETURNING draft_id
+		`, item.Name, item.DeletedAt); err != nil {
+			return nil, fmt.Errorf("restore draft %d: %w", item.ID, err)
+		}
+	}
+
+	for _, item := range archive.EquipmentInProject {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO equipment_in_project (project_id, equipment_id) VALUES ($1, $2)
+		`, projects[item.ProjectID], equipment[item.EquipmentID]); err != nil {
+			return nil, fmt.Errorf("restore equipment %d in project %d: %w", item.EquipmentID, item.ProjectID, err)
+		}
+	}
+
+	for _, item := range archive.EquipmentInDraft {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO equipment_in_draft (draft_id, equipment_id) VALUES ($1, $2)
+		`, drafts[item.DraftID], equipment[item.EquipmentID]); err != nil {
+			return nil, fmt.Errorf("restore equipment %d in draft %d: %w", item.EquipmentID, item.DraftID, err)
+		}
+	}
+
+	stocktakes := remap("stocktakes")
+	for _, item := range archive.Stocktakes {
+		if err := insertReturningID(ctx, tx, stocktakes, item.ID, `
+			INSERT INTO stocktakes (warehouse_id, status, started_by, started_at, closed_at, applied_at, version)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING stocktake_id
+		`,
+			optionalRef(warehouses, item.WarehouseID),
+			item.Status,
+			optionalRef(users, item.StartedBy),
+			item.StartedAt,
+			item.ClosedAt,
+			item.AppliedAt,
+			item.Version,
+		); err != nil {
+			return nil, fmt.Errorf("restore stocktake %d: %w", item.ID, err)
+		}
+	}
+
+	scans := remap("stocktake_scans")
+	for _, item := range archive.StocktakeScans {
+		if err := insertReturningID(ctx, tx, scans, item.ID, `
+			INSERT INTO stocktake_scans (stocktake_id, equipment_id, code, scanned_by, scanned_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING scan_id
+		`,
+			stocktakes[item.StocktakeID],
+			optionalRef(equipment, item.EquipmentID),
+			item.Code,
+			optionalRef(users, item.ScannedBy),
+			item.ScannedAt,
+		); err != nil {
+			return nil, fmt.Errorf("restore stocktake scan %d: %w", item.ID, err)
+		}
+	}
+
+	for _, item := range archive.StocktakeResults {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO stocktake_results (stocktake_id, equipment_id, outcome, moved) VALUES ($1, $2, $3, $4)
+		`, stocktakes[item.StocktakeID], equipment[item.EquipmentID], item.Outcome, item.Moved); err != nil {
+			return nil, fmt.Errorf("restore equipment %d in stocktake %d: %w", item.EquipmentID, item.StocktakeID, err)
+		}
+	}
+
+	stockItems := remap("stock_items")
+	for _, item := range archive.StockItems {
+		if err := insertReturningID(ctx, tx, stockItems, item.ID, `
+			INSERT INTO stock_items (stock_item_name, unit, description) VALUES ($1, $2, $3) RETURNING stock_item_id
+		`, item.Name, item.Unit, item.Description); err != nil {
+			return nil, fmt.Errorf("restore stock item %d: %w", item.ID, err)
+		}
+	}
+
+	for _, item := range archive.StockLevels {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO stock_levels (stock_item_id, warehouse_id, quantity) VALUES ($1, $2, $3)
+		`, stockItems[item.StockItemID], warehouses[item.WarehouseID], item.Quantity); err != nil {
+			return nil, fmt.Errorf("restore stock item %d in warehouse %d: %w", item.StockItemID, item.WarehouseID, err)
+		}
+	}
+
+	for _, item := range archive.StockInProject {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO stock_in_project (project_id, stock_item_id, quantity, consumed, returned_at)
+			VALUES ($1, $2, $3, $4, $5)
+		`, projects[item.ProjectID], stockItems[item.StockItemID], item.Quantity, item.Consumed, item.ReturnedAt); err != nil {
+			return nil, fmt.Errorf("restore stock item %d in project %d: %w", item.StockItemID, item.ProjectID, err)
+		}
+	}
+
+	for _, item := range archive.StockInDraft {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO stock_in_draft (draft_id, stock_item_id, quantity) VALUES ($1, $2, $3)
+		`, drafts[item.DraftID], stockItems[item.StockItemID], item.Quantity); err != nil {
+			return nil, fmt.Errorf("restore stock item %d in draft %d: %w", item.StockItemID, item.DraftID, err)
+		}
+	}
+
+	transfers := remap("warehouse_transfers")
+	for _, item := range archive.Transfers {
+		if err := insertReturningID(ctx, tx, transfers, item.ID, `
+			INSERT INTO warehouse_transfers (
+				from_warehouse_id,
+				to_warehouse_id,
+				status,
+				reason,
+				requested_by,
+				created_at,
+				shipped_at,
+				received_at,
+				cancelled_at
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING transfer_id
+		`,
+			optionalRef(warehouses, item.FromWarehouseID),
+			optionalRef(warehouses, item.ToWarehouseID),
+			item.Status,
+			item.Reason,
+			optionalRef(users, item.RequestedBy),
+			item.CreatedAt,
+			item.ShippedAt,
+			item.ReceivedAt,
+			item.CancelledAt,
+		); err != nil {
+			return nil, fmt.Errorf("restore transfer %d: %w", item.ID, err)
+		}
+	}
+
+	for _, item := range archive.TransferItems {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO warehouse_transfer_items (transfer_id, equipment_id) VALUES ($1, $2)
+		`, transfers[item.TransferID], equipment[item.EquipmentID]); err != nil {
+			return nil, fmt.Errorf("restore equipment %d in transfer %d: %w", item.EquipmentID, item.TransferID, err)
+		}
+	}
+
+	// Movements are restored in their original order, so the history of an
+	// item reads the same and valuation as of a past date places it in the
+	// same warehouse.
+	movements := remap("equipment_movements")
+	for _, item := range archive.Movements {
+		if err := insertReturningID(ctx, tx, movements, item.ID, `
+			INSERT INTO equipment_movements (equipment_id, from_warehouse_id, to_warehouse_id, moved_by, reason, transfer_id, stocktake_id, moved_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING movement_id
+		`,
+			equipment[item.EquipmentID],
+			optionalRef(warehouses, item.FromWarehouseID),
+			optionalRef(warehouses, item.ToWarehouseID),
+			optionalRef(users, item.MovedBy),
+			item.Reason,
+			optionalRef(transfers, item.TransferID),
+			optionalRef(stocktakes, item.StocktakeID),
+			item.MovedAt,
+		); err != nil {
+			return nil, fmt.Errorf("restore movement %d: %w", item.ID, err)
+		}
+	}
+
+	for _, sec := range archive.sections() {
+		var count int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+sec.name).Scan(&count); err != nil {
+			return nil, err
+		}
+		if count != sec.count() {
+			return nil, fmt.Errorf("%w: %s has %d rows after restore, archive has %d", ErrIntegrity, sec.name, count, sec.count())
+		}
+		report.Counts[sec.name] = count
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func ensureEmpty(ctx context.Context, tx *sql.Tx) error {
+	for _, sec := range (&Archive{}).sections() {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+sec.name+`)`).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("%w: %s has rows", ErrDatabaseNotEmpty, sec.name)
+		}
+	}
+	return nil
+}
+
+// optionalRef rewrites a nullable reference through ids.
+func optionalRef(ids map[int]int, ref *int) *int {
+	if ref == nil {
+		return nil
+	}
+	id := ids[*ref]
+	return &id
+}
+
+func insertReturningID(ctx context.Context, tx *sql.Tx, ids map[int]int, oldID int, query string, args ...any) error {
+	var newID int
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&newID); err != nil {
+		return err
+	}
+	ids[oldID] = newID
+	return nil
+}
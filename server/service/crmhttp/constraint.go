@@ -0,0 +1,92 @@
+package crmhttp
+
+import (
+	"VyacheslavKuchumov/test-backend/service/tracker"
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// keyColumns extracts the columns from details such as
+// `Key (serial_number)=(SN-1) already exists.`
+var keyColumns = regexp.MustCompile(`Key \(([^)]+)\)=`)
+
+// constraintProblem turns PostgreSQL constraint violations into client errors
+// naming the offending fields. Column names match the JSON payload fields. A
+// foreign key violation is a record in use when the store reports it from a
+// delete (tracker.ErrInUse) and a reference to a missing record otherwise.
+func constraintProblem(r *http.Request, err error) (types.ErrorResponse, bool) {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return types.ErrorResponse{}, false
+	}
+
+	columns := constraintColumns(pgErr)
+	switch pgErr.Code {
+	case "23505":
+		return types.ErrorResponse{
+			Status: http.StatusConflict,
+			Code:   utils.CodeDuplicate,
+			Detail: utils.T(r, "a record with this %s already exists", strings.Join(columns, ", ")),
+			Errors: fieldErrors(columns, utils.CodeDuplicate, utils.T(r, "is already taken")),
+		}, true
+	case "23503":
+		if errors.Is(err, tracker.ErrInUse) {
+			return types.ErrorResponse{
+				Status: http.StatusConflict,
+				Code:   utils.CodeInUse,
+				Detail: utils.T(r, "record is still used by %s", pgErr.TableName),
+				Errors: fieldErrors(columns, utils.CodeInUse, utils.T(r, "is referenced from %s", pgErr.TableName)),
+			}, true
+		}
+		return types.ErrorResponse{
+			Status: http.StatusConflict,
+			Code:   utils.CodeInvalidReference,
+			Detail: "payload references a record that does not exist",
+			Errors: fieldErrors(columns, utils.CodeInvalidReference, utils.T(r, "references a missing record")),
+		}, true
+	case "23502":
+		return types.ErrorResponse{
+			Status: http.StatusBadRequest,
+			Code:   utils.CodeValidationFailed,
+			Detail: "payload failed validation",
+			Errors: fieldErrors(columns, "required", utils.T(r, "is required")),
+		}, true
+	case "23514":
+		return types.ErrorResponse{
+			Status: http.StatusBadRequest,
+			Code:   utils.CodeValidationFailed,
+			Detail: utils.T(r, "payload violates %s", pgErr.ConstraintName),
+			Errors: fieldErrors(columns, "check", utils.T(r, "has an invalid value")),
+		}, true
+	}
+	return types.ErrorResponse{}, false
+}
+
+func constraintColumns(pgErr *pgconn.PgError) []string {
+	if pgErr.ColumnName != "" {
+		return []string{pgErr.ColumnName}
+	}
+	match := keyColumns.FindStringSubmatch(pgErr.Detail)
+	if match == nil {
+		return nil
+	}
+	columns := strings.Split(match[1], ",")
+	for i := range columns {
+		columns[i] = strings.TrimSpace(columns[i])
+	}
+	return columns
+}
+
+func fieldErrors(columns []string, code, message string) []types.FieldError {
+	fields := make([]types.FieldError, 0, len(columns))
+	for _, column := range columns {
+		fields = append(fields, types.FieldError{Field: column, Code: code, Message: message})
+	}
+	return fields
+}
@@ -0,0 +1,55 @@
+package crmhttp
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// WantsCSV reports whether the client asked for a CSV export with
+// format=csv.
+func WantsCSV(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "csv"
+}
+
+// WriteCSV answers with header and rows as a CSV attachment named filename.
+// The UTF-8 byte order mark makes spreadsheet programs read Cyrillic names
+// correctly. Cells are escaped with escapeCSVCell.
+func WriteCSV(w http.ResponseWriter, filename string, header []string, rows [][]string) error {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte("\ufeff")); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.Write(escapeCSVRow(header)); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.Write(escapeCSVRow(row)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func escapeCSVRow(row []string) []string {
+	escaped := make([]string, len(row))
+	for i, cell := range row {
+		escaped[i] = escapeCSVCell(cell)
+	}
+	return escaped
+}
+
+// escapeCSVCell prefixes cells that spreadsheet programs would run as a
+// formula with a quote, so user-entered names such as =HYPERLINK(...) are
+// shown as text instead.
+func escapeCSVCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
@@ -0,0 +1,28 @@
+package crmhttp
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteCSVEscapesFormulaCells(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	err := WriteCSV(recorder, "report.csv", []string{"name", "cost"}, [][]string{
+		{"=HYPERLINK(\"http://example.com\")", "10"},
+		{"+1", "-2"},
+		{"@SUM(A1)", "\tx"},
+		{"\rx", "Камера"},
+	})
+	if err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+
+	want := "\ufeffname,cost\n" +
+		"\"'=HYPERLINK(\"\"http://example.com\"\")\",10\n" +
+		"'+1,'-2\n" +
+		"'@SUM(A1),'\tx\n" +
+		"\"'\rx\",Камера\n"
+	if got := recorder.Body.String(); got != want {
+		t.Fatalf("unexpected CSV:\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,168 @@
+package crmhttp
+
+import (
+	"VyacheslavKuchumov/test-backend/utils"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Entity tags of versioned resources look like "v<version>-<hash>". The
+// version is what If-Match is checked against; the hash of the body changes
+// with data joined from other rows, so If-None-Match never answers 304 for a
+// stale representation.
+
+// IfMatchVersion returns the entity version named by the If-Match header, or
+// 0 when the header is absent or "*". A header that is not one of our entity
+// tags is answered with 412 and ok is false. Weak tags never match under the
+// strong comparison RFC 9110 prescribes for If-Match, so they get 412 too.
+func IfMatchVersion(w http.ResponseWriter, r *http.Request) (int, bool) {
+	raw := strings.TrimSpace(r.Header.Get("If-Match"))
+	if raw == "" || raw == "*" {
+		return 0, true
+	}
+	if strings.HasPrefix(raw, "W/") {
+		utils.WriteError(w, r, http.StatusPreconditionFailed, fmt.Errorf("If-Match must be a strong ETag"))
+		return 0, false
+	}
+	version, ok := parseVersionTag(raw)
+	if !ok {
+		utils.WriteError(w, r, http.StatusPreconditionFailed, fmt.Errorf("If-Match must be an ETag returned by this API"))
+		return 0, false
+	}
+	return version, true
+}
+
+func parseVersionTag(tag string) (int, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	tag = strings.TrimPrefix(tag[1:len(tag)-1], "v")
+	if hash := strings.IndexByte(tag, '-'); hash >= 0 {
+		tag = tag[:hash]
+	}
+	version, err := strconv.Atoi(tag)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+// WriteVersioned writes v as a 200 JSON response tagged with its version.
+func WriteVersioned(w http.ResponseWriter, version int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusOK, v)
+		return
+	}
+	body = append(body, '\n')
+	w.Header().Set("ETag", fmt.Sprintf(`"v%d-%s"`, version, bodyHash(body)))
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// WriteUpdated writes items, the list an update answers with, as a 200 JSON
+// response. Its ETag is "v<version>" of the updated entity id, so the client
+// can send the next write's If-Match without reading the entity again.
+func WriteUpdated[T any](w http.ResponseWriter, items []*T, id int, identify func(item *T) (id, version int)) {
+	for _, item := range items {
+		if itemID, version := identify(item); itemID == id {
+			w.Header().Set("ETag", fmt.Sprintf(`"v%d"`, version))
+			break
+		}
+	}
+	utils.WriteJSON(w, http.StatusOK, items)
+}
+
+func bodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ConditionalGet buffers successful GET responses, tags those without an ETag
+// with a weak one derived from the body and answers 304 Not Modified when
+// If-None-Match already names it. Streaming routes must be mounted outside it.
+func ConditionalGet(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		buf := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(buf, r)
+
+		header := w.Header()
+		for key, values := range buf.header {
+			header[key] = values
+		}
+		if buf.status != http.StatusOK {
+			w.WriteHeader(buf.status)
+			w.Write(buf.body.Bytes())
+			return
+		}
+
+		etag := header.Get("ETag")
+		if etag == "" {
+			etag = fmt.Sprintf(`W/"%s"`, bodyHash(buf.body.Bytes()))
+			header.Set("ETag", etag)
+		}
+		if header.Get("Cache-Control") == "" {
+			header.Set("Cache-Control", "private, no-cache")
+		}
+		if noneMatch(r.Header.Get("If-None-Match"), etag) {
+			header.Del("Content-Type")
+			header.Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf.body.Bytes())
+	})
+}
+
+// noneMatch reports whether the If-None-Match header names etag, using the
+// weak comparison RFC 9110 prescribes for it.
+func noneMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	wrote  bool
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.wrote {
+		return
+	}
+	b.status = status
+	b.wrote = true
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.wrote = true
+	return b.body.Write(p)
+}
@@ -0,0 +1,139 @@
+package crmhttp
+
+import (
+	"VyacheslavKuchumov/test-backend/service/tracker"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIfMatchVersion(t *testing.T) {
+	testCases := []struct {
+		header  string
+		version int
+		ok      bool
+	}{
+		{header: "", version: 0, ok: true},
+		{header: "*", version: 0, ok: true},
+		{header: `"v4"`, version: 4, ok: true},
+		{header: `"v12-0a1b2c3d4e5f6a7b"`, version: 12, ok: true},
+		{header: `W/"v3"`, ok: false},
+		{header: `v4`, ok: false},
+		{header: `"abc"`, ok: false},
+		{header: `"v0"`, ok: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.header, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/", nil)
+			if tc.header != "" {
+				req.Header.Set("If-Match", tc.header)
+			}
+			rr := httptest.NewRecorder()
+
+			version, ok := IfMatchVersion(rr, req)
+			if ok != tc.ok || version != tc.version {
+				t.Fatalf("expected (%d, %v), got (%d, %v)", tc.version, tc.ok, version, ok)
+			}
+			if !ok && rr.Code != http.StatusPreconditionFailed {
+				t.Fatalf("expected status 412, got %d", rr.Code)
+			}
+		})
+	}
+}
+
+func TestWriteUpdatedTagsTheUpdatedEntity(t *testing.T) {
+	type entity struct{ ID, Version int }
+	items := []*entity{{ID: 1, Version: 3}, {ID: 2, Version: 7}}
+
+	rr := httptest.NewRecorder()
+	WriteUpdated(rr, items, 2, func(item *entity) (int, int) { return item.ID, item.Version })
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	etag := rr.Header().Get("ETag")
+	if etag != `"v7"` {
+		t.Fatalf("expected ETag \"v7\", got %q", etag)
+	}
+	if version, ok := parseVersionTag(etag); !ok || version != 7 {
+		t.Fatalf("expected the ETag to be accepted by If-Match, got (%d, %v)", version, ok)
+	}
+
+	rr = httptest.NewRecorder()
+	WriteUpdated(rr, items, 9, func(item *entity) (int, int) { return item.ID, item.Version })
+	if etag := rr.Header().Get("ETag"); etag != "" {
+		t.Fatalf("expected no ETag for an entity missing from the list, got %q", etag)
+	}
+}
+
+func TestWriteStoreErrorMapsVersionConflict(t *testing.T) {
+	rr := httptest.NewRecorder()
+	WriteStoreError(rr, httptest.NewRequest(http.MethodPut, "/", nil), tracker.ErrVersionConflict)
+
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected status 412, got %d", rr.Code)
+	}
+}
+
+func TestConditionalGetAnswersNotModified(t *testing.T) {
+	handler := ConditionalGet(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteVersioned(w, 2, map[string]string{"draft_name": "Night shoot"})
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with ETag, got %d %q", rr.Code, etag)
+	}
+	if version, ok := parseVersionTag(etag); !ok || version != 2 {
+		t.Fatalf("expected ETag of version 2, got %q", etag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Fatalf("expected empty 304, got %d %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestConditionalGetTagsUnversionedResponses(t *testing.T) {
+	body := "[]\n"
+	handler := ConditionalGet(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	etag := rr.Header().Get("ETag")
+	if etag == "" || etag[:2] != "W/" {
+		t.Fatalf("expected weak ETag, got %q", etag)
+	}
+	if rr.Body.String() != body {
+		t.Fatalf("expected body to pass through, got %q", rr.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", rr.Code)
+	}
+}
+
+func TestConditionalGetPassesErrorsThrough(t *testing.T) {
+	handler := ConditionalGet(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", "*")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound || rr.Header().Get("ETag") != "" {
+		t.Fatalf("expected untagged 404, got %d %q", rr.Code, rr.Header().Get("ETag"))
+	}
+}
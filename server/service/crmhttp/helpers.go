@@ -2,23 +2,27 @@ package crmhttp
 
 import (
 	"VyacheslavKuchumov/test-backend/service/auth"
+	"VyacheslavKuchumov/test-backend/service/logging"
 	"VyacheslavKuchumov/test-backend/service/tracker"
 	"VyacheslavKuchumov/test-backend/types"
 	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-playground/validator/v10"
 )
 
 func RequireAuth(w http.ResponseWriter, r *http.Request) bool {
 	userID := auth.GetUserIDFromContext(r.Context())
 	if userID <= 0 {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
+		utils.WriteError(w, r, http.StatusForbidden, fmt.Errorf("permission denied"))
 		return false
 	}
 	return true
@@ -26,17 +30,26 @@ func RequireAuth(w http.ResponseWriter, r *http.Request) bool {
 
 func ParseAndValidate(w http.ResponseWriter, r *http.Request, payload any) bool {
 	if err := utils.ParseJSON(r, payload); err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			utils.WriteProblem(w, r, types.ErrorResponse{
+				Status: http.StatusBadRequest,
+				Code:   utils.CodeValidationFailed,
+				Detail: "payload failed validation",
+				Errors: []types.FieldError{{
+					Field:   typeErr.Field,
+					Code:    "type",
+					Message: utils.T(r, "must be a %s", typeErr.Type),
+				}},
+			})
+			return false
+		}
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return false
 	}
 
 	if err := utils.Validate.Struct(payload); err != nil {
-		validationErrs, ok := err.(validator.ValidationErrors)
-		if ok {
-			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", validationErrs))
-			return false
-		}
-		utils.WriteError(w, http.StatusBadRequest, err)
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return false
 	}
 
@@ -47,21 +60,98 @@ func MustPathID(w http.ResponseWriter, r *http.Request, key string) (int, bool)
 	idRaw := chi.URLParam(r, key)
 	id, err := strconv.Atoi(idRaw)
 	if err != nil || id <= 0 {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid id"))
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("invalid id"))
 		return 0, false
 	}
 	return id, true
 }
 
-func WriteStoreError(w http.ResponseWriter, err error) {
+// StatusClientClosedRequest is the non-standard status nginx uses when the
+// client hung up; nobody reads the response, it only shows in the access log.
+const StatusClientClosedRequest = 499
+
+func WriteStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	if problem, ok := constraintProblem(r, err); ok {
+		utils.WriteProblem(w, r, problem)
+		return
+	}
+
+	var dependentsErr *tracker.DependentsError
 	switch {
+	case errors.As(err, &dependentsErr):
+		utils.WriteProblem(w, r, types.ErrorResponse{
+			Status:     http.StatusConflict,
+			Code:       utils.CodeInUse,
+			Detail:     utils.Translate(utils.Locale(r), err),
+			Dependents: dependentsErr.Dependents,
+		})
 	case errors.Is(err, tracker.ErrNotFound):
-		utils.WriteError(w, http.StatusNotFound, err)
+		utils.WriteError(w, r, http.StatusNotFound, err)
 	case errors.Is(err, tracker.ErrInvalidReference):
-		utils.WriteError(w, http.StatusBadRequest, err)
+		utils.WriteProblem(w, r, types.ErrorResponse{Status: http.StatusBadRequest, Code: utils.CodeInvalidReference, Detail: utils.Translate(utils.Locale(r), err)})
+	case errors.Is(err, tracker.ErrAmbiguousReference):
+		utils.WriteProblem(w, r, types.ErrorResponse{Status: http.StatusBadRequest, Code: utils.CodeAmbiguousReference, Detail: utils.Translate(utils.Locale(r), err)})
+	case errors.Is(err, tracker.ErrDuplicateSerial):
+		utils.WriteProblem(w, r, types.ErrorResponse{
+			Status: http.StatusConflict,
+			Code:   utils.CodeDuplicate,
+			Detail: utils.Translate(utils.Locale(r), err),
+			Errors: fieldErrors([]string{"serial_number"}, utils.CodeDuplicate, utils.T(r, "is already taken")),
+		})
+	case errors.Is(err, tracker.ErrInvalidAttribute):
+		utils.WriteProblem(w, r, types.ErrorResponse{Status: http.StatusBadRequest, Code: utils.CodeValidationFailed, Detail: utils.Translate(utils.Locale(r), err)})
+	case errors.Is(err, tracker.ErrTrashed):
+		utils.WriteProblem(w, r, types.ErrorResponse{Status: http.StatusConflict, Code: utils.CodeTrashed, Detail: utils.Translate(utils.Locale(r), err)})
+	case errors.Is(err, tracker.ErrInTransfer):
+		utils.WriteProblem(w, r, types.ErrorResponse{Status: http.StatusConflict, Code: utils.CodeInTransfer, Detail: utils.Translate(utils.Locale(r), err)})
+	case errors.Is(err, tracker.ErrInvalidTransition):
+		utils.WriteProblem(w, r, types.ErrorResponse{Status: http.StatusConflict, Code: utils.CodeInvalidTransition, Detail: utils.Translate(utils.Locale(r), err)})
+	case errors.Is(err, tracker.ErrInsufficientStock):
+		utils.WriteProblem(w, r, types.ErrorResponse{Status: http.StatusConflict, Code: utils.CodeInsufficientStock, Detail: utils.Translate(utils.Locale(r), err)})
+	case errors.Is(err, tracker.ErrVersionConflict):
+		utils.WriteError(w, r, http.StatusPreconditionFailed, fmt.Errorf("resource was modified by another request, reload it and retry"))
+	case errors.Is(err, context.DeadlineExceeded):
+		slog.WarnContext(r.Context(), "request timed out", "route", routePattern(r), "error", err)
+		utils.WriteError(w, r, http.StatusGatewayTimeout, fmt.Errorf("request timed out"))
+	case errors.Is(err, context.Canceled):
+		utils.WriteError(w, r, StatusClientClosedRequest, fmt.Errorf("request cancelled"))
 	default:
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		WriteInternalError(w, r, err)
+	}
+}
+
+// WriteInternalError logs err with the request context and answers with a
+// generic 500 that only carries the request ID for correlation.
+func WriteInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "request failed", "route", routePattern(r), "error", err)
+	utils.WriteProblem(w, r, types.ErrorResponse{
+		Status:    http.StatusInternalServerError,
+		Detail:    "internal server error",
+		RequestID: logging.RequestID(r.Context()),
+	})
+}
+
+// QueryTimeout bounds the request context, and with it every query the
+// request runs, to timeout. A zero timeout disables it. Long-lived routes such
+// as the event stream must be mounted outside it.
+func QueryTimeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		return rctx.RoutePattern()
 	}
+	return r.URL.Path
 }
 
 func ParseListQuery(r *http.Request) types.ListQuery {
@@ -2,10 +2,19 @@ package crmhttp
 
 import (
 	"VyacheslavKuchumov/test-backend/service/tracker"
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 func TestWriteStoreErrorMapsStatuses(t *testing.T) {
@@ -24,6 +33,21 @@ func TestWriteStoreErrorMapsStatuses(t *testing.T) {
 			err:        tracker.ErrInvalidReference,
 			statusCode: http.StatusBadRequest,
 		},
+		{
+			name:       "ambiguous reference",
+			err:        tracker.ErrAmbiguousReference,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid attribute",
+			err:        fmt.Errorf("create equipment: %w", tracker.ErrInvalidAttribute),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "query timed out",
+			err:        fmt.Errorf("list equipment: %w", context.DeadlineExceeded),
+			statusCode: http.StatusGatewayTimeout,
+		},
 		{
 			name:       "unexpected error",
 			err:        errors.New("unexpected failure"),
@@ -34,7 +58,7 @@ func TestWriteStoreErrorMapsStatuses(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			rr := httptest.NewRecorder()
-			WriteStoreError(rr, tc.err)
+			WriteStoreError(rr, httptest.NewRequest(http.MethodGet, "/", nil), tc.err)
 
 			if rr.Code != tc.statusCode {
 				t.Fatalf("expected status %d, got %d", tc.statusCode, rr.Code)
@@ -42,3 +66,176 @@ func TestWriteStoreErrorMapsStatuses(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteStoreErrorHidesInternalCause(t *testing.T) {
+	rr := httptest.NewRecorder()
+	WriteStoreError(rr, httptest.NewRequest(http.MethodGet, "/", nil), errors.New("pq: relation \"secret_table\" does not exist"))
+
+	if strings.Contains(rr.Body.String(), "secret_table") {
+		t.Fatalf("internal error leaked to client: %s", rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), "internal server error") {
+		t.Fatalf("expected generic message, got %s", rr.Body.String())
+	}
+}
+
+func TestQueryTimeoutSetsRequestDeadline(t *testing.T) {
+	var deadline time.Time
+	var hasDeadline bool
+	handler := QueryTimeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, hasDeadline = r.Context().Deadline()
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !hasDeadline || time.Until(deadline) > time.Second {
+		t.Fatalf("expected a deadline within 1s, got %v (set: %v)", deadline, hasDeadline)
+	}
+}
+
+func TestWriteStoreErrorMapsConstraintViolations(t *testing.T) {
+	testCases := []struct {
+		name       string
+		err        error
+		statusCode int
+		code       string
+		field      string
+	}{
+		{
+			name:       "unique violation",
+			err:        &pgconn.PgError{Code: "23505", Detail: "Key (serial_number)=(SN-1) already exists."},
+			statusCode: http.StatusConflict,
+			code:       utils.CodeDuplicate,
+			field:      "serial_number",
+		},
+		{
+			name:       "duplicate serial number",
+			err:        fmt.Errorf("create equipment: %w", tracker.ErrDuplicateSerial),
+			statusCode: http.StatusConflict,
+			code:       utils.CodeDuplicate,
+			field:      "serial_number",
+		},
+		{
+			name:       "row still referenced",
+			err:        fmt.Errorf("delete set type: %w: %w", tracker.ErrInUse, &pgconn.PgError{Code: "23503", TableName: "equipment_sets", Detail: `Key (set_type_id)=(3) is still referenced from table "equipment_sets".`}),
+			statusCode: http.StatusConflict,
+			code:       utils.CodeInUse,
+			field:      "set_type_id",
+		},
+		{
+			name:       "missing reference",
+			err:        &pgconn.PgError{Code: "23503", TableName: "equipment", Detail: `Key (storage_id)=(99) is not present in table "warehouses".`},
+			statusCode: http.StatusConflict,
+			code:       utils.CodeInvalidReference,
+			field:      "storage_id",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			WriteStoreError(rr, httptest.NewRequest(http.MethodPost, "/", nil), tc.err)
+
+			problem := decodeProblem(t, rr)
+			if rr.Code != tc.statusCode || problem.Code != tc.code {
+				t.Fatalf("expected %d %s, got %d %s", tc.statusCode, tc.code, rr.Code, problem.Code)
+			}
+			if len(problem.Errors) != 1 || problem.Errors[0].Field != tc.field {
+				t.Fatalf("expected field %s, got %+v", tc.field, problem.Errors)
+			}
+		})
+	}
+}
+
+func TestWriteStoreErrorNamesConflicts(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{
+			name: "trashed",
+			err:  fmt.Errorf("add equipment to project: %w", tracker.ErrTrashed),
+			code: utils.CodeTrashed,
+		},
+		{
+			name: "in transfer",
+			err:  utils.Errorf("%w: equipment %d is on transfer %d", tracker.ErrInTransfer, 5, 2),
+			code: utils.CodeInTransfer,
+		},
+		{
+			name: "invalid transition",
+			err:  fmt.Errorf("close stocktake: %w", tracker.ErrInvalidTransition),
+			code: utils.CodeInvalidTransition,
+		},
+		{
+			name: "insufficient stock",
+			err:  fmt.Errorf("reserve: %w", tracker.ErrInsufficientStock),
+			code: utils.CodeInsufficientStock,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			WriteStoreError(rr, httptest.NewRequest(http.MethodPost, "/", nil), tc.err)
+
+			problem := decodeProblem(t, rr)
+			if rr.Code != http.StatusConflict || problem.Code != tc.code {
+				t.Fatalf("expected 409 %s, got %d %s", tc.code, rr.Code, problem.Code)
+			}
+		})
+	}
+}
+
+func TestWriteStoreErrorListsDependents(t *testing.T) {
+	err := &tracker.DependentsError{
+		Dependents: []types.Dependent{{Kind: "equipment", Count: 12}},
+		Summary:    utils.Errorf("%w: %d equipment items in this warehouse", tracker.ErrInUse, 12),
+	}
+	req := httptest.NewRequest(http.MethodDelete, "/", nil)
+	req.Header.Set("Accept-Language", "ru")
+	rr := httptest.NewRecorder()
+	WriteStoreError(rr, req, fmt.Errorf("delete warehouse: %w", err))
+
+	problem := decodeProblem(t, rr)
+	if rr.Code != http.StatusConflict || problem.Code != utils.CodeInUse {
+		t.Fatalf("expected 409 in_use, got %d %s", rr.Code, problem.Code)
+	}
+	if len(problem.Dependents) != 1 || problem.Dependents[0] != (types.Dependent{Kind: "equipment", Count: 12}) {
+		t.Fatalf("unexpected dependents %+v", problem.Dependents)
+	}
+	if problem.Detail != "запись используется: единиц оборудования на этом складе: 12" {
+		t.Fatalf("unexpected detail %q", problem.Detail)
+	}
+}
+
+func TestParseAndValidateReportsFieldErrors(t *testing.T) {
+	body := strings.NewReader(`{"project_name": "", "project_type_name": "Concert", "shooting_start_date": "2026-01-01", "shooting_end_date": "2026-01-02"}`)
+	rr := httptest.NewRecorder()
+
+	var payload types.ProjectPayload
+	if ParseAndValidate(rr, httptest.NewRequest(http.MethodPost, "/", body), &payload) {
+		t.Fatal("expected validation to fail")
+	}
+
+	problem := decodeProblem(t, rr)
+	if rr.Code != http.StatusBadRequest || problem.Code != utils.CodeValidationFailed {
+		t.Fatalf("expected 400 validation_failed, got %d %s", rr.Code, problem.Code)
+	}
+	if len(problem.Errors) == 0 || problem.Errors[0].Field != "project_name" || problem.Errors[0].Code != "required" {
+		t.Fatalf("expected project_name to be reported as required, got %+v", problem.Errors)
+	}
+}
+
+func decodeProblem(t *testing.T, rr *httptest.ResponseRecorder) types.ErrorResponse {
+	t.Helper()
+	if got := rr.Header().Get("Content-Type"); got != utils.ProblemContentType {
+		t.Fatalf("expected %s, got %s", utils.ProblemContentType, got)
+	}
+	var problem types.ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+		t.Fatal(err)
+	}
+	return problem
+}
@@ -4,18 +4,19 @@ import (
 	"VyacheslavKuchumov/test-backend/service/crmhttp"
 	"VyacheslavKuchumov/test-backend/types"
 	"VyacheslavKuchumov/test-backend/utils"
+	"context"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type Store interface {
-	SearchDrafts(query types.ListQuery) ([]*types.Draft, int, error)
-	ListDrafts() ([]*types.Draft, error)
-	GetDraftByID(id int) (*types.Draft, error)
-	CreateDraft(payload types.DraftPayload) ([]*types.Draft, error)
-	UpdateDraft(id int, payload types.DraftPayload) ([]*types.Draft, error)
-	DeleteDraft(id int) ([]*types.Draft, error)
+	SearchDrafts(ctx context.Context, query types.ListQuery) ([]*types.Draft, int, error)
+	ListDrafts(ctx context.Context) ([]*types.Draft, error)
+	GetDraftByID(ctx context.Context, id int) (*types.Draft, error)
+	CreateDraft(ctx context.Context, payload types.DraftPayload) ([]*types.Draft, error)
+	UpdateDraft(ctx context.Context, id, version int, payload types.DraftPayload) ([]*types.Draft, error)
+	DeleteDraft(ctx context.Context, id, version int) ([]*types.Draft, error)
 }
 
 type Service struct {
@@ -41,9 +42,9 @@ func (s *Service) HandleGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	query := crmhttp.ParseListQuery(r)
-	items, total, err := s.store.SearchDrafts(query)
+	items, total, err := s.store.SearchDrafts(r.Context(), query)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(items, query.Page, query.PerPage, total))
@@ -57,12 +58,12 @@ func (s *Service) HandleGetByID(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	item, err := s.store.GetDraftByID(id)
+	item, err := s.store.GetDraftByID(r.Context(), id)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, item)
+	crmhttp.WriteVersioned(w, item.Version, item)
 }
 
 func (s *Service) HandleCreate(w http.ResponseWriter, r *http.Request) {
@@ -73,9 +74,9 @@ func (s *Service) HandleCreate(w http.ResponseWriter, r *http.Request) {
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	items, err := s.store.CreateDraft(payload)
+	items, err := s.store.CreateDraft(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusCreated, items)
@@ -89,16 +90,20 @@ func (s *Service) HandleUpdate(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
 	var payload types.DraftPayload
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	items, err := s.store.UpdateDraft(id, payload)
+	items, err := s.store.UpdateDraft(r.Context(), id, version, payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, items)
+	crmhttp.WriteUpdated(w, items, id, func(item *types.Draft) (int, int) { return item.DraftID, item.Version })
 }
 
 func (s *Service) HandleDelete(w http.ResponseWriter, r *http.Request) {
@@ -109,9 +114,13 @@ func (s *Service) HandleDelete(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	items, err := s.store.DeleteDraft(id)
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	items, err := s.store.DeleteDraft(r.Context(), id, version)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, items)
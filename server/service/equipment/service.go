@@ -4,20 +4,27 @@ import (
 	"VyacheslavKuchumov/test-backend/service/crmhttp"
 	"VyacheslavKuchumov/test-backend/types"
 	"VyacheslavKuchumov/test-backend/utils"
+	"context"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type Store interface {
-	SearchEquipment(query types.ListQuery) ([]*types.Equipment, int, error)
-	SearchEquipmentBySetID(setID int, query types.ListQuery) ([]*types.Equipment, int, error)
-	ListEquipment() ([]*types.Equipment, error)
-	ListEquipmentBySetID(setID int) ([]*types.Equipment, error)
-	GetEquipmentByID(id int) (*types.Equipment, error)
-	CreateEquipment(payload types.EquipmentPayload) ([]*types.Equipment, error)
-	UpdateEquipment(id int, payload types.EquipmentPayload) ([]*types.Equipment, error)
-	DeleteEquipment(id int) error
+	SearchEquipment(ctx context.Context, filter types.EquipmentFilter, query types.ListQuery) ([]*types.Equipment, int, error)
+	SearchEquipmentBySetID(ctx context.Context, setID int, filter types.EquipmentFilter, query types.ListQuery) ([]*types.Equipment, int, error)
+	ListEquipment(ctx context.Context) ([]*types.Equipment, error)
+	ListEquipmentBySetID(ctx context.Context, setID int) ([]*types.Equipment, error)
+	GetEquipmentByID(ctx context.Context, id int) (*types.Equipment, error)
+	CreateEquipment(ctx context.Context, payload types.EquipmentPayload) ([]*types.Equipment, error)
+	UpdateEquipment(ctx context.Context, id, version int, payload types.EquipmentPayload) ([]*types.Equipment, error)
+	DeleteEquipment(ctx context.Context, id, version int) error
+	SearchEquipmentMovements(ctx context.Context, equipmentID int, query types.ListQuery) ([]*types.EquipmentMovement, int, error)
+	MoveEquipment(ctx context.Context, payload types.EquipmentMovePayload) ([]*types.EquipmentMovement, error)
+	SearchSerialDuplicates(ctx context.Context, acrossSets bool, query types.ListQuery) ([]*types.SerialDuplicate, int, error)
+	MergeEquipment(ctx context.Context, id, version, targetID int) (*types.Equipment, error)
 }
 
 type Service struct {
@@ -33,9 +40,13 @@ func RegisterRoutes(r chi.Router, service *Service) {
 		rt.Get("/", service.HandleGet)
 		rt.Get("/set/{id}", service.HandleGetBySetID)
 		rt.Get("/search/{id}", service.HandleGetByID)
+		rt.Get("/duplicates", service.HandleGetDuplicates)
+		rt.Get("/{id}/movements", service.HandleGetMovements)
 		rt.Post("/", service.HandleCreate)
+		rt.Post("/move", service.HandleMove)
 		rt.Put("/{id}", service.HandleUpdate)
 		rt.Delete("/{id}", service.HandleDelete)
+		rt.Post("/{id}/merge", service.HandleMerge)
 	})
 }
 
@@ -44,9 +55,9 @@ func (s *Service) HandleGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	query := crmhttp.ParseListQuery(r)
-	items, total, err := s.store.SearchEquipment(query)
+	items, total, err := s.store.SearchEquipment(r.Context(), parseFilter(r), query)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(items, query.Page, query.PerPage, total))
@@ -61,9 +72,9 @@ func (s *Service) HandleGetBySetID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	query := crmhttp.ParseListQuery(r)
-	items, total, err := s.store.SearchEquipmentBySetID(id, query)
+	items, total, err := s.store.SearchEquipmentBySetID(r.Context(), id, parseFilter(r), query)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(items, query.Page, query.PerPage, total))
@@ -77,12 +88,12 @@ func (s *Service) HandleGetByID(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	item, err := s.store.GetEquipmentByID(id)
+	item, err := s.store.GetEquipmentByID(r.Context(), id)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, item)
+	crmhttp.WriteVersioned(w, item.Version, item)
 }
 
 func (s *Service) HandleCreate(w http.ResponseWriter, r *http.Request) {
@@ -93,9 +104,9 @@ func (s *Service) HandleCreate(w http.ResponseWriter, r *http.Request) {
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	items, err := s.store.CreateEquipment(payload)
+	items, err := s.store.CreateEquipment(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusCreated, items)
@@ -109,16 +120,20 @@ func (s *Service) HandleUpdate(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
 	var payload types.EquipmentPayload
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	items, err := s.store.UpdateEquipment(id, payload)
+	items, err := s.store.UpdateEquipment(r.Context(), id, version, payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, items)
+	crmhttp.WriteUpdated(w, items, id, func(item *types.Equipment) (int, int) { return item.EquipmentID, item.Version })
 }
 
 func (s *Service) HandleDelete(w http.ResponseWriter, r *http.Request) {
@@ -129,9 +144,101 @@ func (s *Service) HandleDelete(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	if err := s.store.DeleteEquipment(id); err != nil {
-		crmhttp.WriteStoreError(w, err)
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteEquipment(r.Context(), id, version); err != nil {
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (s *Service) HandleGetMovements(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	query := crmhttp.ParseListQuery(r)
+	items, total, err := s.store.SearchEquipmentMovements(r.Context(), id, query)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(items, query.Page, query.PerPage, total))
+}
+
+func (s *Service) HandleMove(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	var payload types.EquipmentMovePayload
+	if !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	movements, err := s.store.MoveEquipment(r.Context(), payload)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, movements)
+}
+
+func (s *Service) HandleGetDuplicates(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	acrossSets, _ := strconv.ParseBool(r.URL.Query().Get("across_sets"))
+	query := crmhttp.ParseListQuery(r)
+	groups, total, err := s.store.SearchSerialDuplicates(r.Context(), acrossSets, query)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(groups, query.Page, query.PerPage, total))
+}
+
+func (s *Service) HandleMerge(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	var payload types.MergePayload
+	if !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	item, err := s.store.MergeEquipment(r.Context(), id, version, payload.TargetID)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	crmhttp.WriteVersioned(w, item.Version, item)
+}
+
+// parseFilter reads attribute filters given as attr.<key>=<value> query
+// parameters.
+func parseFilter(r *http.Request) types.EquipmentFilter {
+	filter := types.EquipmentFilter{}
+	for name, values := range r.URL.Query() {
+		key, ok := strings.CutPrefix(name, "attr.")
+		if !ok || key == "" || len(values) == 0 {
+			continue
+		}
+		if filter.Attributes == nil {
+			filter.Attributes = map[string]string{}
+		}
+		filter.Attributes[key] = values[0]
+	}
+	return filter
+}
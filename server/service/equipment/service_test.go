@@ -0,0 +1,119 @@
+package equipment
+
+import (
+	"VyacheslavKuchumov/test-backend/service/auth"
+	"VyacheslavKuchumov/test-backend/service/tracker"
+	"VyacheslavKuchumov/test-backend/types"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type mockStore struct {
+	acrossSets bool
+	version    int
+	targetID   int
+}
+
+func (s *mockStore) SearchEquipment(ctx context.Context, filter types.EquipmentFilter, query types.ListQuery) ([]*types.Equipment, int, error) {
+	return []*types.Equipment{}, 0, nil
+}
+
+func (s *mockStore) SearchEquipmentBySetID(ctx context.Context, setID int, filter types.EquipmentFilter, query types.ListQuery) ([]*types.Equipment, int, error) {
+	return []*types.Equipment{}, 0, nil
+}
+
+func (s *mockStore) ListEquipment(ctx context.Context) ([]*types.Equipment, error) {
+	return []*types.Equipment{}, nil
+}
+
+func (s *mockStore) ListEquipmentBySetID(ctx context.Context, setID int) ([]*types.Equipment, error) {
+	return []*types.Equipment{}, nil
+}
+
+func (s *mockStore) GetEquipmentByID(ctx context.Context, id int) (*types.Equipment, error) {
+	return nil, tracker.ErrNotFound
+}
+
+func (s *mockStore) CreateEquipment(ctx context.Context, payload types.EquipmentPayload) ([]*types.Equipment, error) {
+	return nil, tracker.ErrDuplicateSerial
+}
+
+func (s *mockStore) UpdateEquipment(ctx context.Context, id, version int, payload types.EquipmentPayload) ([]*types.Equipment, error) {
+	return []*types.Equipment{}, nil
+}
+
+func (s *mockStore) DeleteEquipment(ctx context.Context, id, version int) error {
+	return nil
+}
+
+func (s *mockStore) SearchEquipmentMovements(ctx context.Context, equipmentID int, query types.ListQuery) ([]*types.EquipmentMovement, int, error) {
+	return []*types.EquipmentMovement{}, 0, nil
+}
+
+func (s *mockStore) MoveEquipment(ctx context.Context, payload types.EquipmentMovePayload) ([]*types.EquipmentMovement, error) {
+	return []*types.EquipmentMovement{}, nil
+}
+
+func (s *mockStore) SearchSerialDuplicates(ctx context.Context, acrossSets bool, query types.ListQuery) ([]*types.SerialDuplicate, int, error) {
+	s.acrossSets = acrossSets
+	return []*types.SerialDuplicate{}, 0, nil
+}
+
+func (s *mockStore) MergeEquipment(ctx context.Context, id, version, targetID int) (*types.Equipment, error) {
+	s.version = version
+	s.targetID = targetID
+	return &types.Equipment{EquipmentID: targetID, Version: 2}, nil
+}
+
+func serve(store Store, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	r := chi.NewRouter()
+	RegisterRoutes(r, NewService(store))
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestDuplicatesCanSpanSets(t *testing.T) {
+	store := &mockStore{}
+
+	if rr := serve(store, http.MethodGet, "/equipment/duplicates", "", nil); rr.Code != http.StatusOK || store.acrossSets {
+		t.Fatalf("expected a per-set report, got %d across sets %v", rr.Code, store.acrossSets)
+	}
+	if rr := serve(store, http.MethodGet, "/equipment/duplicates?across_sets=true", "", nil); rr.Code != http.StatusOK || !store.acrossSets {
+		t.Fatalf("expected a report across sets, got %d across sets %v", rr.Code, store.acrossSets)
+	}
+}
+
+func TestMergeNeedsTarget(t *testing.T) {
+	store := &mockStore{}
+
+	if rr := serve(store, http.MethodPost, "/equipment/4/merge", `{}`, nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a target, got %d", rr.Code)
+	}
+	rr := serve(store, http.MethodPost, "/equipment/4/merge", `{"target_id":7}`, http.Header{"If-Match": {`"v3"`}})
+	if rr.Code != http.StatusOK || store.version != 3 || store.targetID != 7 {
+		t.Fatalf("expected a merge into 7 at version 3, got %d with %+v", rr.Code, store)
+	}
+}
+
+func TestDuplicateSerialIsConflict(t *testing.T) {
+	body := `{"equipment_name":"Camera","serial_number":"SN 1","equipment_set_id":1,"warehouse_id":1}`
+	if rr := serve(&mockStore{}, http.MethodPost, "/equipment", body, nil); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a duplicate serial number, got %d", rr.Code)
+	}
+}
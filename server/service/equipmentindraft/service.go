@@ -4,18 +4,19 @@ import (
 	"VyacheslavKuchumov/test-backend/service/crmhttp"
 	"VyacheslavKuchumov/test-backend/types"
 	"VyacheslavKuchumov/test-backend/utils"
+	"context"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type Store interface {
-	GetEquipmentInDraft(draftID int) (*types.EquipmentInDraftResponse, error)
-	AddEquipmentToDraft(payload types.EquipmentInDraftPayload) (*types.EquipmentInDraftResponse, error)
-	RemoveEquipmentFromDraft(payload types.DraftEquipmentDeletePayload) (*types.EquipmentInDraftResponse, error)
-	AddSetToDraft(payload types.DraftSetPayload) (*types.EquipmentInDraftResponse, error)
-	RemoveSetFromDraft(payload types.DraftSetDeletePayload) (*types.EquipmentInDraftResponse, error)
-	GetAvailableDraftEquipmentInSet(payload types.DraftSetPayload) ([]*types.Equipment, error)
+	GetEquipmentInDraft(ctx context.Context, draftID int) (*types.EquipmentInDraftResponse, error)
+	AddEquipmentToDraft(ctx context.Context, payload types.EquipmentInDraftPayload) (*types.EquipmentInDraftResponse, error)
+	RemoveEquipmentFromDraft(ctx context.Context, payload types.DraftEquipmentDeletePayload) (*types.EquipmentInDraftResponse, error)
+	AddSetToDraft(ctx context.Context, payload types.DraftSetPayload) (*types.EquipmentInDraftResponse, error)
+	RemoveSetFromDraft(ctx context.Context, payload types.DraftSetDeletePayload) (*types.EquipmentInDraftResponse, error)
+	GetAvailableDraftEquipmentInSet(ctx context.Context, payload types.DraftSetPayload) ([]*types.Equipment, error)
 }
 
 type Service struct {
@@ -45,9 +46,9 @@ func (s *Service) HandleGet(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	response, err := s.store.GetEquipmentInDraft(draftID)
+	response, err := s.store.GetEquipmentInDraft(r.Context(), draftID)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, response)
@@ -61,9 +62,9 @@ func (s *Service) HandleAddEquipment(w http.ResponseWriter, r *http.Request) {
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	response, err := s.store.AddEquipmentToDraft(payload)
+	response, err := s.store.AddEquipmentToDraft(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, response)
@@ -77,9 +78,9 @@ func (s *Service) HandleRemoveEquipment(w http.ResponseWriter, r *http.Request)
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	response, err := s.store.RemoveEquipmentFromDraft(payload)
+	response, err := s.store.RemoveEquipmentFromDraft(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, response)
@@ -93,9 +94,9 @@ func (s *Service) HandleAddSet(w http.ResponseWriter, r *http.Request) {
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	response, err := s.store.AddSetToDraft(payload)
+	response, err := s.store.AddSetToDraft(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, response)
@@ -109,9 +110,9 @@ func (s *Service) HandleRemoveSet(w http.ResponseWriter, r *http.Request) {
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	response, err := s.store.RemoveSetFromDraft(payload)
+	response, err := s.store.RemoveSetFromDraft(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, response)
@@ -125,9 +126,9 @@ func (s *Service) HandleGetAvailableInSet(w http.ResponseWriter, r *http.Request
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	response, err := s.store.GetAvailableDraftEquipmentInSet(payload)
+	response, err := s.store.GetAvailableDraftEquipmentInSet(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, response)
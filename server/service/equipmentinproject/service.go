@@ -4,22 +4,23 @@ import (
 	"VyacheslavKuchumov/test-backend/service/crmhttp"
 	"VyacheslavKuchumov/test-backend/types"
 	"VyacheslavKuchumov/test-backend/utils"
+	"context"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type Store interface {
-	GetEquipmentInProject(projectID int) (*types.EquipmentInProjectResponse, error)
-	AddEquipmentToProject(payload types.EquipmentInProjectPayload) (*types.EquipmentInProjectResponse, error)
-	RemoveEquipmentFromProject(payload types.ProjectEquipmentDeletePayload) (*types.EquipmentInProjectResponse, error)
-	AddSetToProject(payload types.ProjectSetPayload) (*types.EquipmentInProjectResponse, error)
-	RemoveSetFromProject(payload types.ProjectSetDeletePayload) (*types.EquipmentInProjectResponse, error)
-	GetAvailableProjectEquipmentInSet(payload types.ProjectSetPayload) ([]*types.Equipment, error)
-	GetConflictingEquipment(projectID int) ([]*types.EquipmentConflict, error)
-	AddDraftToProject(payload types.AddDraftToProjectPayload) (*types.EquipmentInProjectResponse, error)
-	ResetEquipmentInProject(projectID int) error
-	GetConflictingProjects() ([]*types.ConflictingProject, error)
+	GetEquipmentInProject(ctx context.Context, projectID int) (*types.EquipmentInProjectResponse, error)
+	AddEquipmentToProject(ctx context.Context, payload types.EquipmentInProjectPayload) (*types.EquipmentInProjectResponse, error)
+	RemoveEquipmentFromProject(ctx context.Context, payload types.ProjectEquipmentDeletePayload) (*types.EquipmentInProjectResponse, error)
+	AddSetToProject(ctx context.Context, payload types.ProjectSetPayload) (*types.EquipmentInProjectResponse, error)
+	RemoveSetFromProject(ctx context.Context, payload types.ProjectSetDeletePayload) (*types.EquipmentInProjectResponse, error)
+	GetAvailableProjectEquipmentInSet(ctx context.Context, payload types.ProjectSetPayload) ([]*types.Equipment, error)
+	GetConflictingEquipment(ctx context.Context, projectID int) ([]*types.EquipmentConflict, error)
+	AddDraftToProject(ctx context.Context, payload types.AddDraftToProjectPayload) (*types.EquipmentInProjectResponse, error)
+	ResetEquipmentInProject(ctx context.Context, projectID int) error
+	GetConflictingProjects(ctx context.Context) ([]*types.ConflictingProject, error)
 }
 
 type Service struct {
@@ -53,9 +54,9 @@ func (s *Service) HandleGet(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	response, err := s.store.GetEquipmentInProject(projectID)
+	response, err := s.store.GetEquipmentInProject(r.Context(), projectID)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, response)
@@ -69,9 +70,9 @@ func (s *Service) HandleAddEquipment(w http.ResponseWriter, r *http.Request) {
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	response, err := s.store.AddEquipmentToProject(payload)
+	response, err := s.store.AddEquipmentToProject(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, response)
@@ -85,9 +86,9 @@ func (s *Service) HandleRemoveEquipment(w http.ResponseWriter, r *http.Request)
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	response, err := s.store.RemoveEquipmentFromProject(payload)
+	response, err := s.store.RemoveEquipmentFromProject(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, response)
@@ -101,9 +102,9 @@ func (s *Service) HandleAddSet(w http.ResponseWriter, r *http.Request) {
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	response, err := s.store.AddSetToProject(payload)
+	response, err := s.store.AddSetToProject(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, response)
@@ -117,9 +118,9 @@ func (s *Service) HandleRemoveSet(w http.ResponseWriter, r *http.Request) {
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	response, err := s.store.RemoveSetFromProject(payload)
+	response, err := s.store.RemoveSetFromProject(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, response)
@@ -133,9 +134,9 @@ func (s *Service) HandleGetAvailableInSet(w http.ResponseWriter, r *http.Request
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	response, err := s.store.GetAvailableProjectEquipmentInSet(payload)
+	response, err := s.store.GetAvailableProjectEquipmentInSet(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, response)
@@ -151,9 +152,9 @@ func (s *Service) HandleGetConflictingEquipment(w http.ResponseWriter, r *http.R
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	response, err := s.store.GetConflictingEquipment(payload.ProjectID)
+	response, err := s.store.GetConflictingEquipment(r.Context(), payload.ProjectID)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, response)
@@ -167,8 +168,8 @@ func (s *Service) HandleReset(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	if err := s.store.ResetEquipmentInProject(projectID); err != nil {
-		crmhttp.WriteStoreError(w, err)
+	if err := s.store.ResetEquipmentInProject(r.Context(), projectID); err != nil {
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "equipment reset"})
@@ -182,9 +183,9 @@ func (s *Service) HandleAddDraft(w http.ResponseWriter, r *http.Request) {
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	response, err := s.store.AddDraftToProject(payload)
+	response, err := s.store.AddDraftToProject(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, response)
@@ -194,9 +195,9 @@ func (s *Service) HandleGetConflictingProjects(w http.ResponseWriter, r *http.Re
 	if !crmhttp.RequireAuth(w, r) {
 		return
 	}
-	response, err := s.store.GetConflictingProjects()
+	response, err := s.store.GetConflictingProjects(r.Context())
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, response)
@@ -4,20 +4,22 @@ import (
 	"VyacheslavKuchumov/test-backend/service/crmhttp"
 	"VyacheslavKuchumov/test-backend/types"
 	"VyacheslavKuchumov/test-backend/utils"
+	"context"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type Store interface {
-	SearchEquipmentSets(query types.ListQuery) ([]*types.EquipmentSet, int, error)
-	ListEquipmentSets() ([]*types.EquipmentSet, error)
-	GetEquipmentSetByID(id int) (*types.EquipmentSet, error)
-	CreateEquipmentSet(payload types.EquipmentSetPayload) ([]*types.EquipmentSet, error)
-	UpdateEquipmentSet(id int, payload types.EquipmentSetPayload) ([]*types.EquipmentSet, error)
-	DeleteEquipmentSet(id int) ([]*types.EquipmentSet, error)
-	GetEquipmentSetsWithMaintenance() ([]*types.EquipmentSet, error)
-	GetEquipmentSetsWithStorage() ([]*types.EquipmentSetStorageSummary, error)
+	SearchEquipmentSets(ctx context.Context, query types.ListQuery) ([]*types.EquipmentSet, int, error)
+	ListEquipmentSets(ctx context.Context) ([]*types.EquipmentSet, error)
+	GetEquipmentSetByID(ctx context.Context, id int) (*types.EquipmentSet, error)
+	CreateEquipmentSet(ctx context.Context, payload types.EquipmentSetPayload) ([]*types.EquipmentSet, error)
+	UpdateEquipmentSet(ctx context.Context, id, version int, payload types.EquipmentSetPayload) ([]*types.EquipmentSet, error)
+	DeleteEquipmentSet(ctx context.Context, id, version int) ([]*types.EquipmentSet, error)
+	MergeEquipmentSet(ctx context.Context, id, version, targetID int) ([]*types.EquipmentSet, error)
+	GetEquipmentSetsWithMaintenance(ctx context.Context) ([]*types.EquipmentSet, error)
+	GetEquipmentSetsWithStorage(ctx context.Context) ([]*types.EquipmentSetStorageSummary, error)
 }
 
 type Service struct {
@@ -37,6 +39,7 @@ func RegisterRoutes(r chi.Router, service *Service) {
 		rt.Post("/", service.HandleCreate)
 		rt.Put("/{id}", service.HandleUpdate)
 		rt.Delete("/{id}", service.HandleDelete)
+		rt.Post("/{id}/merge", service.HandleMerge)
 	})
 }
 
@@ -45,9 +48,9 @@ func (s *Service) HandleGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	query := crmhttp.ParseListQuery(r)
-	items, total, err := s.store.SearchEquipmentSets(query)
+	items, total, err := s.store.SearchEquipmentSets(r.Context(), query)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(items, query.Page, query.PerPage, total))
@@ -61,21 +64,21 @@ func (s *Service) HandleGetByID(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	item, err := s.store.GetEquipmentSetByID(id)
+	item, err := s.store.GetEquipmentSetByID(r.Context(), id)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, item)
+	crmhttp.WriteVersioned(w, item.Version, item)
 }
 
 func (s *Service) HandleGetWithMaintenance(w http.ResponseWriter, r *http.Request) {
 	if !crmhttp.RequireAuth(w, r) {
 		return
 	}
-	items, err := s.store.GetEquipmentSetsWithMaintenance()
+	items, err := s.store.GetEquipmentSetsWithMaintenance(r.Context())
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, items)
@@ -85,9 +88,9 @@ func (s *Service) HandleGetWithStorage(w http.ResponseWriter, r *http.Request) {
 	if !crmhttp.RequireAuth(w, r) {
 		return
 	}
-	items, err := s.store.GetEquipmentSetsWithStorage()
+	items, err := s.store.GetEquipmentSetsWithStorage(r.Context())
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, items)
@@ -101,9 +104,9 @@ func (s *Service) HandleCreate(w http.ResponseWriter, r *http.Request) {
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	items, err := s.store.CreateEquipmentSet(payload)
+	items, err := s.store.CreateEquipmentSet(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusCreated, items)
@@ -117,16 +120,20 @@ func (s *Service) HandleUpdate(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
 	var payload types.EquipmentSetPayload
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	items, err := s.store.UpdateEquipmentSet(id, payload)
+	items, err := s.store.UpdateEquipmentSet(r.Context(), id, version, payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, items)
+	crmhttp.WriteUpdated(w, items, id, func(item *types.EquipmentSet) (int, int) { return item.EquipmentSetID, item.Version })
 }
 
 func (s *Service) HandleDelete(w http.ResponseWriter, r *http.Request) {
@@ -137,9 +144,37 @@ func (s *Service) HandleDelete(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	items, err := s.store.DeleteEquipmentSet(id)
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	items, err := s.store.DeleteEquipmentSet(r.Context(), id, version)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, items)
+}
+
+func (s *Service) HandleMerge(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	var payload types.MergePayload
+	if !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	items, err := s.store.MergeEquipmentSet(r.Context(), id, version, payload.TargetID)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, items)
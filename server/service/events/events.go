@@ -0,0 +1,123 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type Type string
+
+const (
+	ProjectCreated              Type = "project.created"
+	ProjectUpdated              Type = "project.updated"
+	ProjectDeleted              Type = "project.deleted"
+	ProjectRestored             Type = "project.restored"
+	EquipmentAddedToProject     Type = "equipment_in_project.added"
+	EquipmentRemovedFromProject Type = "equipment_in_project.removed"
+	EquipmentAddedToDraft       Type = "equipment_in_draft.added"
+	EquipmentRemovedFromDraft   Type = "equipment_in_draft.removed"
+	EquipmentCreated            Type = "equipment.created"
+	EquipmentUpdated            Type = "equipment.updated"
+	EquipmentDeleted            Type = "equipment.deleted"
+	EquipmentRestored           Type = "equipment.restored"
+	ConflictDetected            Type = "conflict.detected"
+)
+
+// Types lists every event type that can be emitted, in the order they are
+// documented.
+var Types = []Type{
+	ProjectCreated,
+	ProjectUpdated,
+	ProjectDeleted,
+	ProjectRestored,
+	EquipmentAddedToProject,
+	EquipmentRemovedFromProject,
+	EquipmentAddedToDraft,
+	EquipmentRemovedFromDraft,
+	EquipmentCreated,
+	EquipmentUpdated,
+	EquipmentDeleted,
+	EquipmentRestored,
+	ConflictDetected,
+}
+
+type Event struct {
+	ID           string    `json:"id"`
+	Type         Type      `json:"type"`
+	OccurredAt   time.Time `json:"occurred_at"`
+	ProjectID    int       `json:"project_id,omitempty"`
+	DraftID      int       `json:"draft_id,omitempty"`
+	EquipmentIDs []int     `json:"equipment_ids,omitempty"`
+	Data         any       `json:"data,omitempty"`
+}
+
+func New(eventType Type) Event {
+	return Event{
+		ID:         newID(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+func IsKnownType(eventType string) bool {
+	for _, known := range Types {
+		if string(known) == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type Publisher interface {
+	Publish(event Event)
+}
+
+// Bus fans events out to in-process subscribers. Handlers run synchronously
+// on the publishing goroutine, so they must not block.
+type Bus struct {
+	mu          sync.RWMutex
+	nextID      int
+	subscribers map[int]func(Event)
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: map[int]func(Event){}}
+}
+
+func (b *Bus) Subscribe(handler func(Event)) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = handler
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, id)
+	}
+}
+
+func (b *Bus) Publish(event Event) {
+	b.mu.RLock()
+	handlers := make([]func(Event), 0, len(b.subscribers))
+	for _, handler := range b.subscribers {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+func newID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,108 @@
+package health
+
+import (
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const checkTimeout = 2 * time.Second
+
+// SchemaVersionFunc reports the applied migration version and whether the
+// last migration left the schema dirty.
+type SchemaVersionFunc func(ctx context.Context) (version int, dirty bool, err error)
+
+type Service struct {
+	db              *sql.DB
+	schemaVersion   SchemaVersionFunc
+	requiredVersion int
+	draining        atomic.Bool
+}
+
+func NewService(db *sql.DB, schemaVersion SchemaVersionFunc, requiredVersion int) *Service {
+	return &Service{db: db, schemaVersion: schemaVersion, requiredVersion: requiredVersion}
+}
+
+// RegisterRoutes mounts the probes at the router root, outside /api/v1 and
+// its JWT middleware.
+func RegisterRoutes(r chi.Router, service *Service) {
+	r.Get("/healthz", service.HandleLiveness)
+	r.Get("/readyz", service.HandleReadiness)
+}
+
+// Drain makes readiness fail so load balancers stop routing new requests
+// while the server finishes the ones in flight.
+func (s *Service) Drain() {
+	s.draining.Store(true)
+}
+
+// HandleLiveness reports that the process is serving HTTP. It does not touch
+// the database, so a database outage does not get the container restarted.
+func (s *Service) HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// HandleReadiness reports whether the instance can serve API traffic: the
+// database answers and its schema is migrated to the version this build
+// expects.
+func (s *Service) HandleReadiness(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{
+		"database": "ok",
+		"schema":   "ok",
+	}
+	ready := true
+	fail := func(name string, err error) {
+		checks[name] = err.Error()
+		ready = false
+	}
+
+	if s.draining.Load() {
+		fail("server", fmt.Errorf("shutting down"))
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	if s.db == nil {
+		fail("database", fmt.Errorf("not configured"))
+	} else if err := s.db.PingContext(ctx); err != nil {
+		slog.WarnContext(r.Context(), "readiness database check failed", "error", err)
+		fail("database", fmt.Errorf("unreachable"))
+	}
+
+	if checks["database"] != "ok" {
+		checks["schema"] = "unknown"
+	} else if err := s.checkSchema(ctx); err != nil {
+		fail("schema", err)
+	}
+
+	status := http.StatusOK
+	body := map[string]any{"status": "ready", "checks": checks}
+	if !ready {
+		status = http.StatusServiceUnavailable
+		body["status"] = "not ready"
+	}
+	utils.WriteJSON(w, status, body)
+}
+
+func (s *Service) checkSchema(ctx context.Context) error {
+	version, dirty, err := s.schemaVersion(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "readiness schema check failed", "error", err)
+		return fmt.Errorf("unable to read migration version")
+	}
+	if dirty {
+		return fmt.Errorf("migration %d is dirty", version)
+	}
+	if version < s.requiredVersion {
+		return fmt.Errorf("migration version %d is older than required %d", version, s.requiredVersion)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestLivenessDoesNotNeedDatabase(t *testing.T) {
+	r := chi.NewRouter()
+	RegisterRoutes(r, NewService(nil, nil, 1))
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestReadinessFailsWithoutDatabase(t *testing.T) {
+	service := NewService(nil, nil, 1)
+	service.Drain()
+	r := chi.NewRouter()
+	RegisterRoutes(r, service)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	var body struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body.Status != "not ready" || body.Checks["database"] != "not configured" || body.Checks["server"] != "shutting down" {
+		t.Fatalf("unexpected readiness body %s", rr.Body.String())
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	testCases := []struct {
+		name    string
+		version int
+		dirty   bool
+		err     error
+		ok      bool
+	}{
+		{name: "current", version: 8, ok: true},
+		{name: "newer", version: 9, ok: true},
+		{name: "outdated", version: 7},
+		{name: "dirty", version: 8, dirty: true},
+		{name: "unreadable", err: errors.New("relation does not exist")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := NewService(nil, func(context.Context) (int, bool, error) {
+				return tc.version, tc.dirty, tc.err
+			}, 8)
+
+			err := service.checkSchema(context.Background())
+			if tc.ok && err != nil {
+				t.Fatalf("expected schema to be ready, got %v", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatal("expected schema check to fail")
+			}
+		})
+	}
+}
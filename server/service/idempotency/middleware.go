@@ -0,0 +1,181 @@
+package idempotency
+
+import (
+	"VyacheslavKuchumov/test-backend/service/auth"
+	"VyacheslavKuchumov/test-backend/service/crmhttp"
+	"VyacheslavKuchumov/test-backend/utils"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength   = 255
+	maxRequestBody = 10 << 20
+)
+
+type KeyStore interface {
+	Begin(ctx context.Context, userID int, key, fingerprint string, ttl time.Duration) (*Record, error)
+	Complete(ctx context.Context, userID int, key string, status int, contentType string, body []byte) error
+	Release(ctx context.Context, userID int, key string) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// Middleware makes POST, PUT, PATCH and DELETE requests that carry an
+// Idempotency-Key safe to retry. The first request with a key runs and its
+// response is stored; a retry with the same method, URL and body gets the
+// stored response back without running again. Keys are scoped to the
+// authenticated user and kept for the configured TTL.
+type Middleware struct {
+	store KeyStore
+	ttl   time.Duration
+}
+
+func NewMiddleware(store KeyStore, ttl time.Duration) *Middleware {
+	return &Middleware{store: store, ttl: ttl}
+}
+
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		userID := auth.GetUserIDFromContext(r.Context())
+		if key == "" || userID <= 0 || !mutating(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLength {
+			utils.WriteError(w, r, http.StatusBadRequest, utils.Errorf("%s must be at most %d characters", Header, maxKeyLength))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+		if err != nil {
+			utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("failed to read request body"))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(r, body)
+		existing, err := m.store.Begin(r.Context(), userID, key, fingerprint, m.ttl)
+		if err != nil {
+			crmhttp.WriteStoreError(w, r, err)
+			return
+		}
+		if existing != nil {
+			replay(w, r, existing, fingerprint)
+			return
+		}
+
+		// The response is stored even when the client has gone away meanwhile:
+		// its retry is exactly what the key is for.
+		storeCtx := context.WithoutCancel(r.Context())
+		recorder := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		finished := false
+		defer func() {
+			if finished {
+				return
+			}
+			if err := m.store.Release(storeCtx, userID, key); err != nil {
+				slog.ErrorContext(storeCtx, "failed to release idempotency key", "error", err)
+			}
+		}()
+
+		next.ServeHTTP(recorder, r)
+
+		// Server errors and abandoned requests did not necessarily take
+		// effect, so their retry runs again.
+		if recorder.status >= http.StatusInternalServerError || recorder.status == crmhttp.StatusClientClosedRequest {
+			return
+		}
+		if err := m.store.Complete(storeCtx, userID, key, recorder.status, recorder.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+			slog.ErrorContext(storeCtx, "failed to store idempotent response", "error", err)
+			return
+		}
+		finished = true
+	})
+}
+
+func replay(w http.ResponseWriter, r *http.Request, record *Record, fingerprint string) {
+	switch {
+	case record.Fingerprint != fingerprint:
+		utils.WriteError(w, r, http.StatusUnprocessableEntity, utils.Errorf("%s was already used for a different request", Header))
+	case record.Status != StatusCompleted:
+		utils.WriteError(w, r, http.StatusConflict, utils.Errorf("a request with this %s is still being processed", Header))
+	default:
+		if record.ContentType != "" {
+			w.Header().Set("Content-Type", record.ContentType)
+		}
+		w.Header().Set(ReplayedHeader, "true")
+		w.WriteHeader(record.ResponseStatus)
+		w.Write(record.ResponseBody)
+	}
+}
+
+// RunCleanup deletes expired keys every interval until ctx is cancelled.
+func (m *Middleware) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		deleted, err := m.store.DeleteExpired(ctx)
+		if err != nil {
+			slog.Error("failed to delete expired idempotency keys", "error", err)
+			continue
+		}
+		if deleted > 0 {
+			slog.Info("deleted expired idempotency keys", "count", deleted)
+		}
+	}
+}
+
+func mutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s?%s\n", r.Method, r.URL.Path, r.URL.RawQuery)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordingWriter passes the response through and keeps a copy of it.
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
@@ -0,0 +1,138 @@
+package idempotency
+
+import (
+	"VyacheslavKuchumov/test-backend/service/auth"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockStore struct {
+	records map[string]*Record
+}
+
+func newMockStore() *mockStore {
+	return &mockStore{records: map[string]*Record{}}
+}
+
+func (s *mockStore) Begin(ctx context.Context, userID int, key, fingerprint string, ttl time.Duration) (*Record, error) {
+	if record, ok := s.records[key]; ok {
+		return record, nil
+	}
+	s.records[key] = &Record{UserID: userID, Key: key, Fingerprint: fingerprint, Status: StatusProcessing}
+	return nil, nil
+}
+
+func (s *mockStore) Complete(ctx context.Context, userID int, key string, status int, contentType string, body []byte) error {
+	record := s.records[key]
+	record.Status = StatusCompleted
+	record.ResponseStatus = status
+	record.ContentType = contentType
+	record.ResponseBody = append([]byte(nil), body...)
+	return nil
+}
+
+func (s *mockStore) Release(ctx context.Context, userID int, key string) error {
+	delete(s.records, key)
+	return nil
+}
+
+func (s *mockStore) DeleteExpired(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func newRequest(method, body, key string) *http.Request {
+	req := httptest.NewRequest(method, "/projects", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(Header, key)
+	}
+	return req.WithContext(context.WithValue(req.Context(), auth.UserKey, 7))
+}
+
+func TestMiddlewareReplaysCompletedRequest(t *testing.T) {
+	calls := 0
+	handler := NewMiddleware(newMockStore(), time.Hour).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"project_id":1}`))
+	}))
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, newRequest(http.MethodPost, `{"project_name":"Final"}`, "key-1"))
+	retry := httptest.NewRecorder()
+	handler.ServeHTTP(retry, newRequest(http.MethodPost, `{"project_name":"Final"}`, "key-1"))
+
+	if calls != 1 {
+		t.Fatalf("expected handler to run once, ran %d times", calls)
+	}
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Fatalf("expected replayed 201 %q, got %d %q", first.Body.String(), retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get(ReplayedHeader) != "true" || retry.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected replay headers %v", retry.Header())
+	}
+}
+
+func TestMiddlewareRejectsKeyReuseWithDifferentPayload(t *testing.T) {
+	handler := NewMiddleware(newMockStore(), time.Hour).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodPost, `{"project_name":"Final"}`, "key-1"))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest(http.MethodPost, `{"project_name":"Other"}`, "key-1"))
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d", rr.Code)
+	}
+}
+
+func TestMiddlewareRejectsRequestStillInProgress(t *testing.T) {
+	store := newMockStore()
+	store.records["key-1"] = &Record{Key: "key-1", Fingerprint: requestFingerprint(newRequest(http.MethodPost, "", ""), []byte("{}")), Status: StatusProcessing}
+	handler := NewMiddleware(store, time.Hour).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler must not run while the key is in progress")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest(http.MethodPost, "{}", "key-1"))
+
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d", rr.Code)
+	}
+}
+
+func TestMiddlewareReleasesKeyAfterServerError(t *testing.T) {
+	calls := 0
+	handler := NewMiddleware(newMockStore(), time.Hour).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodPost, "{}", "key-1"))
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodPost, "{}", "key-1"))
+
+	if calls != 2 {
+		t.Fatalf("expected retry after a server error to run again, ran %d times", calls)
+	}
+}
+
+func TestMiddlewareIgnoresRequestsWithoutKey(t *testing.T) {
+	calls := 0
+	handler := NewMiddleware(newMockStore(), time.Hour).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodPost, "{}", ""))
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodPost, "{}", ""))
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodGet, "", "key-1"))
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodGet, "", "key-1"))
+
+	if calls != 4 {
+		t.Fatalf("expected every request to run, ran %d times", calls)
+	}
+}
@@ -0,0 +1,101 @@
+package idempotency
+
+import (
+	"VyacheslavKuchumov/test-backend/service/tracing"
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+)
+
+// Record is a stored Idempotency-Key and, once the request finished, the
+// response to replay for it.
+type Record struct {
+	UserID         int
+	Key            string
+	Fingerprint    string
+	Status         string
+	ResponseStatus int
+	ContentType    string
+	ResponseBody   []byte
+}
+
+type Store struct {
+	db *tracing.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: tracing.WrapDB(db, "idempotency")}
+}
+
+// Begin claims key for a new request. It returns nil when the claim
+// succeeded, or the record already holding the key. An expired record is
+// taken over as if it did not exist.
+func (s *Store) Begin(ctx context.Context, userID int, key, fingerprint string, ttl time.Duration) (*Record, error) {
+	var claimed string
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO idempotency_keys (user_id, idempotency_key, fingerprint, expires_at)
+		VALUES ($1, $2, $3, NOW() + $4 * INTERVAL '1 second')
+		ON CONFLICT (user_id, idempotency_key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint,
+			status = 'processing',
+			response_status = NULL,
+			content_type = '',
+			response_body = NULL,
+			created_at = NOW(),
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= NOW()
+		RETURNING idempotency_key
+	`, userID, key, fingerprint, int64(ttl/time.Second)).Scan(&claimed)
+	if err == nil {
+		return nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	record := &Record{UserID: userID, Key: key}
+	var responseStatus sql.NullInt64
+	err = s.db.QueryRowContext(ctx, `
+		SELECT fingerprint, status, response_status, content_type, response_body
+		FROM idempotency_keys
+		WHERE user_id = $1 AND idempotency_key = $2
+	`, userID, key).Scan(&record.Fingerprint, &record.Status, &responseStatus, &record.ContentType, &record.ResponseBody)
+	if err != nil {
+		return nil, err
+	}
+	record.ResponseStatus = int(responseStatus.Int64)
+	return record, nil
+}
+
+// Complete stores the response of a claimed key for replay.
+func (s *Store) Complete(ctx context.Context, userID int, key string, status int, contentType string, body []byte) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET status = 'completed', response_status = $3, content_type = $4, response_body = $5
+		WHERE user_id = $1 AND idempotency_key = $2
+	`, userID, key, status, contentType, body)
+	return err
+}
+
+// Release drops a claimed key, so a retry runs the request again.
+func (s *Store) Release(ctx context.Context, userID int, key string) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND idempotency_key = $2 AND status = 'processing'
+	`, userID, key)
+	return err
+}
+
+// DeleteExpired removes keys past their replay window.
+func (s *Store) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
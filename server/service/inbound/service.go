@@ -0,0 +1,150 @@
+package inbound
+
+import (
+	"VyacheslavKuchumov/test-backend/service/crmhttp"
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ReviewStore interface {
+	SearchReviews(ctx context.Context, status string, query types.ListQuery) ([]*types.InboundReview, int, error)
+	GetReviewByID(ctx context.Context, id int) (*types.InboundReview, error)
+	ResolveReview(ctx context.Context, id int, status string, projectID *int) (*types.InboundReview, error)
+}
+
+// Importer creates the CRM record for a queued item of its source. Items that
+// still cannot be imported come back as a skipped change with a reason.
+type Importer interface {
+	ImportReview(ctx context.Context, review *types.InboundReview) (*types.ProjectSyncChange, error)
+}
+
+type Service struct {
+	store     ReviewStore
+	importers map[string]Importer
+}
+
+func NewService(store ReviewStore) *Service {
+	return &Service{store: store, importers: make(map[string]Importer)}
+}
+
+func (s *Service) RegisterImporter(source string, importer Importer) {
+	s.importers[source] = importer
+}
+
+func RegisterRoutes(r chi.Router, service *Service) {
+	r.Route("/inbound/reviews", func(rt chi.Router) {
+		rt.Get("/", service.HandleGet)
+		rt.Get("/{id}", service.HandleGetByID)
+		rt.Post("/{id}/import", service.HandleImport)
+		rt.Post("/{id}/dismiss", service.HandleDismiss)
+	})
+}
+
+func (s *Service) HandleGet(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	status := strings.TrimSpace(r.URL.Query().Get("status"))
+	switch status {
+	case "", ReviewPending, ReviewImported, ReviewDismissed:
+	default:
+		utils.WriteError(w, r, http.StatusBadRequest, utils.Errorf("unknown review status %q", status))
+		return
+	}
+
+	query := crmhttp.ParseListQuery(r)
+	items, total, err := s.store.SearchReviews(r.Context(), status, query)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(items, query.Page, query.PerPage, total))
+}
+
+func (s *Service) HandleGetByID(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	item, err := s.store.GetReviewByID(r.Context(), id)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, item)
+}
+
+func (s *Service) HandleImport(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	review, err := s.store.GetReviewByID(r.Context(), id)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	if review.Status != ReviewPending {
+		utils.WriteError(w, r, http.StatusConflict, ErrReviewResolved)
+		return
+	}
+	importer, ok := s.importers[review.Source]
+	if !ok {
+		utils.WriteError(w, r, http.StatusServiceUnavailable, utils.Errorf("no importer configured for source %q", review.Source))
+		return
+	}
+
+	change, err := importer.ImportReview(r.Context(), review)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	if change.Action == "skipped" {
+		utils.WriteError(w, r, http.StatusUnprocessableEntity, errors.New(change.Reason))
+		return
+	}
+
+	projectID := change.ProjectID
+	item, err := s.store.ResolveReview(r.Context(), id, ReviewImported, &projectID)
+	if err != nil {
+		s.writeResolveError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, item)
+}
+
+func (s *Service) HandleDismiss(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	item, err := s.store.ResolveReview(r.Context(), id, ReviewDismissed, nil)
+	if err != nil {
+		s.writeResolveError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, item)
+}
+
+func (s *Service) writeResolveError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrReviewResolved) {
+		utils.WriteError(w, r, http.StatusConflict, err)
+		return
+	}
+	crmhttp.WriteStoreError(w, r, err)
+}
@@ -0,0 +1,48 @@
+package inbound
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxSignatureAge is how far a signed timestamp may be from the receiver's
+// clock. Older deliveries are rejected so captured requests cannot be
+// replayed later with a new delivery ID.
+const MaxSignatureAge = 5 * time.Minute
+
+// Sign returns the "sha256=<hex>" HMAC of "<timestamp>.<deliveryID>.<body>"
+// that senders put into their signature header. deliveryID is the delivery
+// header as sent, empty when the sender only puts the ID into the body.
+func Sign(secret string, timestamp int64, deliveryID string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write([]byte(deliveryID))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a signature header against the timestamp header,
+// the delivery ID and the raw request body. The "sha256=" prefix is optional
+// and matched in any case. Timestamps further than MaxSignatureAge from now
+// fail the check.
+func VerifySignature(secret, timestamp, deliveryID string, body []byte, header string, now time.Time) bool {
+	if secret == "" {
+		return false
+	}
+	signedAt, err := strconv.ParseInt(strings.TrimSpace(timestamp), 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(signedAt, 0)); age > MaxSignatureAge || age < -MaxSignatureAge {
+		return false
+	}
+	header = strings.ToLower(strings.TrimSpace(header))
+	header = "sha256=" + strings.TrimPrefix(header, "sha256=")
+	return hmac.Equal([]byte(header), []byte(Sign(secret, signedAt, deliveryID, body)))
+}
@@ -0,0 +1,197 @@
+package inbound
+
+import (
+	"VyacheslavKuchumov/test-backend/service/tracing"
+	"VyacheslavKuchumov/test-backend/service/tracker"
+	"VyacheslavKuchumov/test-backend/types"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+const (
+	DeliveryProcessing = "processing"
+	DeliveryProcessed  = "processed"
+	DeliveryQueued     = "queued"
+	DeliveryFailed     = "failed"
+
+	ReviewPending   = "pending"
+	ReviewImported  = "imported"
+	ReviewDismissed = "dismissed"
+)
+
+var (
+	ErrDuplicateDelivery = errors.New("delivery was already received")
+	ErrReviewResolved    = errors.New("review item is already resolved")
+)
+
+type Store struct {
+	db *tracing.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: tracing.WrapDB(db, "inbound")}
+}
+
+// BeginDelivery records an incoming delivery. It returns ErrDuplicateDelivery
+// when the source already sent this delivery ID, unless processing it failed
+// before, in which case the retry is let through.
+func (s *Store) BeginDelivery(ctx context.Context, source, deliveryID, eventType string) error {
+	var id int
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO inbound_webhook_deliveries (source, delivery_id, event_type)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (source, delivery_id) DO UPDATE
+		SET status = 'processing',
+			attempts = inbound_webhook_deliveries.attempts + 1,
+			error = NULL,
+			received_at = NOW(),
+			processed_at = NULL
+		WHERE inbound_webhook_deliveries.status = 'failed'
+		RETURNING id
+	`, source, deliveryID, eventType).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrDuplicateDelivery
+	}
+	return err
+}
+
+func (s *Store) FinishDelivery(ctx context.Context, source, deliveryID, status, errText string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE inbound_webhook_deliveries
+		SET status = $3, error = NULLIF($4, ''), processed_at = NOW()
+		WHERE source = $1 AND delivery_id = $2
+	`, source, deliveryID, status, errText)
+	return err
+}
+
+// QueueReview adds an item to the review queue. A pending item for the same
+// external ID is refreshed instead of duplicated.
+func (s *Store) QueueReview(ctx context.Context, review types.InboundReview) (int, error) {
+	var id int
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO inbound_reviews (source, external_id, delivery_id, reason, payload)
+		VALUES ($1, $2, $3, $4, $5::JSONB)
+		ON CONFLICT (source, external_id) WHERE status = 'pending' DO UPDATE
+		SET delivery_id = EXCLUDED.delivery_id,
+			reason = EXCLUDED.reason,
+			payload = EXCLUDED.payload,
+			updated_at = NOW()
+		RETURNING review_id
+	`, review.Source, review.ExternalID, review.DeliveryID, review.Reason, string(review.Payload)).Scan(&id)
+	return id, err
+}
+
+func (s *Store) SearchReviews(ctx context.Context, status string, query types.ListQuery) ([]*types.InboundReview, int, error) {
+	search := strings.ToLower(strings.TrimSpace(query.Search))
+	page := query.Page
+	if page < 1 {
+		page = 1
+	}
+	perPage := query.PerPage
+	if perPage <= 0 {
+		perPage = 10
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM inbound_reviews
+		WHERE ($1 = '' OR status = $1)
+		  AND ($2 = '' OR LOWER(external_id) LIKE '%' || $2 || '%' OR LOWER(reason) LIKE '%' || $2 || '%' OR source = $2)
+	`, status, search).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	items, err := s.listReviews(ctx, `
+		WHERE ($1 = '' OR status = $1)
+		  AND ($2 = '' OR LOWER(external_id) LIKE '%' || $2 || '%' OR LOWER(reason) LIKE '%' || $2 || '%' OR source = $2)
+		ORDER BY updated_at DESC, review_id DESC
+		LIMIT $3 OFFSET $4
+	`, status, search, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+func (s *Store) GetReviewByID(ctx context.Context, id int) (*types.InboundReview, error) {
+	items, err := s.listReviews(ctx, "WHERE review_id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, tracker.ErrNotFound
+	}
+	return items[0], nil
+}
+
+// ResolveReview closes a pending review item. projectID links the project
+// created from it, if any.
+func (s *Store) ResolveReview(ctx context.Context, id int, status string, projectID *int) (*types.InboundReview, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE inbound_reviews
+		SET status = $2, project_id = $3, resolved_at = NOW(), updated_at = NOW()
+		WHERE review_id = $1 AND status = 'pending'
+	`, id, status, projectID)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		if _, err := s.GetReviewByID(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrReviewResolved
+	}
+	return s.GetReviewByID(ctx, id)
+}
+
+func (s *Store) listReviews(ctx context.Context, extraWhere string, args ...any) ([]*types.InboundReview, error) {
+	query := `
+		SELECT review_id, source, external_id, delivery_id, reason, payload::TEXT, status, project_id, created_at, updated_at, resolved_at
+		FROM inbound_reviews
+	`
+	if strings.TrimSpace(extraWhere) != "" {
+		query += " " + extraWhere
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*types.InboundReview, 0)
+	for rows.Next() {
+		item := new(types.InboundReview)
+		var payload string
+		var projectID sql.NullInt64
+		var resolvedAt sql.NullTime
+		if err := rows.Scan(
+			&item.ReviewID,
+			&item.Source,
+			&item.ExternalID,
+			&item.DeliveryID,
+			&item.Reason,
+			&payload,
+			&item.Status,
+			&projectID,
+			&item.CreatedAt,
+			&item.UpdatedAt,
+			&resolvedAt,
+		); err != nil {
+			return nil, err
+		}
+		item.Payload = []byte(payload)
+		if projectID.Valid {
+			id := int(projectID.Int64)
+			item.ProjectID = &id
+		}
+		if resolvedAt.Valid {
+			item.ResolvedAt = &resolvedAt.Time
+		}
+		result = append(result, item)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,117 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+type contextKey string
+
+const stateKey contextKey = "requestLogState"
+
+// requestState is shared by pointer so handlers deeper in the chain, such as
+// the JWT middleware, can attach the user ID to the access log line.
+type requestState struct {
+	requestID string
+	userID    atomic.Int64
+}
+
+func (s *requestState) UserID() int {
+	return int(s.userID.Load())
+}
+
+func stateFromContext(ctx context.Context) *requestState {
+	state, _ := ctx.Value(stateKey).(*requestState)
+	return state
+}
+
+// RequestID returns the ID of the request being served, or "" outside one.
+func RequestID(ctx context.Context) string {
+	if state := stateFromContext(ctx); state != nil {
+		return state.requestID
+	}
+	return ""
+}
+
+// SetUserID records the authenticated user for log records of the request.
+func SetUserID(ctx context.Context, userID int) {
+	if state := stateFromContext(ctx); state != nil {
+		state.userID.Store(int64(userID))
+	}
+}
+
+// Middleware assigns a request ID, taken from X-Request-ID when the client
+// sends a usable one, echoes it in the response and writes one access log
+// record per request.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := &requestState{requestID: requestIDFrom(r)}
+		w.Header().Set(RequestIDHeader, state.requestID)
+		ctx := context.WithValue(r.Context(), stateKey, state)
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		route := ""
+		if rctx := chi.RouteContext(ctx); rctx != nil {
+			route = rctx.RoutePattern()
+		}
+
+		slog.Default().LogAttrs(ctx, level, "http request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", status),
+			slog.Int("bytes", ww.BytesWritten()),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_addr", r.RemoteAddr),
+		)
+	})
+}
+
+func requestIDFrom(r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if validRequestID(id) {
+		return id
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(buf)
+}
+
+// validRequestID accepts client IDs made of visible ASCII so they cannot
+// inject log lines or headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestMiddlewareLogsRequestContext(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(New(&buf, "info"))
+	defer slog.SetDefault(previous)
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/projects/{id}", func(w http.ResponseWriter, r *http.Request) {
+		SetUserID(r.Context(), 42)
+		slog.ErrorContext(r.Context(), "store failed")
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	testCases := []struct {
+		name       string
+		incomingID string
+		keepsID    bool
+	}{
+		{name: "client id is reused", incomingID: "abc-123", keepsID: true},
+		{name: "unsafe id is replaced", incomingID: "bad\nid", keepsID: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/projects/7", nil)
+			req.Header.Set(RequestIDHeader, tc.incomingID)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			requestID := rr.Header().Get(RequestIDHeader)
+			if (requestID == tc.incomingID) != tc.keepsID || requestID == "" {
+				t.Fatalf("unexpected response request id %q", requestID)
+			}
+
+			lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+			if len(lines) != 2 {
+				t.Fatalf("expected handler and access log records, got %d", len(lines))
+			}
+			for _, line := range lines {
+				var record map[string]any
+				if err := json.Unmarshal(line, &record); err != nil {
+					t.Fatalf("record is not JSON: %s", line)
+				}
+				if record["request_id"] != requestID || record["user_id"] != float64(42) {
+					t.Fatalf("record misses request context: %s", line)
+				}
+			}
+
+			var access map[string]any
+			json.Unmarshal(lines[1], &access)
+			if access["route"] != "/projects/{id}" || access["status"] != float64(500) || access["level"] != "ERROR" {
+				t.Fatalf("unexpected access record: %s", lines[1])
+			}
+		})
+	}
+}
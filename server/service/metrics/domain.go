@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"VyacheslavKuchumov/test-backend/types"
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectTimeout keeps a slow database from stalling the scrape past the
+// usual Prometheus scrape timeout.
+const collectTimeout = 8 * time.Second
+
+type DomainSource interface {
+	GetDomainStats(ctx context.Context) (*types.DomainStats, error)
+}
+
+// DomainCollector queries business gauges on every scrape, so values are as
+// fresh as the scrape interval and nothing runs between scrapes.
+type DomainCollector struct {
+	source DomainSource
+
+	activeProjects      *prometheus.Desc
+	conflictingProjects *prometheus.Desc
+	needsMaintenance    *prometheus.Desc
+	checkedOut          *prometheus.Desc
+	up                  *prometheus.Desc
+}
+
+func NewDomainCollector(source DomainSource) *DomainCollector {
+	return &DomainCollector{
+		source:              source,
+		activeProjects:      prometheus.NewDesc(namespace+"_projects_active", "Projects that are not archived.", nil, nil),
+		conflictingProjects: prometheus.NewDesc(namespace+"_projects_conflicting", "Active projects sharing equipment with an overlapping active project.", nil, nil),
+		needsMaintenance:    prometheus.NewDesc(namespace+"_equipment_needs_maintenance", "Equipment flagged as needing maintenance.", nil, nil),
+		checkedOut:          prometheus.NewDesc(namespace+"_equipment_checked_out", "Equipment booked on an active project that is shooting today.", nil, nil),
+		up:                  prometheus.NewDesc(namespace+"_domain_stats_up", "Whether the last domain stats query succeeded.", nil, nil),
+	}
+}
+
+func (c *DomainCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.activeProjects
+	ch <- c.conflictingProjects
+	ch <- c.needsMaintenance
+	ch <- c.checkedOut
+	ch <- c.up
+}
+
+func (c *DomainCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+	stats, err := c.source.GetDomainStats(ctx)
+	if err != nil {
+		slog.Error("failed to collect domain metrics", "error", err)
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(c.activeProjects, prometheus.GaugeValue, float64(stats.ActiveProjects))
+	ch <- prometheus.MustNewConstMetric(c.conflictingProjects, prometheus.GaugeValue, float64(stats.ConflictingProjects))
+	ch <- prometheus.MustNewConstMetric(c.needsMaintenance, prometheus.GaugeValue, float64(stats.EquipmentNeedingMaintenance))
+	ch <- prometheus.MustNewConstMetric(c.checkedOut, prometheus.GaugeValue, float64(stats.EquipmentCheckedOut))
+}
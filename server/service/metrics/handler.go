@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"VyacheslavKuchumov/test-backend/utils"
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// NewRegistry returns a registry with Go runtime, process and, when db is
+// set, connection pool collectors.
+func NewRegistry(db *sql.DB) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if db != nil {
+		reg.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+	}
+	return reg
+}
+
+// Handler serves the registry in the Prometheus text format. A non-empty
+// token must be sent as a bearer token, since /metrics sits outside the JWT
+// protected API.
+func Handler(reg *prometheus.Registry, token string) http.Handler {
+	metricsHandler := promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			got := strings.TrimSpace(r.Header.Get("Authorization"))
+			if len(got) > 7 && strings.EqualFold(got[:7], "bearer ") {
+				got = strings.TrimSpace(got[7:])
+			}
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				utils.WriteError(w, r, http.StatusUnauthorized, fmt.Errorf("invalid metrics token"))
+				return
+			}
+		}
+		metricsHandler.ServeHTTP(w, r)
+	})
+}
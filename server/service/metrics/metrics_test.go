@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"VyacheslavKuchumov/test-backend/types"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type statsSource struct {
+	stats *types.DomainStats
+	err   error
+}
+
+func (s statsSource) GetDomainStats(ctx context.Context) (*types.DomainStats, error) {
+	return s.stats, s.err
+}
+
+func TestMiddlewareLabelsByRoutePattern(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	httpMetrics := NewHTTPMetrics(reg)
+
+	r := chi.NewRouter()
+	r.Use(httpMetrics.Middleware)
+	r.Route("/api/v1/projects", func(rt chi.Router) {
+		rt.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+	})
+
+	for _, path := range []string{"/api/v1/projects/1", "/api/v1/projects/2", "/nope"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if count := testutil.CollectAndCount(httpMetrics.duration); count != 2 {
+		t.Fatalf("expected two label sets, got %d", count)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var routes []string
+	for _, family := range families {
+		if family.GetName() != "ultralive_http_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			routes = append(routes, labels["route"]+" "+labels["status"])
+			if labels["route"] == "/api/v1/projects/{id}" && metric.GetHistogram().GetSampleCount() != 2 {
+				t.Fatalf("expected 2 samples for project route, got %d", metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	joined := strings.Join(routes, ",")
+	if !strings.Contains(joined, "/api/v1/projects/{id} 404") || !strings.Contains(joined, "unmatched 404") {
+		t.Fatalf("unexpected route labels %q", joined)
+	}
+}
+
+func TestDomainCollector(t *testing.T) {
+	collector := NewDomainCollector(statsSource{stats: &types.DomainStats{
+		ActiveProjects:              4,
+		ConflictingProjects:         1,
+		EquipmentNeedingMaintenance: 2,
+		EquipmentCheckedOut:         9,
+	}})
+	expected := `
+		# HELP ultralive_equipment_checked_out Equipment booked on an active project that is shooting today.
+		# TYPE ultralive_equipment_checked_out gauge
+		ultralive_equipment_checked_out 9
+		# HELP ultralive_projects_active Projects that are not archived.
+		# TYPE ultralive_projects_active gauge
+		ultralive_projects_active 4
+	`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "ultralive_equipment_checked_out", "ultralive_projects_active"); err != nil {
+		t.Fatal(err)
+	}
+
+	failing := NewDomainCollector(statsSource{err: errors.New("db down")})
+	if got := testutil.ToFloat64(failing); got != 0 {
+		t.Fatalf("expected domain_stats_up 0, got %v", got)
+	}
+}
+
+func TestHandlerRequiresToken(t *testing.T) {
+	handler := Handler(prometheus.NewRegistry(), "secret")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+}
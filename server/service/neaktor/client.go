@@ -0,0 +1,170 @@
+package neaktor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const pageSize = 100
+
+// Task is the subset of a Neaktor task the sync uses. Custom fields such as
+// shooting dates are identified by field ID and configured per installation.
+type Task struct {
+	ID      string  `json:"id"`
+	Name    string  `json:"name"`
+	ModelID string  `json:"modelId"`
+	Status  string  `json:"status"`
+	Fields  []Field `json:"fields"`
+}
+
+type Field struct {
+	ID    string          `json:"id"`
+	Value json.RawMessage `json:"value"`
+}
+
+type tasksPage struct {
+	Data  []Task `json:"data"`
+	Total int    `json:"total"`
+}
+
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// ListTasks pages through GET /v1/tasks until every task has been read.
+func (c *Client) ListTasks(ctx context.Context) ([]Task, error) {
+	tasks := make([]Task, 0)
+	for page := 0; ; page++ {
+		batch, err := c.fetchPage(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, batch.Data...)
+		if len(batch.Data) == 0 || len(batch.Data) < pageSize || len(tasks) >= batch.Total {
+			return tasks, nil
+		}
+	}
+}
+
+// GetTask loads a single task, used to refresh a project after a webhook.
+func (c *Client) GetTask(ctx context.Context, id string) (*Task, error) {
+	task := new(Task)
+	if err := c.get(ctx, "/v1/tasks/"+url.PathEscape(id), nil, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+func (c *Client) fetchPage(ctx context.Context, page int) (*tasksPage, error) {
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+	query.Set("size", strconv.Itoa(pageSize))
+
+	result := new(tasksPage)
+	if err := c.get(ctx, "/v1/tasks", query, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, target any) error {
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("neaktor %s: unexpected status %d: %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+// FieldString returns a custom field value as a string, or "" when the task
+// has no such field.
+func (t *Task) FieldString(fieldID string) string {
+	if fieldID == "" {
+		return ""
+	}
+	for _, field := range t.Fields {
+		if field.ID != fieldID {
+			continue
+		}
+		var text string
+		if err := json.Unmarshal(field.Value, &text); err == nil {
+			return strings.TrimSpace(text)
+		}
+		// Reference fields (users, lists) come back as objects.
+		var ref struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+			Value string `json:"value"`
+		}
+		if err := json.Unmarshal(field.Value, &ref); err == nil {
+			for _, candidate := range []string{ref.Email, ref.Name, ref.Value} {
+				if strings.TrimSpace(candidate) != "" {
+					return strings.TrimSpace(candidate)
+				}
+			}
+		}
+		return strings.Trim(strings.TrimSpace(string(field.Value)), `"`)
+	}
+	return ""
+}
+
+// FieldDate parses a date custom field. Neaktor sends either ISO dates,
+// RFC 3339 timestamps or Unix milliseconds depending on field settings.
+func (t *Task) FieldDate(fieldID string) (string, bool) {
+	raw := t.FieldString(fieldID)
+	if raw == "" {
+		return "", false
+	}
+	return parseDate(raw)
+}
+
+func parseDate(raw string) (string, bool) {
+	if millis, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(millis).UTC().Format("2006-01-02"), true
+	}
+	if parsed, err := time.Parse(time.RFC3339, raw); err == nil {
+		return parsed.Format("2006-01-02"), true
+	}
+	if len(raw) >= 10 {
+		if parsed, err := time.Parse("2006-01-02", raw[:10]); err == nil {
+			return parsed.Format("2006-01-02"), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,161 @@
+package neaktor
+
+import (
+	"VyacheslavKuchumov/test-backend/service/crmhttp"
+	"VyacheslavKuchumov/test-backend/service/inbound"
+	"VyacheslavKuchumov/test-backend/service/tracker"
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Source identifies Neaktor in the inbound delivery log and review queue.
+const Source = "neaktor"
+
+const (
+	SignatureHeader = "X-Neaktor-Signature"
+	DeliveryHeader  = "X-Neaktor-Delivery"
+	TimestampHeader = "X-Neaktor-Timestamp"
+
+	maxWebhookBody = 1 << 20
+)
+
+// WebhookPayload is the body Neaktor posts when a task changes. Senders that
+// only include the task ID get the task loaded from the API.
+type WebhookPayload struct {
+	ID     string `json:"id"`
+	Event  string `json:"event"`
+	TaskID string `json:"taskId"`
+	Task   *Task  `json:"task"`
+}
+
+// DeliveryLog deduplicates incoming deliveries and parks tasks that cannot be
+// matched to a project.
+type DeliveryLog interface {
+	BeginDelivery(ctx context.Context, source, deliveryID, eventType string) error
+	FinishDelivery(ctx context.Context, source, deliveryID, status, errText string) error
+	QueueReview(ctx context.Context, review types.InboundReview) (int, error)
+}
+
+// HandleWebhook receives signed task updates. It is excluded from JWT auth;
+// the HMAC signature over the timestamp, the delivery header and the raw body
+// authenticates the sender, so the delivery ID used for deduplication is
+// always signed and old deliveries cannot be replayed.
+func (s *Service) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	if s.syncer == nil || s.deliveries == nil || s.webhookSecret == "" {
+		utils.WriteError(w, r, http.StatusServiceUnavailable, errNotConfigured)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	headerDeliveryID := r.Header.Get(DeliveryHeader)
+	if !inbound.VerifySignature(s.webhookSecret, r.Header.Get(TimestampHeader), headerDeliveryID, body, r.Header.Get(SignatureHeader), time.Now()) {
+		utils.WriteError(w, r, http.StatusUnauthorized, fmt.Errorf("invalid signature"))
+		return
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	deliveryID := strings.TrimSpace(headerDeliveryID)
+	if deliveryID == "" {
+		deliveryID = strings.TrimSpace(payload.ID)
+	}
+	if deliveryID == "" {
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("missing delivery id"))
+		return
+	}
+	if payload.Task == nil && strings.TrimSpace(payload.TaskID) == "" {
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("payload has neither task nor taskId"))
+		return
+	}
+
+	err = s.deliveries.BeginDelivery(r.Context(), Source, deliveryID, payload.Event)
+	if errors.Is(err, inbound.ErrDuplicateDelivery) {
+		utils.WriteJSON(w, http.StatusOK, types.InboundWebhookResult{DeliveryID: deliveryID, Status: "duplicate"})
+		return
+	}
+	if err != nil {
+		crmhttp.WriteInternalError(w, r, err)
+		return
+	}
+
+	result, err := s.receive(r.Context(), deliveryID, payload)
+	if err != nil {
+		if finishErr := s.deliveries.FinishDelivery(r.Context(), Source, deliveryID, inbound.DeliveryFailed, err.Error()); finishErr != nil {
+			slog.ErrorContext(r.Context(), "failed to record Neaktor delivery", "delivery_id", deliveryID, "error", finishErr)
+		}
+		crmhttp.WriteInternalError(w, r, err)
+		return
+	}
+
+	status := inbound.DeliveryProcessed
+	if result.Status == inbound.DeliveryQueued {
+		status = inbound.DeliveryQueued
+	}
+	if err := s.deliveries.FinishDelivery(r.Context(), Source, deliveryID, status, ""); err != nil {
+		slog.ErrorContext(r.Context(), "failed to record Neaktor delivery", "delivery_id", deliveryID, "error", err)
+	}
+	utils.WriteJSON(w, http.StatusOK, result)
+}
+
+// receive updates the project linked to the task. Tasks without a project or
+// with data the CRM cannot map go to the review queue.
+func (s *Service) receive(ctx context.Context, deliveryID string, payload WebhookPayload) (*types.InboundWebhookResult, error) {
+	task := payload.Task
+	if task == nil {
+		fetched, err := s.syncer.FetchTask(ctx, strings.TrimSpace(payload.TaskID))
+		if err != nil {
+			return nil, fmt.Errorf("fetch task %s: %w", payload.TaskID, err)
+		}
+		task = fetched
+	}
+
+	result := &types.InboundWebhookResult{DeliveryID: deliveryID}
+	change, err := s.syncer.ApplyUpdate(ctx, *task)
+	var reason string
+	switch {
+	case errors.Is(err, tracker.ErrNotFound):
+		reason = "no project is linked to this task"
+	case err != nil:
+		return nil, err
+	case change.Action == "skipped":
+		reason = change.Reason
+	default:
+		result.Status = change.Action
+		result.Change = change
+		return result, nil
+	}
+
+	taskJSON, err := json.Marshal(task)
+	if err != nil {
+		return nil, err
+	}
+	reviewID, err := s.deliveries.QueueReview(ctx, types.InboundReview{
+		Source:     Source,
+		ExternalID: task.ID,
+		DeliveryID: deliveryID,
+		Reason:     reason,
+		Payload:    taskJSON,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Status = inbound.DeliveryQueued
+	result.ReviewID = reviewID
+	return result, nil
+}
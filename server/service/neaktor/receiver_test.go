@@ -0,0 +1,141 @@
+package neaktor
+
+import (
+	"VyacheslavKuchumov/test-backend/service/inbound"
+	"VyacheslavKuchumov/test-backend/types"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "neaktor-webhook-secret"
+
+type mockDeliveryLog struct {
+	statuses map[string]string
+	reviews  []types.InboundReview
+}
+
+func (m *mockDeliveryLog) BeginDelivery(ctx context.Context, source, deliveryID, eventType string) error {
+	if status, ok := m.statuses[deliveryID]; ok && status != inbound.DeliveryFailed {
+		return inbound.ErrDuplicateDelivery
+	}
+	m.statuses[deliveryID] = inbound.DeliveryProcessing
+	return nil
+}
+
+func (m *mockDeliveryLog) FinishDelivery(ctx context.Context, source, deliveryID, status, errText string) error {
+	m.statuses[deliveryID] = status
+	return nil
+}
+
+func (m *mockDeliveryLog) QueueReview(ctx context.Context, review types.InboundReview) (int, error) {
+	m.reviews = append(m.reviews, review)
+	return len(m.reviews), nil
+}
+
+func postWebhook(t *testing.T, service *Service, deliveryID string, payload WebhookPayload, secret string) (int, types.InboundWebhookResult) {
+	t.Helper()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp := time.Now().Unix()
+	return postSigned(service, deliveryID, body, timestamp, inbound.Sign(secret, timestamp, deliveryID, body))
+}
+
+func postSigned(service *Service, deliveryID string, body []byte, timestamp int64, signature string) (int, types.InboundWebhookResult) {
+	req := httptest.NewRequest(http.MethodPost, "/neaktor/webhook", bytes.NewReader(body))
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, signature)
+
+	rr := httptest.NewRecorder()
+	service.HandleWebhook(rr, req)
+
+	var result types.InboundWebhookResult
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	return rr.Code, result
+}
+
+func TestHandleWebhookUpdatesKnownProjectsAndQueuesUnknown(t *testing.T) {
+	store := &mockProjectStore{projects: map[string]types.NeaktorProjectPayload{
+		"T-1": {NeaktorID: "T-1", ShootingEndDate: "2026-03-02"},
+	}}
+	deliveries := &mockDeliveryLog{statuses: map[string]string{}}
+	syncer := NewSyncer(nil, store, Mapping{StartDateField: "start", EndDateField: "end", ChiefEngineerField: "engineer"})
+	service := NewService(syncer, deliveries, testWebhookSecret)
+
+	known := task("T-1", "Concert", "model-1", "open", "2026-03-01", "2026-03-03", "Ivan Petrov")
+	unknown := task("T-9", "New show", "model-1", "open", "2026-04-01", "2026-04-02", "Ivan Petrov")
+
+	testCases := []struct {
+		name           string
+		deliveryID     string
+		task           Task
+		secret         string
+		expectedCode   int
+		expectedStatus string
+	}{
+		{name: "bad signature is rejected", deliveryID: "d-0", task: known, secret: "wrong", expectedCode: http.StatusUnauthorized},
+		{name: "known task updates project", deliveryID: "d-1", task: known, secret: testWebhookSecret, expectedCode: http.StatusOK, expectedStatus: "updated"},
+		{name: "repeated delivery is ignored", deliveryID: "d-1", task: known, secret: testWebhookSecret, expectedCode: http.StatusOK, expectedStatus: "duplicate"},
+		{name: "unknown task is queued for review", deliveryID: "d-2", task: unknown, secret: testWebhookSecret, expectedCode: http.StatusOK, expectedStatus: inbound.DeliveryQueued},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			task := tc.task
+			code, result := postWebhook(t, service, tc.deliveryID, WebhookPayload{Event: "task.updated", Task: &task}, tc.secret)
+			if code != tc.expectedCode {
+				t.Fatalf("expected %d, got %d", tc.expectedCode, code)
+			}
+			if result.Status != tc.expectedStatus {
+				t.Fatalf("expected status %q, got %q", tc.expectedStatus, result.Status)
+			}
+		})
+	}
+
+	if len(deliveries.reviews) != 1 || deliveries.reviews[0].ExternalID != "T-9" {
+		t.Fatalf("expected T-9 in review queue, got %+v", deliveries.reviews)
+	}
+	if _, ok := store.projects["T-9"]; ok {
+		t.Fatalf("webhook must not create projects")
+	}
+	if deliveries.statuses["d-2"] != inbound.DeliveryQueued {
+		t.Fatalf("expected queued delivery status, got %q", deliveries.statuses["d-2"])
+	}
+}
+
+func TestHandleWebhookRejectsReplays(t *testing.T) {
+	store := &mockProjectStore{projects: map[string]types.NeaktorProjectPayload{
+		"T-1": {NeaktorID: "T-1", ShootingEndDate: "2026-03-02"},
+	}}
+	deliveries := &mockDeliveryLog{statuses: map[string]string{}}
+	syncer := NewSyncer(nil, store, Mapping{StartDateField: "start", EndDateField: "end", ChiefEngineerField: "engineer"})
+	service := NewService(syncer, deliveries, testWebhookSecret)
+
+	known := task("T-1", "Concert", "model-1", "open", "2026-03-01", "2026-03-03", "Ivan Petrov")
+	body, err := json.Marshal(WebhookPayload{Event: "task.updated", Task: &known})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix()
+	signature := inbound.Sign(testWebhookSecret, now, "d-1", body)
+
+	if code, _ := postSigned(service, "d-2", body, now, signature); code != http.StatusUnauthorized {
+		t.Fatalf("expected a captured delivery with a new ID to be rejected, got %d", code)
+	}
+	stale := now - int64(inbound.MaxSignatureAge/time.Second) - 60
+	if code, _ := postSigned(service, "d-3", body, stale, inbound.Sign(testWebhookSecret, stale, "d-3", body)); code != http.StatusUnauthorized {
+		t.Fatalf("expected a stale timestamp to be rejected, got %d", code)
+	}
+	if code, result := postSigned(service, "d-1", body, now, strings.ToUpper(signature[:7])+signature[7:]); code != http.StatusOK || result.Status != "updated" {
+		t.Fatalf("expected an upper-case prefix to be accepted, got %d %q", code, result.Status)
+	}
+}
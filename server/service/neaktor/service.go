@@ -0,0 +1,72 @@
+package neaktor
+
+import (
+	"VyacheslavKuchumov/test-backend/service/crmhttp"
+	"VyacheslavKuchumov/test-backend/utils"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var errNotConfigured = errors.New("neaktor integration is not configured")
+
+type Service struct {
+	syncer        *Syncer
+	deliveries    DeliveryLog
+	webhookSecret string
+}
+
+// NewService exposes the syncer over HTTP. A nil syncer means the
+// integration is disabled and every route answers 503. The webhook receiver
+// additionally needs a delivery log and a signing secret.
+func NewService(syncer *Syncer, deliveries DeliveryLog, webhookSecret string) *Service {
+	return &Service{syncer: syncer, deliveries: deliveries, webhookSecret: webhookSecret}
+}
+
+func RegisterRoutes(r chi.Router, service *Service) {
+	r.Route("/neaktor", func(rt chi.Router) {
+		rt.Post("/sync", service.HandleSync)
+		rt.Get("/sync/last", service.HandleGetLastSync)
+		rt.Post("/webhook", service.HandleWebhook)
+	})
+}
+
+func (s *Service) HandleSync(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	if s.syncer == nil {
+		utils.WriteError(w, r, http.StatusServiceUnavailable, errNotConfigured)
+		return
+	}
+
+	report, err := s.syncer.Sync(r.Context(), TriggerManual)
+	if errors.Is(err, ErrSyncInProgress) {
+		utils.WriteError(w, r, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadGateway, report)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, report)
+}
+
+func (s *Service) HandleGetLastSync(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	if s.syncer == nil {
+		utils.WriteError(w, r, http.StatusServiceUnavailable, errNotConfigured)
+		return
+	}
+
+	report := s.syncer.LastReport()
+	if report == nil {
+		utils.WriteError(w, r, http.StatusNotFound, fmt.Errorf("no sync has run yet"))
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, report)
+}
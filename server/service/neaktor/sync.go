@@ -0,0 +1,266 @@
+package neaktor
+
+import (
+	"VyacheslavKuchumov/test-backend/service/tracker"
+	"VyacheslavKuchumov/test-backend/types"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TriggerManual   = "manual"
+	TriggerSchedule = "schedule"
+	TriggerWebhook  = "webhook"
+)
+
+var ErrSyncInProgress = errors.New("neaktor sync is already running")
+
+// Mapping tells the sync which Neaktor custom fields hold project data.
+type Mapping struct {
+	StartDateField     string
+	EndDateField       string
+	ChiefEngineerField string
+	// ArchivedStatuses are task statuses that mark a project as archived.
+	// When empty the archived flag is never changed by the sync.
+	ArchivedStatuses []string
+}
+
+func ParseStatuses(raw string) []string {
+	statuses := make([]string, 0)
+	for _, status := range strings.Split(raw, ",") {
+		status = strings.TrimSpace(status)
+		if status != "" {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// MapTask converts a task into a project upsert. It returns a reason instead
+// of a payload when the task lacks data the projects table requires.
+func (m Mapping) MapTask(task Task) (types.NeaktorProjectPayload, string) {
+	payload := types.NeaktorProjectPayload{
+		NeaktorID:            strings.TrimSpace(task.ID),
+		ProjectName:          strings.TrimSpace(task.Name),
+		ProjectTypeNeaktorID: strings.TrimSpace(task.ModelID),
+		ChiefEngineer:        task.FieldString(m.ChiefEngineerField),
+	}
+
+	switch {
+	case payload.NeaktorID == "":
+		return payload, "task has no id"
+	case payload.ProjectName == "":
+		return payload, "task has no name"
+	case payload.ProjectTypeNeaktorID == "":
+		return payload, "task has no model id"
+	case payload.ChiefEngineer == "":
+		return payload, "chief engineer field is empty"
+	}
+
+	start, ok := task.FieldDate(m.StartDateField)
+	if !ok {
+		return payload, "shooting start date is missing or invalid"
+	}
+	end, ok := task.FieldDate(m.EndDateField)
+	if !ok {
+		return payload, "shooting end date is missing or invalid"
+	}
+	if end < start {
+		return payload, "shooting end date is before start date"
+	}
+	payload.ShootingStartDate = start
+	payload.ShootingEndDate = end
+
+	if len(m.ArchivedStatuses) > 0 {
+		archived := false
+		for _, status := range m.ArchivedStatuses {
+			if strings.EqualFold(status, strings.TrimSpace(task.Status)) {
+				archived = true
+				break
+			}
+		}
+		payload.Archived = &archived
+	}
+
+	return payload, ""
+}
+
+type TaskSource interface {
+	ListTasks(ctx context.Context) ([]Task, error)
+}
+
+// TaskFetcher is implemented by sources that can load a single task, which
+// webhooks that only carry a task ID rely on.
+type TaskFetcher interface {
+	GetTask(ctx context.Context, id string) (*Task, error)
+}
+
+type ProjectStore interface {
+	UpsertProjectByNeaktorID(ctx context.Context, payload types.NeaktorProjectPayload) (*types.ProjectSyncChange, error)
+	UpdateProjectByNeaktorID(ctx context.Context, payload types.NeaktorProjectPayload) (*types.ProjectSyncChange, error)
+}
+
+type Syncer struct {
+	source  TaskSource
+	store   ProjectStore
+	mapping Mapping
+
+	running sync.Mutex
+	mu      sync.RWMutex
+	last    *types.NeaktorSyncReport
+}
+
+func NewSyncer(source TaskSource, store ProjectStore, mapping Mapping) *Syncer {
+	return &Syncer{source: source, store: store, mapping: mapping}
+}
+
+// Sync pulls every task and upserts the matching projects. Only one sync runs
+// at a time; a concurrent call returns ErrSyncInProgress.
+func (s *Syncer) Sync(ctx context.Context, trigger string) (*types.NeaktorSyncReport, error) {
+	if !s.running.TryLock() {
+		return nil, ErrSyncInProgress
+	}
+	defer s.running.Unlock()
+
+	report := &types.NeaktorSyncReport{
+		Trigger:   trigger,
+		StartedAt: time.Now().UTC(),
+		Changes:   make([]*types.ProjectSyncChange, 0),
+	}
+	err := s.sync(ctx, report)
+	report.FinishedAt = time.Now().UTC()
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	s.mu.Lock()
+	s.last = report
+	s.mu.Unlock()
+
+	return report, err
+}
+
+func (s *Syncer) sync(ctx context.Context, report *types.NeaktorSyncReport) error {
+	tasks, err := s.source.ListTasks(ctx)
+	if err != nil {
+		return fmt.Errorf("fetch tasks: %w", err)
+	}
+	report.Fetched = len(tasks)
+
+	for _, task := range tasks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		change, err := s.Apply(ctx, task)
+		if err != nil {
+			return err
+		}
+
+		switch change.Action {
+		case "created":
+			report.Created++
+		case "updated":
+			report.Updated++
+		case "unchanged":
+			report.Unchanged++
+			continue
+		case "skipped":
+			report.Skipped++
+		}
+		report.Changes = append(report.Changes, change)
+	}
+	return nil
+}
+
+// Apply maps and upserts a single task. Tasks that cannot be mapped, that
+// reference unknown project types or users, or whose dates would overbook
+// the project's stock are reported as skipped.
+func (s *Syncer) Apply(ctx context.Context, task Task) (*types.ProjectSyncChange, error) {
+	return s.apply(ctx, task, s.store.UpsertProjectByNeaktorID)
+}
+
+// ApplyUpdate is Apply without creating projects: it returns
+// tracker.ErrNotFound when no project is linked to the task yet.
+func (s *Syncer) ApplyUpdate(ctx context.Context, task Task) (*types.ProjectSyncChange, error) {
+	return s.apply(ctx, task, s.store.UpdateProjectByNeaktorID)
+}
+
+func (s *Syncer) apply(ctx context.Context, task Task, save func(context.Context, types.NeaktorProjectPayload) (*types.ProjectSyncChange, error)) (*types.ProjectSyncChange, error) {
+	payload, reason := s.mapping.MapTask(task)
+	if reason != "" {
+		return skipped(payload, reason), nil
+	}
+
+	change, err := save(ctx, payload)
+	if errors.Is(err, tracker.ErrInvalidReference) || errors.Is(err, tracker.ErrAmbiguousReference) || errors.Is(err, tracker.ErrTrashed) || errors.Is(err, tracker.ErrInsufficientStock) {
+		return skipped(payload, err.Error()), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("upsert task %s: %w", payload.NeaktorID, err)
+	}
+	return change, nil
+}
+
+// FetchTask loads a single task from the source.
+func (s *Syncer) FetchTask(ctx context.Context, id string) (*Task, error) {
+	fetcher, ok := s.source.(TaskFetcher)
+	if !ok {
+		return nil, fmt.Errorf("task source cannot load single tasks")
+	}
+	return fetcher.GetTask(ctx, id)
+}
+
+// ImportReview creates the project for a task parked in the inbound review
+// queue, typically after the missing project type or user has been added.
+func (s *Syncer) ImportReview(ctx context.Context, review *types.InboundReview) (*types.ProjectSyncChange, error) {
+	var task Task
+	if err := json.Unmarshal(review.Payload, &task); err != nil {
+		return nil, fmt.Errorf("decode queued task: %w", err)
+	}
+	return s.Apply(ctx, task)
+}
+
+func (s *Syncer) LastReport() *types.NeaktorSyncReport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.last
+}
+
+// RunScheduler syncs every interval until ctx is cancelled.
+func (s *Syncer) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := s.Sync(ctx, TriggerSchedule)
+		if err != nil {
+			if !errors.Is(err, ErrSyncInProgress) {
+				slog.Error("Neaktor sync failed", "error", err)
+			}
+			continue
+		}
+		slog.Info("Neaktor sync finished", "fetched", report.Fetched, "created", report.Created, "updated", report.Updated, "skipped", report.Skipped)
+	}
+}
+
+func skipped(payload types.NeaktorProjectPayload, reason string) *types.ProjectSyncChange {
+	return &types.ProjectSyncChange{
+		NeaktorID:   payload.NeaktorID,
+		ProjectName: payload.ProjectName,
+		Action:      "skipped",
+		Reason:      reason,
+	}
+}
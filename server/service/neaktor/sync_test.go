@@ -0,0 +1,170 @@
+package neaktor
+
+import (
+	"VyacheslavKuchumov/test-backend/service/tracker"
+	"VyacheslavKuchumov/test-backend/types"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type mockProjectStore struct {
+	projects map[string]types.NeaktorProjectPayload
+	upserts  []types.NeaktorProjectPayload
+}
+
+func (m *mockProjectStore) UpsertProjectByNeaktorID(ctx context.Context, payload types.NeaktorProjectPayload) (*types.ProjectSyncChange, error) {
+	m.upserts = append(m.upserts, payload)
+	if payload.ProjectTypeNeaktorID == "unknown-model" {
+		return nil, fmt.Errorf("%w: no project type with neaktor_id %q", tracker.ErrInvalidReference, payload.ProjectTypeNeaktorID)
+	}
+	if payload.ShootingEndDate == "2026-12-31" {
+		return nil, fmt.Errorf("%w: 0 pcs of XLR 5 m available for these dates, 4 requested", tracker.ErrInsufficientStock)
+	}
+
+	change := &types.ProjectSyncChange{NeaktorID: payload.NeaktorID, ProjectName: payload.ProjectName, ProjectID: len(m.projects) + 1}
+	current, ok := m.projects[payload.NeaktorID]
+	switch {
+	case !ok:
+		change.Action = "created"
+	case current.ShootingEndDate != payload.ShootingEndDate:
+		change.Action = "updated"
+		change.ChangedFields = []string{"shooting_end_date"}
+	default:
+		change.Action = "unchanged"
+	}
+	m.projects[payload.NeaktorID] = payload
+	return change, nil
+}
+
+func (m *mockProjectStore) UpdateProjectByNeaktorID(ctx context.Context, payload types.NeaktorProjectPayload) (*types.ProjectSyncChange, error) {
+	if _, ok := m.projects[payload.NeaktorID]; !ok {
+		return nil, tracker.ErrNotFound
+	}
+	return m.UpsertProjectByNeaktorID(ctx, payload)
+}
+
+func task(id, name, model, status, start, end, engineer string) Task {
+	raw := func(v string) json.RawMessage {
+		encoded, _ := json.Marshal(v)
+		return encoded
+	}
+	return Task{
+		ID:      id,
+		Name:    name,
+		ModelID: model,
+		Status:  status,
+		Fields: []Field{
+			{ID: "start", Value: raw(start)},
+			{ID: "end", Value: raw(end)},
+			{ID: "engineer", Value: json.RawMessage(`{"name":"` + engineer + `"}`)},
+		},
+	}
+}
+
+func newStandIn(t *testing.T, tasks []Task) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/tasks" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		start := page * size
+		end := start + size
+		if start > len(tasks) {
+			start = len(tasks)
+		}
+		if end > len(tasks) {
+			end = len(tasks)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": tasks[start:end], "total": len(tasks)})
+	}))
+}
+
+func TestSyncUpsertsProjectsFromStandInServer(t *testing.T) {
+	tasks := []Task{
+		task("T-1", "Concert", "model-1", "open", "2026-03-01", "2026-03-02", "Ivan Petrov"),
+		task("T-2", "Festival", "model-1", "Closed", "1772582400000", "2026-03-05T18:00:00Z", "Anna Smirnova"),
+		task("T-3", "Broken dates", "model-1", "open", "not a date", "2026-03-02", "Ivan Petrov"),
+		task("T-4", "Unknown type", "unknown-model", "open", "2026-03-01", "2026-03-02", "Ivan Petrov"),
+	}
+	server := newStandIn(t, tasks)
+	defer server.Close()
+
+	store := &mockProjectStore{projects: map[string]types.NeaktorProjectPayload{}}
+	syncer := NewSyncer(NewClient(server.URL, "test-token"), store, Mapping{
+		StartDateField:     "start",
+		EndDateField:       "end",
+		ChiefEngineerField: "engineer",
+		ArchivedStatuses:   ParseStatuses("closed, cancelled"),
+	})
+
+	report, err := syncer.Sync(context.Background(), TriggerManual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Fetched != 4 || report.Created != 2 || report.Skipped != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	festival := store.projects["T-2"]
+	if festival.ShootingStartDate != "2026-03-04" || festival.ShootingEndDate != "2026-03-05" {
+		t.Fatalf("unexpected festival dates: %+v", festival)
+	}
+	if festival.Archived == nil || !*festival.Archived {
+		t.Fatalf("expected closed task to be archived")
+	}
+	if festival.ChiefEngineer != "Anna Smirnova" {
+		t.Fatalf("unexpected chief engineer %q", festival.ChiefEngineer)
+	}
+
+	tasks[0] = task("T-1", "Concert", "model-1", "open", "2026-03-01", "2026-03-03", "Ivan Petrov")
+	report, err = syncer.Sync(context.Background(), TriggerSchedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Updated != 1 || report.Unchanged != 1 || len(report.Changes) != 3 {
+		t.Fatalf("unexpected second report: %+v", report)
+	}
+	if syncer.LastReport() != report {
+		t.Fatalf("expected last report to be stored")
+	}
+}
+
+func TestApplySkipsTasksThatOverbookStock(t *testing.T) {
+	store := &mockProjectStore{projects: map[string]types.NeaktorProjectPayload{}}
+	syncer := NewSyncer(nil, store, Mapping{StartDateField: "start", EndDateField: "end", ChiefEngineerField: "engineer"})
+
+	change, err := syncer.Apply(context.Background(), task("T-1", "Concert", "model-1", "open", "2026-12-30", "2026-12-31", "Ivan Petrov"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Action != "skipped" || !strings.Contains(change.Reason, "available for these dates") {
+		t.Fatalf("expected the task skipped for lack of stock, got %+v", change)
+	}
+}
+
+func TestSyncReportsUpstreamErrors(t *testing.T) {
+	server := newStandIn(t, nil)
+	defer server.Close()
+
+	syncer := NewSyncer(NewClient(server.URL, "wrong-token"), &mockProjectStore{projects: map[string]types.NeaktorProjectPayload{}}, Mapping{})
+	report, err := syncer.Sync(context.Background(), TriggerManual)
+	if err == nil {
+		t.Fatal("expected error for unauthorized request")
+	}
+	if report.Error == "" {
+		t.Fatalf("expected error in report")
+	}
+}
@@ -4,18 +4,19 @@ import (
 	"VyacheslavKuchumov/test-backend/service/crmhttp"
 	"VyacheslavKuchumov/test-backend/types"
 	"VyacheslavKuchumov/test-backend/utils"
+	"context"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type Store interface {
-	SearchProjects(archived bool, query types.ListQuery) ([]*types.Project, int, error)
-	ListProjects(archived bool) ([]*types.Project, error)
-	GetProjectByID(id int) (*types.Project, error)
-	CreateProject(payload types.ProjectPayload) ([]*types.Project, error)
-	UpdateProject(id int, payload types.ProjectPayload) ([]*types.Project, error)
-	DeleteProject(id int) ([]*types.Project, error)
+	SearchProjects(ctx context.Context, archived bool, query types.ListQuery) ([]*types.Project, int, error)
+	ListProjects(ctx context.Context, archived bool) ([]*types.Project, error)
+	GetProjectByID(ctx context.Context, id int) (*types.Project, error)
+	CreateProject(ctx context.Context, payload types.ProjectPayload) ([]*types.Project, error)
+	UpdateProject(ctx context.Context, id, version int, payload types.ProjectPayload) ([]*types.Project, error)
+	DeleteProject(ctx context.Context, id, version int) ([]*types.Project, error)
 }
 
 type Service struct {
@@ -42,9 +43,9 @@ func (s *Service) HandleGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	query := crmhttp.ParseListQuery(r)
-	items, total, err := s.store.SearchProjects(false, query)
+	items, total, err := s.store.SearchProjects(r.Context(), false, query)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(items, query.Page, query.PerPage, total))
@@ -55,9 +56,9 @@ func (s *Service) HandleGetArchived(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	query := crmhttp.ParseListQuery(r)
-	items, total, err := s.store.SearchProjects(true, query)
+	items, total, err := s.store.SearchProjects(r.Context(), true, query)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(items, query.Page, query.PerPage, total))
@@ -71,12 +72,12 @@ func (s *Service) HandleGetByID(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	item, err := s.store.GetProjectByID(id)
+	item, err := s.store.GetProjectByID(r.Context(), id)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, item)
+	crmhttp.WriteVersioned(w, item.Version, item)
 }
 
 func (s *Service) HandleCreate(w http.ResponseWriter, r *http.Request) {
@@ -87,9 +88,9 @@ func (s *Service) HandleCreate(w http.ResponseWriter, r *http.Request) {
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	items, err := s.store.CreateProject(payload)
+	items, err := s.store.CreateProject(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusCreated, items)
@@ -103,16 +104,20 @@ func (s *Service) HandleUpdate(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
 	var payload types.ProjectPayload
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	items, err := s.store.UpdateProject(id, payload)
+	items, err := s.store.UpdateProject(r.Context(), id, version, payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, items)
+	crmhttp.WriteUpdated(w, items, id, func(item *types.Project) (int, int) { return item.ProjectID, item.Version })
 }
 
 func (s *Service) HandleDelete(w http.ResponseWriter, r *http.Request) {
@@ -123,9 +128,13 @@ func (s *Service) HandleDelete(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	items, err := s.store.DeleteProject(id)
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	items, err := s.store.DeleteProject(r.Context(), id, version)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, items)
@@ -4,18 +4,20 @@ import (
 	"VyacheslavKuchumov/test-backend/service/crmhttp"
 	"VyacheslavKuchumov/test-backend/types"
 	"VyacheslavKuchumov/test-backend/utils"
+	"context"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type Store interface {
-	SearchProjectTypes(query types.ListQuery) ([]*types.ProjectType, int, error)
-	ListProjectTypes() ([]*types.ProjectType, error)
-	GetProjectTypeByID(id int) (*types.ProjectType, error)
-	CreateProjectType(payload types.ProjectTypePayload) ([]*types.ProjectType, error)
-	UpdateProjectType(id int, payload types.ProjectTypePayload) ([]*types.ProjectType, error)
-	DeleteProjectType(id int) ([]*types.ProjectType, error)
+	SearchProjectTypes(ctx context.Context, query types.ListQuery) ([]*types.ProjectType, int, error)
+	ListProjectTypes(ctx context.Context) ([]*types.ProjectType, error)
+	GetProjectTypeByID(ctx context.Context, id int) (*types.ProjectType, error)
+	CreateProjectType(ctx context.Context, payload types.ProjectTypePayload) ([]*types.ProjectType, error)
+	UpdateProjectType(ctx context.Context, id, version int, payload types.ProjectTypePayload) ([]*types.ProjectType, error)
+	DeleteProjectType(ctx context.Context, id, version int) ([]*types.ProjectType, error)
+	MergeProjectType(ctx context.Context, id, version, targetID int) ([]*types.ProjectType, error)
 }
 
 type Service struct {
@@ -33,6 +35,7 @@ func RegisterRoutes(r chi.Router, service *Service) {
 		rt.Post("/", service.HandleCreate)
 		rt.Put("/{id}", service.HandleUpdate)
 		rt.Delete("/{id}", service.HandleDelete)
+		rt.Post("/{id}/merge", service.HandleMerge)
 	})
 }
 
@@ -41,9 +44,9 @@ func (s *Service) HandleGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	query := crmhttp.ParseListQuery(r)
-	items, total, err := s.store.SearchProjectTypes(query)
+	items, total, err := s.store.SearchProjectTypes(r.Context(), query)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(items, query.Page, query.PerPage, total))
@@ -57,12 +60,12 @@ func (s *Service) HandleGetByID(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	item, err := s.store.GetProjectTypeByID(id)
+	item, err := s.store.GetProjectTypeByID(r.Context(), id)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, item)
+	crmhttp.WriteVersioned(w, item.Version, item)
 }
 
 func (s *Service) HandleCreate(w http.ResponseWriter, r *http.Request) {
@@ -73,9 +76,9 @@ func (s *Service) HandleCreate(w http.ResponseWriter, r *http.Request) {
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	items, err := s.store.CreateProjectType(payload)
+	items, err := s.store.CreateProjectType(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusCreated, items)
@@ -89,16 +92,20 @@ func (s *Service) HandleUpdate(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
 	var payload types.ProjectTypePayload
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	items, err := s.store.UpdateProjectType(id, payload)
+	items, err := s.store.UpdateProjectType(r.Context(), id, version, payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, items)
+	crmhttp.WriteUpdated(w, items, id, func(item *types.ProjectType) (int, int) { return item.ProjectTypeID, item.Version })
 }
 
 func (s *Service) HandleDelete(w http.ResponseWriter, r *http.Request) {
@@ -109,9 +116,37 @@ func (s *Service) HandleDelete(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	items, err := s.store.DeleteProjectType(id)
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	items, err := s.store.DeleteProjectType(r.Context(), id, version)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, items)
+}
+
+func (s *Service) HandleMerge(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	var payload types.MergePayload
+	if !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	items, err := s.store.MergeProjectType(r.Context(), id, version, payload.TargetID)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, items)
@@ -0,0 +1,88 @@
+package stock
+
+import (
+	"VyacheslavKuchumov/test-backend/service/crmhttp"
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"net/http"
+)
+
+func (s *Service) HandleGetInProject(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	projectID, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	response, err := s.store.GetStockInProject(r.Context(), projectID)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+func (s *Service) HandleSetInProject(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	var payload types.StockInProjectPayload
+	if !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	response, err := s.store.SetStockInProject(r.Context(), payload)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+func (s *Service) HandleReturnFromProject(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	var payload types.StockReturnPayload
+	if !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	response, err := s.store.ReturnStockFromProject(r.Context(), payload)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+func (s *Service) HandleGetInDraft(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	draftID, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	response, err := s.store.GetStockInDraft(r.Context(), draftID)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+func (s *Service) HandleSetInDraft(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	var payload types.StockInDraftPayload
+	if !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	response, err := s.store.SetStockInDraft(r.Context(), payload)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, response)
+}
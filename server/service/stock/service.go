@@ -0,0 +1,166 @@
+package stock
+
+import (
+	"VyacheslavKuchumov/test-backend/service/crmhttp"
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type Store interface {
+	SearchStockItems(ctx context.Context, query types.ListQuery) ([]*types.StockItem, int, error)
+	GetStockItemByID(ctx context.Context, id int) (*types.StockItem, error)
+	CreateStockItem(ctx context.Context, payload types.StockItemPayload) ([]*types.StockItem, error)
+	UpdateStockItem(ctx context.Context, id, version int, payload types.StockItemPayload) ([]*types.StockItem, error)
+	DeleteStockItem(ctx context.Context, id, version int) ([]*types.StockItem, error)
+	SetStockLevel(ctx context.Context, id, warehouseID int, payload types.StockLevelPayload) (*types.StockItem, error)
+	GetStockInProject(ctx context.Context, projectID int) (*types.StockInProjectResponse, error)
+	SetStockInProject(ctx context.Context, payload types.StockInProjectPayload) (*types.StockInProjectResponse, error)
+	ReturnStockFromProject(ctx context.Context, payload types.StockReturnPayload) (*types.StockInProjectResponse, error)
+	GetStockInDraft(ctx context.Context, draftID int) (*types.StockInDraftResponse, error)
+	SetStockInDraft(ctx context.Context, payload types.StockInDraftPayload) (*types.StockInDraftResponse, error)
+}
+
+type Service struct {
+	store Store
+}
+
+func NewService(store Store) *Service {
+	return &Service{store: store}
+}
+
+func RegisterRoutes(r chi.Router, service *Service) {
+	r.Route("/stock_items", func(rt chi.Router) {
+		rt.Get("/", service.HandleGet)
+		rt.Get("/{id}", service.HandleGetByID)
+		rt.Post("/", service.HandleCreate)
+		rt.Put("/{id}", service.HandleUpdate)
+		rt.Delete("/{id}", service.HandleDelete)
+		rt.Put("/{id}/levels/{warehouseID}", service.HandleSetLevel)
+	})
+	r.Route("/stock_in_project", func(rt chi.Router) {
+		rt.Get("/{id}", service.HandleGetInProject)
+		rt.Post("/set", service.HandleSetInProject)
+		rt.Post("/return", service.HandleReturnFromProject)
+	})
+	r.Route("/stock_in_draft", func(rt chi.Router) {
+		rt.Get("/{id}", service.HandleGetInDraft)
+		rt.Post("/set", service.HandleSetInDraft)
+	})
+}
+
+func (s *Service) HandleGet(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	query := crmhttp.ParseListQuery(r)
+	items, total, err := s.store.SearchStockItems(r.Context(), query)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(items, query.Page, query.PerPage, total))
+}
+
+func (s *Service) HandleGetByID(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	item, err := s.store.GetStockItemByID(r.Context(), id)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	crmhttp.WriteVersioned(w, item.Version, item)
+}
+
+func (s *Service) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	var payload types.StockItemPayload
+	if !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	items, err := s.store.CreateStockItem(r.Context(), payload)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, items)
+}
+
+func (s *Service) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	var payload types.StockItemPayload
+	if !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	items, err := s.store.UpdateStockItem(r.Context(), id, version, payload)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	crmhttp.WriteUpdated(w, items, id, func(item *types.StockItem) (int, int) { return item.StockItemID, item.Version })
+}
+
+func (s *Service) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	items, err := s.store.DeleteStockItem(r.Context(), id, version)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, items)
+}
+
+func (s *Service) HandleSetLevel(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	warehouseID, ok := crmhttp.MustPathID(w, r, "warehouseID")
+	if !ok {
+		return
+	}
+	var payload types.StockLevelPayload
+	if !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	item, err := s.store.SetStockLevel(r.Context(), id, warehouseID, payload)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, item)
+}
@@ -0,0 +1,116 @@
+package stock
+
+import (
+	"VyacheslavKuchumov/test-backend/service/auth"
+	"VyacheslavKuchumov/test-backend/service/tracker"
+	"VyacheslavKuchumov/test-backend/types"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type mockStore struct {
+	level       *types.StockLevelPayload
+	warehouseID int
+	returned    *types.StockReturnPayload
+}
+
+func (s *mockStore) SearchStockItems(ctx context.Context, query types.ListQuery) ([]*types.StockItem, int, error) {
+	return []*types.StockItem{}, 0, nil
+}
+
+func (s *mockStore) GetStockItemByID(ctx context.Context, id int) (*types.StockItem, error) {
+	return &types.StockItem{StockItemID: id, Version: 4}, nil
+}
+
+func (s *mockStore) CreateStockItem(ctx context.Context, payload types.StockItemPayload) ([]*types.StockItem, error) {
+	return []*types.StockItem{{StockItemID: 1, StockItemName: payload.StockItemName}}, nil
+}
+
+func (s *mockStore) UpdateStockItem(ctx context.Context, id, version int, payload types.StockItemPayload) ([]*types.StockItem, error) {
+	return nil, tracker.ErrVersionConflict
+}
+
+func (s *mockStore) DeleteStockItem(ctx context.Context, id, version int) ([]*types.StockItem, error) {
+	return []*types.StockItem{}, nil
+}
+
+func (s *mockStore) SetStockLevel(ctx context.Context, id, warehouseID int, payload types.StockLevelPayload) (*types.StockItem, error) {
+	s.level = &payload
+	s.warehouseID = warehouseID
+	return &types.StockItem{StockItemID: id, OnHand: payload.Quantity}, nil
+}
+
+func (s *mockStore) GetStockInProject(ctx context.Context, projectID int) (*types.StockInProjectResponse, error) {
+	return &types.StockInProjectResponse{Project: &types.Project{ProjectID: projectID}, Stock: []*types.StockReservation{}}, nil
+}
+
+func (s *mockStore) SetStockInProject(ctx context.Context, payload types.StockInProjectPayload) (*types.StockInProjectResponse, error) {
+	return nil, tracker.ErrInsufficientStock
+}
+
+func (s *mockStore) ReturnStockFromProject(ctx context.Context, payload types.StockReturnPayload) (*types.StockInProjectResponse, error) {
+	s.returned = &payload
+	return s.GetStockInProject(ctx, payload.ProjectID)
+}
+
+func (s *mockStore) GetStockInDraft(ctx context.Context, draftID int) (*types.StockInDraftResponse, error) {
+	return nil, tracker.ErrNotFound
+}
+
+func (s *mockStore) SetStockInDraft(ctx context.Context, payload types.StockInDraftPayload) (*types.StockInDraftResponse, error) {
+	return &types.StockInDraftResponse{Draft: &types.Draft{DraftID: payload.DraftID}, Stock: []*types.StockReservation{}}, nil
+}
+
+func serve(store Store, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	r := chi.NewRouter()
+	RegisterRoutes(r, NewService(store))
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestSetLevelRejectsNegativeQuantity(t *testing.T) {
+	store := &mockStore{}
+
+	if rr := serve(store, http.MethodPut, "/stock_items/2/levels/5", `{"quantity":-1}`, nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a negative quantity, got %d", rr.Code)
+	}
+	rr := serve(store, http.MethodPut, "/stock_items/2/levels/5", `{"quantity":0}`, nil)
+	if rr.Code != http.StatusOK || store.level == nil || store.warehouseID != 5 {
+		t.Fatalf("expected the level of warehouse 5 to be cleared, got %d with %+v in %d", rr.Code, store.level, store.warehouseID)
+	}
+}
+
+func TestReserveBeyondAvailableIsConflict(t *testing.T) {
+	rr := serve(&mockStore{}, http.MethodPost, "/stock_in_project/set", `{"project_id":1,"stock_item_id":2,"quantity":10}`, nil)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rr.Code)
+	}
+}
+
+func TestReturnNeedsWarehouse(t *testing.T) {
+	store := &mockStore{}
+
+	if rr := serve(store, http.MethodPost, "/stock_in_project/return", `{"project_id":1}`, nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a warehouse, got %d", rr.Code)
+	}
+	rr := serve(store, http.MethodPost, "/stock_in_project/return", `{"project_id":1,"warehouse_id":3,"consumed":[{"stock_item_id":2,"quantity":4}]}`, nil)
+	if rr.Code != http.StatusOK || store.returned == nil || store.returned.Consumed[0].Quantity != 4 {
+		t.Fatalf("expected a return with consumption, got %d with %+v", rr.Code, store.returned)
+	}
+}
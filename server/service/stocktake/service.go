@@ -0,0 +1,180 @@
+package stocktake
+
+import (
+	"VyacheslavKuchumov/test-backend/service/crmhttp"
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type Store interface {
+	SearchStocktakes(ctx context.Context, status string, query types.ListQuery) ([]*types.Stocktake, int, error)
+	GetStocktakeByID(ctx context.Context, id int) (*types.Stocktake, error)
+	GetStocktakeReport(ctx context.Context, id int) (*types.StocktakeReport, error)
+	StartStocktake(ctx context.Context, payload types.StocktakePayload) (*types.Stocktake, error)
+	ScanStocktake(ctx context.Context, id int, payload types.StocktakeScanPayload) (*types.StocktakeReport, error)
+	CloseStocktake(ctx context.Context, id, version int) (*types.StocktakeReport, error)
+	ApplyStocktake(ctx context.Context, id, version int, payload types.StocktakeApplyPayload) (*types.StocktakeReport, error)
+}
+
+type Service struct {
+	store Store
+}
+
+func NewService(store Store) *Service {
+	return &Service{store: store}
+}
+
+func RegisterRoutes(r chi.Router, service *Service) {
+	r.Route("/stocktakes", func(rt chi.Router) {
+		rt.Get("/", service.HandleGet)
+		rt.Get("/{id}", service.HandleGetByID)
+		rt.Get("/{id}/report", service.HandleGetReport)
+		rt.Post("/", service.HandleStart)
+		rt.Post("/{id}/scans", service.HandleScan)
+		rt.Post("/{id}/close", service.HandleClose)
+		rt.Post("/{id}/apply", service.HandleApply)
+	})
+}
+
+func (s *Service) HandleGet(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status != "" && !knownStatus(status) {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.Errorf("unknown stocktake status %q", status))
+		return
+	}
+	query := crmhttp.ParseListQuery(r)
+	items, total, err := s.store.SearchStocktakes(r.Context(), status, query)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(items, query.Page, query.PerPage, total))
+}
+
+func (s *Service) HandleGetByID(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	item, err := s.store.GetStocktakeByID(r.Context(), id)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	crmhttp.WriteVersioned(w, item.Version, item)
+}
+
+func (s *Service) HandleGetReport(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	report, err := s.store.GetStocktakeReport(r.Context(), id)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, report)
+}
+
+func (s *Service) HandleStart(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	var payload types.StocktakePayload
+	if !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	item, err := s.store.StartStocktake(r.Context(), payload)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, item)
+}
+
+func (s *Service) HandleScan(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var payload types.StocktakeScanPayload
+	if !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	report, err := s.store.ScanStocktake(r.Context(), id, payload)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, report)
+}
+
+func (s *Service) HandleClose(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	report, err := s.store.CloseStocktake(r.Context(), id, version)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, report)
+}
+
+// HandleApply accepts an empty body, which applies every unexpected item.
+func (s *Service) HandleApply(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	var payload types.StocktakeApplyPayload
+	if r.ContentLength != 0 && !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	report, err := s.store.ApplyStocktake(r.Context(), id, version, payload)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, report)
+}
+
+func knownStatus(status string) bool {
+	switch status {
+	case types.StocktakeStatusOpen, types.StocktakeStatusClosed, types.StocktakeStatusApplied:
+		return true
+	}
+	return false
+}
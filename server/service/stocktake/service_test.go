@@ -0,0 +1,101 @@
+package stocktake
+
+import (
+	"VyacheslavKuchumov/test-backend/service/auth"
+	"VyacheslavKuchumov/test-backend/service/tracker"
+	"VyacheslavKuchumov/test-backend/types"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type mockStore struct {
+	version int
+	apply   *types.StocktakeApplyPayload
+	scan    *types.StocktakeScanPayload
+}
+
+func (s *mockStore) SearchStocktakes(ctx context.Context, status string, query types.ListQuery) ([]*types.Stocktake, int, error) {
+	return []*types.Stocktake{}, 0, nil
+}
+
+func (s *mockStore) GetStocktakeByID(ctx context.Context, id int) (*types.Stocktake, error) {
+	return nil, tracker.ErrNotFound
+}
+
+func (s *mockStore) GetStocktakeReport(ctx context.Context, id int) (*types.StocktakeReport, error) {
+	return &types.StocktakeReport{Stocktake: &types.Stocktake{StocktakeID: id}}, nil
+}
+
+func (s *mockStore) StartStocktake(ctx context.Context, payload types.StocktakePayload) (*types.Stocktake, error) {
+	return &types.Stocktake{StocktakeID: 1, Status: types.StocktakeStatusOpen}, nil
+}
+
+func (s *mockStore) ScanStocktake(ctx context.Context, id int, payload types.StocktakeScanPayload) (*types.StocktakeReport, error) {
+	s.scan = &payload
+	return s.GetStocktakeReport(ctx, id)
+}
+
+func (s *mockStore) CloseStocktake(ctx context.Context, id, version int) (*types.StocktakeReport, error) {
+	return nil, tracker.ErrInvalidTransition
+}
+
+func (s *mockStore) ApplyStocktake(ctx context.Context, id, version int, payload types.StocktakeApplyPayload) (*types.StocktakeReport, error) {
+	s.version = version
+	s.apply = &payload
+	return s.GetStocktakeReport(ctx, id)
+}
+
+func serve(store Store, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	r := chi.NewRouter()
+	RegisterRoutes(r, NewService(store))
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestScanNeedsIDsOrSerialNumbers(t *testing.T) {
+	store := &mockStore{}
+
+	if rr := serve(store, http.MethodPost, "/stocktakes/3/scans", `{}`, nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an empty scan, got %d", rr.Code)
+	}
+	rr := serve(store, http.MethodPost, "/stocktakes/3/scans", `{"serial_numbers":["SN-1"]}`, nil)
+	if rr.Code != http.StatusOK || store.scan == nil || store.scan.SerialNumbers[0] != "SN-1" {
+		t.Fatalf("expected a scan by serial number, got %d with %+v", rr.Code, store.scan)
+	}
+}
+
+func TestApplyAcceptsEmptyBody(t *testing.T) {
+	store := &mockStore{}
+
+	rr := serve(store, http.MethodPost, "/stocktakes/3/apply", "", http.Header{"If-Match": {`"v2"`}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if store.apply == nil || len(store.apply.EquipmentIDs) != 0 || store.version != 2 {
+		t.Fatalf("expected an apply of every item at version 2, got %+v at %d", store.apply, store.version)
+	}
+}
+
+func TestCloseTwiceIsConflict(t *testing.T) {
+	store := &mockStore{}
+
+	if rr := serve(store, http.MethodPost, "/stocktakes/3/close", "", nil); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rr.Code)
+	}
+}
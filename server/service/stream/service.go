@@ -0,0 +1,190 @@
+package stream
+
+import (
+	"VyacheslavKuchumov/test-backend/service/crmhttp"
+	"VyacheslavKuchumov/test-backend/service/events"
+	"VyacheslavKuchumov/test-backend/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultHeartbeat = 25 * time.Second
+	// clientBuffer is how many events a slow client may fall behind before
+	// its stream is closed with a resync event.
+	clientBuffer = 64
+	retryMillis  = 3000
+)
+
+type Subscriber interface {
+	Subscribe(handler func(events.Event)) (unsubscribe func())
+}
+
+type Service struct {
+	bus       Subscriber
+	heartbeat time.Duration
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func NewService(bus Subscriber) *Service {
+	return &Service{bus: bus, heartbeat: defaultHeartbeat, closing: make(chan struct{})}
+}
+
+// Shutdown ends all open streams so a graceful server shutdown does not wait
+// on them. Clients reconnect after the advertised retry delay.
+func (s *Service) Shutdown() {
+	s.closeOnce.Do(func() { close(s.closing) })
+}
+
+func RegisterRoutes(r chi.Router, service *Service) {
+	r.Get("/events", service.HandleStream)
+}
+
+// Filter narrows a stream to one project and/or draft and to a set of event
+// types. Zero values match everything.
+type Filter struct {
+	ProjectID int
+	DraftID   int
+	Types     map[events.Type]struct{}
+}
+
+func (f Filter) Matches(event events.Event) bool {
+	if len(f.Types) > 0 {
+		if _, ok := f.Types[event.Type]; !ok {
+			return false
+		}
+	}
+	if f.ProjectID == 0 && f.DraftID == 0 {
+		return true
+	}
+	return (f.ProjectID > 0 && event.ProjectID == f.ProjectID) ||
+		(f.DraftID > 0 && event.DraftID == f.DraftID)
+}
+
+func ParseFilter(r *http.Request) (Filter, error) {
+	query := r.URL.Query()
+	filter := Filter{}
+
+	var err error
+	if filter.ProjectID, err = parseOptionalID(query.Get("project_id")); err != nil {
+		return filter, fmt.Errorf("invalid project_id")
+	}
+	if filter.DraftID, err = parseOptionalID(query.Get("draft_id")); err != nil {
+		return filter, fmt.Errorf("invalid draft_id")
+	}
+
+	for _, raw := range strings.Split(query.Get("types"), ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if !events.IsKnownType(raw) {
+			return filter, utils.Errorf("unknown event type %q", raw)
+		}
+		if filter.Types == nil {
+			filter.Types = make(map[events.Type]struct{})
+		}
+		filter.Types[events.Type(raw)] = struct{}{}
+	}
+	return filter, nil
+}
+
+// HandleStream pushes matching events as Server-Sent Events until the client
+// disconnects. The event name is the event type and the data is the event
+// JSON, the same body outbound webhooks receive.
+func (s *Service) HandleStream(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	filter, err := ParseFilter(r)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	// The stream outlives the server write timeout.
+	controller.SetWriteDeadline(time.Time{})
+
+	queue := make(chan events.Event, clientBuffer)
+	lagged := make(chan struct{})
+	var lagOnce sync.Once
+	unsubscribe := s.bus.Subscribe(func(event events.Event) {
+		if !filter.Matches(event) {
+			return
+		}
+		select {
+		case queue <- event:
+		default:
+			lagOnce.Do(func() { close(lagged) })
+		}
+	})
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n: connected\n\n", retryMillis)
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(s.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		case <-lagged:
+			// The client missed events; tell it to reload instead of
+			// silently diverging.
+			fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+			controller.Flush()
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event := <-queue:
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+func parseOptionalID(raw string) (int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid id")
+	}
+	return id, nil
+}
@@ -0,0 +1,121 @@
+package stream
+
+import (
+	"VyacheslavKuchumov/test-backend/service/auth"
+	"VyacheslavKuchumov/test-backend/service/events"
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(context.WithValue(r.Context(), auth.UserKey, 1)))
+	}
+}
+
+func TestHandleStreamPushesFilteredEvents(t *testing.T) {
+	bus := events.NewBus()
+	server := httptest.NewServer(withUser(NewService(bus).HandleStream))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?project_id=7", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(line, ": connected") {
+			break
+		}
+	}
+
+	other := events.New(events.EquipmentAddedToProject)
+	other.ProjectID = 8
+	bus.Publish(other)
+	wanted := events.New(events.EquipmentAddedToProject)
+	wanted.ProjectID = 7
+	wanted.EquipmentIDs = []int{3}
+	bus.Publish(wanted)
+
+	var name string
+	var data string
+	for data == "" {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+
+	if name != string(events.EquipmentAddedToProject) {
+		t.Fatalf("unexpected event name %q", name)
+	}
+	var got events.Event
+	if err := json.Unmarshal([]byte(data), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != wanted.ID || got.ProjectID != 7 {
+		t.Fatalf("expected event for project 7, got %+v", got)
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	testCases := []struct {
+		name    string
+		query   string
+		event   events.Event
+		matches bool
+		invalid bool
+	}{
+		{name: "no filter matches all", query: "", event: events.Event{Type: events.EquipmentCreated}, matches: true},
+		{name: "draft filter", query: "draft_id=2", event: events.Event{Type: events.EquipmentAddedToDraft, DraftID: 2}, matches: true},
+		{name: "draft filter skips projects", query: "draft_id=2", event: events.Event{Type: events.ProjectUpdated, ProjectID: 2}, matches: false},
+		{name: "type filter", query: "types=project.updated,project.deleted", event: events.Event{Type: events.ProjectCreated}, matches: false},
+		{name: "unknown type", query: "types=nope", invalid: true},
+		{name: "bad id", query: "project_id=abc", invalid: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/events?"+tc.query, nil)
+			filter, err := ParseFilter(req)
+			if tc.invalid {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if filter.Matches(tc.event) != tc.matches {
+				t.Fatalf("expected match=%v", tc.matches)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const maxQueryText = 2048
+
+// DB wraps *sql.DB so every query gets a client span named after the store
+// method that issued it, e.g. "tracker.listEquipment", with the returned or
+// affected row count. Only the *Context methods are traced; spans are
+// children of the request span carried by ctx.
+type DB struct {
+	*sql.DB
+	component string
+}
+
+// WrapDB returns nil for a nil db, so stores can keep checking for a missing
+// database.
+func WrapDB(db *sql.DB, component string) *DB {
+	if db == nil {
+		return nil
+	}
+	return &DB{DB: db, component: component}
+}
+
+// Querier is the query surface shared by DB and Tx, so store code can run
+// the same statements inside or outside a transaction.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// conn is what *sql.DB and *sql.Tx have in common.
+type conn interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*Rows, error) {
+	return runQuery(ctx, db.DB, db.component, callerName(), query, args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	return runQueryRow(ctx, db.DB, db.component, callerName(), query, args...)
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return runExec(ctx, db.DB, db.component, callerName(), query, args...)
+}
+
+// BeginTx starts a transaction whose queries are traced like the DB's.
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, component: db.component}, nil
+}
+
+type Tx struct {
+	*sql.Tx
+	component string
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...any) (*Rows, error) {
+	return runQuery(ctx, tx.Tx, tx.component, callerName(), query, args...)
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *Row {
+	return runQueryRow(ctx, tx.Tx, tx.component, callerName(), query, args...)
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return runExec(ctx, tx.Tx, tx.component, callerName(), query, args...)
+}
+
+func runQuery(ctx context.Context, c conn, component, caller, query string, args ...any) (*Rows, error) {
+	ctx, span := startSpan(ctx, component, caller, query)
+	rows, err := c.QueryContext(ctx, query, args...)
+	if err != nil {
+		endSpan(span, 0, err)
+		return nil, err
+	}
+	return &Rows{Rows: rows, span: span}, nil
+}
+
+func runQueryRow(ctx context.Context, c conn, component, caller, query string, args ...any) *Row {
+	ctx, span := startSpan(ctx, component, caller, query)
+	return &Row{Row: c.QueryRowContext(ctx, query, args...), span: span}
+}
+
+func runExec(ctx context.Context, c conn, component, caller, query string, args ...any) (sql.Result, error) {
+	ctx, span := startSpan(ctx, component, caller, query)
+	result, err := c.ExecContext(ctx, query, args...)
+	affected := int64(0)
+	if err == nil {
+		affected, _ = result.RowsAffected()
+	}
+	endSpan(span, affected, err)
+	return result, err
+}
+
+func startSpan(ctx context.Context, component, caller, query string) (context.Context, trace.Span) {
+	name := component + "." + caller
+	return tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "postgresql"),
+			attribute.String("db.operation.name", name),
+			attribute.String("db.query.text", compactQuery(query)),
+		),
+	)
+}
+
+// Rows counts rows as they are read and ends the query span on Close.
+type Rows struct {
+	*sql.Rows
+	span  trace.Span
+	count int64
+	ended bool
+}
+
+func (r *Rows) Next() bool {
+	if r.Rows.Next() {
+		r.count++
+		return true
+	}
+	return false
+}
+
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	if !r.ended {
+		r.ended = true
+		spanErr := r.Rows.Err()
+		if spanErr == nil {
+			spanErr = err
+		}
+		endSpan(r.span, r.count, spanErr)
+	}
+	return err
+}
+
+// Row ends its query span on Scan.
+type Row struct {
+	*sql.Row
+	span trace.Span
+}
+
+func (r *Row) Scan(dest ...any) error {
+	err := r.Row.Scan(dest...)
+	switch {
+	case err == nil:
+		endSpan(r.span, 1, nil)
+	case errors.Is(err, sql.ErrNoRows):
+		endSpan(r.span, 0, nil)
+	default:
+		endSpan(r.span, 0, err)
+	}
+	return err
+}
+
+func endSpan(span trace.Span, rows int64, err error) {
+	span.SetAttributes(attribute.Int64("db.response.returned_rows", rows))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// helpers holds the full names of the functions marked with Helper.
+var helpers sync.Map
+
+// Helper marks the calling function as a shared query helper, such as a
+// generic row counter. Like testing.T.Helper, it makes query spans skip the
+// helper and take the name of the store method that called it.
+func Helper() {
+	pc, _, _, ok := runtime.Caller(1)
+	if !ok {
+		return
+	}
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		helpers.LoadOrStore(fn.Name(), struct{}{})
+	}
+}
+
+// callerName returns the unqualified name of the store method calling into
+// DB or Tx, e.g. "listEquipment" for (*Store).listEquipment, skipping
+// functions marked with Helper.
+func callerName() string {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "" {
+			return "query"
+		}
+		if _, helper := helpers.Load(frame.Function); !helper {
+			return shortName(frame.Function)
+		}
+		if !more {
+			return "query"
+		}
+	}
+}
+
+// shortName trims the package and receiver from a full function name.
+func shortName(full string) string {
+	name := full
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	// Closures are reported as "func1" and friends; keep their parent.
+	if strings.HasPrefix(name, "func") {
+		trimmed := strings.TrimSuffix(full, "."+name)
+		if i := strings.LastIndex(trimmed, "."); i >= 0 {
+			name = trimmed[i+1:]
+		}
+	}
+	return name
+}
+
+func compactQuery(query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	if len(query) > maxQueryText {
+		query = query[:maxQueryText]
+	}
+	return query
+}
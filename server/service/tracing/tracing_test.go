@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddlewareContinuesIncomingTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previousProvider := otel.GetTracerProvider()
+	previousPropagator := otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	}()
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/projects/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/projects/7", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /projects/{id}" {
+		t.Fatalf("unexpected span name %q", span.Name())
+	}
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("expected incoming trace id, got %s", got)
+	}
+	if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Fatalf("expected incoming parent span id, got %s", got)
+	}
+	if span.Status().Code.String() != "Error" {
+		t.Fatalf("expected error status for 500 response, got %s", span.Status().Code)
+	}
+}
+
+func TestCompactQuery(t *testing.T) {
+	got := compactQuery(`
+		SELECT id
+		FROM projects
+		WHERE id = $1
+	`)
+	if got != "SELECT id FROM projects WHERE id = $1" {
+		t.Fatalf("unexpected compacted query %q", got)
+	}
+}
+
+type callerProbe struct{}
+
+func (callerProbe) lookup() string {
+	return probe()
+}
+
+func (callerProbe) lookupFromClosure() string {
+	var name string
+	func() {
+		name = probe()
+	}()
+	return name
+}
+
+// probe stands in for a DB method: callerName skips it and reports its caller.
+func probe() string {
+	return callerName()
+}
+
+func (callerProbe) helper() string {
+	Helper()
+	return probe()
+}
+
+func (p callerProbe) lookupThroughHelper() string {
+	return p.helper()
+}
+
+func TestCallerNameReportsStoreMethod(t *testing.T) {
+	if got := (callerProbe{}).lookup(); got != "lookup" {
+		t.Fatalf("expected lookup, got %q", got)
+	}
+	if got := (callerProbe{}).lookupFromClosure(); got != "lookupFromClosure" {
+		t.Fatalf("expected lookupFromClosure, got %q", got)
+	}
+	if got := (callerProbe{}).lookupThroughHelper(); got != "lookupThroughHelper" {
+		t.Fatalf("expected lookupThroughHelper, got %q", got)
+	}
+}
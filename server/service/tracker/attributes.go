@@ -0,0 +1,274 @@
+package tracker
+
+import (
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var attributeKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// checkAttributeSchema rejects schemas with malformed or repeated keys and
+// options on anything but enums, which need at least one.
+func checkAttributeSchema(schema []types.AttributeDefinition) error {
+	seen := make(map[string]bool, len(schema))
+	for _, definition := range schema {
+		if !attributeKeyPattern.MatchString(definition.Key) {
+			return utils.Errorf("%w: attribute key %q must be lowercase letters, digits and underscores", ErrInvalidAttribute, definition.Key)
+		}
+		if seen[definition.Key] {
+			return utils.Errorf("%w: attribute %q is defined twice", ErrInvalidAttribute, definition.Key)
+		}
+		seen[definition.Key] = true
+
+		if definition.Type == types.AttributeTypeEnum && len(definition.Options) == 0 {
+			return utils.Errorf("%w: enum attribute %q needs options", ErrInvalidAttribute, definition.Key)
+		}
+		if definition.Type != types.AttributeTypeEnum && len(definition.Options) > 0 {
+			return utils.Errorf("%w: only enum attributes take options, %q is a %s", ErrInvalidAttribute, definition.Key, definition.Type)
+		}
+	}
+	return nil
+}
+
+// checkAttributes validates values against schema and returns them without
+// null or empty values.
+func checkAttributes(schema []types.AttributeDefinition, values types.Attributes) (types.Attributes, error) {
+	defined := make(map[string]bool, len(schema))
+	for _, definition := range schema {
+		defined[definition.Key] = true
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !defined[key] {
+			return nil, utils.Errorf("%w: unknown attribute %q", ErrInvalidAttribute, key)
+		}
+	}
+
+	result := types.Attributes{}
+	for _, definition := range schema {
+		value := values[definition.Key]
+		if text, ok := value.(string); ok && strings.TrimSpace(text) == "" {
+			value = nil
+		}
+		if value == nil {
+			if definition.Required {
+				return nil, utils.Errorf("%w: attribute %q is required", ErrInvalidAttribute, definition.Key)
+			}
+			continue
+		}
+
+		valid := false
+		switch definition.Type {
+		case types.AttributeTypeString:
+			_, valid = value.(string)
+		case types.AttributeTypeNumber:
+			_, valid = value.(float64)
+		case types.AttributeTypeBoolean:
+			_, valid = value.(bool)
+		case types.AttributeTypeEnum:
+			text, ok := value.(string)
+			if ok && !slices.Contains(definition.Options, text) {
+				return nil, utils.Errorf("%w: attribute %q must be one of %s", ErrInvalidAttribute, definition.Key, strings.Join(definition.Options, ", "))
+			}
+			valid = ok
+		}
+		if !valid {
+			return nil, utils.Errorf("%w: attribute %q must be a %s", ErrInvalidAttribute, definition.Key, definition.Type)
+		}
+		result[definition.Key] = value
+	}
+	return result, nil
+}
+
+// equipmentAttributes checks payload attributes against the schema of the
+// set type of an equipment set and returns them as JSON for the equipment
+// row. Omitted attributes give nil, which keeps the stored values: a new item
+// is checked as having none, so required attributes cannot be skipped, and
+// the stored values of equipment id are checked when it moves to a set of
+// another set type.
+func (s *Store) equipmentAttributes(ctx context.Context, id, equipmentSetID int, values types.Attributes) (any, error) {
+	var setTypeID int
+	err := s.conn(ctx).QueryRowContext(ctx, `
+		SELECT set_type_id FROM equipment_sets WHERE equipment_set_id = $1
+	`, equipmentSetID).Scan(&setTypeID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	schema, err := s.attributeSchema(ctx, setTypeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if values == nil && id > 0 {
+		var raw string
+		var currentSetTypeID int
+		err := s.conn(ctx).QueryRowContext(ctx, `
+			SELECT e.attributes::TEXT, es.set_type_id
+			FROM equipment e
+			JOIN equipment_sets es ON es.equipment_set_id = e.equipment_set_id
+			WHERE e.equipment_id = $1
+		`, id).Scan(&raw, &currentSetTypeID)
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if currentSetTypeID == setTypeID {
+			return nil, nil
+		}
+		var stored types.Attributes
+		if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+			return nil, err
+		}
+		_, err = checkAttributes(schema, stored)
+		return nil, err
+	}
+
+	checked, err := checkAttributes(schema, values)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(checked)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// requireAttributesFit refuses to move the equipment of equipmentSetIDs to
+// set type setTypeID when the stored attributes of an item of another set
+// type do not fit its schema. Trashed items count too, as they can be
+// restored.
+func (s *Store) requireAttributesFit(ctx context.Context, setTypeID int, equipmentSetIDs []int) error {
+	schema, err := s.attributeSchema(ctx, setTypeID)
+	if err != nil {
+		return err
+	}
+	return s.requireSchemaFits(ctx, schema, `
+		e.equipment_set_id IN (SELECT jsonb_array_elements_text($1::JSONB)::BIGINT)
+		AND es.set_type_id <> $2
+	`, idsJSON(equipmentSetIDs), setTypeID)
+}
+
+// requireSchemaFits fails when the stored attributes of an equipment item
+// matched by where, a condition on equipment e and its set es, do not fit
+// schema.
+func (s *Store) requireSchemaFits(ctx context.Context, schema []types.AttributeDefinition, where string, args ...any) error {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+		SELECT e.equipment_id, e.attributes::TEXT
+		FROM equipment e
+		JOIN equipment_sets es ON es.equipment_set_id = e.equipment_set_id
+		WHERE `+where+`
+		ORDER BY e.equipment_id ASC
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var equipmentID int
+		var raw string
+		if err := rows.Scan(&equipmentID, &raw); err != nil {
+			return err
+		}
+		var stored types.Attributes
+		if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+			return err
+		}
+		if _, err := checkAttributes(schema, stored); err != nil {
+			return utils.Errorf("equipment %d: %w", equipmentID, err)
+		}
+	}
+	return rows.Err()
+}
+
+// attributeSchema returns the attribute schema of a set type.
+func (s *Store) attributeSchema(ctx context.Context, setTypeID int) ([]types.AttributeDefinition, error) {
+	var raw string
+	err := s.conn(ctx).QueryRowContext(ctx, `
+		SELECT attributes::TEXT FROM set_types WHERE set_type_id = $1
+	`, setTypeID).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var schema []types.AttributeDefinition
+	if err := json.Unmarshal([]byte(raw), &schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// schemaJSON returns a set type schema as JSON, or nil when it was omitted.
+func schemaJSON(schema []types.AttributeDefinition) (any, error) {
+	if schema == nil {
+		return nil, nil
+	}
+	if err := checkAttributeSchema(schema); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// matchesAttributes reports whether item has every attribute value of
+// filter. Strings and enums compare case-insensitively, numbers and booleans
+// by value.
+func matchesAttributes(item *types.Equipment, filter map[string]string) bool {
+	for key, want := range filter {
+		switch value := item.Attributes[key].(type) {
+		case string:
+			if !strings.EqualFold(value, strings.TrimSpace(want)) {
+				return false
+			}
+		case float64:
+			number, err := strconv.ParseFloat(strings.TrimSpace(want), 64)
+			if err != nil || number != value {
+				return false
+			}
+		case bool:
+			flag, err := strconv.ParseBool(strings.TrimSpace(want))
+			if err != nil || flag != value {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// attributeText lists attribute values as text for search.
+func attributeText(values types.Attributes) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		switch value := value.(type) {
+		case string:
+			result = append(result, value)
+		case float64:
+			result = append(result, strconv.FormatFloat(value, 'f', -1, 64))
+		}
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+package tracker
+
+import (
+	"VyacheslavKuchumov/test-backend/types"
+	"errors"
+	"testing"
+)
+
+var cameraSchema = []types.AttributeDefinition{
+	{Key: "lens_mount", Type: types.AttributeTypeEnum, Options: []string{"EF", "PL", "E"}, Required: true},
+	{Key: "sensor_format", Type: types.AttributeTypeString},
+	{Key: "weight_kg", Type: types.AttributeTypeNumber},
+	{Key: "has_sdi", Type: types.AttributeTypeBoolean},
+}
+
+func TestCheckAttributeSchema(t *testing.T) {
+	cases := []struct {
+		name   string
+		schema []types.AttributeDefinition
+		valid  bool
+	}{
+		{name: "camera", schema: cameraSchema, valid: true},
+		{name: "bad key", schema: []types.AttributeDefinition{{Key: "Lens Mount", Type: types.AttributeTypeString}}},
+		{name: "repeated key", schema: []types.AttributeDefinition{{Key: "band", Type: types.AttributeTypeString}, {Key: "band", Type: types.AttributeTypeNumber}}},
+		{name: "enum without options", schema: []types.AttributeDefinition{{Key: "band", Type: types.AttributeTypeEnum}}},
+		{name: "options on a string", schema: []types.AttributeDefinition{{Key: "band", Type: types.AttributeTypeString, Options: []string{"UHF"}}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkAttributeSchema(tc.schema)
+			if tc.valid && err != nil {
+				t.Fatalf("expected a valid schema, got %v", err)
+			}
+			if !tc.valid && !errors.Is(err, ErrInvalidAttribute) {
+				t.Fatalf("expected ErrInvalidAttribute, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckAttributes(t *testing.T) {
+	values, err := checkAttributes(cameraSchema, types.Attributes{"lens_mount": "PL", "weight_kg": 2.5, "sensor_format": "", "has_sdi": nil})
+	if err != nil {
+		t.Fatalf("expected valid attributes, got %v", err)
+	}
+	if len(values) != 2 || values["lens_mount"] != "PL" || values["weight_kg"] != 2.5 {
+		t.Fatalf("expected empty values to be dropped, got %v", values)
+	}
+
+	invalid := []types.Attributes{
+		{"weight_kg": 2.5},
+		{"lens_mount": "MFT"},
+		{"lens_mount": "EF", "weight_kg": "2.5"},
+		{"lens_mount": "EF", "has_sdi": "yes"},
+		{"lens_mount": "EF", "color": "black"},
+	}
+	for _, attributes := range invalid {
+		if _, err := checkAttributes(cameraSchema, attributes); !errors.Is(err, ErrInvalidAttribute) {
+			t.Fatalf("expected ErrInvalidAttribute for %v, got %v", attributes, err)
+		}
+	}
+}
+
+func TestMatchesAttributes(t *testing.T) {
+	item := &types.Equipment{Attributes: types.Attributes{"lens_mount": "PL", "weight_kg": 2.5, "has_sdi": true}}
+
+	if !matchesAttributes(item, map[string]string{"lens_mount": "pl", "weight_kg": "2.50", "has_sdi": "true"}) {
+		t.Fatal("expected the item to match")
+	}
+	for _, filter := range []map[string]string{
+		{"lens_mount": "EF"},
+		{"weight_kg": "3"},
+		{"has_sdi": "false"},
+		{"sensor_format": "S35"},
+	} {
+		if matchesAttributes(item, filter) {
+			t.Fatalf("expected no match for %v", filter)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package tracker
+
+import "VyacheslavKuchumov/test-backend/types"
+
+// DependentsError is returned when a delete is refused because other rows
+// still reference the record. Summary wraps ErrInUse in a catalog message
+// meant for people; Dependents is the same for clients.
+type DependentsError struct {
+	Dependents []types.Dependent
+	Summary    error
+}
+
+func dependentsError(kind string, count int, summary error) *DependentsError {
+	return &DependentsError{
+		Dependents: []types.Dependent{{Kind: kind, Count: count}},
+		Summary:    summary,
+	}
+}
+
+func (e *DependentsError) Error() string {
+	return e.Summary.Error()
+}
+
+func (e *DependentsError) Unwrap() error {
+	return e.Summary
+}
@@ -0,0 +1,236 @@
+package tracker
+
+import (
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+)
+
+// ListLocations returns the locations of a warehouse ordered by path, so
+// every location follows its parent.
+func (s *Store) ListLocations(ctx context.Context, warehouseID int) ([]*types.Location, error) {
+	if _, err := s.getWarehouse(ctx, warehouseID); err != nil {
+		return nil, err
+	}
+	return s.listLocations(ctx, "l.warehouse_id = $1", warehouseID)
+}
+
+func (s *Store) GetLocationByID(ctx context.Context, warehouseID, id int) (*types.Location, error) {
+	items, err := s.listLocations(ctx, "l.warehouse_id = $1 AND l.location_id = $2", warehouseID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+	return items[0], nil
+}
+
+func (s *Store) CreateLocation(ctx context.Context, warehouseID int, payload types.LocationPayload) ([]*types.Location, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.Location, error) {
+		if _, err := s.getWarehouse(ctx, warehouseID); err != nil {
+			return nil, err
+		}
+		if err := s.checkPlacement(ctx, warehouseID, 0, payload); err != nil {
+			return nil, err
+		}
+		if _, err := s.conn(ctx).ExecContext(ctx, `
+			INSERT INTO warehouse_locations (warehouse_id, parent_id, kind, location_name)
+			VALUES ($1, NULLIF($2, 0), $3, $4)
+		`, warehouseID, payload.ParentID, payload.Kind, payload.LocationName); err != nil {
+			return nil, err
+		}
+		return s.listLocations(ctx, "l.warehouse_id = $1", warehouseID)
+	})
+}
+
+func (s *Store) UpdateLocation(ctx context.Context, warehouseID, id, version int, payload types.LocationPayload) ([]*types.Location, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.Location, error) {
+		if _, err := s.GetLocationByID(ctx, warehouseID, id); err != nil {
+			return nil, err
+		}
+		if err := s.checkPlacement(ctx, warehouseID, id, payload); err != nil {
+			return nil, err
+		}
+		result, err := s.conn(ctx).ExecContext(ctx, `
+			UPDATE warehouse_locations
+			SET parent_id = NULLIF($1, 0), kind = $2, location_name = $3, version = version + 1
+			WHERE location_id = $4 AND ($5 = 0 OR version = $5)
+		`, payload.ParentID, payload.Kind, payload.LocationName, id, version)
+		if err != nil {
+			return nil, err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return nil, s.missingOrConflict(ctx, "warehouse_locations", "location_id", id)
+		}
+		return s.listLocations(ctx, "l.warehouse_id = $1", warehouseID)
+	})
+}
+
+// DeleteLocation removes an empty location. Locations that still hold other
+// locations or equipment, trashed equipment included, are refused.
+func (s *Store) DeleteLocation(ctx context.Context, warehouseID, id, version int) ([]*types.Location, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.Location, error) {
+		if _, err := s.GetLocationByID(ctx, warehouseID, id); err != nil {
+			return nil, err
+		}
+		count, err := s.countRows(ctx, `SELECT COUNT(*) FROM warehouse_locations WHERE parent_id = $1`, id)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, dependentsError("locations", count, utils.Errorf("%w: %d locations inside this location", ErrInUse, count))
+		}
+		count, err = s.countRows(ctx, `SELECT COUNT(*) FROM equipment WHERE location_id = $1`, id)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, dependentsError("equipment", count, utils.Errorf("%w: %d equipment items in this location", ErrInUse, count))
+		}
+		if err := s.deleteRow(ctx, "warehouse_locations", "location_id", id, version); err != nil {
+			return nil, err
+		}
+		return s.listLocations(ctx, "l.warehouse_id = $1", warehouseID)
+	})
+}
+
+// GetWarehouseContents lists every location of a warehouse with the
+// equipment stored in it, empty locations included.
+func (s *Store) GetWarehouseContents(ctx context.Context, warehouseID int) (*types.WarehouseContents, error) {
+	warehouse, err := s.getWarehouse(ctx, warehouseID)
+	if err != nil {
+		return nil, err
+	}
+	locations, err := s.listLocations(ctx, "l.warehouse_id = $1", warehouseID)
+	if err != nil {
+		return nil, err
+	}
+	equipment, err := s.listEquipment(ctx, "e.storage_id = $1", warehouseID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &types.WarehouseContents{
+		Warehouse: warehouse,
+		Locations: make([]*types.LocationContents, 0, len(locations)),
+		Unplaced:  []*types.Equipment{},
+	}
+	byLocationID := map[int]*types.LocationContents{}
+	for _, location := range locations {
+		contents := &types.LocationContents{Location: location, Equipment: []*types.Equipment{}}
+		result.Locations = append(result.Locations, contents)
+		byLocationID[location.LocationID] = contents
+	}
+	for _, item := range equipment {
+		if contents, ok := byLocationID[item.LocationID]; ok {
+			contents.Equipment = append(contents.Equipment, item)
+		} else {
+			result.Unplaced = append(result.Unplaced, item)
+		}
+	}
+	return result, nil
+}
+
+// checkPlacement validates where payload puts location id (0 for a new one):
+// its parent must be in the same warehouse and of an outer kind, and its own
+// children must stay of inner kinds. This also rules out cycles.
+func (s *Store) checkPlacement(ctx context.Context, warehouseID, id int, payload types.LocationPayload) error {
+	if payload.ParentID > 0 {
+		parentKind, err := s.locationKind(ctx, warehouseID, payload.ParentID)
+		if err != nil {
+			return err
+		}
+		if locationRank(payload.Kind) <= locationRank(parentKind) {
+			return utils.Errorf("%w: a %s cannot be placed inside a %s", ErrInvalidReference, payload.Kind, parentKind)
+		}
+	}
+	if id == 0 {
+		return nil
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx, `SELECT DISTINCT kind FROM warehouse_locations WHERE parent_id = $1`, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var childKind string
+		if err := rows.Scan(&childKind); err != nil {
+			return err
+		}
+		if locationRank(childKind) <= locationRank(payload.Kind) {
+			return utils.Errorf("%w: a %s cannot be placed inside a %s", ErrInvalidReference, childKind, payload.Kind)
+		}
+	}
+	return rows.Err()
+}
+
+// locationKind returns the kind of a location referenced by a payload,
+// which has to be in warehouseID.
+func (s *Store) locationKind(ctx context.Context, warehouseID, id int) (string, error) {
+	var kind string
+	err := s.conn(ctx).QueryRowContext(ctx, `
+		SELECT kind FROM warehouse_locations WHERE location_id = $1 AND warehouse_id = $2
+	`, id, warehouseID).Scan(&kind)
+	if err == sql.ErrNoRows {
+		return "", utils.Errorf("%w: no location %d in warehouse %d", ErrInvalidReference, id, warehouseID)
+	}
+	return kind, err
+}
+
+func locationRank(kind string) int {
+	return slices.Index(types.LocationKinds, kind)
+}
+
+func (s *Store) getWarehouse(ctx context.Context, id int) (*types.Warehouse, error) {
+	item := new(types.Warehouse)
+	err := s.conn(ctx).QueryRowContext(ctx, `
+		SELECT warehouse_id, warehouse_name, COALESCE(warehouse_adress, ''), version FROM warehouses WHERE warehouse_id = $1
+	`, id).Scan(&item.WarehouseID, &item.WarehouseName, &item.WarehouseAdress, &item.Version)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *Store) listLocations(ctx context.Context, filter string, args ...any) ([]*types.Location, error) {
+	query := `
+		SELECT
+			l.location_id,
+			l.warehouse_id,
+			COALESCE(l.parent_id, 0),
+			l.kind,
+			l.location_name,
+			COALESCE(p.path, ''),
+			l.version
+		FROM warehouse_locations l
+		LEFT JOIN warehouse_location_paths p ON p.location_id = l.location_id
+	`
+	if strings.TrimSpace(filter) != "" {
+		query += " WHERE " + filter
+	}
+	query += " ORDER BY l.warehouse_id ASC, p.path ASC, l.location_id ASC"
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*types.Location, 0)
+	for rows.Next() {
+		item := new(types.Location)
+		if err := rows.Scan(&item.LocationID, &item.WarehouseID, &item.ParentID, &item.Kind, &item.LocationName, &item.Path, &item.Version); err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, rows.Err()
+}
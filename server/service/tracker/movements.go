@@ -0,0 +1,269 @@
+package tracker
+
+import (
+	"VyacheslavKuchumov/test-backend/service/auth"
+	"VyacheslavKuchumov/test-backend/service/events"
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+)
+
+// ListEquipmentMovements returns the warehouse timeline of an item, oldest
+// move first.
+func (s *Store) ListEquipmentMovements(ctx context.Context, equipmentID int) ([]*types.EquipmentMovement, error) {
+	var exists bool
+	if err := s.conn(ctx).QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM equipment WHERE equipment_id = $1 AND deleted_at IS NULL)
+	`, equipmentID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return s.listMovements(ctx, "m.equipment_id = $1", equipmentID)
+}
+
+func (s *Store) SearchEquipmentMovements(ctx context.Context, equipmentID int, query types.ListQuery) ([]*types.EquipmentMovement, int, error) {
+	items, err := s.ListEquipmentMovements(ctx, equipmentID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	search := normalizeSearchQuery(query.Search)
+	filtered := make([]*types.EquipmentMovement, 0, len(items))
+	for _, item := range items {
+		var from, to, movedBy string
+		if item.FromWarehouse != nil {
+			from = item.FromWarehouse.WarehouseName
+		}
+		if item.ToWarehouse != nil {
+			to = item.ToWarehouse.WarehouseName
+		}
+		if item.MovedBy != nil {
+			movedBy = item.MovedBy.Name
+		}
+		if matchesSearch(search, from, to, movedBy, item.Reason) {
+			filtered = append(filtered, item)
+		}
+	}
+
+	return paginateSlice(filtered, query), len(filtered), nil
+}
+
+// MoveEquipment moves items to a warehouse right away and records a movement
+// for each one that was stored elsewhere.
+func (s *Store) MoveEquipment(ctx context.Context, payload types.EquipmentMovePayload) ([]*types.EquipmentMovement, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.EquipmentMovement, error) {
+		warehouseID, err := s.getWarehouseID(ctx, payload.WarehouseID, payload.WarehouseName)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.requireEquipment(ctx, payload.EquipmentIDs, 0); err != nil {
+			return nil, err
+		}
+		if err := s.requireNoOpenTransfer(ctx, payload.EquipmentIDs); err != nil {
+			return nil, err
+		}
+		return s.moveEquipment(ctx, payload.EquipmentIDs, warehouseID, payload.Reason, 0, 0)
+	})
+}
+
+// moveEquipment stores equipmentIDs in warehouseID, without a location, logs
+// a movement for each item that was elsewhere and returns those movements.
+// Trashed items stay put. A transferID or stocktakeID of 0 means the move is
+// not part of a transfer or of applying a stocktake.
+func (s *Store) moveEquipment(ctx context.Context, equipmentIDs []int, warehouseID int, reason string, transferID, stocktakeID int) ([]*types.EquipmentMovement, error) {
+	movementIDs, err := s.queryIDs(ctx, `
+		WITH moved AS (
+			UPDATE equipment e
+			SET storage_id = $2, location_id = NULL, version = e.version + 1
+			FROM equipment previous
+			WHERE previous.equipment_id = e.equipment_id
+			  AND e.equipment_id IN (SELECT jsonb_array_elements_text($1::JSONB)::BIGINT)
+			  AND e.deleted_at IS NULL
+			  AND e.storage_id <> $2
+			RETURNING e.equipment_id, previous.storage_id
+		)
+		INSERT INTO equipment_movements (equipment_id, from_warehouse_id, to_warehouse_id, moved_by, reason, transfer_id, stocktake_id)
+		SELECT equipment_id, storage_id, $2, $3, NULLIF($4, ''), NULLIF($5, 0), NULLIF($6, 0) FROM moved
+		RETURNING movement_id
+	`, idsJSON(equipmentIDs), warehouseID, actorID(ctx), reason, transferID, stocktakeID)
+	if err != nil {
+		return nil, err
+	}
+	if len(movementIDs) == 0 {
+		return []*types.EquipmentMovement{}, nil
+	}
+
+	movements, err := s.listMovements(ctx, "m.movement_id IN (SELECT jsonb_array_elements_text($1::JSONB)::BIGINT)", idsJSON(movementIDs))
+	if err != nil {
+		return nil, err
+	}
+	for _, movement := range movements {
+		s.publishEquipment(ctx, events.EquipmentUpdated, movement.EquipmentID)
+	}
+	return movements, nil
+}
+
+// recordMovement logs a single warehouse change made by an equipment write.
+// A fromWarehouseID of 0 marks the item's first placement.
+func (s *Store) recordMovement(ctx context.Context, equipmentID, fromWarehouseID, toWarehouseID int) error {
+	_, err := s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO equipment_movements (equipment_id, from_warehouse_id, to_warehouse_id, moved_by)
+		VALUES ($1, NULLIF($2, 0), $3, $4)
+	`, equipmentID, fromWarehouseID, toWarehouseID, actorID(ctx))
+	return err
+}
+
+// requireEquipment checks that every item exists outside the trash and, when
+// warehouseID is set, is stored there.
+func (s *Store) requireEquipment(ctx context.Context, equipmentIDs []int, warehouseID int) error {
+	found, err := s.queryIDs(ctx, `
+		SELECT equipment_id FROM equipment
+		WHERE equipment_id IN (SELECT jsonb_array_elements_text($1::JSONB)::BIGINT)
+		  AND deleted_at IS NULL
+		  AND ($2 = 0 OR storage_id = $2)
+	`, idsJSON(equipmentIDs), warehouseID)
+	if err != nil {
+		return err
+	}
+
+	present := make(map[int]bool, len(found))
+	for _, id := range found {
+		present[id] = true
+	}
+	for _, id := range equipmentIDs {
+		if present[id] {
+			continue
+		}
+		if warehouseID > 0 {
+			return utils.Errorf("%w: equipment %d is not stored in warehouse %d", ErrInvalidReference, id, warehouseID)
+		}
+		return utils.Errorf("%w: no %s row with id %d", ErrInvalidReference, "equipment", id)
+	}
+	return nil
+}
+
+// requireNoOpenTransfer refuses to move items that a pending or in transit
+// transfer is holding on to.
+func (s *Store) requireNoOpenTransfer(ctx context.Context, equipmentIDs []int) error {
+	var equipmentID, transferID int
+	err := s.conn(ctx).QueryRowContext(ctx, `
+		SELECT ti.equipment_id, ti.transfer_id
+		FROM warehouse_transfer_items ti
+		JOIN warehouse_transfers t ON t.transfer_id = ti.transfer_id
+		WHERE ti.equipment_id IN (SELECT jsonb_array_elements_text($1::JSONB)::BIGINT)
+		  AND t.status IN ('pending', 'in_transit')
+		ORDER BY ti.equipment_id ASC
+		LIMIT 1
+	`, idsJSON(equipmentIDs)).Scan(&equipmentID, &transferID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return utils.Errorf("%w: equipment %d is on transfer %d", ErrInTransfer, equipmentID, transferID)
+}
+
+func (s *Store) listMovements(ctx context.Context, filter string, args ...any) ([]*types.EquipmentMovement, error) {
+	query := `
+		SELECT
+			m.movement_id,
+			m.equipment_id,
+			COALESCE(fw.warehouse_id, 0),
+			COALESCE(fw.warehouse_name, ''),
+			COALESCE(tw.warehouse_id, 0),
+			COALESCE(tw.warehouse_name, ''),
+			COALESCE(u.id, 0),
+			COALESCE(u.name, ''),
+			COALESCE(m.reason, ''),
+			COALESCE(m.transfer_id, 0),
+			COALESCE(m.stocktake_id, 0),
+			m.moved_at
+		FROM equipment_movements m
+		LEFT JOIN warehouses fw ON fw.warehouse_id = m.from_warehouse_id
+		LEFT JOIN warehouses tw ON tw.warehouse_id = m.to_warehouse_id
+		LEFT JOIN users u ON u.id = m.moved_by
+	`
+	if strings.TrimSpace(filter) != "" {
+		query += " WHERE " + filter
+	}
+	query += " ORDER BY m.moved_at ASC, m.movement_id ASC"
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*types.EquipmentMovement, 0)
+	for rows.Next() {
+		item := new(types.EquipmentMovement)
+		var from, to types.Warehouse
+		var movedBy types.UserShort
+		var transferID, stocktakeID int
+		if err := rows.Scan(
+			&item.MovementID,
+			&item.EquipmentID,
+			&from.WarehouseID,
+			&from.WarehouseName,
+			&to.WarehouseID,
+			&to.WarehouseName,
+			&movedBy.ID,
+			&movedBy.Name,
+			&item.Reason,
+			&transferID,
+			&stocktakeID,
+			&item.MovedAt,
+		); err != nil {
+			return nil, err
+		}
+		item.FromWarehouse = optionalWarehouse(from)
+		item.ToWarehouse = optionalWarehouse(to)
+		item.MovedBy = optionalUser(movedBy)
+		if transferID > 0 {
+			item.TransferID = &transferID
+		}
+		if stocktakeID > 0 {
+			item.StocktakeID = &stocktakeID
+		}
+		result = append(result, item)
+	}
+	return result, rows.Err()
+}
+
+func optionalWarehouse(warehouse types.Warehouse) *types.Warehouse {
+	if warehouse.WarehouseID == 0 {
+		return nil
+	}
+	return &warehouse
+}
+
+func optionalUser(user types.UserShort) *types.UserShort {
+	if user.ID == 0 {
+		return nil
+	}
+	return &user
+}
+
+// actorID is the signed-in user making the change, or nil for background
+// jobs and imports.
+func actorID(ctx context.Context) any {
+	if userID := auth.GetUserIDFromContext(ctx); userID > 0 {
+		return userID
+	}
+	return nil
+}
+
+// idsJSON encodes ids for a `jsonb_array_elements_text($n::JSONB)` argument.
+func idsJSON(ids []int) string {
+	if ids == nil {
+		ids = []int{}
+	}
+	data, _ := json.Marshal(ids)
+	return string(data)
+}
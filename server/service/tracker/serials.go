@@ -0,0 +1,235 @@
+package tracker
+
+import (
+	"VyacheslavKuchumov/test-backend/service/events"
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+)
+
+// serialKey is the SQL expression that normalizes the serial number in
+// placeholder the way the generated serial_key column does: lowercased with
+// all whitespace removed.
+func serialKey(placeholder string) string {
+	return `LOWER(REGEXP_REPLACE(` + placeholder + `, '\s', '', 'g'))`
+}
+
+// duplicateGroup identifies a group of the duplicate report. setID is 0 when
+// the report spans sets.
+type duplicateGroup struct {
+	setID int
+	key   string
+}
+
+// requireUniqueSerial checks that no live equipment other than id has serial
+// in equipmentSetID. Equipment that keeps its set and serial passes as is, so
+// items that already collided when uniqueness came in can still be edited.
+func (s *Store) requireUniqueSerial(ctx context.Context, id, equipmentSetID int, serial string) error {
+	var otherID int
+	err := s.conn(ctx).QueryRowContext(ctx, `
+		SELECT o.equipment_id
+		FROM equipment o
+		WHERE o.deleted_at IS NULL
+		  AND o.equipment_id <> $1
+		  AND o.equipment_set_id = $2
+		  AND o.serial_key = `+serialKey("$3")+`
+		  AND NOT EXISTS (
+			SELECT 1 FROM equipment self
+			WHERE self.equipment_id = $1 AND self.deleted_at IS NULL
+			  AND self.equipment_set_id = $2 AND self.serial_key = `+serialKey("$3")+`
+		  )
+		ORDER BY o.equipment_id ASC
+		LIMIT 1
+	`, id, equipmentSetID, serial).Scan(&otherID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return utils.Errorf("%w: serial number %q is already used by equipment %d in this set", ErrDuplicateSerial, serial, otherID)
+}
+
+// restoreSerial checks that trashed equipment id can come back without its
+// serial number colliding with live equipment of its set.
+func (s *Store) restoreSerial(ctx context.Context, id int) error {
+	var equipmentSetID int
+	var serial string
+	err := s.conn(ctx).QueryRowContext(ctx, `
+		SELECT equipment_set_id, serial_number FROM equipment WHERE equipment_id = $1
+	`, id).Scan(&equipmentSetID, &serial)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.requireUniqueSerial(ctx, id, equipmentSetID, serial); err != nil {
+		return err
+	}
+	_, err = s.conn(ctx).ExecContext(ctx, `UPDATE equipment SET serial_exempt = FALSE WHERE equipment_id = $1 AND deleted_at IS NOT NULL`, id)
+	return err
+}
+
+// requireDisjointSerials checks that the live equipment of two sets shares
+// no serial number, so merging one set into the other keeps them unique.
+func (s *Store) requireDisjointSerials(ctx context.Context, setID, otherSetID int) error {
+	var serial string
+	err := s.conn(ctx).QueryRowContext(ctx, `
+		SELECT e.serial_number
+		FROM equipment e
+		JOIN equipment o ON o.serial_key = e.serial_key AND o.equipment_set_id = $2 AND o.deleted_at IS NULL
+		WHERE e.equipment_set_id = $1 AND e.deleted_at IS NULL
+		ORDER BY e.equipment_id ASC
+		LIMIT 1
+	`, setID, otherSetID).Scan(&serial)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return utils.Errorf("%w: serial number %q is used in both sets", ErrDuplicateSerial, serial)
+}
+
+// ListSerialDuplicates returns groups of live equipment sharing a serial
+// number within a set, or in any set when acrossSets is set.
+func (s *Store) ListSerialDuplicates(ctx context.Context, acrossSets bool) ([]*types.SerialDuplicate, error) {
+	sameSet := "AND o.equipment_set_id = e.equipment_set_id"
+	if acrossSets {
+		sameSet = ""
+	}
+	items, err := s.listEquipment(ctx, `EXISTS (
+		SELECT 1 FROM equipment o
+		WHERE o.deleted_at IS NULL AND o.equipment_id <> e.equipment_id
+		  AND o.serial_key = e.serial_key `+sameSet+`
+	)`)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[duplicateGroup]*types.SerialDuplicate)
+	groups := make([]*types.SerialDuplicate, 0)
+	for _, item := range items {
+		groupKey := duplicateGroup{key: strings.ToLower(strings.Join(strings.Fields(item.SerialNumber), ""))}
+		if !acrossSets {
+			groupKey.setID = item.EquipmentSetID
+		}
+		group, ok := byKey[groupKey]
+		if !ok {
+			group = &types.SerialDuplicate{SerialKey: groupKey.key, Equipment: make([]*types.Equipment, 0, 2)}
+			byKey[groupKey] = group
+			groups = append(groups, group)
+		}
+		group.Equipment = append(group.Equipment, item)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].SerialKey < groups[j].SerialKey
+	})
+	for _, group := range groups {
+		sort.Slice(group.Equipment, func(i, j int) bool {
+			return group.Equipment[i].EquipmentID < group.Equipment[j].EquipmentID
+		})
+	}
+	return groups, nil
+}
+
+func (s *Store) SearchSerialDuplicates(ctx context.Context, acrossSets bool, query types.ListQuery) ([]*types.SerialDuplicate, int, error) {
+	groups, err := s.ListSerialDuplicates(ctx, acrossSets)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	search := normalizeSearchQuery(query.Search)
+	filtered := make([]*types.SerialDuplicate, 0, len(groups))
+	for _, group := range groups {
+		values := []string{group.SerialKey}
+		for _, item := range group.Equipment {
+			values = append(values, item.EquipmentName, item.SerialNumber)
+		}
+		if matchesSearch(search, values...) {
+			filtered = append(filtered, group)
+		}
+	}
+	return paginateSlice(filtered, query), len(filtered), nil
+}
+
+// MergeEquipment folds equipment id into targetID and deletes id. Project
+// and draft bookings, transfer items, stocktake scans and results and the
+// movement history move to the target; a project or draft that already holds the
+// target keeps a single booking. Fields the target left empty are taken from
+// id, and so are attributes it lacks when both are in the same set.
+func (s *Store) MergeEquipment(ctx context.Context, id, version, targetID int) (*types.Equipment, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.Equipment, error) {
+		if _, err := s.GetEquipmentByID(ctx, id); err != nil {
+			return nil, err
+		}
+		if err := s.requireMergeTarget(ctx, "equipment", "equipment_id", id, targetID); err != nil {
+			return nil, err
+		}
+		if err := s.requireNoOpenTransfer(ctx, []int{id}); err != nil {
+			return nil, err
+		}
+
+		for _, statement := range []string{
+			`UPDATE equipment_in_project l SET equipment_id = $1
+			WHERE l.equipment_id = $2 AND NOT EXISTS (
+				SELECT 1 FROM equipment_in_project t WHERE t.project_id = l.project_id AND t.equipment_id = $1
+			)`,
+			`UPDATE equipment_in_draft l SET equipment_id = $1
+			WHERE l.equipment_id = $2 AND NOT EXISTS (
+				SELECT 1 FROM equipment_in_draft t WHERE t.draft_id = l.draft_id AND t.equipment_id = $1
+			)`,
+			`UPDATE warehouse_transfer_items l SET equipment_id = $1
+			WHERE l.equipment_id = $2 AND NOT EXISTS (
+				SELECT 1 FROM warehouse_transfer_items t WHERE t.transfer_id = l.transfer_id AND t.equipment_id = $1
+			)`,
+			`UPDATE stocktake_scans l SET equipment_id = $1
+			WHERE l.equipment_id = $2 AND NOT EXISTS (
+				SELECT 1 FROM stocktake_scans t WHERE t.stocktake_id = l.stocktake_id AND t.equipment_id = $1
+			)`,
+			`UPDATE stocktake_results l SET equipment_id = $1
+			WHERE l.equipment_id = $2 AND NOT EXISTS (
+				SELECT 1 FROM stocktake_results t WHERE t.stocktake_id = l.stocktake_id AND t.equipment_id = $1
+			)`,
+			`UPDATE equipment_movements SET equipment_id = $1 WHERE equipment_id = $2`,
+			`UPDATE equipment t
+			SET description = COALESCE(t.description, e.description),
+				date_of_purchase = COALESCE(t.date_of_purchase, e.date_of_purchase),
+				cost_of_purchase = COALESCE(t.cost_of_purchase, e.cost_of_purchase),
+				attributes = CASE WHEN e.equipment_set_id = t.equipment_set_id THEN e.attributes || t.attributes ELSE t.attributes END,
+				version = t.version + 1
+			FROM equipment e
+			WHERE t.equipment_id = $1 AND e.equipment_id = $2`,
+		} {
+			if _, err := s.conn(ctx).ExecContext(ctx, statement, targetID, id); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.deleteRow(ctx, "equipment", "equipment_id", id, version); err != nil {
+			return nil, err
+		}
+
+		// The target may have been exempt from uniqueness only because of
+		// the item just merged into it.
+		if _, err := s.conn(ctx).ExecContext(ctx, `
+			UPDATE equipment t SET serial_exempt = FALSE
+			WHERE t.equipment_id = $1 AND t.serial_exempt AND NOT EXISTS (
+				SELECT 1 FROM equipment o
+				WHERE o.deleted_at IS NULL AND NOT o.serial_exempt
+				  AND o.equipment_set_id = t.equipment_set_id AND o.serial_key = t.serial_key
+			)
+		`, targetID); err != nil {
+			return nil, err
+		}
+
+		event := events.New(events.EquipmentDeleted)
+		event.EquipmentIDs = []int{id}
+		s.publish(ctx, event)
+		s.publishEquipment(ctx, events.EquipmentUpdated, targetID)
+		return s.GetEquipmentByID(ctx, targetID)
+	})
+}
@@ -0,0 +1,522 @@
+package tracker
+
+import (
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"strconv"
+	"strings"
+)
+
+func (s *Store) ListStockItems(ctx context.Context) ([]*types.StockItem, error) {
+	return s.listStockItems(ctx, "")
+}
+
+func (s *Store) SearchStockItems(ctx context.Context, query types.ListQuery) ([]*types.StockItem, int, error) {
+	items, err := s.ListStockItems(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	search := normalizeSearchQuery(query.Search)
+	filtered := make([]*types.StockItem, 0, len(items))
+	for _, item := range items {
+		if matchesSearch(search, strconv.Itoa(item.StockItemID), item.StockItemName, item.Unit, item.Description) {
+			filtered = append(filtered, item)
+		}
+	}
+
+	return paginateSlice(filtered, query), len(filtered), nil
+}
+
+func (s *Store) GetStockItemByID(ctx context.Context, id int) (*types.StockItem, error) {
+	items, err := s.listStockItems(ctx, "si.stock_item_id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+	return items[0], nil
+}
+
+func (s *Store) CreateStockItem(ctx context.Context, payload types.StockItemPayload) ([]*types.StockItem, error) {
+	if _, err := s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO stock_items (stock_item_name, unit, description)
+		VALUES ($1, COALESCE(NULLIF($2, ''), 'pcs'), NULLIF($3, ''))
+	`, payload.StockItemName, payload.Unit, payload.Description); err != nil {
+		return nil, err
+	}
+	return s.ListStockItems(ctx)
+}
+
+func (s *Store) UpdateStockItem(ctx context.Context, id, version int, payload types.StockItemPayload) ([]*types.StockItem, error) {
+	result, err := s.conn(ctx).ExecContext(ctx, `
+		UPDATE stock_items
+		SET stock_item_name = $1, unit = COALESCE(NULLIF($2, ''), 'pcs'), description = NULLIF($3, ''), version = version + 1
+		WHERE stock_item_id = $4 AND ($5 = 0 OR version = $5)
+	`, payload.StockItemName, payload.Unit, payload.Description, id, version)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, s.missingOrConflict(ctx, "stock_items", "stock_item_id", id)
+	}
+	return s.ListStockItems(ctx)
+}
+
+// DeleteStockItem removes a stock item with its levels. Items reserved by a
+// live project that has not returned its stock, or by a live draft, are
+// refused.
+func (s *Store) DeleteStockItem(ctx context.Context, id, version int) ([]*types.StockItem, error) {
+	return withTx(ctx, s, stockIsolation, func(ctx context.Context) ([]*types.StockItem, error) {
+		count, err := s.countRows(ctx, `
+			SELECT COUNT(*) FROM stock_in_project r
+			JOIN projects p ON p.project_id = r.project_id
+			WHERE r.stock_item_id = $1 AND r.returned_at IS NULL AND p.deleted_at IS NULL
+		`, id)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, dependentsError("projects", count, utils.Errorf("%w: %d projects reserve this stock item", ErrInUse, count))
+		}
+		count, err = s.countRows(ctx, `
+			SELECT COUNT(*) FROM stock_in_draft r
+			JOIN drafts d ON d.draft_id = r.draft_id
+			WHERE r.stock_item_id = $1 AND d.deleted_at IS NULL
+		`, id)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, dependentsError("drafts", count, utils.Errorf("%w: %d drafts reserve this stock item", ErrInUse, count))
+		}
+		if err := s.deleteRow(ctx, "stock_items", "stock_item_id", id, version); err != nil {
+			return nil, err
+		}
+		return s.ListStockItems(ctx)
+	})
+}
+
+// SetStockLevel records the on-hand count of a stock item in a warehouse.
+func (s *Store) SetStockLevel(ctx context.Context, id, warehouseID int, payload types.StockLevelPayload) (*types.StockItem, error) {
+	return withTx(ctx, s, stockIsolation, func(ctx context.Context) (*types.StockItem, error) {
+		if _, err := s.GetStockItemByID(ctx, id); err != nil {
+			return nil, err
+		}
+		if err := s.requireID(ctx, "warehouses", "warehouse_id", warehouseID); err != nil {
+			return nil, err
+		}
+		if _, err := s.conn(ctx).ExecContext(ctx, `
+			INSERT INTO stock_levels (stock_item_id, warehouse_id, quantity)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (stock_item_id, warehouse_id) DO UPDATE SET quantity = EXCLUDED.quantity
+		`, id, warehouseID, payload.Quantity); err != nil {
+			return nil, err
+		}
+		return s.GetStockItemByID(ctx, id)
+	})
+}
+
+func (s *Store) GetStockInProject(ctx context.Context, projectID int) (*types.StockInProjectResponse, error) {
+	project, err := s.GetProjectByID(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	stock, err := s.listProjectStock(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return &types.StockInProjectResponse{Project: project, Stock: stock}, nil
+}
+
+// SetStockInProject reserves a quantity of a stock item for a project, or
+// drops the reservation when the quantity is 0. The quantity has to be free
+// on every shooting day of the project.
+func (s *Store) SetStockInProject(ctx context.Context, payload types.StockInProjectPayload) (*types.StockInProjectResponse, error) {
+	return withTx(ctx, s, stockIsolation, func(ctx context.Context) (*types.StockInProjectResponse, error) {
+		if err := s.requireOpenProjectStock(ctx, payload.ProjectID); err != nil {
+			return nil, err
+		}
+		if err := s.requireID(ctx, "stock_items", "stock_item_id", payload.StockItemID); err != nil {
+			return nil, err
+		}
+		if payload.Quantity == 0 {
+			if _, err := s.conn(ctx).ExecContext(ctx, `
+				DELETE FROM stock_in_project WHERE project_id = $1 AND stock_item_id = $2
+			`, payload.ProjectID, payload.StockItemID); err != nil {
+				return nil, err
+			}
+			return s.GetStockInProject(ctx, payload.ProjectID)
+		}
+
+		if _, err := s.conn(ctx).ExecContext(ctx, `
+			INSERT INTO stock_in_project (project_id, stock_item_id, quantity)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (project_id, stock_item_id) DO UPDATE SET quantity = EXCLUDED.quantity
+		`, payload.ProjectID, payload.StockItemID, payload.Quantity); err != nil {
+			return nil, err
+		}
+		if err := s.checkProjectStock(ctx, payload.ProjectID, []int{payload.StockItemID}); err != nil {
+			return nil, err
+		}
+		return s.GetStockInProject(ctx, payload.ProjectID)
+	})
+}
+
+// ReturnStockFromProject closes the reservations of a project: the consumed
+// quantities are recorded and taken off the stock of the given warehouse,
+// and the rest is free again for other projects.
+func (s *Store) ReturnStockFromProject(ctx context.Context, payload types.StockReturnPayload) (*types.StockInProjectResponse, error) {
+	return withTx(ctx, s, stockIsolation, func(ctx context.Context) (*types.StockInProjectResponse, error) {
+		if err := s.requireOpenProjectStock(ctx, payload.ProjectID); err != nil {
+			return nil, err
+		}
+		if err := s.requireID(ctx, "warehouses", "warehouse_id", payload.WarehouseID); err != nil {
+			return nil, err
+		}
+		reservations, err := s.listProjectStock(ctx, payload.ProjectID)
+		if err != nil {
+			return nil, err
+		}
+		if len(reservations) == 0 {
+			return nil, utils.Errorf("%w: project %d reserves no stock", ErrInvalidTransition, payload.ProjectID)
+		}
+		reserved := make(map[int]*types.StockReservation, len(reservations))
+		for _, reservation := range reservations {
+			reserved[reservation.StockItem.StockItemID] = reservation
+		}
+
+		for _, consumption := range payload.Consumed {
+			reservation, ok := reserved[consumption.StockItemID]
+			if !ok {
+				return nil, utils.Errorf("%w: project %d does not reserve stock item %d", ErrInvalidReference, payload.ProjectID, consumption.StockItemID)
+			}
+			if consumption.Quantity > reservation.Quantity {
+				return nil, utils.Errorf("%w: %d %s of %s consumed but only %d reserved", ErrInvalidReference, consumption.Quantity, reservation.StockItem.Unit, reservation.StockItem.StockItemName, reservation.Quantity)
+			}
+			if consumption.Quantity == 0 {
+				continue
+			}
+			result, err := s.conn(ctx).ExecContext(ctx, `
+				UPDATE stock_levels SET quantity = quantity - $3
+				WHERE stock_item_id = $1 AND warehouse_id = $2 AND quantity >= $3
+			`, consumption.StockItemID, payload.WarehouseID, consumption.Quantity)
+			if err != nil {
+				return nil, err
+			}
+			if rows, _ := result.RowsAffected(); rows == 0 {
+				return nil, utils.Errorf("%w: warehouse %d holds less than %d %s of %s", ErrInsufficientStock, payload.WarehouseID, consumption.Quantity, reservation.StockItem.Unit, reservation.StockItem.StockItemName)
+			}
+			if _, err := s.conn(ctx).ExecContext(ctx, `
+				UPDATE stock_in_project SET consumed = $3 WHERE project_id = $1 AND stock_item_id = $2
+			`, payload.ProjectID, consumption.StockItemID, consumption.Quantity); err != nil {
+				return nil, err
+			}
+		}
+
+		if _, err := s.conn(ctx).ExecContext(ctx, `
+			UPDATE stock_in_project SET returned_at = NOW() WHERE project_id = $1
+		`, payload.ProjectID); err != nil {
+			return nil, err
+		}
+		return s.GetStockInProject(ctx, payload.ProjectID)
+	})
+}
+
+func (s *Store) GetStockInDraft(ctx context.Context, draftID int) (*types.StockInDraftResponse, error) {
+	draft, err := s.GetDraftByID(ctx, draftID)
+	if err != nil {
+		return nil, err
+	}
+	stock, err := s.listDraftStock(ctx, draftID)
+	if err != nil {
+		return nil, err
+	}
+	return &types.StockInDraftResponse{Draft: draft, Stock: stock}, nil
+}
+
+// SetStockInDraft sets the quantity of a stock item a draft asks for, or
+// drops it when the quantity is 0. Drafts have no dates, so the quantity is
+// only checked against what is on hand.
+func (s *Store) SetStockInDraft(ctx context.Context, payload types.StockInDraftPayload) (*types.StockInDraftResponse, error) {
+	return withTx(ctx, s, stockIsolation, func(ctx context.Context) (*types.StockInDraftResponse, error) {
+		if err := s.requireID(ctx, "drafts", "draft_id", payload.DraftID); err != nil {
+			return nil, err
+		}
+		item, err := s.GetStockItemByID(ctx, payload.StockItemID)
+		if err == ErrNotFound {
+			return nil, utils.Errorf("%w: no %s row with id %d", ErrInvalidReference, "stock_items", payload.StockItemID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if payload.Quantity > item.OnHand {
+			return nil, utils.Errorf("%w: %d %s of %s available, %d requested", ErrInsufficientStock, item.OnHand, item.Unit, item.StockItemName, payload.Quantity)
+		}
+
+		if payload.Quantity == 0 {
+			_, err = s.conn(ctx).ExecContext(ctx, `
+				DELETE FROM stock_in_draft WHERE draft_id = $1 AND stock_item_id = $2
+			`, payload.DraftID, payload.StockItemID)
+		} else {
+			_, err = s.conn(ctx).ExecContext(ctx, `
+				INSERT INTO stock_in_draft (draft_id, stock_item_id, quantity)
+				VALUES ($1, $2, $3)
+				ON CONFLICT (draft_id, stock_item_id) DO UPDATE SET quantity = EXCLUDED.quantity
+			`, payload.DraftID, payload.StockItemID, payload.Quantity)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return s.GetStockInDraft(ctx, payload.DraftID)
+	})
+}
+
+// addDraftStockToProject copies the stock of a draft into a project, keeping
+// the larger quantity where both reserve an item, and checks the copied
+// items are free. With replace the project ends up with exactly the draft's
+// stock. Projects that returned their stock are left alone.
+func (s *Store) addDraftStockToProject(ctx context.Context, projectID, draftID int, replace bool) error {
+	returned, err := s.countRows(ctx, `
+		SELECT COUNT(*) FROM stock_in_project WHERE project_id = $1 AND returned_at IS NOT NULL
+	`, projectID)
+	if err != nil || returned > 0 {
+		return err
+	}
+	if replace {
+		if _, err := s.conn(ctx).ExecContext(ctx, `
+			DELETE FROM stock_in_project
+			WHERE project_id = $1
+			  AND stock_item_id NOT IN (SELECT stock_item_id FROM stock_in_draft WHERE draft_id = $2)
+		`, projectID, draftID); err != nil {
+			return err
+		}
+	}
+
+	update := "GREATEST(stock_in_project.quantity, EXCLUDED.quantity)"
+	if replace {
+		update = "EXCLUDED.quantity"
+	}
+	itemIDs, err := s.queryIDs(ctx, `
+		INSERT INTO stock_in_project (project_id, stock_item_id, quantity)
+		SELECT $1, stock_item_id, quantity FROM stock_in_draft WHERE draft_id = $2
+		ON CONFLICT (project_id, stock_item_id) DO UPDATE SET quantity = `+update+`
+		RETURNING stock_item_id
+	`, projectID, draftID)
+	if err != nil {
+		return err
+	}
+	return s.checkProjectStock(ctx, projectID, itemIDs)
+}
+
+// requireOpenProjectStock checks that a project is live and has not returned
+// its stock yet.
+func (s *Store) requireOpenProjectStock(ctx context.Context, projectID int) error {
+	if err := s.requireID(ctx, "projects", "project_id", projectID); err != nil {
+		return err
+	}
+	returned, err := s.countRows(ctx, `
+		SELECT COUNT(*) FROM stock_in_project WHERE project_id = $1 AND returned_at IS NOT NULL
+	`, projectID)
+	if err != nil {
+		return err
+	}
+	if returned > 0 {
+		return utils.Errorf("%w: project %d has already returned its stock", ErrInvalidTransition, projectID)
+	}
+	return nil
+}
+
+// checkProjectStock fails when an open reservation of the project for one
+// of itemIDs, or for any item when itemIDs is nil, exceeds what is free on
+// its busiest shooting day.
+func (s *Store) checkProjectStock(ctx context.Context, projectID int, itemIDs []int) error {
+	reservations, err := s.listProjectStock(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	check := make(map[int]bool, len(itemIDs))
+	for _, id := range itemIDs {
+		check[id] = true
+	}
+	for _, reservation := range reservations {
+		item := reservation.StockItem
+		if reservation.ReturnedAt != nil || (itemIDs != nil && !check[item.StockItemID]) {
+			continue
+		}
+		if reservation.Quantity > reservation.Available {
+			return utils.Errorf("%w: %d %s of %s available for these dates, %d requested", ErrInsufficientStock, max(reservation.Available, 0), item.Unit, item.StockItemName, reservation.Quantity)
+		}
+	}
+	return nil
+}
+
+// listProjectStock returns the reservations of a project. Available is the
+// stock on hand minus what other live, non-archived projects that have not
+// returned their stock hold on the busiest day they share with this one.
+func (s *Store) listProjectStock(ctx context.Context, projectID int) ([]*types.StockReservation, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+		WITH days AS (
+			SELECT d::DATE AS day
+			FROM projects p, generate_series(p.shooting_start_date, p.shooting_end_date, INTERVAL '1 day') d
+			WHERE p.project_id = $1
+		), daily AS (
+			SELECT r.stock_item_id, days.day, SUM(r.quantity) AS used
+			FROM days
+			JOIN projects p2 ON days.day BETWEEN p2.shooting_start_date AND p2.shooting_end_date
+			JOIN stock_in_project r ON r.project_id = p2.project_id
+			WHERE p2.project_id <> $1
+			  AND p2.archived = FALSE
+			  AND p2.deleted_at IS NULL
+			  AND r.returned_at IS NULL
+			GROUP BY r.stock_item_id, days.day
+		), peaks AS (
+			SELECT stock_item_id, MAX(used) AS used FROM daily GROUP BY stock_item_id
+		), on_hand AS (
+			SELECT stock_item_id, SUM(quantity) AS quantity FROM stock_levels GROUP BY stock_item_id
+		)
+		SELECT
+			si.stock_item_id,
+			si.stock_item_name,
+			si.unit,
+			COALESCE(si.description, ''),
+			COALESCE(oh.quantity, 0)::INT,
+			si.version,
+			r.quantity,
+			(COALESCE(oh.quantity, 0) - COALESCE(pk.used, 0))::INT,
+			r.consumed,
+			r.returned_at
+		FROM stock_in_project r
+		JOIN stock_items si ON si.stock_item_id = r.stock_item_id
+		LEFT JOIN on_hand oh ON oh.stock_item_id = r.stock_item_id
+		LEFT JOIN peaks pk ON pk.stock_item_id = r.stock_item_id
+		WHERE r.project_id = $1
+		ORDER BY si.stock_item_name ASC, si.stock_item_id ASC
+	`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*types.StockReservation, 0)
+	for rows.Next() {
+		item := new(types.StockItem)
+		reservation := &types.StockReservation{StockItem: item}
+		if err := rows.Scan(
+			&item.StockItemID,
+			&item.StockItemName,
+			&item.Unit,
+			&item.Description,
+			&item.OnHand,
+			&item.Version,
+			&reservation.Quantity,
+			&reservation.Available,
+			&reservation.Consumed,
+			&reservation.ReturnedAt,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, reservation)
+	}
+	return result, rows.Err()
+}
+
+func (s *Store) listDraftStock(ctx context.Context, draftID int) ([]*types.StockReservation, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+		SELECT
+			si.stock_item_id,
+			si.stock_item_name,
+			si.unit,
+			COALESCE(si.description, ''),
+			COALESCE((SELECT SUM(quantity) FROM stock_levels l WHERE l.stock_item_id = si.stock_item_id), 0)::INT,
+			si.version,
+			r.quantity
+		FROM stock_in_draft r
+		JOIN stock_items si ON si.stock_item_id = r.stock_item_id
+		WHERE r.draft_id = $1
+		ORDER BY si.stock_item_name ASC, si.stock_item_id ASC
+	`, draftID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*types.StockReservation, 0)
+	for rows.Next() {
+		item := new(types.StockItem)
+		reservation := &types.StockReservation{StockItem: item}
+		if err := rows.Scan(&item.StockItemID, &item.StockItemName, &item.Unit, &item.Description, &item.OnHand, &item.Version, &reservation.Quantity); err != nil {
+			return nil, err
+		}
+		reservation.Available = item.OnHand
+		result = append(result, reservation)
+	}
+	return result, rows.Err()
+}
+
+func (s *Store) listStockItems(ctx context.Context, filter string, args ...any) ([]*types.StockItem, error) {
+	query := `
+		SELECT
+			si.stock_item_id,
+			si.stock_item_name,
+			si.unit,
+			COALESCE(si.description, ''),
+			si.version
+		FROM stock_items si
+	`
+	if strings.TrimSpace(filter) != "" {
+		query += " WHERE " + filter
+	}
+	query += " ORDER BY si.stock_item_name ASC, si.stock_item_id ASC"
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*types.StockItem, 0)
+	byItemID := map[int]*types.StockItem{}
+	for rows.Next() {
+		item := new(types.StockItem)
+		if err := rows.Scan(&item.StockItemID, &item.StockItemName, &item.Unit, &item.Description, &item.Version); err != nil {
+			return nil, err
+		}
+		item.Levels = []*types.StockLevel{}
+		result = append(result, item)
+		byItemID[item.StockItemID] = item
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return result, nil
+	}
+
+	levelRows, err := s.conn(ctx).QueryContext(ctx, `
+		SELECT l.stock_item_id, w.warehouse_id, w.warehouse_name, l.quantity
+		FROM stock_levels l
+		JOIN warehouses w ON w.warehouse_id = l.warehouse_id
+		WHERE l.quantity > 0
+		ORDER BY w.warehouse_name ASC, w.warehouse_id ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer levelRows.Close()
+
+	for levelRows.Next() {
+		var itemID int
+		level := &types.StockLevel{Warehouse: new(types.Warehouse)}
+		if err := levelRows.Scan(&itemID, &level.Warehouse.WarehouseID, &level.Warehouse.WarehouseName, &level.Quantity); err != nil {
+			return nil, err
+		}
+		if item, ok := byItemID[itemID]; ok {
+			item.Levels = append(item.Levels, level)
+			item.OnHand += level.Quantity
+		}
+	}
+	return result, levelRows.Err()
+}
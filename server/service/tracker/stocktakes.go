@@ -0,0 +1,515 @@
+package tracker
+
+import (
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// stocktakeTransitions lists, per target status, the status a stocktake has
+// to be in and the timestamp column that records the change.
+var stocktakeTransitions = map[string]struct {
+	from  string
+	stamp string
+}{
+	types.StocktakeStatusClosed:  {from: types.StocktakeStatusOpen, stamp: "closed_at"},
+	types.StocktakeStatusApplied: {from: types.StocktakeStatusClosed, stamp: "applied_at"},
+}
+
+func (s *Store) ListStocktakes(ctx context.Context, status string) ([]*types.Stocktake, error) {
+	if status == "" {
+		return s.listStocktakes(ctx, "")
+	}
+	return s.listStocktakes(ctx, "st.status = $1", status)
+}
+
+func (s *Store) SearchStocktakes(ctx context.Context, status string, query types.ListQuery) ([]*types.Stocktake, int, error) {
+	items, err := s.ListStocktakes(ctx, status)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	search := normalizeSearchQuery(query.Search)
+	filtered := make([]*types.Stocktake, 0, len(items))
+	for _, item := range items {
+		values := []string{strconv.Itoa(item.StocktakeID), item.Status}
+		if item.Warehouse != nil {
+			values = append(values, item.Warehouse.WarehouseName)
+		}
+		if item.StartedBy != nil {
+			values = append(values, item.StartedBy.Name)
+		}
+		if matchesSearch(search, values...) {
+			filtered = append(filtered, item)
+		}
+	}
+
+	return paginateSlice(filtered, query), len(filtered), nil
+}
+
+func (s *Store) GetStocktakeByID(ctx context.Context, id int) (*types.Stocktake, error) {
+	items, err := s.listStocktakes(ctx, "st.stocktake_id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+	return items[0], nil
+}
+
+// StartStocktake opens a stocktake of a warehouse that is not being counted
+// already.
+func (s *Store) StartStocktake(ctx context.Context, payload types.StocktakePayload) (*types.Stocktake, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.Stocktake, error) {
+		if err := s.requireID(ctx, "warehouses", "warehouse_id", payload.WarehouseID); err != nil {
+			return nil, err
+		}
+		var openID int
+		err := s.conn(ctx).QueryRowContext(ctx, `
+			SELECT stocktake_id FROM stocktakes WHERE warehouse_id = $1 AND status = 'open'
+		`, payload.WarehouseID).Scan(&openID)
+		if err == nil {
+			return nil, utils.Errorf("%w: warehouse %d is already counted by stocktake %d", ErrInvalidTransition, payload.WarehouseID, openID)
+		}
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+
+		var stocktakeID int
+		if err := s.conn(ctx).QueryRowContext(ctx, `
+			INSERT INTO stocktakes (warehouse_id, started_by) VALUES ($1, $2) RETURNING stocktake_id
+		`, payload.WarehouseID, actorID(ctx)).Scan(&stocktakeID); err != nil {
+			return nil, err
+		}
+		return s.GetStocktakeByID(ctx, stocktakeID)
+	})
+}
+
+// ScanStocktake records items found during an open stocktake, by ID or by
+// serial number, and returns the updated report. Scanning an item twice is
+// harmless. Serial numbers match ignoring case and whitespace. One that
+// matches no item is kept as unknown; one that matches several has to be
+// scanned by ID instead.
+func (s *Store) ScanStocktake(ctx context.Context, id int, payload types.StocktakeScanPayload) (*types.StocktakeReport, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.StocktakeReport, error) {
+		stocktake, err := s.GetStocktakeByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if stocktake.Status != types.StocktakeStatusOpen {
+			return nil, utils.Errorf("%w: stocktake %d is %s and takes no more scans", ErrInvalidTransition, id, stocktake.Status)
+		}
+		if len(payload.EquipmentIDs) > 0 {
+			if err := s.requireEquipment(ctx, payload.EquipmentIDs, 0); err != nil {
+				return nil, err
+			}
+		}
+
+		equipmentIDs := append([]int{}, payload.EquipmentIDs...)
+		unknown := make([]string, 0)
+		for _, serial := range payload.SerialNumbers {
+			serial = strings.TrimSpace(serial)
+			if serial == "" {
+				continue
+			}
+			matches, err := s.queryIDs(ctx, `
+				SELECT equipment_id FROM equipment
+				WHERE deleted_at IS NULL AND serial_key = `+serialKey("$1")+`
+			`, serial)
+			if err != nil {
+				return nil, err
+			}
+			switch len(matches) {
+			case 0:
+				unknown = append(unknown, serial)
+			case 1:
+				equipmentIDs = append(equipmentIDs, matches[0])
+			default:
+				return nil, utils.Errorf("%w: several equipment items have serial number %q, scan the equipment id instead", ErrAmbiguousReference, serial)
+			}
+		}
+
+		if _, err := s.conn(ctx).ExecContext(ctx, `
+			INSERT INTO stocktake_scans (stocktake_id, equipment_id, scanned_by)
+			SELECT $1, jsonb_array_elements_text($2::JSONB)::BIGINT, $3
+			ON CONFLICT DO NOTHING
+		`, id, idsJSON(equipmentIDs), actorID(ctx)); err != nil {
+			return nil, err
+		}
+		for _, code := range unknown {
+			if _, err := s.conn(ctx).ExecContext(ctx, `
+				INSERT INTO stocktake_scans (stocktake_id, code, scanned_by)
+				VALUES ($1, $2, $3)
+				ON CONFLICT DO NOTHING
+			`, id, code, actorID(ctx)); err != nil {
+				return nil, err
+			}
+		}
+		return s.GetStocktakeReport(ctx, id)
+	})
+}
+
+// CloseStocktake ends scanning and saves the reconciliation, so the report
+// of a closed stocktake no longer follows where equipment is stored.
+func (s *Store) CloseStocktake(ctx context.Context, id, version int) (*types.StocktakeReport, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.StocktakeReport, error) {
+		if err := s.setStocktakeStatus(ctx, id, version, types.StocktakeStatusClosed); err != nil {
+			return nil, err
+		}
+		stocktake, err := s.GetStocktakeByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		report := newStocktakeReport(stocktake)
+		if err := s.reconcileStocktake(ctx, report); err != nil {
+			return nil, err
+		}
+
+		for outcome, items := range map[string][]*types.Equipment{
+			stocktakeFound:      report.Found,
+			stocktakeMissing:    report.Missing,
+			stocktakeUnexpected: report.Unexpected,
+		} {
+			equipmentIDs := make([]int, 0, len(items))
+			for _, item := range items {
+				equipmentIDs = append(equipmentIDs, item.EquipmentID)
+			}
+			if _, err := s.conn(ctx).ExecContext(ctx, `
+				INSERT INTO stocktake_results (stocktake_id, equipment_id, outcome)
+				SELECT $1, jsonb_array_elements_text($2::JSONB)::BIGINT, $3
+			`, id, idsJSON(equipmentIDs), outcome); err != nil {
+				return nil, err
+			}
+		}
+		return s.GetStocktakeReport(ctx, id)
+	})
+}
+
+// ApplyStocktake moves the unexpected items of a closed stocktake, or the
+// chosen ones among them, into the counted warehouse. Each logged move
+// points at the stocktake.
+func (s *Store) ApplyStocktake(ctx context.Context, id, version int, payload types.StocktakeApplyPayload) (*types.StocktakeReport, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.StocktakeReport, error) {
+		if err := s.setStocktakeStatus(ctx, id, version, types.StocktakeStatusApplied); err != nil {
+			return nil, err
+		}
+		report, err := s.GetStocktakeReport(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if report.Stocktake.Warehouse == nil {
+			return nil, utils.Errorf("%w: the warehouse of stocktake %d was deleted", ErrInvalidReference, id)
+		}
+
+		unexpected := make(map[int]bool, len(report.Unexpected))
+		for _, item := range report.Unexpected {
+			unexpected[item.EquipmentID] = true
+		}
+		equipmentIDs := payload.EquipmentIDs
+		if len(equipmentIDs) == 0 {
+			equipmentIDs = make([]int, 0, len(report.Unexpected))
+			for _, item := range report.Unexpected {
+				equipmentIDs = append(equipmentIDs, item.EquipmentID)
+			}
+		}
+		for _, equipmentID := range equipmentIDs {
+			if !unexpected[equipmentID] {
+				return nil, utils.Errorf("%w: equipment %d is not an unexpected item of stocktake %d", ErrInvalidReference, equipmentID, id)
+			}
+		}
+		if len(equipmentIDs) == 0 {
+			return report, nil
+		}
+
+		if err := s.requireNoOpenTransfer(ctx, equipmentIDs); err != nil {
+			return nil, err
+		}
+		movements, err := s.moveEquipment(ctx, equipmentIDs, report.Stocktake.Warehouse.WarehouseID, "", 0, id)
+		if err != nil {
+			return nil, err
+		}
+		movedIDs := make([]int, 0, len(movements))
+		for _, movement := range movements {
+			movedIDs = append(movedIDs, movement.EquipmentID)
+		}
+		if _, err := s.conn(ctx).ExecContext(ctx, `
+			UPDATE stocktake_results SET moved = TRUE
+			WHERE stocktake_id = $1
+			  AND equipment_id IN (SELECT jsonb_array_elements_text($2::JSONB)::BIGINT)
+		`, id, idsJSON(movedIDs)); err != nil {
+			return nil, err
+		}
+		return s.GetStocktakeReport(ctx, id)
+	})
+}
+
+// GetStocktakeReport compares the scans of an open stocktake with where
+// equipment is stored now. Once the stocktake is closed the report reads the
+// reconciliation saved at closing instead, so later moves, including the
+// ones applying it makes, do not rewrite what was counted.
+func (s *Store) GetStocktakeReport(ctx context.Context, id int) (*types.StocktakeReport, error) {
+	stocktake, err := s.GetStocktakeByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	report := newStocktakeReport(stocktake)
+	if stocktake.Status == types.StocktakeStatusOpen {
+		err = s.reconcileStocktake(ctx, report)
+	} else {
+		err = s.loadStocktakeResults(ctx, report)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	byEquipmentID := make(map[int]*types.Equipment, len(report.Found)+len(report.Unexpected))
+	for _, item := range append(append([]*types.Equipment{}, report.Found...), report.Unexpected...) {
+		byEquipmentID[item.EquipmentID] = item
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+		SELECT
+			eip.equipment_id,
+			p.project_id,
+			p.project_name,
+			TO_CHAR(p.shooting_start_date, 'YYYY-MM-DD'),
+			TO_CHAR(p.shooting_end_date, 'YYYY-MM-DD')
+		FROM stocktake_scans sc
+		JOIN equipment_in_project eip ON eip.equipment_id = sc.equipment_id
+		JOIN projects p ON p.project_id = eip.project_id
+		WHERE sc.stocktake_id = $1
+		  AND p.archived = FALSE
+		  AND p.deleted_at IS NULL
+		  AND CURRENT_DATE BETWEEN p.shooting_start_date AND p.shooting_end_date
+		ORDER BY eip.equipment_id ASC, p.shooting_start_date ASC, p.project_id ASC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var equipmentID int
+		project := new(types.Project)
+		if err := rows.Scan(&equipmentID, &project.ProjectID, &project.ProjectName, &project.ShootingStartDate, &project.ShootingEndDate); err != nil {
+			return nil, err
+		}
+		if item, ok := byEquipmentID[equipmentID]; ok {
+			report.Booked = append(report.Booked, &types.StocktakeBooking{Equipment: item, Project: project})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	codeRows, err := s.conn(ctx).QueryContext(ctx, `
+		SELECT code FROM stocktake_scans
+		WHERE stocktake_id = $1 AND equipment_id IS NULL
+		ORDER BY scanned_at ASC, scan_id ASC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer codeRows.Close()
+	for codeRows.Next() {
+		var code string
+		if err := codeRows.Scan(&code); err != nil {
+			return nil, err
+		}
+		report.UnknownSerialNumbers = append(report.UnknownSerialNumbers, code)
+	}
+	return report, codeRows.Err()
+}
+
+// Outcomes saved in stocktake_results.
+const (
+	stocktakeFound      = "found"
+	stocktakeMissing    = "missing"
+	stocktakeUnexpected = "unexpected"
+)
+
+func newStocktakeReport(stocktake *types.Stocktake) *types.StocktakeReport {
+	return &types.StocktakeReport{
+		Stocktake:            stocktake,
+		Found:                []*types.Equipment{},
+		Missing:              []*types.Equipment{},
+		Unexpected:           []*types.Equipment{},
+		Moved:                []*types.Equipment{},
+		Booked:               []*types.StocktakeBooking{},
+		UnknownSerialNumbers: []string{},
+	}
+}
+
+// reconcileStocktake fills Found, Missing and Unexpected of report from the
+// scans and the current storage of equipment.
+func (s *Store) reconcileStocktake(ctx context.Context, report *types.StocktakeReport) error {
+	id := report.Stocktake.StocktakeID
+	warehouseID := 0
+	if report.Stocktake.Warehouse != nil {
+		warehouseID = report.Stocktake.Warehouse.WarehouseID
+	}
+
+	scanned, err := s.listEquipment(ctx, `
+		e.equipment_id IN (SELECT equipment_id FROM stocktake_scans WHERE stocktake_id = $1)
+	`, id)
+	if err != nil {
+		return err
+	}
+	scannedIDs := make(map[int]bool, len(scanned))
+	for _, item := range scanned {
+		scannedIDs[item.EquipmentID] = true
+		if item.StorageID == warehouseID {
+			report.Found = append(report.Found, item)
+		} else {
+			report.Unexpected = append(report.Unexpected, item)
+		}
+	}
+
+	stored, err := s.listEquipment(ctx, "e.storage_id = $1", warehouseID)
+	if err != nil {
+		return err
+	}
+	for _, item := range stored {
+		if !scannedIDs[item.EquipmentID] {
+			report.Missing = append(report.Missing, item)
+		}
+	}
+	return nil
+}
+
+// loadStocktakeResults fills report from the reconciliation saved when the
+// stocktake closed. Equipment details are current; the outcomes are not.
+func (s *Store) loadStocktakeResults(ctx context.Context, report *types.StocktakeReport) error {
+	id := report.Stocktake.StocktakeID
+	for outcome, target := range map[string]*[]*types.Equipment{
+		stocktakeFound:      &report.Found,
+		stocktakeMissing:    &report.Missing,
+		stocktakeUnexpected: &report.Unexpected,
+	} {
+		items, err := s.listEquipment(ctx, `
+			e.equipment_id IN (SELECT equipment_id FROM stocktake_results WHERE stocktake_id = $1 AND outcome = $2)
+		`, id, outcome)
+		if err != nil {
+			return err
+		}
+		*target = items
+	}
+
+	moved, err := s.listEquipment(ctx, `
+		e.equipment_id IN (SELECT equipment_id FROM stocktake_results WHERE stocktake_id = $1 AND moved)
+	`, id)
+	if err != nil {
+		return err
+	}
+	report.Moved = moved
+	return nil
+}
+
+// setStocktakeStatus moves stocktake id to status when its current status
+// allows it and it still has version (any version when 0).
+func (s *Store) setStocktakeStatus(ctx context.Context, id, version int, status string) error {
+	transition := stocktakeTransitions[status]
+	query := fmt.Sprintf(`
+		UPDATE stocktakes
+		SET status = $1, %s = NOW(), version = version + 1
+		WHERE stocktake_id = $2 AND ($3 = 0 OR version = $3) AND status = $4
+	`, transition.stamp)
+	result, err := s.conn(ctx).ExecContext(ctx, query, status, id, version, transition.from)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		return nil
+	}
+
+	var current string
+	var currentVersion int
+	err = s.conn(ctx).QueryRowContext(ctx, `
+		SELECT status, version FROM stocktakes WHERE stocktake_id = $1
+	`, id).Scan(&current, &currentVersion)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if version != 0 && version != currentVersion {
+		return ErrVersionConflict
+	}
+	return utils.Errorf("%w: stocktake %d is %s and cannot become %s", ErrInvalidTransition, id, current, status)
+}
+
+// requireNoOpenStocktake refuses to remove a warehouse while it is being
+// counted.
+func (s *Store) requireNoOpenStocktake(ctx context.Context, warehouseID int) error {
+	count, err := s.countRows(ctx, `
+		SELECT COUNT(*) FROM stocktakes WHERE warehouse_id = $1 AND status = 'open'
+	`, warehouseID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return dependentsError("stocktakes", count, utils.Errorf("%w: this warehouse is being counted by an open stocktake", ErrInUse))
+	}
+	return nil
+}
+
+func (s *Store) listStocktakes(ctx context.Context, filter string, args ...any) ([]*types.Stocktake, error) {
+	query := `
+		SELECT
+			st.stocktake_id,
+			COALESCE(w.warehouse_id, 0),
+			COALESCE(w.warehouse_name, ''),
+			st.status,
+			COALESCE(u.id, 0),
+			COALESCE(u.name, ''),
+			st.started_at,
+			st.closed_at,
+			st.applied_at,
+			(SELECT COUNT(*) FROM stocktake_scans sc WHERE sc.stocktake_id = st.stocktake_id)::INT,
+			st.version
+		FROM stocktakes st
+		LEFT JOIN warehouses w ON w.warehouse_id = st.warehouse_id
+		LEFT JOIN users u ON u.id = st.started_by
+	`
+	if strings.TrimSpace(filter) != "" {
+		query += " WHERE " + filter
+	}
+	query += " ORDER BY st.started_at DESC, st.stocktake_id DESC"
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*types.Stocktake, 0)
+	for rows.Next() {
+		item := new(types.Stocktake)
+		var warehouse types.Warehouse
+		var startedBy types.UserShort
+		if err := rows.Scan(
+			&item.StocktakeID,
+			&warehouse.WarehouseID,
+			&warehouse.WarehouseName,
+			&item.Status,
+			&startedBy.ID,
+			&startedBy.Name,
+			&item.StartedAt,
+			&item.ClosedAt,
+			&item.AppliedAt,
+			&item.ScannedCount,
+			&item.Version,
+		); err != nil {
+			return nil, err
+		}
+		item.Warehouse = optionalWarehouse(warehouse)
+		item.StartedBy = optionalUser(startedBy)
+		result = append(result, item)
+	}
+	return result, rows.Err()
+}
@@ -1,10 +1,16 @@
 package tracker
 
 import (
+	"VyacheslavKuchumov/test-backend/service/events"
+	"VyacheslavKuchumov/test-backend/service/tracing"
 	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"strconv"
 	"strings"
 )
@@ -12,18 +18,88 @@ import (
 var (
 	ErrNotFound         = errors.New("resource not found")
 	ErrInvalidReference = errors.New("invalid reference")
+	// ErrVersionConflict is returned when an update or delete names a version
+	// the row no longer has.
+	ErrVersionConflict = errors.New("version conflict")
+	// ErrAmbiguousReference is returned when a name given instead of an ID
+	// matches more than one row.
+	ErrAmbiguousReference = errors.New("ambiguous reference")
+	// ErrInUse is returned, wrapped in a *DependentsError or around the
+	// foreign key violation of the delete, when a record cannot be deleted
+	// because other rows still reference it.
+	ErrInUse = errors.New("record is in use")
+	// ErrTrashed is returned when a write targets a record in the trash
+	// that it cannot see.
+	ErrTrashed = errors.New("record is in the trash")
+	// ErrInTransfer is returned when equipment held by a pending or in
+	// transit transfer is moved some other way.
+	ErrInTransfer = errors.New("equipment is on an open transfer")
+	// ErrInvalidTransition is returned when a transfer or stocktake cannot
+	// go to the requested status from the one it has.
+	ErrInvalidTransition = errors.New("invalid status transition")
+	// ErrInsufficientStock is returned when a reservation or consumption
+	// asks for more of a stock item than is free.
+	ErrInsufficientStock = errors.New("not enough stock")
+	// ErrInvalidAttribute is returned when a set type attribute schema or
+	// the attribute values of equipment do not hold up.
+	ErrInvalidAttribute = errors.New("invalid attribute")
+	// ErrDuplicateSerial is returned when equipment would share its serial
+	// number, ignoring case and whitespace, with other live equipment of
+	// its set.
+	ErrDuplicateSerial = errors.New("duplicate serial number")
 )
 
 type Store struct {
-	db *sql.DB
+	db     *tracing.DB
+	events events.Publisher
 }
 
 func NewStore(db *sql.DB) *Store {
-	return &Store{db: db}
+	return &Store{db: tracing.WrapDB(db, "tracker")}
 }
 
-func (s *Store) ListSetTypes() ([]*types.SetType, error) {
-	rows, err := s.db.Query(`SELECT set_type_id, set_type_name FROM set_types ORDER BY set_type_name ASC`)
+// SetPublisher makes mutations emit events to publisher. Events are only
+// published after the change has been written.
+func (s *Store) SetPublisher(publisher events.Publisher) {
+	s.events = publisher
+}
+
+const setTypeColumns = `
+	set_type_id,
+	set_type_name,
+	attributes::TEXT,
+	depreciation_method,
+	COALESCE(useful_life_months, 0),
+	salvage_percent::FLOAT8,
+	version
+`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSetType(row rowScanner) (*types.SetType, error) {
+	item := &types.SetType{Depreciation: &types.Depreciation{}}
+	var attributes string
+	if err := row.Scan(
+		&item.SetTypeID,
+		&item.SetTypeName,
+		&attributes,
+		&item.Depreciation.Method,
+		&item.Depreciation.UsefulLifeMonths,
+		&item.Depreciation.SalvagePercent,
+		&item.Version,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(attributes), &item.Attributes); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *Store) ListSetTypes(ctx context.Context) ([]*types.SetType, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `SELECT `+setTypeColumns+` FROM set_types ORDER BY set_type_name ASC`)
 	if err != nil {
 		return nil, err
 	}
@@ -31,8 +107,8 @@ func (s *Store) ListSetTypes() ([]*types.SetType, error) {
 
 	result := make([]*types.SetType, 0)
 	for rows.Next() {
-		item := new(types.SetType)
-		if err := rows.Scan(&item.SetTypeID, &item.SetTypeName); err != nil {
+		item, err := scanSetType(rows)
+		if err != nil {
 			return nil, err
 		}
 		result = append(result, item)
@@ -40,8 +116,8 @@ func (s *Store) ListSetTypes() ([]*types.SetType, error) {
 	return result, rows.Err()
 }
 
-func (s *Store) SearchSetTypes(query types.ListQuery) ([]*types.SetType, int, error) {
-	items, err := s.ListSetTypes()
+func (s *Store) SearchSetTypes(ctx context.Context, query types.ListQuery) ([]*types.SetType, int, error) {
+	items, err := s.ListSetTypes(ctx)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -57,50 +133,111 @@ func (s *Store) SearchSetTypes(query types.ListQuery) ([]*types.SetType, int, er
 	return paginateSlice(filtered, query), len(filtered), nil
 }
 
-func (s *Store) GetSetTypeByID(id int) (*types.SetType, error) {
-	row := s.db.QueryRow(`SELECT set_type_id, set_type_name FROM set_types WHERE set_type_id = $1`, id)
-	item := new(types.SetType)
-	if err := row.Scan(&item.SetTypeID, &item.SetTypeName); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrNotFound
-		}
-		return nil, err
+func (s *Store) GetSetTypeByID(ctx context.Context, id int) (*types.SetType, error) {
+	item, err := scanSetType(s.conn(ctx).QueryRowContext(ctx, `SELECT `+setTypeColumns+` FROM set_types WHERE set_type_id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
 	}
-	return item, nil
+	return item, err
 }
 
-func (s *Store) CreateSetType(payload types.SetTypePayload) ([]*types.SetType, error) {
-	_, err := s.db.Exec(`INSERT INTO set_types (set_type_name) VALUES ($1)`, payload.SetTypeName)
+func (s *Store) CreateSetType(ctx context.Context, payload types.SetTypePayload) ([]*types.SetType, error) {
+	schema, err := schemaJSON(payload.Attributes)
 	if err != nil {
 		return nil, err
 	}
-	return s.ListSetTypes()
-}
-
-func (s *Store) UpdateSetType(id int, payload types.SetTypePayload) ([]*types.SetType, error) {
-	result, err := s.db.Exec(`UPDATE set_types SET set_type_name = $1 WHERE set_type_id = $2`, payload.SetTypeName, id)
+	method, life, salvage := depreciationArgs(payload.Depreciation)
+	_, err = s.conn(ctx).ExecContext(ctx, `
+		INSERT INTO set_types (set_type_name, attributes, depreciation_method, useful_life_months, salvage_percent)
+		VALUES ($1, COALESCE($2::JSONB, '[]'), COALESCE($3, 'none'), $4, COALESCE($5, 0))
+	`, payload.SetTypeName, schema, method, life, salvage)
 	if err != nil {
 		return nil, err
 	}
-	if rows, _ := result.RowsAffected(); rows == 0 {
-		return nil, ErrNotFound
-	}
-	return s.ListSetTypes()
+	return s.ListSetTypes(ctx)
 }
 
-func (s *Store) DeleteSetType(id int) ([]*types.SetType, error) {
-	result, err := s.db.Exec(`DELETE FROM set_types WHERE set_type_id = $1`, id)
+// UpdateSetType saves a set type. A new attribute schema is refused when the
+// stored attributes of equipment of this set type, trashed items included,
+// do not fit it.
+func (s *Store) UpdateSetType(ctx context.Context, id, version int, payload types.SetTypePayload) ([]*types.SetType, error) {
+	schema, err := schemaJSON(payload.Attributes)
 	if err != nil {
 		return nil, err
 	}
-	if rows, _ := result.RowsAffected(); rows == 0 {
-		return nil, ErrNotFound
-	}
-	return s.ListSetTypes()
+	method, life, salvage := depreciationArgs(payload.Depreciation)
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.SetType, error) {
+		if schema != nil {
+			if err := s.requireSchemaFits(ctx, payload.Attributes, `es.set_type_id = $1`, id); err != nil {
+				return nil, err
+			}
+		}
+		result, err := s.conn(ctx).ExecContext(ctx, `
+			UPDATE set_types
+			SET set_type_name = $1,
+				attributes = COALESCE($2::JSONB, attributes),
+				depreciation_method = COALESCE($5, depreciation_method),
+				useful_life_months = CASE WHEN $5::TEXT IS NULL THEN useful_life_months ELSE $6 END,
+				salvage_percent = COALESCE($7, salvage_percent),
+				version = version + 1
+			WHERE set_type_id = $3 AND ($4 = 0 OR version = $4)
+		`, payload.SetTypeName, schema, id, version, method, life, salvage)
+		if err != nil {
+			return nil, err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return nil, s.missingOrConflict(ctx, "set_types", "set_type_id", id)
+		}
+		return s.ListSetTypes(ctx)
+	})
 }
 
-func (s *Store) ListProjectTypes() ([]*types.ProjectType, error) {
-	rows, err := s.db.Query(`SELECT project_type_id, project_type_name, COALESCE(neaktor_id, '') FROM project_types ORDER BY project_type_name ASC`)
+func (s *Store) DeleteSetType(ctx context.Context, id, version int) ([]*types.SetType, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.SetType, error) {
+		count, err := s.countRows(ctx, `SELECT COUNT(*) FROM equipment_sets WHERE set_type_id = $1`, id)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, dependentsError("equipment_sets", count, utils.Errorf("%w: %d equipment sets of this type", ErrInUse, count))
+		}
+		if err := s.deleteRow(ctx, "set_types", "set_type_id", id, version); err != nil {
+			return nil, err
+		}
+		return s.ListSetTypes(ctx)
+	})
+}
+
+// MergeSetType moves the equipment sets of set type id to targetID and
+// deletes id. It is refused when the attributes of equipment in those sets
+// do not fit the schema of targetID.
+func (s *Store) MergeSetType(ctx context.Context, id, version, targetID int) ([]*types.SetType, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.SetType, error) {
+		if err := s.requireMergeTarget(ctx, "set_types", "set_type_id", id, targetID); err != nil {
+			return nil, err
+		}
+		equipmentSetIDs, err := s.queryIDs(ctx, `SELECT equipment_set_id FROM equipment_sets WHERE set_type_id = $1`, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.requireAttributesFit(ctx, targetID, equipmentSetIDs); err != nil {
+			return nil, err
+		}
+		_, err = s.conn(ctx).ExecContext(ctx, `
+			UPDATE equipment_sets SET set_type_id = $1, version = version + 1 WHERE set_type_id = $2
+		`, targetID, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.deleteRow(ctx, "set_types", "set_type_id", id, version); err != nil {
+			return nil, err
+		}
+		return s.ListSetTypes(ctx)
+	})
+}
+
+func (s *Store) ListProjectTypes(ctx context.Context) ([]*types.ProjectType, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `SELECT project_type_id, project_type_name, COALESCE(neaktor_id, ''), version FROM project_types ORDER BY project_type_name ASC`)
 	if err != nil {
 		return nil, err
 	}
@@ -109,7 +246,7 @@ func (s *Store) ListProjectTypes() ([]*types.ProjectType, error) {
 	result := make([]*types.ProjectType, 0)
 	for rows.Next() {
 		item := new(types.ProjectType)
-		if err := rows.Scan(&item.ProjectTypeID, &item.ProjectTypeName, &item.NeaktorID); err != nil {
+		if err := rows.Scan(&item.ProjectTypeID, &item.ProjectTypeName, &item.NeaktorID, &item.Version); err != nil {
 			return nil, err
 		}
 		result = append(result, item)
@@ -117,8 +254,8 @@ func (s *Store) ListProjectTypes() ([]*types.ProjectType, error) {
 	return result, rows.Err()
 }
 
-func (s *Store) SearchProjectTypes(query types.ListQuery) ([]*types.ProjectType, int, error) {
-	items, err := s.ListProjectTypes()
+func (s *Store) SearchProjectTypes(ctx context.Context, query types.ListQuery) ([]*types.ProjectType, int, error) {
+	items, err := s.ListProjectTypes(ctx)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -134,10 +271,10 @@ func (s *Store) SearchProjectTypes(query types.ListQuery) ([]*types.ProjectType,
 	return paginateSlice(filtered, query), len(filtered), nil
 }
 
-func (s *Store) GetProjectTypeByID(id int) (*types.ProjectType, error) {
-	row := s.db.QueryRow(`SELECT project_type_id, project_type_name, COALESCE(neaktor_id, '') FROM project_types WHERE project_type_id = $1`, id)
+func (s *Store) GetProjectTypeByID(ctx context.Context, id int) (*types.ProjectType, error) {
+	row := s.conn(ctx).QueryRowContext(ctx, `SELECT project_type_id, project_type_name, COALESCE(neaktor_id, ''), version FROM project_types WHERE project_type_id = $1`, id)
 	item := new(types.ProjectType)
-	if err := row.Scan(&item.ProjectTypeID, &item.ProjectTypeName, &item.NeaktorID); err != nil {
+	if err := row.Scan(&item.ProjectTypeID, &item.ProjectTypeName, &item.NeaktorID, &item.Version); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrNotFound
 		}
@@ -146,38 +283,73 @@ func (s *Store) GetProjectTypeByID(id int) (*types.ProjectType, error) {
 	return item, nil
 }
 
-func (s *Store) CreateProjectType(payload types.ProjectTypePayload) ([]*types.ProjectType, error) {
-	_, err := s.db.Exec(`INSERT INTO project_types (project_type_name, neaktor_id) VALUES ($1, NULLIF($2, ''))`, payload.ProjectTypeName, payload.NeaktorID)
+func (s *Store) CreateProjectType(ctx context.Context, payload types.ProjectTypePayload) ([]*types.ProjectType, error) {
+	_, err := s.conn(ctx).ExecContext(ctx, `INSERT INTO project_types (project_type_name, neaktor_id) VALUES ($1, NULLIF($2, ''))`, payload.ProjectTypeName, payload.NeaktorID)
 	if err != nil {
 		return nil, err
 	}
-	return s.ListProjectTypes()
+	return s.ListProjectTypes(ctx)
 }
 
-func (s *Store) UpdateProjectType(id int, payload types.ProjectTypePayload) ([]*types.ProjectType, error) {
-	result, err := s.db.Exec(`UPDATE project_types SET project_type_name = $1, neaktor_id = NULLIF($2, '') WHERE project_type_id = $3`, payload.ProjectTypeName, payload.NeaktorID, id)
+func (s *Store) UpdateProjectType(ctx context.Context, id, version int, payload types.ProjectTypePayload) ([]*types.ProjectType, error) {
+	result, err := s.conn(ctx).ExecContext(ctx, `UPDATE project_types SET project_type_name = $1, neaktor_id = NULLIF($2, ''), version = version + 1 WHERE project_type_id = $3 AND ($4 = 0 OR version = $4)`, payload.ProjectTypeName, payload.NeaktorID, id, version)
 	if err != nil {
 		return nil, err
 	}
 	if rows, _ := result.RowsAffected(); rows == 0 {
-		return nil, ErrNotFound
+		return nil, s.missingOrConflict(ctx, "project_types", "project_type_id", id)
 	}
-	return s.ListProjectTypes()
+	return s.ListProjectTypes(ctx)
 }
 
-func (s *Store) DeleteProjectType(id int) ([]*types.ProjectType, error) {
-	result, err := s.db.Exec(`DELETE FROM project_types WHERE project_type_id = $1`, id)
-	if err != nil {
-		return nil, err
-	}
-	if rows, _ := result.RowsAffected(); rows == 0 {
-		return nil, ErrNotFound
-	}
-	return s.ListProjectTypes()
+// DeleteProjectType deletes a project type no project uses, trashed projects
+// included.
+func (s *Store) DeleteProjectType(ctx context.Context, id, version int) ([]*types.ProjectType, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.ProjectType, error) {
+		count, err := s.countRows(ctx, `SELECT COUNT(*) FROM projects WHERE project_type_id = $1`, id)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, dependentsError("projects", count, utils.Errorf("%w: %d projects of this type", ErrInUse, count))
+		}
+		if err := s.deleteRow(ctx, "project_types", "project_type_id", id, version); err != nil {
+			return nil, err
+		}
+		return s.ListProjectTypes(ctx)
+	})
+}
+
+// MergeProjectType moves the projects of project type id, trashed ones
+// included, to targetID and deletes id.
+func (s *Store) MergeProjectType(ctx context.Context, id, version, targetID int) ([]*types.ProjectType, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.ProjectType, error) {
+		if err := s.requireMergeTarget(ctx, "project_types", "project_type_id", id, targetID); err != nil {
+			return nil, err
+		}
+		projectIDs, err := s.queryIDs(ctx, `
+			WITH moved AS (
+				UPDATE projects SET project_type_id = $1, version = version + 1
+				WHERE project_type_id = $2
+				RETURNING project_id, deleted_at
+			)
+			SELECT project_id FROM moved WHERE deleted_at IS NULL ORDER BY project_id ASC
+		`, targetID, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.deleteRow(ctx, "project_types", "project_type_id", id, version); err != nil {
+			return nil, err
+		}
+		for _, projectID := range projectIDs {
+			s.publishProject(ctx, events.ProjectUpdated, projectID)
+		}
+		return s.ListProjectTypes(ctx)
+	})
 }
 
-func (s *Store) ListWarehouses() ([]*types.Warehouse, error) {
-	rows, err := s.db.Query(`SELECT warehouse_id, warehouse_name, COALESCE(warehouse_adress, '') FROM warehouses ORDER BY warehouse_name ASC`)
+func (s *Store) ListWarehouses(ctx context.Context) ([]*types.Warehouse, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `SELECT warehouse_id, warehouse_name, COALESCE(warehouse_adress, ''), version FROM warehouses ORDER BY warehouse_name ASC`)
 	if err != nil {
 		return nil, err
 	}
@@ -186,7 +358,7 @@ func (s *Store) ListWarehouses() ([]*types.Warehouse, error) {
 	result := make([]*types.Warehouse, 0)
 	for rows.Next() {
 		item := new(types.Warehouse)
-		if err := rows.Scan(&item.WarehouseID, &item.WarehouseName, &item.WarehouseAdress); err != nil {
+		if err := rows.Scan(&item.WarehouseID, &item.WarehouseName, &item.WarehouseAdress, &item.Version); err != nil {
 			return nil, err
 		}
 		result = append(result, item)
@@ -194,8 +366,8 @@ func (s *Store) ListWarehouses() ([]*types.Warehouse, error) {
 	return result, rows.Err()
 }
 
-func (s *Store) SearchWarehouses(query types.ListQuery) ([]*types.Warehouse, int, error) {
-	items, err := s.ListWarehouses()
+func (s *Store) SearchWarehouses(ctx context.Context, query types.ListQuery) ([]*types.Warehouse, int, error) {
+	items, err := s.ListWarehouses(ctx)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -211,42 +383,103 @@ func (s *Store) SearchWarehouses(query types.ListQuery) ([]*types.Warehouse, int
 	return paginateSlice(filtered, query), len(filtered), nil
 }
 
-func (s *Store) CreateWarehouse(payload types.WarehousePayload) ([]*types.Warehouse, error) {
-	_, err := s.db.Exec(`INSERT INTO warehouses (warehouse_name, warehouse_adress) VALUES ($1, NULLIF($2, ''))`, payload.WarehouseName, payload.WarehouseAdress)
+func (s *Store) CreateWarehouse(ctx context.Context, payload types.WarehousePayload) ([]*types.Warehouse, error) {
+	_, err := s.conn(ctx).ExecContext(ctx, `INSERT INTO warehouses (warehouse_name, warehouse_adress) VALUES ($1, NULLIF($2, ''))`, payload.WarehouseName, payload.WarehouseAdress)
 	if err != nil {
 		return nil, err
 	}
-	return s.ListWarehouses()
+	return s.ListWarehouses(ctx)
 }
 
-func (s *Store) UpdateWarehouse(id int, payload types.WarehousePayload) ([]*types.Warehouse, error) {
-	result, err := s.db.Exec(`UPDATE warehouses SET warehouse_name = $1, warehouse_adress = NULLIF($2, '') WHERE warehouse_id = $3`, payload.WarehouseName, payload.WarehouseAdress, id)
+func (s *Store) UpdateWarehouse(ctx context.Context, id, version int, payload types.WarehousePayload) ([]*types.Warehouse, error) {
+	result, err := s.conn(ctx).ExecContext(ctx, `UPDATE warehouses SET warehouse_name = $1, warehouse_adress = NULLIF($2, ''), version = version + 1 WHERE warehouse_id = $3 AND ($4 = 0 OR version = $4)`, payload.WarehouseName, payload.WarehouseAdress, id, version)
 	if err != nil {
 		return nil, err
 	}
 	if rows, _ := result.RowsAffected(); rows == 0 {
-		return nil, ErrNotFound
+		return nil, s.missingOrConflict(ctx, "warehouses", "warehouse_id", id)
 	}
-	return s.ListWarehouses()
+	return s.ListWarehouses(ctx)
 }
 
-func (s *Store) DeleteWarehouse(id int) ([]*types.Warehouse, error) {
-	result, err := s.db.Exec(`DELETE FROM warehouses WHERE warehouse_id = $1`, id)
-	if err != nil {
-		return nil, err
-	}
-	if rows, _ := result.RowsAffected(); rows == 0 {
-		return nil, ErrNotFound
-	}
-	return s.ListWarehouses()
+func (s *Store) DeleteWarehouse(ctx context.Context, id, version int) ([]*types.Warehouse, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.Warehouse, error) {
+		count, err := s.countRows(ctx, `SELECT COUNT(*) FROM equipment WHERE storage_id = $1`, id)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, dependentsError("equipment", count, utils.Errorf("%w: %d equipment items in this warehouse", ErrInUse, count))
+		}
+		if err := s.requireNoOpenTransfers(ctx, id); err != nil {
+			return nil, err
+		}
+		if err := s.requireNoOpenStocktake(ctx, id); err != nil {
+			return nil, err
+		}
+		count, err = s.countRows(ctx, `SELECT COUNT(*) FROM stock_levels WHERE warehouse_id = $1 AND quantity > 0`, id)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, dependentsError("stock", count, utils.Errorf("%w: %d stock items are kept in this warehouse", ErrInUse, count))
+		}
+		if err := s.deleteRow(ctx, "warehouses", "warehouse_id", id, version); err != nil {
+			return nil, err
+		}
+		return s.ListWarehouses(ctx)
+	})
+}
+
+// MergeWarehouse moves the equipment stored in warehouse id to targetID,
+// logging each move, adds its stock to the target's and deletes id.
+func (s *Store) MergeWarehouse(ctx context.Context, id, version, targetID int) ([]*types.Warehouse, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.Warehouse, error) {
+		if err := s.requireMergeTarget(ctx, "warehouses", "warehouse_id", id, targetID); err != nil {
+			return nil, err
+		}
+		if err := s.requireNoOpenTransfers(ctx, id); err != nil {
+			return nil, err
+		}
+		if err := s.requireNoOpenStocktake(ctx, id); err != nil {
+			return nil, err
+		}
+		equipmentIDs, err := s.queryIDs(ctx, `
+			WITH moved AS (
+				UPDATE equipment SET storage_id = $1, location_id = NULL, version = version + 1 WHERE storage_id = $2
+				RETURNING equipment_id, deleted_at
+			), logged AS (
+				INSERT INTO equipment_movements (equipment_id, from_warehouse_id, to_warehouse_id, moved_by)
+				SELECT equipment_id, $2, $1, $3 FROM moved
+			)
+			SELECT equipment_id FROM moved WHERE deleted_at IS NULL
+		`, targetID, id, actorID(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.conn(ctx).ExecContext(ctx, `
+			INSERT INTO stock_levels (stock_item_id, warehouse_id, quantity)
+			SELECT stock_item_id, $1, quantity FROM stock_levels WHERE warehouse_id = $2
+			ON CONFLICT (stock_item_id, warehouse_id) DO UPDATE SET quantity = stock_levels.quantity + EXCLUDED.quantity
+		`, targetID, id); err != nil {
+			return nil, err
+		}
+		if err := s.deleteRow(ctx, "warehouses", "warehouse_id", id, version); err != nil {
+			return nil, err
+		}
+		for _, equipmentID := range equipmentIDs {
+			s.publishEquipment(ctx, events.EquipmentUpdated, equipmentID)
+		}
+		return s.ListWarehouses(ctx)
+	})
 }
 
-func (s *Store) ListEquipmentSets() ([]*types.EquipmentSet, error) {
-	return s.listEquipmentSets("")
+func (s *Store) ListEquipmentSets(ctx context.Context) ([]*types.EquipmentSet, error) {
+	return s.listEquipmentSets(ctx, "")
 }
 
-func (s *Store) SearchEquipmentSets(query types.ListQuery) ([]*types.EquipmentSet, int, error) {
-	items, err := s.ListEquipmentSets()
+func (s *Store) SearchEquipmentSets(ctx context.Context, query types.ListQuery) ([]*types.EquipmentSet, int, error) {
+	items, err := s.ListEquipmentSets(ctx)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -262,8 +495,8 @@ func (s *Store) SearchEquipmentSets(query types.ListQuery) ([]*types.EquipmentSe
 	return paginateSlice(filtered, query), len(filtered), nil
 }
 
-func (s *Store) GetEquipmentSetByID(id int) (*types.EquipmentSet, error) {
-	rows, err := s.listEquipmentSets("WHERE es.equipment_set_id = $1", id)
+func (s *Store) GetEquipmentSetByID(ctx context.Context, id int) (*types.EquipmentSet, error) {
+	rows, err := s.listEquipmentSets(ctx, "WHERE es.equipment_set_id = $1", id)
 	if err != nil {
 		return nil, err
 	}
@@ -273,59 +506,111 @@ func (s *Store) GetEquipmentSetByID(id int) (*types.EquipmentSet, error) {
 	return rows[0], nil
 }
 
-func (s *Store) CreateEquipmentSet(payload types.EquipmentSetPayload) ([]*types.EquipmentSet, error) {
-	setTypeID, err := s.getSetTypeIDByName(payload.SetTypeName)
-	if err != nil {
-		return nil, err
-	}
+func (s *Store) CreateEquipmentSet(ctx context.Context, payload types.EquipmentSetPayload) ([]*types.EquipmentSet, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.EquipmentSet, error) {
+		setTypeID, err := s.getSetTypeID(ctx, payload.SetTypeID, payload.SetTypeName)
+		if err != nil {
+			return nil, err
+		}
 
-	_, err = s.db.Exec(`
-		INSERT INTO equipment_sets (equipment_set_name, description, set_type_id)
-		VALUES ($1, NULLIF($2, ''), $3)
-	`, payload.EquipmentSetName, payload.Description, setTypeID)
-	if err != nil {
-		return nil, err
-	}
-	return s.ListEquipmentSets()
+		_, err = s.conn(ctx).ExecContext(ctx, `
+			INSERT INTO equipment_sets (equipment_set_name, description, set_type_id)
+			VALUES ($1, NULLIF($2, ''), $3)
+		`, payload.EquipmentSetName, payload.Description, setTypeID)
+		if err != nil {
+			return nil, err
+		}
+		return s.ListEquipmentSets(ctx)
+	})
 }
 
-func (s *Store) UpdateEquipmentSet(id int, payload types.EquipmentSetPayload) ([]*types.EquipmentSet, error) {
-	setTypeID, err := s.getSetTypeIDByName(payload.SetTypeName)
-	if err != nil {
-		return nil, err
-	}
+func (s *Store) UpdateEquipmentSet(ctx context.Context, id, version int, payload types.EquipmentSetPayload) ([]*types.EquipmentSet, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.EquipmentSet, error) {
+		setTypeID, err := s.getSetTypeID(ctx, payload.SetTypeID, payload.SetTypeName)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.requireAttributesFit(ctx, setTypeID, []int{id}); err != nil {
+			return nil, err
+		}
 
-	result, err := s.db.Exec(`
-		UPDATE equipment_sets
-		SET equipment_set_name = $1, description = NULLIF($2, ''), set_type_id = $3
-		WHERE equipment_set_id = $4
-	`, payload.EquipmentSetName, payload.Description, setTypeID, id)
-	if err != nil {
-		return nil, err
-	}
-	if rows, _ := result.RowsAffected(); rows == 0 {
-		return nil, ErrNotFound
-	}
-	return s.ListEquipmentSets()
+		result, err := s.conn(ctx).ExecContext(ctx, `
+			UPDATE equipment_sets
+			SET equipment_set_name = $1, description = NULLIF($2, ''), set_type_id = $3, version = version + 1
+			WHERE equipment_set_id = $4 AND ($5 = 0 OR version = $5)
+		`, payload.EquipmentSetName, payload.Description, setTypeID, id, version)
+		if err != nil {
+			return nil, err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return nil, s.missingOrConflict(ctx, "equipment_sets", "equipment_set_id", id)
+		}
+		return s.ListEquipmentSets(ctx)
+	})
 }
 
-func (s *Store) DeleteEquipmentSet(id int) ([]*types.EquipmentSet, error) {
-	result, err := s.db.Exec(`DELETE FROM equipment_sets WHERE equipment_set_id = $1`, id)
-	if err != nil {
-		return nil, err
-	}
-	if rows, _ := result.RowsAffected(); rows == 0 {
-		return nil, ErrNotFound
-	}
-	return s.ListEquipmentSets()
+func (s *Store) DeleteEquipmentSet(ctx context.Context, id, version int) ([]*types.EquipmentSet, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.EquipmentSet, error) {
+		count, err := s.countRows(ctx, `SELECT COUNT(*) FROM equipment WHERE equipment_set_id = $1`, id)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, dependentsError("equipment", count, utils.Errorf("%w: %d equipment items in this set", ErrInUse, count))
+		}
+		if err := s.deleteRow(ctx, "equipment_sets", "equipment_set_id", id, version); err != nil {
+			return nil, err
+		}
+		return s.ListEquipmentSets(ctx)
+	})
+}
+
+// MergeEquipmentSet moves the equipment of set id to targetID and deletes id.
+// Equipment whose attributes do not fit the set type of targetID blocks it.
+func (s *Store) MergeEquipmentSet(ctx context.Context, id, version, targetID int) ([]*types.EquipmentSet, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.EquipmentSet, error) {
+		if err := s.requireMergeTarget(ctx, "equipment_sets", "equipment_set_id", id, targetID); err != nil {
+			return nil, err
+		}
+		var setTypeID int
+		if err := s.conn(ctx).QueryRowContext(ctx, `
+			SELECT set_type_id FROM equipment_sets WHERE equipment_set_id = $1
+		`, targetID).Scan(&setTypeID); err != nil {
+			return nil, err
+		}
+		if err := s.requireAttributesFit(ctx, setTypeID, []int{id}); err != nil {
+			return nil, err
+		}
+		if err := s.requireDisjointSerials(ctx, id, targetID); err != nil {
+			return nil, err
+		}
+		equipmentIDs, err := s.queryIDs(ctx, `
+			WITH moved AS (
+				UPDATE equipment SET equipment_set_id = $1, version = version + 1 WHERE equipment_set_id = $2
+				RETURNING equipment_id, deleted_at
+			)
+			SELECT equipment_id FROM moved WHERE deleted_at IS NULL
+		`, targetID, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.deleteRow(ctx, "equipment_sets", "equipment_set_id", id, version); err != nil {
+			return nil, err
+		}
+		for _, equipmentID := range equipmentIDs {
+			s.publishEquipment(ctx, events.EquipmentUpdated, equipmentID)
+		}
+		return s.ListEquipmentSets(ctx)
+	})
 }
 
-func (s *Store) GetEquipmentSetsWithMaintenance() ([]*types.EquipmentSet, error) {
-	rows, err := s.listEquipmentSets(`
+func (s *Store) GetEquipmentSetsWithMaintenance(ctx context.Context) ([]*types.EquipmentSet, error) {
+	rows, err := s.listEquipmentSets(ctx, `
 		WHERE EXISTS (
 			SELECT 1 FROM equipment e
 			WHERE e.equipment_set_id = es.equipment_set_id
 			  AND e.needs_maintenance = TRUE
+			  AND e.deleted_at IS NULL
 		)
 	`)
 	if err != nil {
@@ -334,8 +619,8 @@ func (s *Store) GetEquipmentSetsWithMaintenance() ([]*types.EquipmentSet, error)
 	return rows, nil
 }
 
-func (s *Store) GetEquipmentSetsWithStorage() ([]*types.EquipmentSetStorageSummary, error) {
-	rows, err := s.db.Query(`
+func (s *Store) GetEquipmentSetsWithStorage(ctx context.Context) ([]*types.EquipmentSetStorageSummary, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
 		SELECT
 			es.equipment_set_name,
 			w.warehouse_name,
@@ -343,6 +628,7 @@ func (s *Store) GetEquipmentSetsWithStorage() ([]*types.EquipmentSetStorageSumma
 		FROM equipment_sets es
 		JOIN equipment e ON e.equipment_set_id = es.equipment_set_id
 		JOIN warehouses w ON w.warehouse_id = e.storage_id
+		WHERE e.deleted_at IS NULL
 		GROUP BY es.equipment_set_name, w.warehouse_name
 		ORDER BY es.equipment_set_name, w.warehouse_name
 	`)
@@ -362,66 +648,63 @@ func (s *Store) GetEquipmentSetsWithStorage() ([]*types.EquipmentSetStorageSumma
 	return result, rows.Err()
 }
 
-func (s *Store) ListEquipment() ([]*types.Equipment, error) {
-	return s.listEquipment("")
+func (s *Store) ListEquipment(ctx context.Context) ([]*types.Equipment, error) {
+	return s.listEquipment(ctx, "")
 }
 
-func (s *Store) SearchEquipment(query types.ListQuery) ([]*types.Equipment, int, error) {
-	items, err := s.ListEquipment()
+func (s *Store) SearchEquipment(ctx context.Context, filter types.EquipmentFilter, query types.ListQuery) ([]*types.Equipment, int, error) {
+	items, err := s.ListEquipment(ctx)
 	if err != nil {
 		return nil, 0, err
 	}
-
-	search := normalizeSearchQuery(query.Search)
-	filtered := make([]*types.Equipment, 0, len(items))
-	for _, item := range items {
-		if matchesSearch(
-			search,
-			strconv.Itoa(item.EquipmentID),
-			item.EquipmentName,
-			item.SerialNumber,
-			item.Description,
-			item.EquipmentSet.EquipmentSetName,
-			item.Storage.WarehouseName,
-		) {
-			filtered = append(filtered, item)
-		}
-	}
-
+	filtered := filterEquipment(items, filter, query)
 	return paginateSlice(filtered, query), len(filtered), nil
 }
 
-func (s *Store) ListEquipmentBySetID(setID int) ([]*types.Equipment, error) {
-	return s.listEquipment("WHERE e.equipment_set_id = $1", setID)
+func (s *Store) ListEquipmentBySetID(ctx context.Context, setID int) ([]*types.Equipment, error) {
+	return s.listEquipment(ctx, "e.equipment_set_id = $1", setID)
 }
 
-func (s *Store) SearchEquipmentBySetID(setID int, query types.ListQuery) ([]*types.Equipment, int, error) {
-	items, err := s.ListEquipmentBySetID(setID)
+func (s *Store) SearchEquipmentBySetID(ctx context.Context, setID int, filter types.EquipmentFilter, query types.ListQuery) ([]*types.Equipment, int, error) {
+	items, err := s.ListEquipmentBySetID(ctx, setID)
 	if err != nil {
 		return nil, 0, err
 	}
+	filtered := filterEquipment(items, filter, query)
+	return paginateSlice(filtered, query), len(filtered), nil
+}
 
+// filterEquipment keeps the items with the attribute values of filter that
+// match the search, which also looks at attribute values.
+func filterEquipment(items []*types.Equipment, filter types.EquipmentFilter, query types.ListQuery) []*types.Equipment {
 	search := normalizeSearchQuery(query.Search)
 	filtered := make([]*types.Equipment, 0, len(items))
 	for _, item := range items {
-		if matchesSearch(
-			search,
+		if !matchesAttributes(item, filter.Attributes) {
+			continue
+		}
+		locationPath := ""
+		if item.Location != nil {
+			locationPath = item.Location.Path
+		}
+		values := append([]string{
 			strconv.Itoa(item.EquipmentID),
 			item.EquipmentName,
 			item.SerialNumber,
 			item.Description,
 			item.EquipmentSet.EquipmentSetName,
 			item.Storage.WarehouseName,
-		) {
+			locationPath,
+		}, attributeText(item.Attributes)...)
+		if matchesSearch(search, values...) {
 			filtered = append(filtered, item)
 		}
 	}
-
-	return paginateSlice(filtered, query), len(filtered), nil
+	return filtered
 }
 
-func (s *Store) GetEquipmentByID(id int) (*types.Equipment, error) {
-	rows, err := s.listEquipment("WHERE e.equipment_id = $1", id)
+func (s *Store) GetEquipmentByID(ctx context.Context, id int) (*types.Equipment, error) {
+	rows, err := s.listEquipment(ctx, "e.equipment_id = $1", id)
 	if err != nil {
 		return nil, err
 	}
@@ -431,98 +714,166 @@ func (s *Store) GetEquipmentByID(id int) (*types.Equipment, error) {
 	return rows[0], nil
 }
 
-func (s *Store) CreateEquipment(payload types.EquipmentPayload) ([]*types.Equipment, error) {
-	equipmentSetID, err := s.getEquipmentSetIDByName(payload.EquipmentSetName)
-	if err != nil {
-		return nil, err
-	}
+func (s *Store) CreateEquipment(ctx context.Context, payload types.EquipmentPayload) ([]*types.Equipment, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.Equipment, error) {
+		equipmentSetID, err := s.getEquipmentSetID(ctx, payload.EquipmentSetID, payload.EquipmentSetName)
+		if err != nil {
+			return nil, err
+		}
 
-	warehouseID, err := s.getWarehouseIDByName(payload.WarehouseName)
-	if err != nil {
-		return nil, err
-	}
+		warehouseID, err := s.getWarehouseID(ctx, payload.WarehouseID, payload.WarehouseName)
+		if err != nil {
+			return nil, err
+		}
+		if payload.LocationID > 0 {
+			if _, err := s.locationKind(ctx, warehouseID, payload.LocationID); err != nil {
+				return nil, err
+			}
+		}
+		attributes, err := s.equipmentAttributes(ctx, 0, equipmentSetID, payload.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.requireUniqueSerial(ctx, 0, equipmentSetID, payload.SerialNumber); err != nil {
+			return nil, err
+		}
 
-	_, err = s.db.Exec(`
-		INSERT INTO equipment (
-			equipment_set_id,
-			equipment_name,
-			description,
-			serial_number,
-			storage_id,
-			current_storage,
-			needs_maintenance,
-			date_of_purchase,
-			cost_of_purchase
-		)
-		VALUES ($1, $2, NULLIF($3, ''), $4, $5, NULLIF($6, ''), $7, NULLIF($8, '')::DATE, $9)
-	`, equipmentSetID, payload.EquipmentName, payload.Description, payload.SerialNumber, warehouseID, payload.CurrentStorage, payload.NeedsMaintenance, payload.DateOfPurchase, payload.CostOfPurchase)
-	if err != nil {
-		return nil, err
-	}
+		var equipmentID int
+		err = s.conn(ctx).QueryRowContext(ctx, `
+			INSERT INTO equipment (
+				equipment_set_id,
+				equipment_name,
+				description,
+				serial_number,
+				storage_id,
+				location_id,
+				needs_maintenance,
+				date_of_purchase,
+				cost_of_purchase,
+				attributes
+			)
+			VALUES ($1, $2, NULLIF($3, ''), $4, $5, NULLIF($6, 0), $7, NULLIF($8, '')::DATE, $9, COALESCE($10::JSONB, '{}'))
+			RETURNING equipment_id
+		`, equipmentSetID, payload.EquipmentName, payload.Description, payload.SerialNumber, warehouseID, payload.LocationID, payload.NeedsMaintenance, payload.DateOfPurchase, payload.CostOfPurchase, attributes).Scan(&equipmentID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.recordMovement(ctx, equipmentID, 0, warehouseID); err != nil {
+			return nil, err
+		}
+		s.publishEquipment(ctx, events.EquipmentCreated, equipmentID)
 
-	return s.ListEquipment()
+		return s.ListEquipment(ctx)
+	})
 }
 
-func (s *Store) UpdateEquipment(id int, payload types.EquipmentPayload) ([]*types.Equipment, error) {
-	equipmentSetID, err := s.getEquipmentSetIDByName(payload.EquipmentSetName)
-	if err != nil {
-		return nil, err
-	}
+func (s *Store) UpdateEquipment(ctx context.Context, id, version int, payload types.EquipmentPayload) ([]*types.Equipment, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.Equipment, error) {
+		equipmentSetID, err := s.getEquipmentSetID(ctx, payload.EquipmentSetID, payload.EquipmentSetName)
+		if err != nil {
+			return nil, err
+		}
 
-	warehouseID, err := s.getWarehouseIDByName(payload.WarehouseName)
-	if err != nil {
-		return nil, err
-	}
+		warehouseID, err := s.getWarehouseID(ctx, payload.WarehouseID, payload.WarehouseName)
+		if err != nil {
+			return nil, err
+		}
+		if payload.LocationID > 0 {
+			if _, err := s.locationKind(ctx, warehouseID, payload.LocationID); err != nil {
+				return nil, err
+			}
+		}
+		attributes, err := s.equipmentAttributes(ctx, id, equipmentSetID, payload.Attributes)
+		if err != nil {
+			return nil, err
+		}
 
-	result, err := s.db.Exec(`
-		UPDATE equipment
-		SET equipment_set_id = $1,
-			equipment_name = $2,
-			description = NULLIF($3, ''),
-			serial_number = $4,
-			storage_id = $5,
-			current_storage = NULLIF($6, ''),
-			needs_maintenance = $7,
-			date_of_purchase = NULLIF($8, '')::DATE,
-			cost_of_purchase = $9
-		WHERE equipment_id = $10
-	`, equipmentSetID, payload.EquipmentName, payload.Description, payload.SerialNumber, warehouseID, payload.CurrentStorage, payload.NeedsMaintenance, payload.DateOfPurchase, payload.CostOfPurchase, id)
-	if err != nil {
-		return nil, err
-	}
-	if rows, _ := result.RowsAffected(); rows == 0 {
-		return nil, ErrNotFound
-	}
+		var storageID int
+		err = s.conn(ctx).QueryRowContext(ctx, `
+			SELECT storage_id FROM equipment WHERE equipment_id = $1 AND deleted_at IS NULL
+		`, id).Scan(&storageID)
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if storageID != warehouseID {
+			if err := s.requireNoOpenTransfer(ctx, []int{id}); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.requireUniqueSerial(ctx, id, equipmentSetID, payload.SerialNumber); err != nil {
+			return nil, err
+		}
+
+		result, err := s.conn(ctx).ExecContext(ctx, `
+			UPDATE equipment
+			SET equipment_set_id = $1,
+				equipment_name = $2,
+				description = NULLIF($3, ''),
+				serial_number = $4,
+				storage_id = $5,
+				location_id = NULLIF($6, 0),
+				needs_maintenance = $7,
+				date_of_purchase = NULLIF($8, '')::DATE,
+				cost_of_purchase = $9,
+				attributes = COALESCE($10::JSONB, attributes),
+				serial_exempt = serial_exempt AND equipment_set_id = $1 AND serial_key = `+serialKey("$4")+`,
+				version = version + 1
+			WHERE equipment_id = $11 AND deleted_at IS NULL AND ($12 = 0 OR version = $12)
+		`, equipmentSetID, payload.EquipmentName, payload.Description, payload.SerialNumber, warehouseID, payload.LocationID, payload.NeedsMaintenance, payload.DateOfPurchase, payload.CostOfPurchase, attributes, id, version)
+		if err != nil {
+			return nil, err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return nil, s.missingOrConflict(ctx, "equipment", "equipment_id", id)
+		}
+		if storageID != warehouseID {
+			if err := s.recordMovement(ctx, id, storageID, warehouseID); err != nil {
+				return nil, err
+			}
+		}
+		s.publishEquipment(ctx, events.EquipmentUpdated, id)
 
-	return s.ListEquipment()
+		return s.ListEquipment(ctx)
+	})
 }
 
-func (s *Store) DeleteEquipment(id int) error {
-	result, err := s.db.Exec(`DELETE FROM equipment WHERE equipment_id = $1`, id)
+// DeleteEquipment moves equipment to the trash. Its project and draft links
+// stay in place, hidden, and come back with RestoreEquipment.
+func (s *Store) DeleteEquipment(ctx context.Context, id, version int) error {
+	result, err := s.conn(ctx).ExecContext(ctx, `
+		UPDATE equipment SET deleted_at = NOW(), version = version + 1
+		WHERE equipment_id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)
+	`, id, version)
 	if err != nil {
 		return err
 	}
 	if rows, _ := result.RowsAffected(); rows == 0 {
-		return ErrNotFound
+		return s.missingOrConflict(ctx, "equipment", "equipment_id", id)
 	}
+	event := events.New(events.EquipmentDeleted)
+	event.EquipmentIDs = []int{id}
+	s.publish(ctx, event)
 	return nil
 }
 
-func (s *Store) ListProjects(archived bool) ([]*types.Project, error) {
-	where := "WHERE p.archived IS FALSE"
+func (s *Store) ListProjects(ctx context.Context, archived bool) ([]*types.Project, error) {
+	where := "p.archived IS FALSE"
 	if archived {
-		where = "WHERE p.archived IS TRUE"
+		where = "p.archived IS TRUE"
 	}
 
-	result, err := s.listProjects(where)
+	result, err := s.listProjects(ctx, where)
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-func (s *Store) SearchProjects(archived bool, query types.ListQuery) ([]*types.Project, int, error) {
-	items, err := s.ListProjects(archived)
+func (s *Store) SearchProjects(ctx context.Context, archived bool, query types.ListQuery) ([]*types.Project, int, error) {
+	items, err := s.ListProjects(ctx, archived)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -546,8 +897,8 @@ func (s *Store) SearchProjects(archived bool, query types.ListQuery) ([]*types.P
 	return paginateSlice(filtered, query), len(filtered), nil
 }
 
-func (s *Store) GetProjectByID(id int) (*types.Project, error) {
-	result, err := s.listProjects("WHERE p.project_id = $1", id)
+func (s *Store) GetProjectByID(ctx context.Context, id int) (*types.Project, error) {
+	result, err := s.listProjects(ctx, "p.project_id = $1", id)
 	if err != nil {
 		return nil, err
 	}
@@ -556,8 +907,8 @@ func (s *Store) GetProjectByID(id int) (*types.Project, error) {
 	}
 
 	project := result[0]
-	equipment, err := s.listEquipment(`
-		WHERE e.equipment_id IN (
+	equipment, err := s.listEquipment(ctx, `
+		e.equipment_id IN (
 			SELECT equipment_id FROM equipment_in_project WHERE project_id = $1
 		)
 	`, project.ProjectID)
@@ -568,79 +919,228 @@ func (s *Store) GetProjectByID(id int) (*types.Project, error) {
 	return project, nil
 }
 
-func (s *Store) CreateProject(payload types.ProjectPayload) ([]*types.Project, error) {
-	projectTypeID, err := s.getProjectTypeIDByName(payload.ProjectTypeName)
-	if err != nil {
-		return nil, err
-	}
+func (s *Store) CreateProject(ctx context.Context, payload types.ProjectPayload) ([]*types.Project, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) ([]*types.Project, error) {
+		projectTypeID, err := s.getProjectTypeID(ctx, payload.ProjectTypeID, payload.ProjectTypeName)
+		if err != nil {
+			return nil, err
+		}
 
-	chiefEngineerID, err := s.getUserIDByName(payload.ChiefEngineerName)
-	if err != nil {
-		return nil, err
-	}
+		chiefEngineerID, err := s.getUserID(ctx, payload.ChiefEngineerID, payload.ChiefEngineerName)
+		if err != nil {
+			return nil, err
+		}
 
-	_, err = s.db.Exec(`
-		INSERT INTO projects (
-			project_name,
-			archived,
-			project_type_id,
-			shooting_start_date,
-			shooting_end_date,
-			chief_engineer_id
-		)
-		VALUES ($1, $2, $3, $4::DATE, $5::DATE, $6)
-	`, payload.ProjectName, payload.Archived, projectTypeID, payload.ShootingStartDate, payload.ShootingEndDate, chiefEngineerID)
-	if err != nil {
-		return nil, err
-	}
+		var projectID int
+		err = s.conn(ctx).QueryRowContext(ctx, `
+			INSERT INTO projects (
+				project_name,
+				archived,
+				project_type_id,
+				shooting_start_date,
+				shooting_end_date,
+				chief_engineer_id
+			)
+			VALUES ($1, $2, $3, $4::DATE, $5::DATE, $6)
+			RETURNING project_id
+		`, payload.ProjectName, payload.Archived, projectTypeID, payload.ShootingStartDate, payload.ShootingEndDate, chiefEngineerID).Scan(&projectID)
+		if err != nil {
+			return nil, err
+		}
+		s.publishProject(ctx, events.ProjectCreated, projectID)
 
-	return s.ListProjects(false)
+		return s.ListProjects(ctx, false)
+	})
 }
 
-func (s *Store) UpdateProject(id int, payload types.ProjectPayload) ([]*types.Project, error) {
-	projectTypeID, err := s.getProjectTypeIDByName(payload.ProjectTypeName)
-	if err != nil {
-		return nil, err
-	}
+func (s *Store) UpdateProject(ctx context.Context, id, version int, payload types.ProjectPayload) ([]*types.Project, error) {
+	return withTx(ctx, s, stockIsolation, func(ctx context.Context) ([]*types.Project, error) {
+		projectTypeID, err := s.getProjectTypeID(ctx, payload.ProjectTypeID, payload.ProjectTypeName)
+		if err != nil {
+			return nil, err
+		}
 
-	chiefEngineerID, err := s.getUserIDByName(payload.ChiefEngineerName)
-	if err != nil {
-		return nil, err
-	}
+		chiefEngineerID, err := s.getUserID(ctx, payload.ChiefEngineerID, payload.ChiefEngineerName)
+		if err != nil {
+			return nil, err
+		}
 
-	result, err := s.db.Exec(`
-		UPDATE projects
-		SET project_name = $1,
-			archived = $2,
-			project_type_id = $3,
-			shooting_start_date = $4::DATE,
-			shooting_end_date = $5::DATE,
-			chief_engineer_id = $6
-		WHERE project_id = $7
-	`, payload.ProjectName, payload.Archived, projectTypeID, payload.ShootingStartDate, payload.ShootingEndDate, chiefEngineerID, id)
-	if err != nil {
-		return nil, err
-	}
-	if rows, _ := result.RowsAffected(); rows == 0 {
-		return nil, ErrNotFound
-	}
+		result, err := s.conn(ctx).ExecContext(ctx, `
+			UPDATE projects
+			SET project_name = $1,
+				archived = $2,
+				project_type_id = $3,
+				shooting_start_date = $4::DATE,
+				shooting_end_date = $5::DATE,
+				chief_engineer_id = $6,
+				version = version + 1
+			WHERE project_id = $7 AND deleted_at IS NULL AND ($8 = 0 OR version = $8)
+		`, payload.ProjectName, payload.Archived, projectTypeID, payload.ShootingStartDate, payload.ShootingEndDate, chiefEngineerID, id, version)
+		if err != nil {
+			return nil, err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return nil, s.missingOrConflict(ctx, "projects", "project_id", id)
+		}
+		// New dates or leaving the archive can collide with the stock other
+		// projects reserved in the meantime.
+		if !payload.Archived {
+			if err := s.checkProjectStock(ctx, id, nil); err != nil {
+				return nil, err
+			}
+		}
+		s.publishProject(ctx, events.ProjectUpdated, id)
 
-	return s.ListProjects(payload.Archived)
+		return s.ListProjects(ctx, payload.Archived)
+	})
 }
 
-func (s *Store) DeleteProject(id int) ([]*types.Project, error) {
-	result, err := s.db.Exec(`DELETE FROM projects WHERE project_id = $1`, id)
+// DeleteProject moves a project to the trash together with its bookings,
+// which RestoreProject brings back.
+func (s *Store) DeleteProject(ctx context.Context, id, version int) ([]*types.Project, error) {
+	result, err := s.conn(ctx).ExecContext(ctx, `
+		UPDATE projects SET deleted_at = NOW(), version = version + 1
+		WHERE project_id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)
+	`, id, version)
 	if err != nil {
 		return nil, err
 	}
 	if rows, _ := result.RowsAffected(); rows == 0 {
-		return nil, ErrNotFound
+		return nil, s.missingOrConflict(ctx, "projects", "project_id", id)
 	}
-	return s.ListProjects(false)
+	event := events.New(events.ProjectDeleted)
+	event.ProjectID = id
+	s.publish(ctx, event)
+	return s.ListProjects(ctx, false)
+}
+
+// UpsertProjectByNeaktorID creates or updates the project linked to a
+// Neaktor task and reports which fields changed. Unknown project types or
+// chief engineers are returned as ErrInvalidReference, and new dates or
+// leaving the archive that overbook the project's stock as
+// ErrInsufficientStock.
+func (s *Store) UpsertProjectByNeaktorID(ctx context.Context, payload types.NeaktorProjectPayload) (*types.ProjectSyncChange, error) {
+	return s.syncProjectByNeaktorID(ctx, payload, true)
+}
+
+// UpdateProjectByNeaktorID behaves like UpsertProjectByNeaktorID but never
+// creates a project; ErrNotFound is returned when none is linked to the task.
+func (s *Store) UpdateProjectByNeaktorID(ctx context.Context, payload types.NeaktorProjectPayload) (*types.ProjectSyncChange, error) {
+	return s.syncProjectByNeaktorID(ctx, payload, false)
+}
+
+func (s *Store) syncProjectByNeaktorID(ctx context.Context, payload types.NeaktorProjectPayload, create bool) (*types.ProjectSyncChange, error) {
+	return withTx(ctx, s, stockIsolation, func(ctx context.Context) (*types.ProjectSyncChange, error) {
+		existing, err := s.listProjects(ctx, "p.neaktor_id = $1", payload.NeaktorID)
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) == 0 {
+			trashed, err := s.countRows(ctx, `SELECT COUNT(*) FROM projects WHERE neaktor_id = $1`, payload.NeaktorID)
+			if err != nil {
+				return nil, err
+			}
+			if trashed > 0 {
+				return nil, utils.Errorf("%w: the project linked to task %s", ErrTrashed, payload.NeaktorID)
+			}
+			if !create {
+				return nil, ErrNotFound
+			}
+		}
+
+		projectTypeID, err := s.getProjectTypeIDByNeaktorID(ctx, payload.ProjectTypeNeaktorID)
+		if err != nil {
+			return nil, err
+		}
+
+		chiefEngineerID, err := s.getUserIDByNameOrEmail(ctx, payload.ChiefEngineer)
+		if err != nil {
+			return nil, err
+		}
+
+		change := &types.ProjectSyncChange{NeaktorID: payload.NeaktorID, ProjectName: payload.ProjectName}
+
+		if len(existing) == 0 {
+			archived := payload.Archived != nil && *payload.Archived
+			err := s.conn(ctx).QueryRowContext(ctx, `
+				INSERT INTO projects (
+					neaktor_id,
+					project_name,
+					archived,
+					project_type_id,
+					shooting_start_date,
+					shooting_end_date,
+					chief_engineer_id
+				)
+				VALUES ($1, $2, $3, $4, $5::DATE, $6::DATE, $7)
+				RETURNING project_id
+			`, payload.NeaktorID, payload.ProjectName, archived, projectTypeID, payload.ShootingStartDate, payload.ShootingEndDate, chiefEngineerID).Scan(&change.ProjectID)
+			if err != nil {
+				return nil, err
+			}
+			change.Action = "created"
+			s.publishProject(ctx, events.ProjectCreated, change.ProjectID)
+			return change, nil
+		}
+
+		current := existing[0]
+		change.ProjectID = current.ProjectID
+		archived := current.Archived
+		if payload.Archived != nil {
+			archived = *payload.Archived
+		}
+
+		if current.ProjectName != payload.ProjectName {
+			change.ChangedFields = append(change.ChangedFields, "project_name")
+		}
+		if current.ProjectTypeID != projectTypeID {
+			change.ChangedFields = append(change.ChangedFields, "project_type_id")
+		}
+		if current.ShootingStartDate != payload.ShootingStartDate {
+			change.ChangedFields = append(change.ChangedFields, "shooting_start_date")
+		}
+		if current.ShootingEndDate != payload.ShootingEndDate {
+			change.ChangedFields = append(change.ChangedFields, "shooting_end_date")
+		}
+		if current.ChiefEngineerID != chiefEngineerID {
+			change.ChangedFields = append(change.ChangedFields, "chief_engineer_id")
+		}
+		if current.Archived != archived {
+			change.ChangedFields = append(change.ChangedFields, "archived")
+		}
+
+		if len(change.ChangedFields) == 0 {
+			change.Action = "unchanged"
+			return change, nil
+		}
+
+		_, err = s.conn(ctx).ExecContext(ctx, `
+			UPDATE projects
+			SET project_name = $1,
+				archived = $2,
+				project_type_id = $3,
+				shooting_start_date = $4::DATE,
+				shooting_end_date = $5::DATE,
+				chief_engineer_id = $6,
+				version = version + 1
+			WHERE project_id = $7
+		`, payload.ProjectName, archived, projectTypeID, payload.ShootingStartDate, payload.ShootingEndDate, chiefEngineerID, current.ProjectID)
+		if err != nil {
+			return nil, err
+		}
+		if !archived {
+			if err := s.checkProjectStock(ctx, current.ProjectID, nil); err != nil {
+				return nil, err
+			}
+		}
+		change.Action = "updated"
+		s.publishProject(ctx, events.ProjectUpdated, current.ProjectID)
+		return change, nil
+	})
 }
 
-func (s *Store) ListDrafts() ([]*types.Draft, error) {
-	rows, err := s.db.Query(`SELECT draft_id, draft_name FROM drafts ORDER BY draft_name DESC`)
+func (s *Store) ListDrafts(ctx context.Context) ([]*types.Draft, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `SELECT draft_id, draft_name, version FROM drafts WHERE deleted_at IS NULL ORDER BY draft_name DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -649,7 +1149,7 @@ func (s *Store) ListDrafts() ([]*types.Draft, error) {
 	result := make([]*types.Draft, 0)
 	for rows.Next() {
 		item := new(types.Draft)
-		if err := rows.Scan(&item.DraftID, &item.DraftName); err != nil {
+		if err := rows.Scan(&item.DraftID, &item.DraftName, &item.Version); err != nil {
 			return nil, err
 		}
 		result = append(result, item)
@@ -659,8 +1159,8 @@ func (s *Store) ListDrafts() ([]*types.Draft, error) {
 	}
 
 	for _, draft := range result {
-		equipment, err := s.listEquipment(`
-			WHERE e.equipment_id IN (
+		equipment, err := s.listEquipment(ctx, `
+			e.equipment_id IN (
 				SELECT equipment_id FROM equipment_in_draft WHERE draft_id = $1
 			)
 		`, draft.DraftID)
@@ -673,8 +1173,8 @@ func (s *Store) ListDrafts() ([]*types.Draft, error) {
 	return result, nil
 }
 
-func (s *Store) SearchDrafts(query types.ListQuery) ([]*types.Draft, int, error) {
-	items, err := s.ListDrafts()
+func (s *Store) SearchDrafts(ctx context.Context, query types.ListQuery) ([]*types.Draft, int, error) {
+	items, err := s.ListDrafts(ctx)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -698,18 +1198,18 @@ func (s *Store) SearchDrafts(query types.ListQuery) ([]*types.Draft, int, error)
 	return paginateSlice(filtered, query), len(filtered), nil
 }
 
-func (s *Store) GetDraftByID(id int) (*types.Draft, error) {
-	row := s.db.QueryRow(`SELECT draft_id, draft_name FROM drafts WHERE draft_id = $1`, id)
+func (s *Store) GetDraftByID(ctx context.Context, id int) (*types.Draft, error) {
+	row := s.conn(ctx).QueryRowContext(ctx, `SELECT draft_id, draft_name, version FROM drafts WHERE draft_id = $1 AND deleted_at IS NULL`, id)
 	draft := new(types.Draft)
-	if err := row.Scan(&draft.DraftID, &draft.DraftName); err != nil {
+	if err := row.Scan(&draft.DraftID, &draft.DraftName, &draft.Version); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
 
-	equipment, err := s.listEquipment(`
-		WHERE e.equipment_id IN (
+	equipment, err := s.listEquipment(ctx, `
+		e.equipment_id IN (
 			SELECT equipment_id FROM equipment_in_draft WHERE draft_id = $1
 		)
 	`, draft.DraftID)
@@ -720,95 +1220,122 @@ func (s *Store) GetDraftByID(id int) (*types.Draft, error) {
 	return draft, nil
 }
 
-func (s *Store) CreateDraft(payload types.DraftPayload) ([]*types.Draft, error) {
-	_, err := s.db.Exec(`INSERT INTO drafts (draft_name) VALUES ($1)`, payload.DraftName)
+func (s *Store) CreateDraft(ctx context.Context, payload types.DraftPayload) ([]*types.Draft, error) {
+	_, err := s.conn(ctx).ExecContext(ctx, `INSERT INTO drafts (draft_name) VALUES ($1)`, payload.DraftName)
 	if err != nil {
 		return nil, err
 	}
-	return s.ListDrafts()
+	return s.ListDrafts(ctx)
 }
 
-func (s *Store) UpdateDraft(id int, payload types.DraftPayload) ([]*types.Draft, error) {
-	result, err := s.db.Exec(`UPDATE drafts SET draft_name = $1 WHERE draft_id = $2`, payload.DraftName, id)
+func (s *Store) UpdateDraft(ctx context.Context, id, version int, payload types.DraftPayload) ([]*types.Draft, error) {
+	result, err := s.conn(ctx).ExecContext(ctx, `UPDATE drafts SET draft_name = $1, version = version + 1 WHERE draft_id = $2 AND deleted_at IS NULL AND ($3 = 0 OR version = $3)`, payload.DraftName, id, version)
 	if err != nil {
 		return nil, err
 	}
 	if rows, _ := result.RowsAffected(); rows == 0 {
-		return nil, ErrNotFound
+		return nil, s.missingOrConflict(ctx, "drafts", "draft_id", id)
 	}
-	return s.ListDrafts()
+	return s.ListDrafts(ctx)
 }
 
-func (s *Store) DeleteDraft(id int) ([]*types.Draft, error) {
-	result, err := s.db.Exec(`DELETE FROM drafts WHERE draft_id = $1`, id)
+// DeleteDraft moves a draft and its equipment list to the trash.
+func (s *Store) DeleteDraft(ctx context.Context, id, version int) ([]*types.Draft, error) {
+	result, err := s.conn(ctx).ExecContext(ctx, `
+		UPDATE drafts SET deleted_at = NOW(), version = version + 1
+		WHERE draft_id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)
+	`, id, version)
 	if err != nil {
 		return nil, err
 	}
 	if rows, _ := result.RowsAffected(); rows == 0 {
-		return nil, ErrNotFound
-	}
-	return s.ListDrafts()
-}
-
-func (s *Store) GetEquipmentInProject(projectID int) (*types.EquipmentInProjectResponse, error) {
-	return s.buildProjectEquipmentResponse(projectID)
-}
-
-func (s *Store) AddEquipmentToProject(payload types.EquipmentInProjectPayload) (*types.EquipmentInProjectResponse, error) {
-	_, err := s.db.Exec(`
-		INSERT INTO equipment_in_project (project_id, equipment_id)
-		VALUES ($1, $2)
-		ON CONFLICT DO NOTHING
-	`, payload.ProjectID, payload.EquipmentID)
-	if err != nil {
-		return nil, err
+		return nil, s.missingOrConflict(ctx, "drafts", "draft_id", id)
 	}
-	return s.buildProjectEquipmentResponse(payload.ProjectID)
+	return s.ListDrafts(ctx)
 }
 
-func (s *Store) RemoveEquipmentFromProject(payload types.ProjectEquipmentDeletePayload) (*types.EquipmentInProjectResponse, error) {
-	_, err := s.db.Exec(`DELETE FROM equipment_in_project WHERE project_id = $1 AND equipment_id = $2`, payload.ProjectID, payload.EquipmentID)
-	if err != nil {
-		return nil, err
-	}
-	return s.buildProjectEquipmentResponse(payload.ProjectID)
+func (s *Store) GetEquipmentInProject(ctx context.Context, projectID int) (*types.EquipmentInProjectResponse, error) {
+	return s.buildProjectEquipmentResponse(ctx, projectID)
 }
 
-func (s *Store) AddSetToProject(payload types.ProjectSetPayload) (*types.EquipmentInProjectResponse, error) {
-	_, err := s.db.Exec(`
-		INSERT INTO equipment_in_project (project_id, equipment_id)
-		SELECT $1, e.equipment_id
-		FROM equipment e
-		WHERE e.equipment_set_id = $2
-		ON CONFLICT DO NOTHING
-	`, payload.ProjectID, payload.EquipmentSetID)
-	if err != nil {
-		return nil, err
-	}
-	return s.buildProjectEquipmentResponse(payload.ProjectID)
+func (s *Store) AddEquipmentToProject(ctx context.Context, payload types.EquipmentInProjectPayload) (*types.EquipmentInProjectResponse, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.EquipmentInProjectResponse, error) {
+		if err := s.requireID(ctx, "equipment", "equipment_id", payload.EquipmentID); err != nil {
+			return nil, err
+		}
+		added, err := s.queryIDs(ctx, `
+			INSERT INTO equipment_in_project (project_id, equipment_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+			RETURNING equipment_id
+		`, payload.ProjectID, payload.EquipmentID)
+		if err != nil {
+			return nil, err
+		}
+		s.publishEquipmentAdded(ctx, payload.ProjectID, added)
+		return s.buildProjectEquipmentResponse(ctx, payload.ProjectID)
+	})
+}
+
+func (s *Store) RemoveEquipmentFromProject(ctx context.Context, payload types.ProjectEquipmentDeletePayload) (*types.EquipmentInProjectResponse, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.EquipmentInProjectResponse, error) {
+		removed, err := s.queryIDs(ctx, `
+			DELETE FROM equipment_in_project
+			WHERE project_id = $1 AND equipment_id = $2
+			RETURNING equipment_id
+		`, payload.ProjectID, payload.EquipmentID)
+		if err != nil {
+			return nil, err
+		}
+		s.publishEquipmentRemoved(ctx, payload.ProjectID, removed)
+		return s.buildProjectEquipmentResponse(ctx, payload.ProjectID)
+	})
+}
+
+func (s *Store) AddSetToProject(ctx context.Context, payload types.ProjectSetPayload) (*types.EquipmentInProjectResponse, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.EquipmentInProjectResponse, error) {
+		added, err := s.queryIDs(ctx, `
+			INSERT INTO equipment_in_project (project_id, equipment_id)
+			SELECT $1, e.equipment_id
+			FROM equipment e
+			WHERE e.equipment_set_id = $2 AND e.deleted_at IS NULL
+			ON CONFLICT DO NOTHING
+			RETURNING equipment_id
+		`, payload.ProjectID, payload.EquipmentSetID)
+		if err != nil {
+			return nil, err
+		}
+		s.publishEquipmentAdded(ctx, payload.ProjectID, added)
+		return s.buildProjectEquipmentResponse(ctx, payload.ProjectID)
+	})
 }
 
-func (s *Store) RemoveSetFromProject(payload types.ProjectSetDeletePayload) (*types.EquipmentInProjectResponse, error) {
-	setID, err := s.getEquipmentSetIDByName(payload.EquipmentSetName)
-	if err != nil {
-		return nil, err
-	}
-	_, err = s.db.Exec(`
-		DELETE FROM equipment_in_project eip
-		USING equipment e
-		WHERE eip.project_id = $1
-		  AND eip.equipment_id = e.equipment_id
-		  AND e.equipment_set_id = $2
-	`, payload.ProjectID, setID)
-	if err != nil {
-		return nil, err
-	}
-	return s.buildProjectEquipmentResponse(payload.ProjectID)
+func (s *Store) RemoveSetFromProject(ctx context.Context, payload types.ProjectSetDeletePayload) (*types.EquipmentInProjectResponse, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.EquipmentInProjectResponse, error) {
+		setID, err := s.getEquipmentSetIDByName(ctx, payload.EquipmentSetName)
+		if err != nil {
+			return nil, err
+		}
+		removed, err := s.queryIDs(ctx, `
+			DELETE FROM equipment_in_project eip
+			USING equipment e
+			WHERE eip.project_id = $1
+			  AND eip.equipment_id = e.equipment_id
+			  AND e.equipment_set_id = $2
+			  AND e.deleted_at IS NULL
+			RETURNING eip.equipment_id
+		`, payload.ProjectID, setID)
+		if err != nil {
+			return nil, err
+		}
+		s.publishEquipmentRemoved(ctx, payload.ProjectID, removed)
+		return s.buildProjectEquipmentResponse(ctx, payload.ProjectID)
+	})
 }
 
-func (s *Store) GetAvailableProjectEquipmentInSet(payload types.ProjectSetPayload) ([]*types.Equipment, error) {
-	rows, err := s.listEquipment(`
-		WHERE e.equipment_set_id = $1
+func (s *Store) GetAvailableProjectEquipmentInSet(ctx context.Context, payload types.ProjectSetPayload) ([]*types.Equipment, error) {
+	rows, err := s.listEquipment(ctx, `
+		e.equipment_set_id = $1
 		  AND e.equipment_id NOT IN (
 			SELECT equipment_id FROM equipment_in_project WHERE project_id = $2
 		)
@@ -819,8 +1346,8 @@ func (s *Store) GetAvailableProjectEquipmentInSet(payload types.ProjectSetPayloa
 	return rows, nil
 }
 
-func (s *Store) GetConflictingEquipment(projectID int) ([]*types.EquipmentConflict, error) {
-	rows, err := s.db.Query(`
+func (s *Store) GetConflictingEquipment(ctx context.Context, projectID int) ([]*types.EquipmentConflict, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
 		SELECT DISTINCT
 			e.equipment_id,
 			e.equipment_name,
@@ -836,6 +1363,8 @@ func (s *Store) GetConflictingEquipment(projectID int) ([]*types.EquipmentConfli
 		WHERE p.project_id = $1
 		  AND p2.project_id <> p.project_id
 		  AND p2.archived = FALSE
+		  AND p2.deleted_at IS NULL
+		  AND e.deleted_at IS NULL
 		  AND NOT (p2.shooting_end_date < p.shooting_start_date OR p2.shooting_start_date > p.shooting_end_date)
 		ORDER BY e.equipment_name, p2.project_name
 	`, projectID)
@@ -855,27 +1384,60 @@ func (s *Store) GetConflictingEquipment(projectID int) ([]*types.EquipmentConfli
 	return result, rows.Err()
 }
 
-func (s *Store) AddDraftToProject(payload types.AddDraftToProjectPayload) (*types.EquipmentInProjectResponse, error) {
-	_, err := s.db.Exec(`
-		INSERT INTO equipment_in_project (project_id, equipment_id)
-		SELECT $1, eid.equipment_id
-		FROM equipment_in_draft eid
-		WHERE eid.draft_id = $2
-		ON CONFLICT DO NOTHING
-	`, payload.ProjectID, payload.DraftID)
-	if err != nil {
-		return nil, err
-	}
-	return s.buildProjectEquipmentResponse(payload.ProjectID)
-}
+func (s *Store) AddDraftToProject(ctx context.Context, payload types.AddDraftToProjectPayload) (*types.EquipmentInProjectResponse, error) {
+	return withTx(ctx, s, stockIsolation, func(ctx context.Context) (*types.EquipmentInProjectResponse, error) {
+		if payload.Replace {
+			removed, err := s.queryIDs(ctx, `
+				DELETE FROM equipment_in_project
+				WHERE project_id = $1
+				  AND equipment_id NOT IN (SELECT equipment_id FROM equipment_in_draft WHERE draft_id = $2)
+				  AND equipment_id IN (SELECT equipment_id FROM equipment WHERE deleted_at IS NULL)
+				RETURNING equipment_id
+			`, payload.ProjectID, payload.DraftID)
+			if err != nil {
+				return nil, err
+			}
+			s.publishEquipmentRemoved(ctx, payload.ProjectID, removed)
+		}
 
-func (s *Store) ResetEquipmentInProject(projectID int) error {
-	_, err := s.db.Exec(`DELETE FROM equipment_in_project WHERE project_id = $1`, projectID)
-	return err
+		added, err := s.queryIDs(ctx, `
+			INSERT INTO equipment_in_project (project_id, equipment_id)
+			SELECT $1, eid.equipment_id
+			FROM equipment_in_draft eid
+			JOIN equipment e ON e.equipment_id = eid.equipment_id
+			WHERE eid.draft_id = $2 AND e.deleted_at IS NULL
+			ON CONFLICT DO NOTHING
+			RETURNING equipment_id
+		`, payload.ProjectID, payload.DraftID)
+		if err != nil {
+			return nil, err
+		}
+		s.publishEquipmentAdded(ctx, payload.ProjectID, added)
+		if err := s.addDraftStockToProject(ctx, payload.ProjectID, payload.DraftID, payload.Replace); err != nil {
+			return nil, err
+		}
+		return s.buildProjectEquipmentResponse(ctx, payload.ProjectID)
+	})
+}
+
+func (s *Store) ResetEquipmentInProject(ctx context.Context, projectID int) error {
+	return s.inTx(ctx, writeIsolation, func(ctx context.Context) error {
+		removed, err := s.queryIDs(ctx, `
+			DELETE FROM equipment_in_project
+			WHERE project_id = $1
+			  AND equipment_id IN (SELECT equipment_id FROM equipment WHERE deleted_at IS NULL)
+			RETURNING equipment_id
+		`, projectID)
+		if err != nil {
+			return err
+		}
+		s.publishEquipmentRemoved(ctx, projectID, removed)
+		return nil
+	})
 }
 
-func (s *Store) GetConflictingProjects() ([]*types.ConflictingProject, error) {
-	rows, err := s.db.Query(`
+func (s *Store) GetConflictingProjects(ctx context.Context) ([]*types.ConflictingProject, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
 		SELECT
 			p.project_id,
 			p.project_name,
@@ -886,9 +1448,13 @@ func (s *Store) GetConflictingProjects() ([]*types.ConflictingProject, error) {
 		JOIN equipment_in_project eip1 ON eip1.project_id = p.project_id
 		JOIN equipment_in_project eip2 ON eip2.equipment_id = eip1.equipment_id
 		JOIN projects p2 ON p2.project_id = eip2.project_id
+		JOIN equipment e ON e.equipment_id = eip1.equipment_id
 		WHERE p.archived = FALSE
+		  AND p.deleted_at IS NULL
 		  AND p2.project_id <> p.project_id
 		  AND p2.archived = FALSE
+		  AND p2.deleted_at IS NULL
+		  AND e.deleted_at IS NULL
 		  AND NOT (p2.shooting_end_date < p.shooting_start_date OR p2.shooting_start_date > p.shooting_end_date)
 		GROUP BY p.project_id, p.project_name, p.shooting_start_date, p.shooting_end_date
 		ORDER BY p.shooting_start_date ASC
@@ -909,65 +1475,120 @@ func (s *Store) GetConflictingProjects() ([]*types.ConflictingProject, error) {
 	return result, rows.Err()
 }
 
-func (s *Store) GetEquipmentInDraft(draftID int) (*types.EquipmentInDraftResponse, error) {
-	return s.buildDraftEquipmentResponse(draftID)
-}
-
-func (s *Store) AddEquipmentToDraft(payload types.EquipmentInDraftPayload) (*types.EquipmentInDraftResponse, error) {
-	_, err := s.db.Exec(`
-		INSERT INTO equipment_in_draft (draft_id, equipment_id)
-		VALUES ($1, $2)
-		ON CONFLICT DO NOTHING
-	`, payload.DraftID, payload.EquipmentID)
+// GetDomainStats counts the business gauges exported as metrics. Equipment is
+// checked out while it is booked on a non-archived project that is shooting
+// today.
+func (s *Store) GetDomainStats(ctx context.Context) (*types.DomainStats, error) {
+	stats := new(types.DomainStats)
+	err := s.conn(ctx).QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM projects WHERE archived = FALSE AND deleted_at IS NULL)::INT,
+			(SELECT COUNT(*) FROM equipment WHERE needs_maintenance = TRUE AND deleted_at IS NULL)::INT,
+			(
+				SELECT COUNT(DISTINCT eip.equipment_id)
+				FROM equipment_in_project eip
+				JOIN projects p ON p.project_id = eip.project_id
+				JOIN equipment e ON e.equipment_id = eip.equipment_id
+				WHERE p.archived = FALSE
+				  AND p.deleted_at IS NULL
+				  AND e.deleted_at IS NULL
+				  AND CURRENT_DATE BETWEEN p.shooting_start_date AND p.shooting_end_date
+			)::INT
+	`).Scan(&stats.ActiveProjects, &stats.EquipmentNeedingMaintenance, &stats.EquipmentCheckedOut)
 	if err != nil {
 		return nil, err
 	}
-	return s.buildDraftEquipmentResponse(payload.DraftID)
-}
 
-func (s *Store) RemoveEquipmentFromDraft(payload types.DraftEquipmentDeletePayload) (*types.EquipmentInDraftResponse, error) {
-	_, err := s.db.Exec(`DELETE FROM equipment_in_draft WHERE draft_id = $1 AND equipment_id = $2`, payload.DraftID, payload.EquipmentID)
+	conflicts, err := s.GetConflictingProjects(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return s.buildDraftEquipmentResponse(payload.DraftID)
+	stats.ConflictingProjects = len(conflicts)
+	return stats, nil
 }
 
-func (s *Store) AddSetToDraft(payload types.DraftSetPayload) (*types.EquipmentInDraftResponse, error) {
-	_, err := s.db.Exec(`
-		INSERT INTO equipment_in_draft (draft_id, equipment_id)
-		SELECT $1, e.equipment_id
-		FROM equipment e
-		WHERE e.equipment_set_id = $2
-		ON CONFLICT DO NOTHING
-	`, payload.DraftID, payload.EquipmentSetID)
-	if err != nil {
-		return nil, err
-	}
-	return s.buildDraftEquipmentResponse(payload.DraftID)
+func (s *Store) GetEquipmentInDraft(ctx context.Context, draftID int) (*types.EquipmentInDraftResponse, error) {
+	return s.buildDraftEquipmentResponse(ctx, draftID)
 }
 
-func (s *Store) RemoveSetFromDraft(payload types.DraftSetDeletePayload) (*types.EquipmentInDraftResponse, error) {
-	setID, err := s.getEquipmentSetIDByName(payload.EquipmentSetName)
-	if err != nil {
-		return nil, err
-	}
-	_, err = s.db.Exec(`
-		DELETE FROM equipment_in_draft eid
-		USING equipment e
-		WHERE eid.draft_id = $1
-		  AND eid.equipment_id = e.equipment_id
-		  AND e.equipment_set_id = $2
-	`, payload.DraftID, setID)
-	if err != nil {
-		return nil, err
-	}
-	return s.buildDraftEquipmentResponse(payload.DraftID)
+func (s *Store) AddEquipmentToDraft(ctx context.Context, payload types.EquipmentInDraftPayload) (*types.EquipmentInDraftResponse, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.EquipmentInDraftResponse, error) {
+		if err := s.requireID(ctx, "equipment", "equipment_id", payload.EquipmentID); err != nil {
+			return nil, err
+		}
+		added, err := s.queryIDs(ctx, `
+			INSERT INTO equipment_in_draft (draft_id, equipment_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+			RETURNING equipment_id
+		`, payload.DraftID, payload.EquipmentID)
+		if err != nil {
+			return nil, err
+		}
+		s.publishDraftEquipment(ctx, events.EquipmentAddedToDraft, payload.DraftID, added)
+		return s.buildDraftEquipmentResponse(ctx, payload.DraftID)
+	})
+}
+
+func (s *Store) RemoveEquipmentFromDraft(ctx context.Context, payload types.DraftEquipmentDeletePayload) (*types.EquipmentInDraftResponse, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.EquipmentInDraftResponse, error) {
+		removed, err := s.queryIDs(ctx, `
+			DELETE FROM equipment_in_draft
+			WHERE draft_id = $1 AND equipment_id = $2
+			RETURNING equipment_id
+		`, payload.DraftID, payload.EquipmentID)
+		if err != nil {
+			return nil, err
+		}
+		s.publishDraftEquipment(ctx, events.EquipmentRemovedFromDraft, payload.DraftID, removed)
+		return s.buildDraftEquipmentResponse(ctx, payload.DraftID)
+	})
+}
+
+func (s *Store) AddSetToDraft(ctx context.Context, payload types.DraftSetPayload) (*types.EquipmentInDraftResponse, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.EquipmentInDraftResponse, error) {
+		added, err := s.queryIDs(ctx, `
+			INSERT INTO equipment_in_draft (draft_id, equipment_id)
+			SELECT $1, e.equipment_id
+			FROM equipment e
+			WHERE e.equipment_set_id = $2 AND e.deleted_at IS NULL
+			ON CONFLICT DO NOTHING
+			RETURNING equipment_id
+		`, payload.DraftID, payload.EquipmentSetID)
+		if err != nil {
+			return nil, err
+		}
+		s.publishDraftEquipment(ctx, events.EquipmentAddedToDraft, payload.DraftID, added)
+		return s.buildDraftEquipmentResponse(ctx, payload.DraftID)
+	})
+}
+
+func (s *Store) RemoveSetFromDraft(ctx context.Context, payload types.DraftSetDeletePayload) (*types.EquipmentInDraftResponse, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.EquipmentInDraftResponse, error) {
+		setID, err := s.getEquipmentSetIDByName(ctx, payload.EquipmentSetName)
+		if err != nil {
+			return nil, err
+		}
+		removed, err := s.queryIDs(ctx, `
+			DELETE FROM equipment_in_draft eid
+			USING equipment e
+			WHERE eid.draft_id = $1
+			  AND eid.equipment_id = e.equipment_id
+			  AND e.equipment_set_id = $2
+			  AND e.deleted_at IS NULL
+			RETURNING eid.equipment_id
+		`, payload.DraftID, setID)
+		if err != nil {
+			return nil, err
+		}
+		s.publishDraftEquipment(ctx, events.EquipmentRemovedFromDraft, payload.DraftID, removed)
+		return s.buildDraftEquipmentResponse(ctx, payload.DraftID)
+	})
 }
 
-func (s *Store) GetAvailableDraftEquipmentInSet(payload types.DraftSetPayload) ([]*types.Equipment, error) {
-	rows, err := s.listEquipment(`
-		WHERE e.equipment_set_id = $1
+func (s *Store) GetAvailableDraftEquipmentInSet(ctx context.Context, payload types.DraftSetPayload) ([]*types.Equipment, error) {
+	rows, err := s.listEquipment(ctx, `
+		e.equipment_set_id = $1
 		  AND e.equipment_id NOT IN (
 			SELECT equipment_id FROM equipment_in_draft WHERE draft_id = $2
 		)
@@ -978,14 +1599,14 @@ func (s *Store) GetAvailableDraftEquipmentInSet(payload types.DraftSetPayload) (
 	return rows, nil
 }
 
-func (s *Store) buildProjectEquipmentResponse(projectID int) (*types.EquipmentInProjectResponse, error) {
-	project, err := s.GetProjectByID(projectID)
+func (s *Store) buildProjectEquipmentResponse(ctx context.Context, projectID int) (*types.EquipmentInProjectResponse, error) {
+	project, err := s.GetProjectByID(ctx, projectID)
 	if err != nil {
 		return nil, err
 	}
 
-	equipmentInProject, err := s.listEquipment(`
-		WHERE e.equipment_id IN (
+	equipmentInProject, err := s.listEquipment(ctx, `
+		e.equipment_id IN (
 			SELECT equipment_id FROM equipment_in_project WHERE project_id = $1
 		)
 	`, projectID)
@@ -993,8 +1614,8 @@ func (s *Store) buildProjectEquipmentResponse(projectID int) (*types.EquipmentIn
 		return nil, err
 	}
 
-	availableEquipment, err := s.listEquipment(`
-		WHERE e.equipment_id NOT IN (
+	availableEquipment, err := s.listEquipment(ctx, `
+		e.equipment_id NOT IN (
 			SELECT equipment_id FROM equipment_in_project WHERE project_id = $1
 		)
 	`, projectID)
@@ -1005,7 +1626,7 @@ func (s *Store) buildProjectEquipmentResponse(projectID int) (*types.EquipmentIn
 	setIDs := uniqueEquipmentSetIDs(availableEquipment)
 	setsInProject := make([]*types.EquipmentSet, 0)
 	for _, setID := range setIDs {
-		set, err := s.GetEquipmentSetByID(setID)
+		set, err := s.GetEquipmentSetByID(ctx, setID)
 		if err != nil {
 			return nil, err
 		}
@@ -1020,14 +1641,14 @@ func (s *Store) buildProjectEquipmentResponse(projectID int) (*types.EquipmentIn
 	}, nil
 }
 
-func (s *Store) buildDraftEquipmentResponse(draftID int) (*types.EquipmentInDraftResponse, error) {
-	draft, err := s.GetDraftByID(draftID)
+func (s *Store) buildDraftEquipmentResponse(ctx context.Context, draftID int) (*types.EquipmentInDraftResponse, error) {
+	draft, err := s.GetDraftByID(ctx, draftID)
 	if err != nil {
 		return nil, err
 	}
 
-	equipmentInDraft, err := s.listEquipment(`
-		WHERE e.equipment_id IN (
+	equipmentInDraft, err := s.listEquipment(ctx, `
+		e.equipment_id IN (
 			SELECT equipment_id FROM equipment_in_draft WHERE draft_id = $1
 		)
 	`, draftID)
@@ -1035,8 +1656,8 @@ func (s *Store) buildDraftEquipmentResponse(draftID int) (*types.EquipmentInDraf
 		return nil, err
 	}
 
-	availableEquipment, err := s.listEquipment(`
-		WHERE e.equipment_id NOT IN (
+	availableEquipment, err := s.listEquipment(ctx, `
+		e.equipment_id NOT IN (
 			SELECT equipment_id FROM equipment_in_draft WHERE draft_id = $1
 		)
 	`, draftID)
@@ -1047,7 +1668,7 @@ func (s *Store) buildDraftEquipmentResponse(draftID int) (*types.EquipmentInDraf
 	setIDs := uniqueEquipmentSetIDs(availableEquipment)
 	setsInDraft := make([]*types.EquipmentSet, 0)
 	for _, setID := range setIDs {
-		set, err := s.GetEquipmentSetByID(setID)
+		set, err := s.GetEquipmentSetByID(ctx, setID)
 		if err != nil {
 			return nil, err
 		}
@@ -1062,6 +1683,150 @@ func (s *Store) buildDraftEquipmentResponse(draftID int) (*types.EquipmentInDraf
 	}, nil
 }
 
+func (s *Store) queryIDs(ctx context.Context, query string, args ...any) ([]int, error) {
+	tracing.Helper()
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// eventContext detaches event lookups from request cancellation: the change
+// is already committed, so a client hanging up must not drop its event.
+func eventContext(ctx context.Context) context.Context {
+	return context.WithoutCancel(ctx)
+}
+
+// publish sends event to subscribers, or holds it until commit when ctx
+// carries a transaction.
+func (s *Store) publish(ctx context.Context, event events.Event) {
+	if s.events == nil {
+		return
+	}
+	if state := txFromContext(ctx); state != nil {
+		state.pending = append(state.pending, event)
+		return
+	}
+	s.events.Publish(event)
+}
+
+func (s *Store) publishProject(ctx context.Context, eventType events.Type, projectID int) {
+	if s.events == nil {
+		return
+	}
+	ctx = eventContext(ctx)
+	projects, err := s.listProjects(ctx, "p.project_id = $1", projectID)
+	if err != nil || len(projects) == 0 {
+		slog.ErrorContext(ctx, "failed to load project for event", "project_id", projectID, "event_type", eventType, "error", err)
+		return
+	}
+
+	event := events.New(eventType)
+	event.ProjectID = projectID
+	event.Data = projects[0]
+	s.publish(ctx, event)
+}
+
+func (s *Store) publishEquipmentAdded(ctx context.Context, projectID int, equipmentIDs []int) {
+	if s.events == nil || len(equipmentIDs) == 0 {
+		return
+	}
+	ctx = eventContext(ctx)
+
+	event := events.New(events.EquipmentAddedToProject)
+	event.ProjectID = projectID
+	event.EquipmentIDs = equipmentIDs
+	s.publish(ctx, event)
+
+	// Only conflicts caused by the equipment that was just added are new;
+	// pre-existing overlaps have already been reported.
+	conflicts, err := s.GetConflictingEquipment(ctx, projectID)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to check conflicts", "project_id", projectID, "error", err)
+		return
+	}
+	added := make(map[int]struct{}, len(equipmentIDs))
+	for _, id := range equipmentIDs {
+		added[id] = struct{}{}
+	}
+	newConflicts := make([]*types.EquipmentConflict, 0)
+	for _, conflict := range conflicts {
+		if _, ok := added[conflict.EquipmentID]; ok {
+			newConflicts = append(newConflicts, conflict)
+		}
+	}
+	if len(newConflicts) == 0 {
+		return
+	}
+
+	conflictEvent := events.New(events.ConflictDetected)
+	conflictEvent.ProjectID = projectID
+	conflictEvent.EquipmentIDs = uniqueConflictEquipmentIDs(newConflicts)
+	conflictEvent.Data = newConflicts
+	s.publish(ctx, conflictEvent)
+}
+
+func (s *Store) publishEquipmentRemoved(ctx context.Context, projectID int, equipmentIDs []int) {
+	if len(equipmentIDs) == 0 {
+		return
+	}
+	event := events.New(events.EquipmentRemovedFromProject)
+	event.ProjectID = projectID
+	event.EquipmentIDs = equipmentIDs
+	s.publish(ctx, event)
+}
+
+func (s *Store) publishDraftEquipment(ctx context.Context, eventType events.Type, draftID int, equipmentIDs []int) {
+	if len(equipmentIDs) == 0 {
+		return
+	}
+	event := events.New(eventType)
+	event.DraftID = draftID
+	event.EquipmentIDs = equipmentIDs
+	s.publish(ctx, event)
+}
+
+func (s *Store) publishEquipment(ctx context.Context, eventType events.Type, equipmentID int) {
+	if s.events == nil {
+		return
+	}
+	ctx = eventContext(ctx)
+	equipment, err := s.listEquipment(ctx, "e.equipment_id = $1", equipmentID)
+	if err != nil || len(equipment) == 0 {
+		slog.ErrorContext(ctx, "failed to load equipment for event", "equipment_id", equipmentID, "event_type", eventType, "error", err)
+		return
+	}
+
+	event := events.New(eventType)
+	event.EquipmentIDs = []int{equipmentID}
+	event.Data = equipment[0]
+	s.publish(ctx, event)
+}
+
+func uniqueConflictEquipmentIDs(conflicts []*types.EquipmentConflict) []int {
+	seen := map[int]struct{}{}
+	ids := make([]int, 0)
+	for _, conflict := range conflicts {
+		if _, ok := seen[conflict.EquipmentID]; ok {
+			continue
+		}
+		seen[conflict.EquipmentID] = struct{}{}
+		ids = append(ids, conflict.EquipmentID)
+	}
+	return ids
+}
+
 func uniqueEquipmentSetIDs(items []*types.Equipment) []int {
 	seen := map[int]struct{}{}
 	ids := make([]int, 0)
@@ -1075,14 +1840,15 @@ func uniqueEquipmentSetIDs(items []*types.Equipment) []int {
 	return ids
 }
 
-func (s *Store) listEquipmentSets(extraWhere string, args ...any) ([]*types.EquipmentSet, error) {
+func (s *Store) listEquipmentSets(ctx context.Context, extraWhere string, args ...any) ([]*types.EquipmentSet, error) {
 	query := `
 		SELECT
 			es.equipment_set_id,
 			es.equipment_set_name,
 			COALESCE(es.description, ''),
 			es.set_type_id,
-			st.set_type_name
+			st.set_type_name,
+			es.version
 		FROM equipment_sets es
 		JOIN set_types st ON st.set_type_id = es.set_type_id
 	`
@@ -1091,7 +1857,7 @@ func (s *Store) listEquipmentSets(extraWhere string, args ...any) ([]*types.Equi
 	}
 	query += " ORDER BY es.equipment_set_name ASC"
 
-	rows, err := s.db.Query(query, args...)
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1101,7 +1867,7 @@ func (s *Store) listEquipmentSets(extraWhere string, args ...any) ([]*types.Equi
 	for rows.Next() {
 		item := new(types.EquipmentSet)
 		setTypeName := ""
-		if err := rows.Scan(&item.EquipmentSetID, &item.EquipmentSetName, &item.Description, &item.SetTypeID, &setTypeName); err != nil {
+		if err := rows.Scan(&item.EquipmentSetID, &item.EquipmentSetName, &item.Description, &item.SetTypeID, &setTypeName, &item.Version); err != nil {
 			return nil, err
 		}
 		item.Type = &types.SetType{SetTypeID: item.SetTypeID, SetTypeName: setTypeName}
@@ -1110,7 +1876,9 @@ func (s *Store) listEquipmentSets(extraWhere string, args ...any) ([]*types.Equi
 	return result, rows.Err()
 }
 
-func (s *Store) listEquipment(extraWhere string, args ...any) ([]*types.Equipment, error) {
+// listEquipment returns equipment that is not in the trash, narrowed by the
+// SQL condition filter when it is not empty.
+func (s *Store) listEquipment(ctx context.Context, filter string, args ...any) ([]*types.Equipment, error) {
 	query := `
 		SELECT
 			e.equipment_id,
@@ -1119,27 +1887,38 @@ func (s *Store) listEquipment(extraWhere string, args ...any) ([]*types.Equipmen
 			COALESCE(e.description, ''),
 			e.serial_number,
 			e.storage_id,
-			COALESCE(e.current_storage, ''),
+			COALESCE(e.location_id, 0),
+			COALESCE(l.warehouse_id, 0),
+			COALESCE(l.parent_id, 0),
+			COALESCE(l.kind, ''),
+			COALESCE(l.location_name, ''),
+			COALESCE(lp.path, ''),
+			COALESCE(l.version, 0),
 			e.needs_maintenance,
 			COALESCE(TO_CHAR(e.date_of_purchase, 'YYYY-MM-DD'), ''),
 			e.cost_of_purchase,
+			e.attributes::TEXT,
 			es.equipment_set_name,
 			COALESCE(es.description, ''),
 			es.set_type_id,
 			st.set_type_name,
 			w.warehouse_name,
-			COALESCE(w.warehouse_adress, '')
+			COALESCE(w.warehouse_adress, ''),
+			e.version
 		FROM equipment e
 		JOIN equipment_sets es ON es.equipment_set_id = e.equipment_set_id
 		JOIN set_types st ON st.set_type_id = es.set_type_id
 		JOIN warehouses w ON w.warehouse_id = e.storage_id
+		LEFT JOIN warehouse_locations l ON l.location_id = e.location_id
+		LEFT JOIN warehouse_location_paths lp ON lp.location_id = e.location_id
+		WHERE e.deleted_at IS NULL
 	`
-	if strings.TrimSpace(extraWhere) != "" {
-		query += " " + extraWhere
+	if strings.TrimSpace(filter) != "" {
+		query += " AND (" + filter + ")"
 	}
 	query += " ORDER BY e.equipment_name ASC, e.equipment_id ASC"
 
-	rows, err := s.db.Query(query, args...)
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1157,6 +1936,8 @@ func (s *Store) listEquipment(extraWhere string, args ...any) ([]*types.Equipmen
 		warehouseName := ""
 		warehouseAdress := ""
 		dateOfPurchase := ""
+		attributes := ""
+		location := new(types.Location)
 
 		if err := rows.Scan(
 			&item.EquipmentID,
@@ -1165,16 +1946,24 @@ func (s *Store) listEquipment(extraWhere string, args ...any) ([]*types.Equipmen
 			&item.Description,
 			&item.SerialNumber,
 			&item.StorageID,
-			&item.CurrentStorage,
+			&item.LocationID,
+			&location.WarehouseID,
+			&location.ParentID,
+			&location.Kind,
+			&location.LocationName,
+			&location.Path,
+			&location.Version,
 			&item.NeedsMaintenance,
 			&dateOfPurchase,
 			&cost,
+			&attributes,
 			&equipmentSetName,
 			&setDescription,
 			&setTypeID,
 			&setTypeName,
 			&warehouseName,
 			&warehouseAdress,
+			&item.Version,
 		); err != nil {
 			return nil, err
 		}
@@ -1183,6 +1972,9 @@ func (s *Store) listEquipment(extraWhere string, args ...any) ([]*types.Equipmen
 		if cost.Valid {
 			item.CostOfPurchase = &cost.Float64
 		}
+		if err := json.Unmarshal([]byte(attributes), &item.Attributes); err != nil {
+			return nil, err
+		}
 		item.EquipmentSet = &types.EquipmentSet{
 			EquipmentSetID:   item.EquipmentSetID,
 			EquipmentSetName: equipmentSetName,
@@ -1198,6 +1990,10 @@ func (s *Store) listEquipment(extraWhere string, args ...any) ([]*types.Equipmen
 			WarehouseName:   warehouseName,
 			WarehouseAdress: warehouseAdress,
 		}
+		if item.LocationID > 0 {
+			location.LocationID = item.LocationID
+			item.Location = location
+		}
 		result = append(result, item)
 		ids = append(ids, item.EquipmentID)
 	}
@@ -1209,10 +2005,11 @@ func (s *Store) listEquipment(extraWhere string, args ...any) ([]*types.Equipmen
 		return result, nil
 	}
 
-	projRows, err := s.db.Query(`
+	projRows, err := s.conn(ctx).QueryContext(ctx, `
 		SELECT p.project_id, p.project_name, eip.equipment_id
 		FROM equipment_in_project eip
 		JOIN projects p ON p.project_id = eip.project_id
+		WHERE p.deleted_at IS NULL
 		ORDER BY p.project_id ASC
 	`)
 	if err != nil {
@@ -1241,7 +2038,9 @@ func (s *Store) listEquipment(extraWhere string, args ...any) ([]*types.Equipmen
 	return result, nil
 }
 
-func (s *Store) listProjects(extraWhere string, args ...any) ([]*types.Project, error) {
+// listProjects returns projects that are not in the trash, narrowed by the
+// SQL condition filter when it is not empty.
+func (s *Store) listProjects(ctx context.Context, filter string, args ...any) ([]*types.Project, error) {
 	query := `
 		SELECT
 			p.project_id,
@@ -1253,17 +2052,19 @@ func (s *Store) listProjects(extraWhere string, args ...any) ([]*types.Project,
 			TO_CHAR(p.shooting_end_date, 'YYYY-MM-DD'),
 			COALESCE(p.chief_engineer_id, 0),
 			COALESCE(pt.project_type_name, ''),
-			COALESCE(u.name, '')
+			COALESCE(u.name, ''),
+			p.version
 		FROM projects p
 		LEFT JOIN project_types pt ON pt.project_type_id = p.project_type_id
 		LEFT JOIN users u ON u.id = p.chief_engineer_id
+		WHERE p.deleted_at IS NULL
 	`
-	if strings.TrimSpace(extraWhere) != "" {
-		query += " " + extraWhere
+	if strings.TrimSpace(filter) != "" {
+		query += " AND (" + filter + ")"
 	}
 	query += " ORDER BY p.shooting_start_date ASC, p.project_id ASC"
 
-	rows, err := s.db.Query(query, args...)
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -1285,6 +2086,7 @@ func (s *Store) listProjects(extraWhere string, args ...any) ([]*types.Project,
 			&item.ChiefEngineerID,
 			&projectTypeName,
 			&chiefEngineerName,
+			&item.Version,
 		); err != nil {
 			return nil, err
 		}
@@ -1297,10 +2099,12 @@ func (s *Store) listProjects(extraWhere string, args ...any) ([]*types.Project,
 		return nil, err
 	}
 
-	equipmentRows, err := s.db.Query(`
-		SELECT project_id, equipment_id
-		FROM equipment_in_project
-		ORDER BY project_id ASC, equipment_id ASC
+	equipmentRows, err := s.conn(ctx).QueryContext(ctx, `
+		SELECT eip.project_id, eip.equipment_id
+		FROM equipment_in_project eip
+		JOIN equipment e ON e.equipment_id = eip.equipment_id
+		WHERE e.deleted_at IS NULL
+		ORDER BY eip.project_id ASC, eip.equipment_id ASC
 	`)
 	if err != nil {
 		return nil, err
@@ -1327,60 +2131,211 @@ func (s *Store) listProjects(extraWhere string, args ...any) ([]*types.Project,
 	return result, nil
 }
 
-func (s *Store) getSetTypeIDByName(name string) (int, error) {
-	row := s.db.QueryRow(`SELECT set_type_id FROM set_types WHERE set_type_name = $1`, name)
+// trashTables are soft deleted: rows with deleted_at set are in the trash and
+// count as missing everywhere but the trash listing.
+var trashTables = map[string]bool{"equipment": true, "projects": true, "drafts": true}
+
+// notTrashed is the condition that hides trashed rows of table, if it has any.
+func notTrashed(table string) string {
+	if trashTables[table] {
+		return " AND deleted_at IS NULL"
+	}
+	return ""
+}
+
+// missingOrConflict explains a versioned update or delete that matched no
+// row: ErrVersionConflict when the row exists, ErrNotFound otherwise. Table
+// and column names come from the callers, never from input.
+func (s *Store) missingOrConflict(ctx context.Context, table, idColumn string, id int) error {
+	tracing.Helper()
+	var exists bool
+	query := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE %s = $1%s)`, table, idColumn, notTrashed(table))
+	if err := s.conn(ctx).QueryRowContext(ctx, query, id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return ErrNotFound
+}
+
+// deleteRow deletes the row id of table when it still has version (any
+// version when 0). A foreign key violation means other rows still reference
+// it and is wrapped with ErrInUse. Table and column names come from the
+// callers, never from input.
+func (s *Store) deleteRow(ctx context.Context, table, idColumn string, id, version int) error {
+	tracing.Helper()
+	query := fmt.Sprintf(`DELETE FROM %s WHERE %s = $1 AND ($2 = 0 OR version = $2)`, table, idColumn)
+	result, err := s.conn(ctx).ExecContext(ctx, query, id, version)
+	if isForeignKeyViolation(err) {
+		return fmt.Errorf("%w: %w", ErrInUse, err)
+	}
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return s.missingOrConflict(ctx, table, idColumn, id)
+	}
+	return nil
+}
+
+// requireMergeTarget checks that targetID is an existing row other than id.
+// The source itself is checked by the delete that ends the merge.
+func (s *Store) requireMergeTarget(ctx context.Context, table, idColumn string, id, targetID int) error {
+	tracing.Helper()
+	if id == targetID {
+		return utils.Errorf("%w: cannot merge a record into itself", ErrInvalidReference)
+	}
+	return s.requireID(ctx, table, idColumn, targetID)
+}
+
+func (s *Store) countRows(ctx context.Context, query string, args ...any) (int, error) {
+	tracing.Helper()
+	var count int
+	err := s.conn(ctx).QueryRowContext(ctx, query, args...).Scan(&count)
+	return count, err
+}
+
+// requireID checks that a referenced row exists. Table and column names come
+// from the callers, never from input.
+func (s *Store) requireID(ctx context.Context, table, idColumn string, id int) error {
+	tracing.Helper()
+	var exists bool
+	query := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE %s = $1%s)`, table, idColumn, notTrashed(table))
+	if err := s.conn(ctx).QueryRowContext(ctx, query, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return utils.Errorf("%w: no %s row with id %d", ErrInvalidReference, table, id)
+	}
+	return nil
+}
+
+// The get*ID helpers resolve a payload reference: the ID when the client sent
+// one, the name otherwise.
+
+func (s *Store) getSetTypeID(ctx context.Context, id int, name string) (int, error) {
+	if id > 0 {
+		return id, s.requireID(ctx, "set_types", "set_type_id", id)
+	}
+	return s.getSetTypeIDByName(ctx, name)
+}
+
+func (s *Store) getProjectTypeID(ctx context.Context, id int, name string) (int, error) {
+	if id > 0 {
+		return id, s.requireID(ctx, "project_types", "project_type_id", id)
+	}
+	return s.getProjectTypeIDByName(ctx, name)
+}
+
+func (s *Store) getWarehouseID(ctx context.Context, id int, name string) (int, error) {
+	if id > 0 {
+		return id, s.requireID(ctx, "warehouses", "warehouse_id", id)
+	}
+	return s.getWarehouseIDByName(ctx, name)
+}
+
+func (s *Store) getEquipmentSetID(ctx context.Context, id int, name string) (int, error) {
+	if id > 0 {
+		return id, s.requireID(ctx, "equipment_sets", "equipment_set_id", id)
+	}
+	return s.getEquipmentSetIDByName(ctx, name)
+}
+
+func (s *Store) getUserID(ctx context.Context, id int, name string) (int, error) {
+	if id > 0 {
+		return id, s.requireID(ctx, "users", "id", id)
+	}
+	return s.getUserIDByName(ctx, name)
+}
+
+func (s *Store) getSetTypeIDByName(ctx context.Context, name string) (int, error) {
+	row := s.conn(ctx).QueryRowContext(ctx, `SELECT set_type_id FROM set_types WHERE set_type_name = $1`, name)
+	var id int
+	if err := row.Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, utils.Errorf("%w: no set type named %q", ErrInvalidReference, name)
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Store) getProjectTypeIDByName(ctx context.Context, name string) (int, error) {
+	row := s.conn(ctx).QueryRowContext(ctx, `SELECT project_type_id FROM project_types WHERE project_type_name = $1`, name)
 	var id int
 	if err := row.Scan(&id); err != nil {
 		if err == sql.ErrNoRows {
-			return 0, ErrInvalidReference
+			return 0, utils.Errorf("%w: no project type named %q", ErrInvalidReference, name)
 		}
 		return 0, err
 	}
 	return id, nil
 }
 
-func (s *Store) getProjectTypeIDByName(name string) (int, error) {
-	row := s.db.QueryRow(`SELECT project_type_id FROM project_types WHERE project_type_name = $1`, name)
+func (s *Store) getProjectTypeIDByNeaktorID(ctx context.Context, neaktorID string) (int, error) {
+	row := s.conn(ctx).QueryRowContext(ctx, `SELECT project_type_id FROM project_types WHERE neaktor_id = $1`, neaktorID)
 	var id int
 	if err := row.Scan(&id); err != nil {
 		if err == sql.ErrNoRows {
-			return 0, ErrInvalidReference
+			return 0, utils.Errorf("%w: no project type with neaktor_id %q", ErrInvalidReference, neaktorID)
 		}
 		return 0, err
 	}
 	return id, nil
 }
 
-func (s *Store) getWarehouseIDByName(name string) (int, error) {
-	row := s.db.QueryRow(`SELECT warehouse_id FROM warehouses WHERE warehouse_name = $1`, name)
+func (s *Store) getWarehouseIDByName(ctx context.Context, name string) (int, error) {
+	row := s.conn(ctx).QueryRowContext(ctx, `SELECT warehouse_id FROM warehouses WHERE warehouse_name = $1`, name)
 	var id int
 	if err := row.Scan(&id); err != nil {
 		if err == sql.ErrNoRows {
-			return 0, ErrInvalidReference
+			return 0, utils.Errorf("%w: no warehouse named %q", ErrInvalidReference, name)
 		}
 		return 0, err
 	}
 	return id, nil
 }
 
-func (s *Store) getEquipmentSetIDByName(name string) (int, error) {
-	row := s.db.QueryRow(`SELECT equipment_set_id FROM equipment_sets WHERE equipment_set_name = $1`, name)
+func (s *Store) getEquipmentSetIDByName(ctx context.Context, name string) (int, error) {
+	row := s.conn(ctx).QueryRowContext(ctx, `SELECT equipment_set_id FROM equipment_sets WHERE equipment_set_name = $1`, name)
 	var id int
 	if err := row.Scan(&id); err != nil {
 		if err == sql.ErrNoRows {
-			return 0, ErrInvalidReference
+			return 0, utils.Errorf("%w: no equipment set named %q", ErrInvalidReference, name)
 		}
 		return 0, err
 	}
 	return id, nil
 }
 
-func (s *Store) getUserIDByName(name string) (int, error) {
-	row := s.db.QueryRow(`SELECT id FROM users WHERE name = $1`, name)
+// getUserIDByName is the one name lookup that can be ambiguous: user names
+// are not unique, so a name shared by several users is rejected rather than
+// resolved to whichever row comes first.
+func (s *Store) getUserIDByName(ctx context.Context, name string) (int, error) {
+	ids, err := s.queryIDs(ctx, `SELECT id FROM users WHERE name = $1 ORDER BY id LIMIT 2`, name)
+	if err != nil {
+		return 0, err
+	}
+	switch len(ids) {
+	case 0:
+		return 0, utils.Errorf("%w: no user named %q", ErrInvalidReference, name)
+	case 1:
+		return ids[0], nil
+	}
+	return 0, utils.Errorf("%w: several users are named %q, pass the user id instead", ErrAmbiguousReference, name)
+}
+
+func (s *Store) getUserIDByNameOrEmail(ctx context.Context, value string) (int, error) {
+	if !strings.Contains(value, "@") {
+		return s.getUserIDByName(ctx, value)
+	}
+
+	row := s.conn(ctx).QueryRowContext(ctx, `SELECT id FROM users WHERE LOWER(email) = LOWER($1)`, value)
 	var id int
 	if err := row.Scan(&id); err != nil {
 		if err == sql.ErrNoRows {
-			return 0, ErrInvalidReference
+			return 0, utils.Errorf("%w: no user with email %q", ErrInvalidReference, value)
 		}
 		return 0, err
 	}
@@ -1391,7 +2346,7 @@ func mapStoreError(err error) error {
 	if err == nil {
 		return nil
 	}
-	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalidReference) {
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalidReference) || errors.Is(err, ErrAmbiguousReference) || errors.Is(err, ErrTrashed) {
 		return err
 	}
 	return fmt.Errorf("store error: %w", err)
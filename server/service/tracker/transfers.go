@@ -0,0 +1,289 @@
+package tracker
+
+import (
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// transferTransitions lists, per target status, the statuses a transfer may
+// leave for it and the timestamp column that records the change.
+var transferTransitions = map[string]struct {
+	from  string
+	stamp string
+}{
+	types.TransferStatusInTransit: {from: `'pending'`, stamp: "shipped_at"},
+	types.TransferStatusReceived:  {from: `'in_transit'`, stamp: "received_at"},
+	types.TransferStatusCancelled: {from: `'pending', 'in_transit'`, stamp: "cancelled_at"},
+}
+
+func (s *Store) ListTransfers(ctx context.Context, status string) ([]*types.WarehouseTransfer, error) {
+	if status == "" {
+		return s.listTransfers(ctx, "")
+	}
+	return s.listTransfers(ctx, "t.status = $1", status)
+}
+
+func (s *Store) SearchTransfers(ctx context.Context, status string, query types.ListQuery) ([]*types.WarehouseTransfer, int, error) {
+	items, err := s.ListTransfers(ctx, status)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	search := normalizeSearchQuery(query.Search)
+	filtered := make([]*types.WarehouseTransfer, 0, len(items))
+	for _, item := range items {
+		values := []string{strconv.Itoa(item.TransferID), item.Status, item.Reason}
+		if item.FromWarehouse != nil {
+			values = append(values, item.FromWarehouse.WarehouseName)
+		}
+		if item.ToWarehouse != nil {
+			values = append(values, item.ToWarehouse.WarehouseName)
+		}
+		if matchesSearch(search, values...) {
+			filtered = append(filtered, item)
+		}
+	}
+
+	return paginateSlice(filtered, query), len(filtered), nil
+}
+
+func (s *Store) GetTransferByID(ctx context.Context, id int) (*types.WarehouseTransfer, error) {
+	items, err := s.listTransfers(ctx, "t.transfer_id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+	return items[0], nil
+}
+
+// CreateTransfer opens a pending transfer of equipment stored in the source
+// warehouse. The items stay where they are until the transfer is received.
+func (s *Store) CreateTransfer(ctx context.Context, payload types.WarehouseTransferPayload) (*types.WarehouseTransfer, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.WarehouseTransfer, error) {
+		if err := s.requireID(ctx, "warehouses", "warehouse_id", payload.FromWarehouseID); err != nil {
+			return nil, err
+		}
+		if err := s.requireID(ctx, "warehouses", "warehouse_id", payload.ToWarehouseID); err != nil {
+			return nil, err
+		}
+		if err := s.requireEquipment(ctx, payload.EquipmentIDs, payload.FromWarehouseID); err != nil {
+			return nil, err
+		}
+		if err := s.requireNoOpenTransfer(ctx, payload.EquipmentIDs); err != nil {
+			return nil, err
+		}
+
+		var transferID int
+		err := s.conn(ctx).QueryRowContext(ctx, `
+			INSERT INTO warehouse_transfers (from_warehouse_id, to_warehouse_id, reason, requested_by)
+			VALUES ($1, $2, NULLIF($3, ''), $4)
+			RETURNING transfer_id
+		`, payload.FromWarehouseID, payload.ToWarehouseID, payload.Reason, actorID(ctx)).Scan(&transferID)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.conn(ctx).ExecContext(ctx, `
+			INSERT INTO warehouse_transfer_items (transfer_id, equipment_id)
+			SELECT $1, jsonb_array_elements_text($2::JSONB)::BIGINT
+			ON CONFLICT DO NOTHING
+		`, transferID, idsJSON(payload.EquipmentIDs)); err != nil {
+			return nil, err
+		}
+		return s.GetTransferByID(ctx, transferID)
+	})
+}
+
+// ShipTransfer marks a pending transfer as in transit.
+func (s *Store) ShipTransfer(ctx context.Context, id, version int) (*types.WarehouseTransfer, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.WarehouseTransfer, error) {
+		if err := s.setTransferStatus(ctx, id, version, types.TransferStatusInTransit); err != nil {
+			return nil, err
+		}
+		return s.GetTransferByID(ctx, id)
+	})
+}
+
+// ReceiveTransfer completes a transfer in transit: its equipment is stored in
+// the destination warehouse and each move is logged against the transfer.
+func (s *Store) ReceiveTransfer(ctx context.Context, id, version int) (*types.WarehouseTransfer, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.WarehouseTransfer, error) {
+		if err := s.setTransferStatus(ctx, id, version, types.TransferStatusReceived); err != nil {
+			return nil, err
+		}
+		transfer, err := s.GetTransferByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		equipmentIDs := make([]int, 0, len(transfer.Equipment))
+		for _, item := range transfer.Equipment {
+			equipmentIDs = append(equipmentIDs, item.EquipmentID)
+		}
+		if _, err := s.moveEquipment(ctx, equipmentIDs, transfer.ToWarehouse.WarehouseID, transfer.Reason, id, 0); err != nil {
+			return nil, err
+		}
+		return s.GetTransferByID(ctx, id)
+	})
+}
+
+// CancelTransfer closes an open transfer without moving anything.
+func (s *Store) CancelTransfer(ctx context.Context, id, version int) (*types.WarehouseTransfer, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.WarehouseTransfer, error) {
+		if err := s.setTransferStatus(ctx, id, version, types.TransferStatusCancelled); err != nil {
+			return nil, err
+		}
+		return s.GetTransferByID(ctx, id)
+	})
+}
+
+// setTransferStatus moves transfer id to status when its current status
+// allows it and it still has version (any version when 0).
+func (s *Store) setTransferStatus(ctx context.Context, id, version int, status string) error {
+	transition := transferTransitions[status]
+	query := fmt.Sprintf(`
+		UPDATE warehouse_transfers
+		SET status = $1, %s = NOW(), version = version + 1
+		WHERE transfer_id = $2 AND ($3 = 0 OR version = $3) AND status IN (%s)
+	`, transition.stamp, transition.from)
+	result, err := s.conn(ctx).ExecContext(ctx, query, status, id, version)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		return nil
+	}
+
+	var current string
+	var currentVersion int
+	err = s.conn(ctx).QueryRowContext(ctx, `
+		SELECT status, version FROM warehouse_transfers WHERE transfer_id = $1
+	`, id).Scan(&current, &currentVersion)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if version != 0 && version != currentVersion {
+		return ErrVersionConflict
+	}
+	return utils.Errorf("%w: transfer %d is %s and cannot become %s", ErrInvalidTransition, id, current, status)
+}
+
+// requireNoOpenTransfers refuses to remove a warehouse that a pending or in
+// transit transfer starts or ends at.
+func (s *Store) requireNoOpenTransfers(ctx context.Context, warehouseID int) error {
+	count, err := s.countRows(ctx, `
+		SELECT COUNT(*) FROM warehouse_transfers
+		WHERE (from_warehouse_id = $1 OR to_warehouse_id = $1) AND status IN ('pending', 'in_transit')
+	`, warehouseID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return dependentsError("transfers", count, utils.Errorf("%w: %d open transfers to or from this warehouse", ErrInUse, count))
+	}
+	return nil
+}
+
+func (s *Store) listTransfers(ctx context.Context, filter string, args ...any) ([]*types.WarehouseTransfer, error) {
+	query := `
+		SELECT
+			t.transfer_id,
+			COALESCE(fw.warehouse_id, 0),
+			COALESCE(fw.warehouse_name, ''),
+			COALESCE(tw.warehouse_id, 0),
+			COALESCE(tw.warehouse_name, ''),
+			t.status,
+			COALESCE(t.reason, ''),
+			COALESCE(u.id, 0),
+			COALESCE(u.name, ''),
+			t.created_at,
+			t.shipped_at,
+			t.received_at,
+			t.cancelled_at,
+			t.version
+		FROM warehouse_transfers t
+		LEFT JOIN warehouses fw ON fw.warehouse_id = t.from_warehouse_id
+		LEFT JOIN warehouses tw ON tw.warehouse_id = t.to_warehouse_id
+		LEFT JOIN users u ON u.id = t.requested_by
+	`
+	if strings.TrimSpace(filter) != "" {
+		query += " WHERE " + filter
+	}
+	query += " ORDER BY t.created_at DESC, t.transfer_id DESC"
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*types.WarehouseTransfer, 0)
+	byTransferID := map[int]*types.WarehouseTransfer{}
+	for rows.Next() {
+		item := new(types.WarehouseTransfer)
+		var from, to types.Warehouse
+		var requestedBy types.UserShort
+		if err := rows.Scan(
+			&item.TransferID,
+			&from.WarehouseID,
+			&from.WarehouseName,
+			&to.WarehouseID,
+			&to.WarehouseName,
+			&item.Status,
+			&item.Reason,
+			&requestedBy.ID,
+			&requestedBy.Name,
+			&item.CreatedAt,
+			&item.ShippedAt,
+			&item.ReceivedAt,
+			&item.CancelledAt,
+			&item.Version,
+		); err != nil {
+			return nil, err
+		}
+		item.FromWarehouse = optionalWarehouse(from)
+		item.ToWarehouse = optionalWarehouse(to)
+		item.RequestedBy = optionalUser(requestedBy)
+		item.Equipment = []*types.Equipment{}
+		result = append(result, item)
+		byTransferID[item.TransferID] = item
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return result, nil
+	}
+
+	// Trashed items are listed too: the transfer still carried them.
+	itemRows, err := s.conn(ctx).QueryContext(ctx, `
+		SELECT ti.transfer_id, e.equipment_id, e.equipment_name, e.serial_number
+		FROM warehouse_transfer_items ti
+		JOIN equipment e ON e.equipment_id = ti.equipment_id
+		ORDER BY ti.transfer_id ASC, e.equipment_id ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var transferID int
+		equipment := new(types.Equipment)
+		if err := itemRows.Scan(&transferID, &equipment.EquipmentID, &equipment.EquipmentName, &equipment.SerialNumber); err != nil {
+			return nil, err
+		}
+		if transfer, ok := byTransferID[transferID]; ok {
+			transfer.Equipment = append(transfer.Equipment, equipment)
+		}
+	}
+	return result, itemRows.Err()
+}
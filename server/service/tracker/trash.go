@@ -0,0 +1,146 @@
+package tracker
+
+import (
+	"VyacheslavKuchumov/test-backend/service/events"
+	"VyacheslavKuchumov/test-backend/service/tracing"
+	"VyacheslavKuchumov/test-backend/types"
+	"context"
+	"strconv"
+	"time"
+)
+
+// ListTrash returns trashed equipment, projects and drafts, most recently
+// deleted first. An empty kind lists all of them.
+func (s *Store) ListTrash(ctx context.Context, kind string) ([]*types.TrashItem, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+		SELECT kind, id, name, deleted_at FROM (
+			SELECT 'equipment' AS kind, equipment_id AS id, equipment_name AS name, deleted_at
+			FROM equipment WHERE deleted_at IS NOT NULL
+			UNION ALL
+			SELECT 'project', project_id, project_name, deleted_at
+			FROM projects WHERE deleted_at IS NOT NULL
+			UNION ALL
+			SELECT 'draft', draft_id, draft_name, deleted_at
+			FROM drafts WHERE deleted_at IS NOT NULL
+		) trash
+		WHERE $1 = '' OR kind = $1
+		ORDER BY deleted_at DESC, kind, id
+	`, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*types.TrashItem, 0)
+	for rows.Next() {
+		item := new(types.TrashItem)
+		if err := rows.Scan(&item.Kind, &item.ID, &item.Name, &item.DeletedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, rows.Err()
+}
+
+func (s *Store) SearchTrash(ctx context.Context, kind string, query types.ListQuery) ([]*types.TrashItem, int, error) {
+	items, err := s.ListTrash(ctx, kind)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	search := normalizeSearchQuery(query.Search)
+	filtered := make([]*types.TrashItem, 0, len(items))
+	for _, item := range items {
+		if matchesSearch(search, strconv.Itoa(item.ID), item.Name, item.Kind) {
+			filtered = append(filtered, item)
+		}
+	}
+
+	return paginateSlice(filtered, query), len(filtered), nil
+}
+
+// RestoreEquipment takes equipment out of the trash. Its project and draft
+// links were kept, so its bookings reappear with it. Live equipment that took
+// its serial number in the meantime makes this fail.
+func (s *Store) RestoreEquipment(ctx context.Context, id int) (*types.Equipment, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.Equipment, error) {
+		if err := s.restoreSerial(ctx, id); err != nil {
+			return nil, err
+		}
+		if err := s.untrash(ctx, "equipment", "equipment_id", id); err != nil {
+			return nil, err
+		}
+		s.publishEquipment(ctx, events.EquipmentRestored, id)
+		return s.GetEquipmentByID(ctx, id)
+	})
+}
+
+// RestoreProject takes a project out of the trash together with its
+// equipment bookings and stock reservations. Stock other projects reserved
+// for its dates in the meantime makes this fail with ErrInsufficientStock.
+func (s *Store) RestoreProject(ctx context.Context, id int) (*types.Project, error) {
+	return withTx(ctx, s, stockIsolation, func(ctx context.Context) (*types.Project, error) {
+		if err := s.untrash(ctx, "projects", "project_id", id); err != nil {
+			return nil, err
+		}
+		project, err := s.GetProjectByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !project.Archived {
+			if err := s.checkProjectStock(ctx, id, nil); err != nil {
+				return nil, err
+			}
+		}
+		s.publishProject(ctx, events.ProjectRestored, id)
+		return project, nil
+	})
+}
+
+// RestoreDraft takes a draft out of the trash together with its equipment
+// list. A live draft that took its name in the meantime makes this fail as a
+// duplicate.
+func (s *Store) RestoreDraft(ctx context.Context, id int) (*types.Draft, error) {
+	return withTx(ctx, s, writeIsolation, func(ctx context.Context) (*types.Draft, error) {
+		if err := s.untrash(ctx, "drafts", "draft_id", id); err != nil {
+			return nil, err
+		}
+		return s.GetDraftByID(ctx, id)
+	})
+}
+
+// PurgeTrash permanently deletes what has been in the trash since before
+// cutoff. Link rows go with them through ON DELETE CASCADE.
+func (s *Store) PurgeTrash(ctx context.Context, cutoff time.Time) (int64, error) {
+	var purged int64
+	err := s.inTx(ctx, writeIsolation, func(ctx context.Context) error {
+		purged = 0
+		for _, table := range []string{"drafts", "projects", "equipment"} {
+			result, err := s.conn(ctx).ExecContext(ctx, `DELETE FROM `+table+` WHERE deleted_at < $1`, cutoff)
+			if err != nil {
+				return err
+			}
+			rows, _ := result.RowsAffected()
+			purged += rows
+		}
+		return nil
+	})
+	return purged, err
+}
+
+// untrash clears deleted_at of row id. Table and column names come from the
+// callers, never from input.
+func (s *Store) untrash(ctx context.Context, table, idColumn string, id int) error {
+	tracing.Helper()
+	result, err := s.conn(ctx).ExecContext(ctx, `
+		UPDATE `+table+` SET deleted_at = NULL, version = version + 1
+		WHERE `+idColumn+` = $1 AND deleted_at IS NOT NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package tracker
+
+import (
+	"VyacheslavKuchumov/test-backend/service/events"
+	"VyacheslavKuchumov/test-backend/service/tracing"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	maxTxAttempts = 4
+	txRetryDelay  = 20 * time.Millisecond
+
+	// writeIsolation gives composite writes one snapshot for their lookups,
+	// the write and the response built from it. Concurrent updates of the
+	// same rows fail with a serialization error and are retried.
+	writeIsolation = sql.LevelRepeatableRead
+
+	// stockIsolation is used by every write that reserves stock or changes
+	// what is free. Availability is checked against the reservations of other
+	// projects, which a snapshot does not protect: two transactions could
+	// each insert a reservation the other never sees. Serializable turns that
+	// into a serialization failure, and the retry sees the committed row.
+	stockIsolation = sql.LevelSerializable
+)
+
+// errTxIsolation is returned when a nested call asks for a stricter
+// isolation level than the transaction it would join. Its guarantees would
+// silently not hold, so the outer operation has to use the stricter level.
+var errTxIsolation = errors.New("nested transaction needs a stricter isolation level")
+
+type txKey struct{}
+
+// txState is carried in the context of a running transaction. Events are
+// held back until commit, so subscribers never see changes that were rolled
+// back or are about to be retried.
+type txState struct {
+	tx        *tracing.Tx
+	isolation sql.IsolationLevel
+	pending   []events.Event
+}
+
+func txFromContext(ctx context.Context) *txState {
+	state, _ := ctx.Value(txKey{}).(*txState)
+	return state
+}
+
+// conn returns the transaction carried by ctx, or the pool outside one.
+func (s *Store) conn(ctx context.Context) tracing.Querier {
+	if state := txFromContext(ctx); state != nil {
+		return state.tx
+	}
+	return s.db
+}
+
+// inTx runs fn in one transaction at the given isolation level. fn must issue
+// its queries with the ctx it receives. A call inside a running transaction
+// joins it, or fails with errTxIsolation when that transaction runs at a
+// weaker level. Serialization failures and deadlocks roll back and rerun fn,
+// so fn must not have side effects other than its queries and published
+// events.
+func (s *Store) inTx(ctx context.Context, isolation sql.IsolationLevel, fn func(ctx context.Context) error) error {
+	if state := txFromContext(ctx); state != nil {
+		if isolation > state.isolation {
+			return fmt.Errorf("%w: %s inside %s", errTxIsolation, isolation, state.isolation)
+		}
+		return fn(ctx)
+	}
+
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		var state *txState
+		state, err = s.runTx(ctx, isolation, fn)
+		if err == nil {
+			for _, event := range state.pending {
+				s.publish(ctx, event)
+			}
+			return nil
+		}
+		if !isRetryable(err) || attempt == maxTxAttempts {
+			break
+		}
+
+		delay := txRetryDelay*time.Duration(1<<(attempt-1)) + rand.N(txRetryDelay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	return err
+}
+
+func (s *Store) runTx(ctx context.Context, isolation sql.IsolationLevel, fn func(ctx context.Context) error) (*txState, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("database is not configured")
+	}
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: isolation})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	state := &txState{tx: tx, isolation: isolation}
+	if err := fn(context.WithValue(ctx, txKey{}, state)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// isRetryable reports PostgreSQL serialization failures (40001) and
+// deadlocks (40P01), which succeed when the transaction is run again.
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == "40001" || pgErr.Code == "40P01"
+}
+
+// isForeignKeyViolation reports PostgreSQL foreign key violations (23503).
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
+
+// withTx is inTx for operations that return a value.
+func withTx[T any](ctx context.Context, s *Store, isolation sql.IsolationLevel, fn func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := s.inTx(ctx, isolation, func(ctx context.Context) error {
+		var err error
+		result, err = fn(ctx)
+		return err
+	})
+	return result, err
+}
@@ -0,0 +1,263 @@
+package tracker
+
+import (
+	"VyacheslavKuchumov/test-backend/service/events"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeDB counts the transactions database/sql runs on it, so the retries and
+// held events of inTx can be tested without PostgreSQL. It runs no queries.
+type fakeDB struct {
+	mu         sync.Mutex
+	begun      int
+	committed  int
+	rolledBack int
+}
+
+func (d *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: d}, nil }
+func (d *fakeDB) Driver() driver.Driver                        { return d }
+func (d *fakeDB) Open(string) (driver.Conn, error)             { return &fakeConn{db: d}, nil }
+
+func (d *fakeDB) counts() (begun, committed, rolledBack int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.begun, d.committed, d.rolledBack
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("the fake database runs no queries")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.begun++
+	return &fakeTx{db: c.db}, nil
+}
+
+type fakeTx struct {
+	db *fakeDB
+}
+
+func (t *fakeTx) Commit() error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+	t.db.committed++
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+	t.db.rolledBack++
+	return nil
+}
+
+type recordingPublisher struct {
+	events []events.Event
+}
+
+func (p *recordingPublisher) Publish(event events.Event) {
+	p.events = append(p.events, event)
+}
+
+func newTxStore(t *testing.T) (*Store, *fakeDB, *recordingPublisher) {
+	t.Helper()
+	fake := &fakeDB{}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+	store := NewStore(db)
+	publisher := &recordingPublisher{}
+	store.SetPublisher(publisher)
+	return store, fake, publisher
+}
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{name: "serialization failure", err: &pgconn.PgError{Code: "40001"}, retryable: true},
+		{name: "deadlock", err: &pgconn.PgError{Code: "40P01"}, retryable: true},
+		{name: "wrapped serialization failure", err: fmt.Errorf("update equipment: %w", &pgconn.PgError{Code: "40001"}), retryable: true},
+		{name: "unique violation", err: &pgconn.PgError{Code: "23505"}},
+		{name: "not a database error", err: ErrNotFound},
+		{name: "no error"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isRetryable(tc.err); got != tc.retryable {
+				t.Fatalf("expected %v, got %v", tc.retryable, got)
+			}
+		})
+	}
+}
+
+func TestInTxRetriesSerializationFailuresAndDeadlocks(t *testing.T) {
+	for _, code := range []string{"40001", "40P01"} {
+		t.Run(code, func(t *testing.T) {
+			store, fake, publisher := newTxStore(t)
+
+			attempts := 0
+			result, err := withTx(context.Background(), store, writeIsolation, func(ctx context.Context) (int, error) {
+				attempts++
+				store.publish(ctx, events.New(events.EquipmentUpdated))
+				if attempts == 1 {
+					return 0, &pgconn.PgError{Code: code}
+				}
+				return 42, nil
+			})
+			if err != nil || result != 42 {
+				t.Fatalf("expected the retry to succeed, got %d, %v", result, err)
+			}
+			if attempts != 2 {
+				t.Fatalf("expected 2 attempts, got %d", attempts)
+			}
+			if begun, committed, rolledBack := fake.counts(); begun != 2 || committed != 1 || rolledBack != 1 {
+				t.Fatalf("expected one rolled back and one committed transaction, got %d begun, %d committed, %d rolled back", begun, committed, rolledBack)
+			}
+			if len(publisher.events) != 1 {
+				t.Fatalf("expected only the committed attempt's event, got %d", len(publisher.events))
+			}
+		})
+	}
+}
+
+func TestInTxGivesUpAfterMaxAttempts(t *testing.T) {
+	store, fake, publisher := newTxStore(t)
+
+	attempts := 0
+	err := store.inTx(context.Background(), writeIsolation, func(ctx context.Context) error {
+		attempts++
+		store.publish(ctx, events.New(events.EquipmentUpdated))
+		return &pgconn.PgError{Code: "40001"}
+	})
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "40001" {
+		t.Fatalf("expected the last serialization failure, got %v", err)
+	}
+	if attempts != maxTxAttempts {
+		t.Fatalf("expected %d attempts, got %d", maxTxAttempts, attempts)
+	}
+	if begun, committed, rolledBack := fake.counts(); begun != maxTxAttempts || committed != 0 || rolledBack != maxTxAttempts {
+		t.Fatalf("expected every attempt rolled back, got %d begun, %d committed, %d rolled back", begun, committed, rolledBack)
+	}
+	if len(publisher.events) != 0 {
+		t.Fatalf("expected no events from rolled back attempts, got %d", len(publisher.events))
+	}
+}
+
+func TestInTxDoesNotRetryOtherErrors(t *testing.T) {
+	for name, failure := range map[string]error{
+		"not found":        ErrNotFound,
+		"unique violation": &pgconn.PgError{Code: "23505"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			store, fake, publisher := newTxStore(t)
+
+			attempts := 0
+			err := store.inTx(context.Background(), writeIsolation, func(ctx context.Context) error {
+				attempts++
+				store.publish(ctx, events.New(events.EquipmentUpdated))
+				return failure
+			})
+			if !errors.Is(err, failure) {
+				t.Fatalf("expected %v, got %v", failure, err)
+			}
+			if attempts != 1 {
+				t.Fatalf("expected a single attempt, got %d", attempts)
+			}
+			if _, committed, rolledBack := fake.counts(); committed != 0 || rolledBack != 1 {
+				t.Fatalf("expected the transaction rolled back, got %d committed, %d rolled back", committed, rolledBack)
+			}
+			if len(publisher.events) != 0 {
+				t.Fatalf("expected the event dropped with the rollback, got %d", len(publisher.events))
+			}
+		})
+	}
+}
+
+func TestInTxPublishesEventsAfterCommit(t *testing.T) {
+	store, fake, publisher := newTxStore(t)
+
+	err := store.inTx(context.Background(), writeIsolation, func(ctx context.Context) error {
+		store.publish(ctx, events.New(events.EquipmentCreated))
+		// A nested call joins the running transaction and holds its events
+		// back as well.
+		if err := store.inTx(ctx, writeIsolation, func(ctx context.Context) error {
+			store.publish(ctx, events.New(events.EquipmentUpdated))
+			return nil
+		}); err != nil {
+			return err
+		}
+		if len(publisher.events) != 0 {
+			t.Errorf("expected events held until commit, got %d published", len(publisher.events))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if begun, committed, _ := fake.counts(); begun != 1 || committed != 1 {
+		t.Fatalf("expected one committed transaction, got %d begun, %d committed", begun, committed)
+	}
+	if len(publisher.events) != 2 || publisher.events[0].Type != events.EquipmentCreated || publisher.events[1].Type != events.EquipmentUpdated {
+		t.Fatalf("expected both events in order after commit, got %+v", publisher.events)
+	}
+}
+
+func TestInTxRejectsStricterNestedIsolation(t *testing.T) {
+	store, fake, publisher := newTxStore(t)
+
+	nested := 0
+	err := store.inTx(context.Background(), writeIsolation, func(ctx context.Context) error {
+		store.publish(ctx, events.New(events.EquipmentCreated))
+		return store.inTx(ctx, stockIsolation, func(ctx context.Context) error {
+			nested++
+			return nil
+		})
+	})
+	if !errors.Is(err, errTxIsolation) {
+		t.Fatalf("expected the stricter nested call to be refused, got %v", err)
+	}
+	if nested != 0 {
+		t.Fatalf("expected the nested function not to run, ran %d times", nested)
+	}
+	if _, committed, rolledBack := fake.counts(); committed != 0 || rolledBack != 1 {
+		t.Fatalf("expected the transaction rolled back, got %d committed, %d rolled back", committed, rolledBack)
+	}
+	if len(publisher.events) != 0 {
+		t.Fatalf("expected the event dropped with the rollback, got %d", len(publisher.events))
+	}
+
+	// A weaker level joins: the outer transaction gives at least its
+	// guarantees.
+	err = store.inTx(context.Background(), stockIsolation, func(ctx context.Context) error {
+		return store.inTx(ctx, writeIsolation, func(ctx context.Context) error {
+			nested++
+			return nil
+		})
+	})
+	if err != nil || nested != 1 {
+		t.Fatalf("expected the weaker nested call to join, got %v after %d runs", err, nested)
+	}
+}
@@ -0,0 +1,265 @@
+package tracker
+
+import (
+	"VyacheslavKuchumov/test-backend/types"
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// depreciationArgs returns the depreciation columns of a set type payload,
+// all nil when it leaves depreciation as it is.
+func depreciationArgs(depreciation *types.Depreciation) (method, usefulLifeMonths, salvagePercent any) {
+	if depreciation == nil {
+		return nil, nil, nil
+	}
+	if depreciation.Method == types.DepreciationNone {
+		return depreciation.Method, nil, 0.0
+	}
+	return depreciation.Method, depreciation.UsefulLifeMonths, depreciation.SalvagePercent
+}
+
+// monthsBetween counts the whole months from from to to, 0 when to is
+// earlier.
+func monthsBetween(from, to time.Time) int {
+	months := (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+	if to.Day() < from.Day() {
+		months--
+	}
+	return max(months, 0)
+}
+
+// bookValue is what cost is worth ageMonths after purchase. Straight-line
+// spreads cost less salvage evenly over the useful life. Declining balance
+// takes twice the straight-line rate of the remaining value each month and
+// switches to straight-line over the rest of the life once that takes more,
+// so both methods reach the salvage value when the life ends.
+func bookValue(cost float64, ageMonths int, depreciation types.Depreciation) float64 {
+	life := depreciation.UsefulLifeMonths
+	if depreciation.Method == types.DepreciationNone || life <= 0 {
+		return cost
+	}
+	salvage := cost * depreciation.SalvagePercent / 100
+	if ageMonths >= life {
+		return salvage
+	}
+
+	switch depreciation.Method {
+	case types.DepreciationStraightLine:
+		return cost - (cost-salvage)*float64(ageMonths)/float64(life)
+	case types.DepreciationDecliningBalance:
+		value := cost
+		rate := 2 / float64(life)
+		for month := 0; month < ageMonths; month++ {
+			declining := value * rate
+			straight := (value - salvage) / float64(life-month)
+			value = max(value-max(declining, straight), salvage)
+		}
+		return value
+	}
+	return cost
+}
+
+func roundMoney(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// valueItem fills in the depreciation of item as of asOf. Items without a
+// purchase date or cost are marked unvalued.
+func valueItem(item *types.ValuedItem, cost *float64, depreciation types.Depreciation, asOf time.Time, nearingMonths int) {
+	item.Method = depreciation.Method
+	if depreciation.Method != types.DepreciationNone {
+		item.UsefulLifeMonths = depreciation.UsefulLifeMonths
+	}
+	purchased, err := time.Parse(time.DateOnly, item.DateOfPurchase)
+	if cost == nil || err != nil {
+		item.Unvalued = true
+		return
+	}
+
+	item.CostOfPurchase = roundMoney(*cost)
+	item.AgeMonths = monthsBetween(purchased, asOf)
+	item.BookValue = roundMoney(bookValue(*cost, item.AgeMonths, depreciation))
+	item.Depreciated = roundMoney(item.CostOfPurchase - item.BookValue)
+	if item.UsefulLifeMonths == 0 {
+		return
+	}
+
+	remaining := max(item.UsefulLifeMonths-item.AgeMonths, 0)
+	item.RemainingMonths = &remaining
+	switch {
+	case remaining == 0:
+		item.EndOfLife = types.EndOfLifeReached
+	case remaining <= nearingMonths:
+		item.EndOfLife = types.EndOfLifeNearing
+	}
+}
+
+// ListValuedItems values the live equipment purchased by query.AsOf,
+// narrowed by the ID and end of life filters of query. Items are placed in
+// the warehouse their movement history has them in on that date.
+func (s *Store) ListValuedItems(ctx context.Context, query types.ValuationQuery) ([]*types.ValuedItem, error) {
+	asOf := query.AsOf.Format(time.DateOnly)
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+		WITH placed AS (
+			SELECT
+				e.*,
+				COALESCE((
+					SELECT m.to_warehouse_id
+					FROM equipment_movements m
+					WHERE m.equipment_id = e.equipment_id AND m.moved_at < $1::DATE + 1
+					ORDER BY m.moved_at DESC, m.movement_id DESC
+					LIMIT 1
+				), e.storage_id) AS warehouse_id
+			FROM equipment e
+			WHERE e.deleted_at IS NULL
+			  AND (e.date_of_purchase IS NULL OR e.date_of_purchase <= $1::DATE)
+		)
+		SELECT
+			e.equipment_id,
+			e.equipment_name,
+			e.serial_number,
+			es.equipment_set_id,
+			es.equipment_set_name,
+			st.set_type_id,
+			st.set_type_name,
+			w.warehouse_id,
+			w.warehouse_name,
+			COALESCE(TO_CHAR(e.date_of_purchase, 'YYYY-MM-DD'), ''),
+			e.cost_of_purchase::FLOAT8,
+			st.depreciation_method,
+			COALESCE(st.useful_life_months, 0),
+			st.salvage_percent::FLOAT8
+		FROM placed e
+		JOIN equipment_sets es ON es.equipment_set_id = e.equipment_set_id
+		JOIN set_types st ON st.set_type_id = es.set_type_id
+		JOIN warehouses w ON w.warehouse_id = e.warehouse_id
+		WHERE ($2 = 0 OR w.warehouse_id = $2)
+		  AND ($3 = 0 OR st.set_type_id = $3)
+		  AND ($4 = 0 OR es.equipment_set_id = $4)
+		ORDER BY e.equipment_name ASC, e.equipment_id ASC
+	`, asOf, query.WarehouseID, query.SetTypeID, query.EquipmentSetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*types.ValuedItem, 0)
+	for rows.Next() {
+		item := new(types.ValuedItem)
+		var cost *float64
+		var depreciation types.Depreciation
+		if err := rows.Scan(
+			&item.EquipmentID,
+			&item.EquipmentName,
+			&item.SerialNumber,
+			&item.EquipmentSetID,
+			&item.EquipmentSetName,
+			&item.SetTypeID,
+			&item.SetTypeName,
+			&item.WarehouseID,
+			&item.WarehouseName,
+			&item.DateOfPurchase,
+			&cost,
+			&depreciation.Method,
+			&depreciation.UsefulLifeMonths,
+			&depreciation.SalvagePercent,
+		); err != nil {
+			return nil, err
+		}
+		valueItem(item, cost, depreciation, query.AsOf, query.NearingMonths)
+		if matchesEndOfLife(item, query.EndOfLife) {
+			result = append(result, item)
+		}
+	}
+	return result, rows.Err()
+}
+
+// matchesEndOfLife reports whether item is in the end of life state filter
+// asks for: nearing, reached, flagged for either, or anything when empty.
+func matchesEndOfLife(item *types.ValuedItem, filter string) bool {
+	switch filter {
+	case "":
+		return true
+	case types.EndOfLifeFlagged:
+		return item.EndOfLife != ""
+	default:
+		return item.EndOfLife == filter
+	}
+}
+
+func (s *Store) SearchValuedItems(ctx context.Context, query types.ValuationQuery, listQuery types.ListQuery) ([]*types.ValuedItem, int, error) {
+	items, err := s.ListValuedItems(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	search := normalizeSearchQuery(listQuery.Search)
+	filtered := make([]*types.ValuedItem, 0, len(items))
+	for _, item := range items {
+		if matchesSearch(search, strconv.Itoa(item.EquipmentID), item.EquipmentName, item.SerialNumber, item.EquipmentSetName, item.SetTypeName, item.WarehouseName) {
+			filtered = append(filtered, item)
+		}
+	}
+	return paginateSlice(filtered, listQuery), len(filtered), nil
+}
+
+// GetValuationReport sums the valued equipment as of query.AsOf by
+// warehouse, set type or equipment set.
+func (s *Store) GetValuationReport(ctx context.Context, query types.ValuationQuery) (*types.ValuationReport, error) {
+	query.EndOfLife = ""
+	items, err := s.ListValuedItems(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &types.ValuationReport{
+		AsOf:    query.AsOf.Format(time.DateOnly),
+		GroupBy: query.GroupBy,
+		Groups:  make([]*types.ValuationGroup, 0),
+		Total:   &types.ValuationGroup{Name: "total"},
+	}
+	groups := make(map[int]*types.ValuationGroup)
+	for _, item := range items {
+		id, name := item.WarehouseID, item.WarehouseName
+		switch query.GroupBy {
+		case types.ValuationBySetType:
+			id, name = item.SetTypeID, item.SetTypeName
+		case types.ValuationByEquipmentSet:
+			id, name = item.EquipmentSetID, item.EquipmentSetName
+		}
+		group, ok := groups[id]
+		if !ok {
+			group = &types.ValuationGroup{ID: id, Name: name}
+			groups[id] = group
+			report.Groups = append(report.Groups, group)
+		}
+		addToGroup(group, item)
+		addToGroup(report.Total, item)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		if report.Groups[i].Name != report.Groups[j].Name {
+			return report.Groups[i].Name < report.Groups[j].Name
+		}
+		return report.Groups[i].ID < report.Groups[j].ID
+	})
+	return report, nil
+}
+
+func addToGroup(group *types.ValuationGroup, item *types.ValuedItem) {
+	group.Items++
+	if item.Unvalued {
+		group.Unvalued++
+		return
+	}
+	group.Cost = roundMoney(group.Cost + item.CostOfPurchase)
+	group.BookValue = roundMoney(group.BookValue + item.BookValue)
+	switch item.EndOfLife {
+	case types.EndOfLifeNearing:
+		group.NearingEndOfLife++
+	case types.EndOfLifeReached:
+		group.EndOfLifeReached++
+	}
+}
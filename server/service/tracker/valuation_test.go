@@ -0,0 +1,97 @@
+package tracker
+
+import (
+	"VyacheslavKuchumov/test-backend/types"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMonthsBetween(t *testing.T) {
+	cases := []struct {
+		from, to string
+		months   int
+	}{
+		{"2024-01-15", "2024-01-15", 0},
+		{"2024-01-15", "2024-02-14", 0},
+		{"2024-01-15", "2024-02-15", 1},
+		{"2023-11-30", "2026-01-31", 26},
+		{"2026-03-01", "2026-01-01", 0},
+	}
+	for _, tc := range cases {
+		from, _ := time.Parse(time.DateOnly, tc.from)
+		to, _ := time.Parse(time.DateOnly, tc.to)
+		if got := monthsBetween(from, to); got != tc.months {
+			t.Fatalf("monthsBetween(%s, %s) = %d, expected %d", tc.from, tc.to, got, tc.months)
+		}
+	}
+}
+
+func TestBookValue(t *testing.T) {
+	straight := types.Depreciation{Method: types.DepreciationStraightLine, UsefulLifeMonths: 60, SalvagePercent: 10}
+	declining := types.Depreciation{Method: types.DepreciationDecliningBalance, UsefulLifeMonths: 60, SalvagePercent: 10}
+
+	cases := []struct {
+		name         string
+		depreciation types.Depreciation
+		age          int
+		value        float64
+	}{
+		{name: "no depreciation", depreciation: types.Depreciation{Method: types.DepreciationNone}, age: 120, value: 1000},
+		{name: "straight-line when new", depreciation: straight, age: 0, value: 1000},
+		{name: "straight-line halfway", depreciation: straight, age: 30, value: 550},
+		{name: "straight-line after its life", depreciation: straight, age: 90, value: 100},
+		{name: "declining balance after a month", depreciation: declining, age: 1, value: 1000 * (1 - 2.0/60)},
+		{name: "declining balance at the end of its life", depreciation: declining, age: 60, value: 100},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := bookValue(1000, tc.age, tc.depreciation); math.Abs(got-tc.value) > 0.005 {
+				t.Fatalf("expected %.2f, got %.2f", tc.value, got)
+			}
+		})
+	}
+
+	previous := 1000.0
+	for age := 1; age <= 60; age++ {
+		value := bookValue(1000, age, declining)
+		if value > previous || value < 100 {
+			t.Fatalf("declining balance went from %.2f to %.2f at month %d", previous, value, age)
+		}
+		if age < 30 && value > bookValue(1000, age, straight) {
+			t.Fatalf("declining balance should depreciate faster early on, month %d", age)
+		}
+		previous = value
+	}
+	if previous-bookValue(1000, 59, declining) > 20 {
+		t.Fatal("declining balance should not drop to salvage in one step at the end")
+	}
+}
+
+func TestValueItemFlagsEndOfLife(t *testing.T) {
+	asOf, _ := time.Parse(time.DateOnly, "2026-06-01")
+	cost := 1200.0
+	depreciation := types.Depreciation{Method: types.DepreciationStraightLine, UsefulLifeMonths: 36}
+
+	cases := []struct {
+		purchased string
+		endOfLife string
+	}{
+		{"2025-06-01", ""},
+		{"2023-10-01", types.EndOfLifeNearing},
+		{"2023-06-01", types.EndOfLifeReached},
+	}
+	for _, tc := range cases {
+		item := &types.ValuedItem{DateOfPurchase: tc.purchased}
+		valueItem(item, &cost, depreciation, asOf, 6)
+		if item.EndOfLife != tc.endOfLife {
+			t.Fatalf("purchased %s: expected %q, got %q", tc.purchased, tc.endOfLife, item.EndOfLife)
+		}
+	}
+
+	item := &types.ValuedItem{}
+	valueItem(item, &cost, depreciation, asOf, 6)
+	if !item.Unvalued || item.BookValue != 0 {
+		t.Fatalf("expected an item without a purchase date to be unvalued, got %+v", item)
+	}
+}
@@ -0,0 +1,121 @@
+package transfer
+
+import (
+	"VyacheslavKuchumov/test-backend/service/crmhttp"
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type Store interface {
+	SearchTransfers(ctx context.Context, status string, query types.ListQuery) ([]*types.WarehouseTransfer, int, error)
+	GetTransferByID(ctx context.Context, id int) (*types.WarehouseTransfer, error)
+	CreateTransfer(ctx context.Context, payload types.WarehouseTransferPayload) (*types.WarehouseTransfer, error)
+	ShipTransfer(ctx context.Context, id, version int) (*types.WarehouseTransfer, error)
+	ReceiveTransfer(ctx context.Context, id, version int) (*types.WarehouseTransfer, error)
+	CancelTransfer(ctx context.Context, id, version int) (*types.WarehouseTransfer, error)
+}
+
+type Service struct {
+	store Store
+}
+
+func NewService(store Store) *Service {
+	return &Service{store: store}
+}
+
+func RegisterRoutes(r chi.Router, service *Service) {
+	r.Route("/transfers", func(rt chi.Router) {
+		rt.Get("/", service.HandleGet)
+		rt.Get("/{id}", service.HandleGetByID)
+		rt.Post("/", service.HandleCreate)
+		rt.Post("/{id}/ship", service.handleTransition(service.store.ShipTransfer))
+		rt.Post("/{id}/receive", service.handleTransition(service.store.ReceiveTransfer))
+		rt.Post("/{id}/cancel", service.handleTransition(service.store.CancelTransfer))
+	})
+}
+
+func (s *Service) HandleGet(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status != "" && !knownStatus(status) {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.Errorf("unknown transfer status %q", status))
+		return
+	}
+	query := crmhttp.ParseListQuery(r)
+	items, total, err := s.store.SearchTransfers(r.Context(), status, query)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(items, query.Page, query.PerPage, total))
+}
+
+func (s *Service) HandleGetByID(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	item, err := s.store.GetTransferByID(r.Context(), id)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	crmhttp.WriteVersioned(w, item.Version, item)
+}
+
+func (s *Service) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	var payload types.WarehouseTransferPayload
+	if !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	item, err := s.store.CreateTransfer(r.Context(), payload)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, item)
+}
+
+// handleTransition serves the status changes, which differ only in the store
+// method they call.
+func (s *Service) handleTransition(transition func(ctx context.Context, id, version int) (*types.WarehouseTransfer, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !crmhttp.RequireAuth(w, r) {
+			return
+		}
+		id, ok := crmhttp.MustPathID(w, r, "id")
+		if !ok {
+			return
+		}
+		version, ok := crmhttp.IfMatchVersion(w, r)
+		if !ok {
+			return
+		}
+		item, err := transition(r.Context(), id, version)
+		if err != nil {
+			crmhttp.WriteStoreError(w, r, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, item)
+	}
+}
+
+func knownStatus(status string) bool {
+	switch status {
+	case types.TransferStatusPending, types.TransferStatusInTransit, types.TransferStatusReceived, types.TransferStatusCancelled:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package transfer
+
+import (
+	"VyacheslavKuchumov/test-backend/service/auth"
+	"VyacheslavKuchumov/test-backend/service/tracker"
+	"VyacheslavKuchumov/test-backend/types"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type mockStore struct {
+	calls   []string
+	version int
+	status  string
+}
+
+func (s *mockStore) SearchTransfers(ctx context.Context, status string, query types.ListQuery) ([]*types.WarehouseTransfer, int, error) {
+	s.status = status
+	return []*types.WarehouseTransfer{}, 0, nil
+}
+
+func (s *mockStore) GetTransferByID(ctx context.Context, id int) (*types.WarehouseTransfer, error) {
+	return nil, tracker.ErrNotFound
+}
+
+func (s *mockStore) CreateTransfer(ctx context.Context, payload types.WarehouseTransferPayload) (*types.WarehouseTransfer, error) {
+	return &types.WarehouseTransfer{TransferID: 1, Status: types.TransferStatusPending}, nil
+}
+
+func (s *mockStore) ShipTransfer(ctx context.Context, id, version int) (*types.WarehouseTransfer, error) {
+	return s.transition("ship", id, version, types.TransferStatusInTransit)
+}
+
+func (s *mockStore) ReceiveTransfer(ctx context.Context, id, version int) (*types.WarehouseTransfer, error) {
+	return nil, tracker.ErrInvalidTransition
+}
+
+func (s *mockStore) CancelTransfer(ctx context.Context, id, version int) (*types.WarehouseTransfer, error) {
+	return s.transition("cancel", id, version, types.TransferStatusCancelled)
+}
+
+func (s *mockStore) transition(call string, id, version int, status string) (*types.WarehouseTransfer, error) {
+	s.calls = append(s.calls, call)
+	s.version = version
+	return &types.WarehouseTransfer{TransferID: id, Status: status}, nil
+}
+
+func serve(store Store, method, target string, header http.Header) *httptest.ResponseRecorder {
+	r := chi.NewRouter()
+	RegisterRoutes(r, NewService(store))
+	req := httptest.NewRequest(method, target, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestTransitionsPassIfMatchVersion(t *testing.T) {
+	store := &mockStore{}
+
+	rr := serve(store, http.MethodPost, "/transfers/7/ship", http.Header{"If-Match": {`"v3"`}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var transfer types.WarehouseTransfer
+	if err := json.NewDecoder(rr.Body).Decode(&transfer); err != nil || transfer.TransferID != 7 || transfer.Status != types.TransferStatusInTransit {
+		t.Fatalf("expected transfer 7 in transit, got %+v (%v)", transfer, err)
+	}
+	if len(store.calls) != 1 || store.calls[0] != "ship" || store.version != 3 {
+		t.Fatalf("expected a ship at version 3, got %v at %d", store.calls, store.version)
+	}
+}
+
+func TestInvalidTransitionIsConflict(t *testing.T) {
+	store := &mockStore{}
+
+	if rr := serve(store, http.MethodPost, "/transfers/7/receive", nil); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rr.Code)
+	}
+}
+
+func TestListValidatesStatus(t *testing.T) {
+	store := &mockStore{}
+
+	if rr := serve(store, http.MethodGet, "/transfers/?status=in_transit", nil); rr.Code != http.StatusOK || store.status != types.TransferStatusInTransit {
+		t.Fatalf("expected in transit listing, got %d with status %q", rr.Code, store.status)
+	}
+	if rr := serve(store, http.MethodGet, "/transfers/?status=lost", nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown status, got %d", rr.Code)
+	}
+}
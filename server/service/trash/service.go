@@ -0,0 +1,115 @@
+package trash
+
+import (
+	"VyacheslavKuchumov/test-backend/service/crmhttp"
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type Store interface {
+	SearchTrash(ctx context.Context, kind string, query types.ListQuery) ([]*types.TrashItem, int, error)
+	RestoreEquipment(ctx context.Context, id int) (*types.Equipment, error)
+	RestoreProject(ctx context.Context, id int) (*types.Project, error)
+	RestoreDraft(ctx context.Context, id int) (*types.Draft, error)
+	PurgeTrash(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+type Service struct {
+	store Store
+}
+
+func NewService(store Store) *Service {
+	return &Service{store: store}
+}
+
+func RegisterRoutes(r chi.Router, service *Service) {
+	r.Route("/trash", func(rt chi.Router) {
+		rt.Get("/", service.HandleGet)
+		rt.Post("/{kind}/{id}/restore", service.HandleRestore)
+	})
+}
+
+func (s *Service) HandleGet(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	kind := r.URL.Query().Get("kind")
+	if kind != "" && !knownKind(kind) {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.Errorf("unknown trash kind %q", kind))
+		return
+	}
+	query := crmhttp.ParseListQuery(r)
+	items, total, err := s.store.SearchTrash(r.Context(), kind, query)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(items, query.Page, query.PerPage, total))
+}
+
+func (s *Service) HandleRestore(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var item any
+	var err error
+	switch kind := chi.URLParam(r, "kind"); kind {
+	case types.TrashKindEquipment:
+		item, err = s.store.RestoreEquipment(r.Context(), id)
+	case types.TrashKindProject:
+		item, err = s.store.RestoreProject(r.Context(), id)
+	case types.TrashKindDraft:
+		item, err = s.store.RestoreDraft(r.Context(), id)
+	default:
+		utils.WriteError(w, r, http.StatusNotFound, utils.Errorf("unknown trash kind %q", kind))
+		return
+	}
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, item)
+}
+
+// RunPurge permanently deletes trash older than retention every interval
+// until ctx is cancelled.
+func (s *Service) RunPurge(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		purged, err := s.store.PurgeTrash(ctx, time.Now().Add(-retention))
+		if err != nil {
+			slog.Error("failed to purge trash", "error", err)
+			continue
+		}
+		if purged > 0 {
+			slog.Info("purged trash", "count", purged)
+		}
+	}
+}
+
+func knownKind(kind string) bool {
+	switch kind {
+	case types.TrashKindEquipment, types.TrashKindProject, types.TrashKindDraft:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package trash
+
+import (
+	"VyacheslavKuchumov/test-backend/service/auth"
+	"VyacheslavKuchumov/test-backend/service/tracker"
+	"VyacheslavKuchumov/test-backend/types"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type mockStore struct {
+	restored []string
+	kind     string
+}
+
+func (s *mockStore) SearchTrash(ctx context.Context, kind string, query types.ListQuery) ([]*types.TrashItem, int, error) {
+	s.kind = kind
+	return []*types.TrashItem{}, 0, nil
+}
+
+func (s *mockStore) RestoreEquipment(ctx context.Context, id int) (*types.Equipment, error) {
+	s.restored = append(s.restored, "equipment")
+	return &types.Equipment{EquipmentID: id}, nil
+}
+
+func (s *mockStore) RestoreProject(ctx context.Context, id int) (*types.Project, error) {
+	s.restored = append(s.restored, "project")
+	return &types.Project{ProjectID: id}, nil
+}
+
+func (s *mockStore) RestoreDraft(ctx context.Context, id int) (*types.Draft, error) {
+	return nil, tracker.ErrNotFound
+}
+
+func (s *mockStore) PurgeTrash(ctx context.Context, cutoff time.Time) (int64, error) {
+	return 0, nil
+}
+
+func serve(store Store, method, target string) *httptest.ResponseRecorder {
+	r := chi.NewRouter()
+	RegisterRoutes(r, NewService(store))
+	req := httptest.NewRequest(method, target, nil)
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRestoreDispatchesByKind(t *testing.T) {
+	store := &mockStore{}
+
+	rr := serve(store, http.MethodPost, "/trash/project/4/restore")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var project types.Project
+	if err := json.NewDecoder(rr.Body).Decode(&project); err != nil || project.ProjectID != 4 {
+		t.Fatalf("expected project 4, got %+v (%v)", project, err)
+	}
+	if len(store.restored) != 1 || store.restored[0] != "project" {
+		t.Fatalf("expected a project restore, got %v", store.restored)
+	}
+}
+
+func TestRestoreRejectsUnknownKindAndMissingItems(t *testing.T) {
+	store := &mockStore{}
+
+	if rr := serve(store, http.MethodPost, "/trash/warehouse/4/restore"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown kind, got %d", rr.Code)
+	}
+	if rr := serve(store, http.MethodPost, "/trash/draft/4/restore"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a draft not in the trash, got %d", rr.Code)
+	}
+	if len(store.restored) != 0 {
+		t.Fatalf("expected nothing restored, got %v", store.restored)
+	}
+}
+
+func TestListValidatesKind(t *testing.T) {
+	store := &mockStore{}
+
+	if rr := serve(store, http.MethodGet, "/trash/?kind=equipment"); rr.Code != http.StatusOK || store.kind != "equipment" {
+		t.Fatalf("expected equipment listing, got %d with kind %q", rr.Code, store.kind)
+	}
+	if rr := serve(store, http.MethodGet, "/trash/?kind=users"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown kind, got %d", rr.Code)
+	}
+}
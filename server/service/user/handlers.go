@@ -5,6 +5,7 @@ import (
 	"VyacheslavKuchumov/test-backend/service/auth"
 	"VyacheslavKuchumov/test-backend/types"
 	"VyacheslavKuchumov/test-backend/utils"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -12,7 +13,6 @@ import (
 	"strings"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-playground/validator/v10"
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
@@ -37,13 +37,13 @@ func NewHandler(store types.UserStore) *Handler {
 func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	var payload types.LoginUserPayload
 	if err := utils.ParseJSON(r, &payload); err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	token, err := h.createSessionToken(payload)
+	token, err := h.createSessionToken(r.Context(), payload)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
@@ -60,17 +60,22 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 // @Param payload body types.RegisterUserPayload true "Registration payload"
 // @Success 201 {object} map[string]interface{}
 // @Failure 400 {object} types.ErrorResponse
+// @Failure 409 {object} types.ErrorResponse
 // @Router /register [post]
 func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 	var payload types.RegisterUserPayload
 	if err := utils.ParseJSON(r, &payload); err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	err := h.registerUser(payload)
+	err := h.registerUser(r.Context(), payload)
+	if errors.Is(err, errEmailTaken) {
+		writeEmailTaken(w, r, payload.Email)
+		return
+	}
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
@@ -90,13 +95,13 @@ func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) HandleGetProfile(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserIDFromContext(r.Context())
 	if userID <= 0 {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
+		utils.WriteError(w, r, http.StatusForbidden, fmt.Errorf("permission denied"))
 		return
 	}
 
-	user, err := h.store.GetUserByID(userID)
+	user, err := h.store.GetUserByID(r.Context(), userID)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -114,18 +119,19 @@ func (h *Handler) HandleGetProfile(w http.ResponseWriter, r *http.Request) {
 // @Success 200 {object} types.UserProfile
 // @Failure 400 {object} types.ErrorResponse
 // @Failure 403 {object} types.ErrorResponse
+// @Failure 409 {object} types.ErrorResponse
 // @Failure 500 {object} types.ErrorResponse
 // @Router /profile [put]
 func (h *Handler) HandleUpdateProfile(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserIDFromContext(r.Context())
 	if userID <= 0 {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
+		utils.WriteError(w, r, http.StatusForbidden, fmt.Errorf("permission denied"))
 		return
 	}
 
 	var payload types.UpdateProfilePayload
 	if err := utils.ParseJSON(r, &payload); err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 	payload.FirstName = strings.TrimSpace(payload.FirstName)
@@ -134,28 +140,27 @@ func (h *Handler) HandleUpdateProfile(w http.ResponseWriter, r *http.Request) {
 	payload.CurrentPassword = strings.TrimSpace(payload.CurrentPassword)
 
 	if err := utils.Validate.Struct(payload); err != nil {
-		errors := err.(validator.ValidationErrors)
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	currentUser, err := h.store.GetUserByID(userID)
+	currentUser, err := h.store.GetUserByID(r.Context(), userID)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	if !auth.ComparePasswords(currentUser.Password, payload.CurrentPassword) {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("current password is invalid"))
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("current password is invalid"))
 		return
 	}
 
-	user, err := h.store.UpdateUserProfile(userID, payload)
+	user, err := h.store.UpdateUserProfile(r.Context(), userID, payload)
 	if err != nil {
 		if isUniqueViolation(err) {
-			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("user with email %s already exists", payload.Email))
+			writeEmailTaken(w, r, payload.Email)
 			return
 		}
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -178,41 +183,40 @@ func (h *Handler) HandleUpdateProfile(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) HandleUpdatePassword(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserIDFromContext(r.Context())
 	if userID <= 0 {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
+		utils.WriteError(w, r, http.StatusForbidden, fmt.Errorf("permission denied"))
 		return
 	}
 
 	var payload types.UpdatePasswordPayload
 	if err := utils.ParseJSON(r, &payload); err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	if err := utils.Validate.Struct(payload); err != nil {
-		errors := err.(validator.ValidationErrors)
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		utils.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	user, err := h.store.GetUserByID(userID)
+	user, err := h.store.GetUserByID(r.Context(), userID)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	if !auth.ComparePasswords(user.Password, payload.CurrentPassword) {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("current password is invalid"))
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("current password is invalid"))
 		return
 	}
 
 	hashedPassword, err := auth.HashPassword(payload.NewPassword)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	if err := h.store.UpdateUserPassword(userID, hashedPassword); err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+	if err := h.store.UpdateUserPassword(r.Context(), userID, hashedPassword); err != nil {
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -232,13 +236,13 @@ func (h *Handler) HandleUpdatePassword(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) HandleListUsers(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserIDFromContext(r.Context())
 	if userID <= 0 {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
+		utils.WriteError(w, r, http.StatusForbidden, fmt.Errorf("permission denied"))
 		return
 	}
 
-	users, err := h.store.ListUsers()
+	users, err := h.store.ListUsers(r.Context())
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -248,13 +252,13 @@ func (h *Handler) HandleListUsers(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) HandleGetUsers(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserIDFromContext(r.Context())
 	if userID <= 0 {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
+		utils.WriteError(w, r, http.StatusForbidden, fmt.Errorf("permission denied"))
 		return
 	}
 
-	users, err := h.store.ListUsers()
+	users, err := h.store.ListUsers(r.Context())
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -264,19 +268,19 @@ func (h *Handler) HandleGetUsers(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) HandleGetUserByID(w http.ResponseWriter, r *http.Request) {
 	requesterID := auth.GetUserIDFromContext(r.Context())
 	if requesterID <= 0 {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
+		utils.WriteError(w, r, http.StatusForbidden, fmt.Errorf("permission denied"))
 		return
 	}
 
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil || id <= 0 {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid user id"))
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("invalid user id"))
 		return
 	}
 
-	user, err := h.store.GetUserByID(id)
+	user, err := h.store.GetUserByID(r.Context(), id)
 	if err != nil {
-		utils.WriteError(w, http.StatusNotFound, err)
+		utils.WriteError(w, r, http.StatusNotFound, err)
 		return
 	}
 
@@ -286,34 +290,33 @@ func (h *Handler) HandleGetUserByID(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) HandleGetUserByName(w http.ResponseWriter, r *http.Request) {
 	requesterID := auth.GetUserIDFromContext(r.Context())
 	if requesterID <= 0 {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
+		utils.WriteError(w, r, http.StatusForbidden, fmt.Errorf("permission denied"))
 		return
 	}
 
 	name := strings.TrimSpace(chi.URLParam(r, "name"))
 	if name == "" {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid user name"))
+		utils.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("invalid user name"))
 		return
 	}
 
-	user, err := h.store.GetUserByName(name)
+	user, err := h.store.GetUserByName(r.Context(), name)
 	if err != nil {
-		utils.WriteError(w, http.StatusNotFound, err)
+		utils.WriteError(w, r, http.StatusNotFound, err)
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusOK, toUserProfile(user))
 }
 
-func (h *Handler) registerUser(payload types.RegisterUserPayload) error {
+func (h *Handler) registerUser(ctx context.Context, payload types.RegisterUserPayload) error {
 	if err := utils.Validate.Struct(payload); err != nil {
-		errors := err.(validator.ValidationErrors)
-		return fmt.Errorf("Invalid payload %v", errors)
+		return err
 	}
 
-	_, err := h.store.GetUserByEmail(payload.Email)
+	_, err := h.store.GetUserByEmail(ctx, payload.Email)
 	if err == nil {
-		return fmt.Errorf("User with email %s already exists", payload.Email)
+		return errEmailTaken
 	}
 
 	hashedPassword, err := auth.HashPassword(payload.Password)
@@ -321,7 +324,7 @@ func (h *Handler) registerUser(payload types.RegisterUserPayload) error {
 		return err
 	}
 
-	err = h.store.CreateUser(types.User{
+	err = h.store.CreateUser(ctx, types.User{
 		FirstName: payload.FirstName,
 		LastName:  payload.LastName,
 		Name:      fmt.Sprintf("%s %s", payload.FirstName, payload.LastName),
@@ -336,13 +339,12 @@ func (h *Handler) registerUser(payload types.RegisterUserPayload) error {
 	return nil
 }
 
-func (h *Handler) createSessionToken(payload types.LoginUserPayload) (string, error) {
+func (h *Handler) createSessionToken(ctx context.Context, payload types.LoginUserPayload) (string, error) {
 	if err := utils.Validate.Struct(payload); err != nil {
-		errors := err.(validator.ValidationErrors)
-		return "", fmt.Errorf("Invalid payload %v", errors)
+		return "", err
 	}
 
-	u, err := h.store.GetUserByEmail(payload.Email)
+	u, err := h.store.GetUserByEmail(ctx, payload.Email)
 	if err != nil {
 		return "", fmt.Errorf("User not found, invalid email or password")
 	}
@@ -371,6 +373,17 @@ func toUserProfile(user *types.User) types.UserProfile {
 	}
 }
 
+var errEmailTaken = errors.New("user with this email already exists")
+
+func writeEmailTaken(w http.ResponseWriter, r *http.Request, email string) {
+	utils.WriteProblem(w, r, types.ErrorResponse{
+		Status: http.StatusConflict,
+		Code:   utils.CodeDuplicate,
+		Detail: utils.T(r, "user with email %s already exists", email),
+		Errors: []types.FieldError{{Field: "email", Code: utils.CodeDuplicate, Message: utils.T(r, "is already taken")}},
+	})
+}
+
 func isUniqueViolation(err error) bool {
 	var pgErr *pgconn.PgError
 	if errors.As(err, &pgErr) {
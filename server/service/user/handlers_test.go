@@ -255,7 +255,7 @@ func (m *mockUserStore) ensure() {
 	}
 }
 
-func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+func (m *mockUserStore) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
 	m.ensure()
 	u, ok := m.userByEmail[email]
 	if !ok {
@@ -264,7 +264,7 @@ func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
 	return u, nil
 }
 
-func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+func (m *mockUserStore) GetUserByID(ctx context.Context, id int) (*types.User, error) {
 	m.ensure()
 	u, ok := m.userByID[id]
 	if !ok {
@@ -273,7 +273,7 @@ func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
 	return u, nil
 }
 
-func (m *mockUserStore) GetUserByName(name string) (*types.User, error) {
+func (m *mockUserStore) GetUserByName(ctx context.Context, name string) (*types.User, error) {
 	m.ensure()
 	for _, u := range m.userByID {
 		if u.Name == name || (u.FirstName+" "+u.LastName) == name {
@@ -283,7 +283,7 @@ func (m *mockUserStore) GetUserByName(name string) (*types.User, error) {
 	return nil, fmt.Errorf("User doesn't exist")
 }
 
-func (m *mockUserStore) CreateUser(user types.User) error {
+func (m *mockUserStore) CreateUser(ctx context.Context, user types.User) error {
 	m.ensure()
 	if user.ID == 0 {
 		user.ID = len(m.userByID) + 1
@@ -294,7 +294,7 @@ func (m *mockUserStore) CreateUser(user types.User) error {
 	return nil
 }
 
-func (m *mockUserStore) UpdateUserProfile(userID int, payload types.UpdateProfilePayload) (*types.User, error) {
+func (m *mockUserStore) UpdateUserProfile(ctx context.Context, userID int, payload types.UpdateProfilePayload) (*types.User, error) {
 	m.ensure()
 	u, ok := m.userByID[userID]
 	if !ok {
@@ -311,7 +311,7 @@ func (m *mockUserStore) UpdateUserProfile(userID int, payload types.UpdateProfil
 	return u, nil
 }
 
-func (m *mockUserStore) UpdateUserPassword(userID int, hashedPassword string) error {
+func (m *mockUserStore) UpdateUserPassword(ctx context.Context, userID int, hashedPassword string) error {
 	m.ensure()
 	u, ok := m.userByID[userID]
 	if !ok {
@@ -321,7 +321,7 @@ func (m *mockUserStore) UpdateUserPassword(userID int, hashedPassword string) er
 	return nil
 }
 
-func (m *mockUserStore) ListUsers() ([]*types.UserLookup, error) {
+func (m *mockUserStore) ListUsers(ctx context.Context) ([]*types.UserLookup, error) {
 	m.ensure()
 	users := make([]*types.UserLookup, 0, len(m.userByID))
 	for _, u := range m.userByID {
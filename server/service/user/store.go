@@ -1,30 +1,32 @@
 package user
 
 import (
+	"VyacheslavKuchumov/test-backend/service/tracing"
 	"VyacheslavKuchumov/test-backend/types"
+	"context"
 	"database/sql"
 	"fmt"
 )
 
 type Store struct {
-	db      *sql.DB
+	db      *tracing.DB
 	initErr error
 }
 
 func NewStore(db *sql.DB) *Store {
-	store := &Store{db: db}
+	store := &Store{db: tracing.WrapDB(db, "user")}
 	if db != nil {
-		store.initErr = store.ensureUserSchema()
+		store.initErr = store.ensureUserSchema(context.Background())
 	}
 	return store
 }
 
-func (s *Store) GetUserByEmail(email string) (*types.User, error) {
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
 	if err := s.ensureReady(); err != nil {
 		return nil, err
 	}
 
-	row := s.db.QueryRow(
+	row := s.db.QueryRowContext(ctx,
 		"SELECT id, first_name, last_name, name, email, password, role, created_at FROM users WHERE email = $1",
 		email,
 	)
@@ -38,12 +40,12 @@ func (s *Store) GetUserByEmail(email string) (*types.User, error) {
 	return u, nil
 }
 
-func (s *Store) GetUserByID(id int) (*types.User, error) {
+func (s *Store) GetUserByID(ctx context.Context, id int) (*types.User, error) {
 	if err := s.ensureReady(); err != nil {
 		return nil, err
 	}
 
-	row := s.db.QueryRow(
+	row := s.db.QueryRowContext(ctx,
 		"SELECT id, first_name, last_name, name, email, password, role, created_at FROM users WHERE id = $1",
 		id,
 	)
@@ -57,12 +59,12 @@ func (s *Store) GetUserByID(id int) (*types.User, error) {
 	return u, nil
 }
 
-func (s *Store) CreateUser(user types.User) error {
+func (s *Store) CreateUser(ctx context.Context, user types.User) error {
 	if err := s.ensureReady(); err != nil {
 		return err
 	}
 
-	_, err := s.db.Exec(
+	_, err := s.db.ExecContext(ctx,
 		"INSERT INTO users (first_name, last_name, name, email, password, role) VALUES ($1, $2, $3, $4, $5, $6)",
 		user.FirstName, user.LastName, user.Name, user.Email, user.Password, user.Role,
 	)
@@ -73,12 +75,12 @@ func (s *Store) CreateUser(user types.User) error {
 	return nil
 }
 
-func (s *Store) UpdateUserProfile(userID int, payload types.UpdateProfilePayload) (*types.User, error) {
+func (s *Store) UpdateUserProfile(ctx context.Context, userID int, payload types.UpdateProfilePayload) (*types.User, error) {
 	if err := s.ensureReady(); err != nil {
 		return nil, err
 	}
 
-	row := s.db.QueryRow(
+	row := s.db.QueryRowContext(ctx,
 		`UPDATE users
 		 SET first_name = CAST($1 AS VARCHAR(255)),
 		     last_name = CAST($2 AS VARCHAR(255)),
@@ -102,12 +104,12 @@ func (s *Store) UpdateUserProfile(userID int, payload types.UpdateProfilePayload
 	return u, nil
 }
 
-func (s *Store) UpdateUserPassword(userID int, hashedPassword string) error {
+func (s *Store) UpdateUserPassword(ctx context.Context, userID int, hashedPassword string) error {
 	if err := s.ensureReady(); err != nil {
 		return err
 	}
 
-	result, err := s.db.Exec(
+	result, err := s.db.ExecContext(ctx,
 		`UPDATE users
 		 SET password = $1
 		 WHERE id = $2`,
@@ -128,12 +130,12 @@ func (s *Store) UpdateUserPassword(userID int, hashedPassword string) error {
 	return nil
 }
 
-func (s *Store) ListUsers() ([]*types.UserLookup, error) {
+func (s *Store) ListUsers(ctx context.Context) ([]*types.UserLookup, error) {
 	if err := s.ensureReady(); err != nil {
 		return nil, err
 	}
 
-	rows, err := s.db.Query(
+	rows, err := s.db.QueryContext(ctx,
 		`SELECT id, name
 		 FROM users
 		 ORDER BY name, id`,
@@ -154,12 +156,12 @@ func (s *Store) ListUsers() ([]*types.UserLookup, error) {
 	return users, rows.Err()
 }
 
-func (s *Store) GetUserByName(name string) (*types.User, error) {
+func (s *Store) GetUserByName(ctx context.Context, name string) (*types.User, error) {
 	if err := s.ensureReady(); err != nil {
 		return nil, err
 	}
 
-	row := s.db.QueryRow(
+	row := s.db.QueryRowContext(ctx,
 		"SELECT id, first_name, last_name, name, email, password, role, created_at FROM users WHERE name = $1",
 		name,
 	)
@@ -206,7 +208,7 @@ func (s *Store) ensureReady() error {
 	return nil
 }
 
-func (s *Store) ensureUserSchema() error {
+func (s *Store) ensureUserSchema(ctx context.Context) error {
 	statements := []string{
 		`ALTER TABLE users
 			ADD COLUMN IF NOT EXISTS first_name VARCHAR(255),
@@ -242,7 +244,7 @@ func (s *Store) ensureUserSchema() error {
 	}
 
 	for _, statement := range statements {
-		if _, err := s.db.Exec(statement); err != nil {
+		if _, err := s.db.ExecContext(ctx, statement); err != nil {
 			return err
 		}
 	}
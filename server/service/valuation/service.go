@@ -0,0 +1,228 @@
+package valuation
+
+import (
+	"VyacheslavKuchumov/test-backend/service/crmhttp"
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultNearingMonths is how close to the end of its useful life an item
+// is flagged when nearing_months is not given.
+const defaultNearingMonths = 6
+
+type Store interface {
+	GetValuationReport(ctx context.Context, query types.ValuationQuery) (*types.ValuationReport, error)
+	ListValuedItems(ctx context.Context, query types.ValuationQuery) ([]*types.ValuedItem, error)
+	SearchValuedItems(ctx context.Context, query types.ValuationQuery, listQuery types.ListQuery) ([]*types.ValuedItem, int, error)
+}
+
+type Service struct {
+	store Store
+	now   func() time.Time
+}
+
+func NewService(store Store) *Service {
+	return &Service{store: store, now: time.Now}
+}
+
+func RegisterRoutes(r chi.Router, service *Service) {
+	r.Route("/valuation", func(rt chi.Router) {
+		rt.Get("/", service.HandleGetReport)
+		rt.Get("/items", service.HandleGetItems)
+	})
+}
+
+func (s *Service) HandleGetReport(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	query, ok := s.parseQuery(w, r)
+	if !ok {
+		return
+	}
+	report, err := s.store.GetValuationReport(r.Context(), query)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	if !crmhttp.WantsCSV(r) {
+		utils.WriteJSON(w, http.StatusOK, report)
+		return
+	}
+
+	rows := make([][]string, 0, len(report.Groups)+1)
+	for _, group := range report.Groups {
+		rows = append(rows, groupRow(strconv.Itoa(group.ID), group))
+	}
+	rows = append(rows, groupRow("", report.Total))
+	crmhttp.WriteCSV(w, "valuation-"+report.GroupBy+"-"+report.AsOf+".csv", []string{
+		report.GroupBy + "_id",
+		report.GroupBy + "_name",
+		"items",
+		"cost",
+		"book_value",
+		"nearing_end_of_life",
+		"end_of_life_reached",
+		"unvalued",
+	}, rows)
+}
+
+func (s *Service) HandleGetItems(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	query, ok := s.parseQuery(w, r)
+	if !ok {
+		return
+	}
+	if !crmhttp.WantsCSV(r) {
+		listQuery := crmhttp.ParseListQuery(r)
+		items, total, err := s.store.SearchValuedItems(r.Context(), query, listQuery)
+		if err != nil {
+			crmhttp.WriteStoreError(w, r, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(items, listQuery.Page, listQuery.PerPage, total))
+		return
+	}
+
+	items, err := s.store.ListValuedItems(r.Context(), query)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	rows := make([][]string, 0, len(items))
+	for _, item := range items {
+		rows = append(rows, itemRow(item))
+	}
+	crmhttp.WriteCSV(w, "valuation-items-"+query.AsOf.Format(time.DateOnly)+".csv", []string{
+		"equipment_id",
+		"equipment_name",
+		"serial_number",
+		"equipment_set_name",
+		"set_type_name",
+		"warehouse_name",
+		"date_of_purchase",
+		"method",
+		"useful_life_months",
+		"cost_of_purchase",
+		"age_months",
+		"remaining_months",
+		"depreciated",
+		"book_value",
+		"end_of_life",
+	}, rows)
+}
+
+// parseQuery reads as_of (a date, today by default), group_by,
+// nearing_months, the warehouse_id, set_type_id and equipment_set_id filters
+// and end_of_life. Invalid values are answered with 400 and ok is false.
+func (s *Service) parseQuery(w http.ResponseWriter, r *http.Request) (types.ValuationQuery, bool) {
+	values := r.URL.Query()
+	query := types.ValuationQuery{
+		AsOf:          s.now(),
+		GroupBy:       types.ValuationByWarehouse,
+		NearingMonths: defaultNearingMonths,
+		EndOfLife:     values.Get("end_of_life"),
+	}
+
+	if raw := values.Get("as_of"); raw != "" {
+		asOf, err := time.Parse(time.DateOnly, raw)
+		if err != nil {
+			utils.WriteError(w, r, http.StatusBadRequest, utils.Errorf("as_of must be a date such as %s", s.now().Format(time.DateOnly)))
+			return query, false
+		}
+		query.AsOf = asOf
+	}
+
+	switch groupBy := values.Get("group_by"); groupBy {
+	case "":
+	case types.ValuationByWarehouse, types.ValuationBySetType, types.ValuationByEquipmentSet:
+		query.GroupBy = groupBy
+	default:
+		utils.WriteError(w, r, http.StatusBadRequest, utils.Errorf("unknown valuation grouping %q", groupBy))
+		return query, false
+	}
+
+	switch query.EndOfLife {
+	case "", types.EndOfLifeNearing, types.EndOfLifeReached, types.EndOfLifeFlagged:
+	default:
+		utils.WriteError(w, r, http.StatusBadRequest, utils.Errorf("unknown end of life filter %q", query.EndOfLife))
+		return query, false
+	}
+
+	for _, param := range []struct {
+		name   string
+		target *int
+	}{
+		{"nearing_months", &query.NearingMonths},
+		{"warehouse_id", &query.WarehouseID},
+		{"set_type_id", &query.SetTypeID},
+		{"equipment_set_id", &query.EquipmentSetID},
+	} {
+		raw := values.Get(param.name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			utils.WriteError(w, r, http.StatusBadRequest, utils.Errorf("%s must be a non-negative integer", param.name))
+			return query, false
+		}
+		*param.target = value
+	}
+	return query, true
+}
+
+func groupRow(id string, group *types.ValuationGroup) []string {
+	return []string{
+		id,
+		group.Name,
+		strconv.Itoa(group.Items),
+		money(group.Cost),
+		money(group.BookValue),
+		strconv.Itoa(group.NearingEndOfLife),
+		strconv.Itoa(group.EndOfLifeReached),
+		strconv.Itoa(group.Unvalued),
+	}
+}
+
+// itemRow leaves the values of unvalued items empty rather than zero.
+func itemRow(item *types.ValuedItem) []string {
+	row := []string{
+		strconv.Itoa(item.EquipmentID),
+		item.EquipmentName,
+		item.SerialNumber,
+		item.EquipmentSetName,
+		item.SetTypeName,
+		item.WarehouseName,
+		item.DateOfPurchase,
+		item.Method,
+		strconv.Itoa(item.UsefulLifeMonths),
+	}
+	if item.Unvalued {
+		return append(row, "", "", "", "", "", "")
+	}
+	remaining := ""
+	if item.RemainingMonths != nil {
+		remaining = strconv.Itoa(*item.RemainingMonths)
+	}
+	return append(row,
+		money(item.CostOfPurchase),
+		strconv.Itoa(item.AgeMonths),
+		remaining,
+		money(item.Depreciated),
+		money(item.BookValue),
+		item.EndOfLife,
+	)
+}
+
+func money(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
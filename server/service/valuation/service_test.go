@@ -0,0 +1,101 @@
+package valuation
+
+import (
+	"VyacheslavKuchumov/test-backend/service/auth"
+	"VyacheslavKuchumov/test-backend/types"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type mockStore struct {
+	query types.ValuationQuery
+}
+
+func (s *mockStore) GetValuationReport(ctx context.Context, query types.ValuationQuery) (*types.ValuationReport, error) {
+	s.query = query
+	return &types.ValuationReport{
+		AsOf:    query.AsOf.Format(time.DateOnly),
+		GroupBy: query.GroupBy,
+		Groups:  []*types.ValuationGroup{{ID: 2, Name: "Склад", Items: 1, Cost: 1000, BookValue: 550}},
+		Total:   &types.ValuationGroup{Name: "total", Items: 1, Cost: 1000, BookValue: 550},
+	}, nil
+}
+
+func (s *mockStore) ListValuedItems(ctx context.Context, query types.ValuationQuery) ([]*types.ValuedItem, error) {
+	s.query = query
+	return []*types.ValuedItem{
+		{EquipmentID: 1, EquipmentName: "Camera", CostOfPurchase: 1000, BookValue: 550, Depreciated: 450},
+		{EquipmentID: 2, EquipmentName: "Tripod", Unvalued: true},
+	}, nil
+}
+
+func (s *mockStore) SearchValuedItems(ctx context.Context, query types.ValuationQuery, listQuery types.ListQuery) ([]*types.ValuedItem, int, error) {
+	s.query = query
+	return []*types.ValuedItem{}, 0, nil
+}
+
+func serve(store Store, target string) *httptest.ResponseRecorder {
+	service := NewService(store)
+	service.now = func() time.Time { return time.Date(2026, 5, 4, 12, 0, 0, 0, time.UTC) }
+	r := chi.NewRouter()
+	RegisterRoutes(r, service)
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserKey, 1))
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestReportDefaults(t *testing.T) {
+	store := &mockStore{}
+
+	if rr := serve(store, "/valuation"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if store.query.GroupBy != types.ValuationByWarehouse || store.query.AsOf.Format(time.DateOnly) != "2026-05-04" || store.query.NearingMonths != defaultNearingMonths {
+		t.Fatalf("expected today by warehouse, got %+v", store.query)
+	}
+}
+
+func TestRejectsInvalidQuery(t *testing.T) {
+	for _, target := range []string{
+		"/valuation?as_of=04.05.2026",
+		"/valuation?group_by=project",
+		"/valuation/items?end_of_life=soon",
+		"/valuation/items?warehouse_id=-1",
+	} {
+		if rr := serve(&mockStore{}, target); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", target, rr.Code)
+		}
+	}
+}
+
+func TestReportAsCSV(t *testing.T) {
+	store := &mockStore{}
+
+	rr := serve(store, "/valuation?as_of=2025-12-31&group_by=set_type&format=csv")
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("expected a CSV report, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if disposition := rr.Header().Get("Content-Disposition"); !strings.Contains(disposition, "valuation-set_type-2025-12-31.csv") {
+		t.Fatalf("unexpected disposition %q", disposition)
+	}
+	lines := strings.Split(strings.TrimSpace(strings.TrimPrefix(rr.Body.String(), "\ufeff")), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "set_type_id,set_type_name,") || lines[2] != ",total,1,1000.00,550.00,0,0,0" {
+		t.Fatalf("unexpected CSV %q", lines)
+	}
+}
+
+func TestItemsAsCSVLeaveUnvaluedEmpty(t *testing.T) {
+	rr := serve(&mockStore{}, "/valuation/items?format=csv&end_of_life=flagged")
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[2], ",,,,,,") {
+		t.Fatalf("expected empty values for the unvalued item, got %q", lines)
+	}
+}
@@ -0,0 +1,132 @@
+package warehouse
+
+import (
+	"VyacheslavKuchumov/test-backend/service/crmhttp"
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"net/http"
+)
+
+func (s *Service) HandleGetContents(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	contents, err := s.store.GetWarehouseContents(r.Context(), id)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, contents)
+}
+
+func (s *Service) HandleGetLocations(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	items, err := s.store.ListLocations(r.Context(), id)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, items)
+}
+
+func (s *Service) HandleGetLocationByID(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	locationID, ok := crmhttp.MustPathID(w, r, "locationID")
+	if !ok {
+		return
+	}
+	item, err := s.store.GetLocationByID(r.Context(), id, locationID)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	crmhttp.WriteVersioned(w, item.Version, item)
+}
+
+func (s *Service) HandleCreateLocation(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var payload types.LocationPayload
+	if !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	items, err := s.store.CreateLocation(r.Context(), id, payload)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, items)
+}
+
+func (s *Service) HandleUpdateLocation(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	locationID, ok := crmhttp.MustPathID(w, r, "locationID")
+	if !ok {
+		return
+	}
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	var payload types.LocationPayload
+	if !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	items, err := s.store.UpdateLocation(r.Context(), id, locationID, version, payload)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	crmhttp.WriteUpdated(w, items, locationID, func(item *types.Location) (int, int) { return item.LocationID, item.Version })
+}
+
+func (s *Service) HandleDeleteLocation(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	locationID, ok := crmhttp.MustPathID(w, r, "locationID")
+	if !ok {
+		return
+	}
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	items, err := s.store.DeleteLocation(r.Context(), id, locationID, version)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, items)
+}
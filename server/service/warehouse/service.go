@@ -4,17 +4,25 @@ import (
 	"VyacheslavKuchumov/test-backend/service/crmhttp"
 	"VyacheslavKuchumov/test-backend/types"
 	"VyacheslavKuchumov/test-backend/utils"
+	"context"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type Store interface {
-	SearchWarehouses(query types.ListQuery) ([]*types.Warehouse, int, error)
-	ListWarehouses() ([]*types.Warehouse, error)
-	CreateWarehouse(payload types.WarehousePayload) ([]*types.Warehouse, error)
-	UpdateWarehouse(id int, payload types.WarehousePayload) ([]*types.Warehouse, error)
-	DeleteWarehouse(id int) ([]*types.Warehouse, error)
+	SearchWarehouses(ctx context.Context, query types.ListQuery) ([]*types.Warehouse, int, error)
+	ListWarehouses(ctx context.Context) ([]*types.Warehouse, error)
+	CreateWarehouse(ctx context.Context, payload types.WarehousePayload) ([]*types.Warehouse, error)
+	UpdateWarehouse(ctx context.Context, id, version int, payload types.WarehousePayload) ([]*types.Warehouse, error)
+	DeleteWarehouse(ctx context.Context, id, version int) ([]*types.Warehouse, error)
+	MergeWarehouse(ctx context.Context, id, version, targetID int) ([]*types.Warehouse, error)
+	GetWarehouseContents(ctx context.Context, warehouseID int) (*types.WarehouseContents, error)
+	ListLocations(ctx context.Context, warehouseID int) ([]*types.Location, error)
+	GetLocationByID(ctx context.Context, warehouseID, id int) (*types.Location, error)
+	CreateLocation(ctx context.Context, warehouseID int, payload types.LocationPayload) ([]*types.Location, error)
+	UpdateLocation(ctx context.Context, warehouseID, id, version int, payload types.LocationPayload) ([]*types.Location, error)
+	DeleteLocation(ctx context.Context, warehouseID, id, version int) ([]*types.Location, error)
 }
 
 type Service struct {
@@ -31,6 +39,13 @@ func RegisterRoutes(r chi.Router, service *Service) {
 		rt.Post("/", service.HandleCreate)
 		rt.Put("/{id}", service.HandleUpdate)
 		rt.Delete("/{id}", service.HandleDelete)
+		rt.Post("/{id}/merge", service.HandleMerge)
+		rt.Get("/{id}/contents", service.HandleGetContents)
+		rt.Get("/{id}/locations", service.HandleGetLocations)
+		rt.Get("/{id}/locations/{locationID}", service.HandleGetLocationByID)
+		rt.Post("/{id}/locations", service.HandleCreateLocation)
+		rt.Put("/{id}/locations/{locationID}", service.HandleUpdateLocation)
+		rt.Delete("/{id}/locations/{locationID}", service.HandleDeleteLocation)
 	})
 }
 
@@ -39,9 +54,9 @@ func (s *Service) HandleGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	query := crmhttp.ParseListQuery(r)
-	items, total, err := s.store.SearchWarehouses(query)
+	items, total, err := s.store.SearchWarehouses(r.Context(), query)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(items, query.Page, query.PerPage, total))
@@ -55,9 +70,9 @@ func (s *Service) HandleCreate(w http.ResponseWriter, r *http.Request) {
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	items, err := s.store.CreateWarehouse(payload)
+	items, err := s.store.CreateWarehouse(r.Context(), payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusCreated, items)
@@ -71,16 +86,20 @@ func (s *Service) HandleUpdate(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
 	var payload types.WarehousePayload
 	if !crmhttp.ParseAndValidate(w, r, &payload) {
 		return
 	}
-	items, err := s.store.UpdateWarehouse(id, payload)
+	items, err := s.store.UpdateWarehouse(r.Context(), id, version, payload)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
-	utils.WriteJSON(w, http.StatusOK, items)
+	crmhttp.WriteUpdated(w, items, id, func(item *types.Warehouse) (int, int) { return item.WarehouseID, item.Version })
 }
 
 func (s *Service) HandleDelete(w http.ResponseWriter, r *http.Request) {
@@ -91,9 +110,37 @@ func (s *Service) HandleDelete(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
-	items, err := s.store.DeleteWarehouse(id)
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	items, err := s.store.DeleteWarehouse(r.Context(), id, version)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, items)
+}
+
+func (s *Service) HandleMerge(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	version, ok := crmhttp.IfMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	var payload types.MergePayload
+	if !crmhttp.ParseAndValidate(w, r, &payload) {
+		return
+	}
+	items, err := s.store.MergeWarehouse(r.Context(), id, version, payload.TargetID)
 	if err != nil {
-		crmhttp.WriteStoreError(w, err)
+		crmhttp.WriteStoreError(w, r, err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, items)
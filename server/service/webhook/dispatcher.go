@@ -0,0 +1,203 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Ultralive-Signature"
+	TimestampHeader = "X-Ultralive-Timestamp"
+	EventHeader     = "X-Ultralive-Event"
+	DeliveryHeader  = "X-Ultralive-Delivery"
+)
+
+const (
+	baseRetryDelay = 30 * time.Second
+	maxRetryDelay  = 6 * time.Hour
+	claimBatchSize = 20
+	maxErrorLength = 1000
+)
+
+// Delivery is a claimed queue entry together with the endpoint it goes to.
+type Delivery struct {
+	ID        int
+	EventID   string
+	EventType string
+	Payload   []byte
+	Attempts  int
+	URL       string
+	Secret    string
+}
+
+type AttemptResult struct {
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+}
+
+type DeliveryQueue interface {
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*Delivery, error)
+	RecordAttempt(ctx context.Context, delivery *Delivery, attempt AttemptResult, status string, nextAttemptAt time.Time) error
+}
+
+type DispatcherConfig struct {
+	PollInterval time.Duration
+	Timeout      time.Duration
+	MaxAttempts  int
+	// AllowPrivateTargets lets deliveries connect to loopback and internal
+	// addresses, which are refused otherwise.
+	AllowPrivateTargets bool
+}
+
+type Dispatcher struct {
+	queue  DeliveryQueue
+	client *http.Client
+	cfg    DispatcherConfig
+}
+
+func NewDispatcher(queue DeliveryQueue, cfg DispatcherConfig) *Dispatcher {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Connect directly so the dialer sees, and can refuse, the real target.
+	transport.Proxy = nil
+	transport.DialContext = newTargetDialer(cfg.AllowPrivateTargets).DialContext
+	return &Dispatcher{
+		queue:  queue,
+		client: &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		cfg:    cfg,
+	}
+}
+
+// Run polls the queue until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.dispatchDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) dispatchDue(ctx context.Context) {
+	// The lease has to outlive one HTTP attempt, otherwise another worker
+	// could claim the same delivery while it is still in flight.
+	deliveries, err := d.queue.ClaimDue(ctx, claimBatchSize, 2*d.cfg.Timeout+time.Minute)
+	if err != nil {
+		slog.Error("failed to claim webhook deliveries", "error", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		d.deliver(ctx, delivery)
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery *Delivery) {
+	attempt := d.send(ctx, delivery)
+
+	status := StatusPending
+	nextAttemptAt := time.Now().Add(retryDelay(delivery.Attempts + 1))
+	switch {
+	case attempt.Error == "":
+		status = StatusSucceeded
+		nextAttemptAt = time.Now()
+	case delivery.Attempts+1 >= d.cfg.MaxAttempts:
+		status = StatusFailed
+		nextAttemptAt = time.Now()
+	}
+
+	// Record the attempt even when shutdown cancelled ctx meanwhile, so the
+	// delivery is not sent again once its lease expires.
+	if err := d.queue.RecordAttempt(context.WithoutCancel(ctx), delivery, attempt, status, nextAttemptAt); err != nil {
+		slog.Error("failed to record webhook delivery attempt", "delivery_id", delivery.ID, "error", err)
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *Delivery) AttemptResult {
+	started := time.Now()
+	timestamp := started.Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return AttemptResult{Error: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ultralive-webhooks/1")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.ID))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	result := AttemptResult{Duration: time.Since(started)}
+	if err != nil {
+		result.Error = truncate(err.Error())
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorLength))
+		result.Error = truncate(fmt.Sprintf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(body)))
+	}
+	return result
+}
+
+// Sign returns the signature header value for a payload: an HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the endpoint secret. Receivers should
+// recompute it and reject stale timestamps to prevent replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryDelay doubles the wait after every failed attempt, capped at
+// maxRetryDelay.
+func retryDelay(attempt int) time.Duration {
+	delay := baseRetryDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= maxRetryDelay {
+			return maxRetryDelay
+		}
+	}
+	return delay
+}
+
+func truncate(message string) string {
+	if len(message) <= maxErrorLength {
+		return message
+	}
+	return message[:maxErrorLength]
+}
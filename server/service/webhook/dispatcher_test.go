@@ -0,0 +1,135 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordedAttempt struct {
+	attempt AttemptResult
+	status  string
+	next    time.Time
+}
+
+type mockQueue struct {
+	due      []*Delivery
+	attempts []recordedAttempt
+}
+
+func (q *mockQueue) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*Delivery, error) {
+	due := q.due
+	q.due = nil
+	return due, nil
+}
+
+func (q *mockQueue) RecordAttempt(ctx context.Context, delivery *Delivery, attempt AttemptResult, status string, nextAttemptAt time.Time) error {
+	q.attempts = append(q.attempts, recordedAttempt{attempt: attempt, status: status, next: nextAttemptAt})
+	return nil
+}
+
+func TestDispatcherSignsAndDeliversPayload(t *testing.T) {
+	payload := []byte(`{"id":"evt","type":"project.created"}`)
+	secret := "whsec_test_secret_value"
+
+	var gotSignature string
+	var gotTimestamp string
+	var gotBody []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get(SignatureHeader)
+		gotTimestamp = r.Header.Get(TimestampHeader)
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	queue := &mockQueue{due: []*Delivery{{ID: 1, EventType: "project.created", Payload: payload, URL: receiver.URL, Secret: secret}}}
+	// The test receiver listens on loopback.
+	NewDispatcher(queue, DispatcherConfig{AllowPrivateTargets: true}).dispatchDue(context.Background())
+
+	if len(queue.attempts) != 1 || queue.attempts[0].status != StatusSucceeded {
+		t.Fatalf("expected one succeeded attempt, got %+v", queue.attempts)
+	}
+	if string(gotBody) != string(payload) {
+		t.Fatalf("unexpected body %s", gotBody)
+	}
+	timestamp, err := strconv.ParseInt(gotTimestamp, 10, 64)
+	if err != nil {
+		t.Fatalf("invalid timestamp header %q", gotTimestamp)
+	}
+	if gotSignature != Sign(secret, timestamp, payload) {
+		t.Fatalf("signature mismatch: %s", gotSignature)
+	}
+}
+
+func TestDispatcherRetriesAndGivesUp(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	dispatcher := NewDispatcher(&mockQueue{}, DispatcherConfig{MaxAttempts: 3, AllowPrivateTargets: true})
+
+	testCases := []struct {
+		name           string
+		previousTries  int
+		expectedStatus string
+	}{
+		{name: "first failure is retried", previousTries: 0, expectedStatus: StatusPending},
+		{name: "last attempt fails delivery", previousTries: 2, expectedStatus: StatusFailed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			queue := &mockQueue{due: []*Delivery{{ID: 2, Payload: []byte(`{}`), URL: receiver.URL, Attempts: tc.previousTries}}}
+			dispatcher.queue = queue
+			dispatcher.dispatchDue(context.Background())
+
+			if len(queue.attempts) != 1 {
+				t.Fatalf("expected one attempt, got %d", len(queue.attempts))
+			}
+			got := queue.attempts[0]
+			if got.status != tc.expectedStatus {
+				t.Fatalf("expected status %s, got %s", tc.expectedStatus, got.status)
+			}
+			if got.attempt.StatusCode != http.StatusInternalServerError || got.attempt.Error == "" {
+				t.Fatalf("expected recorded 500 error, got %+v", got.attempt)
+			}
+		})
+	}
+}
+
+func TestDispatcherRefusesPrivateTargets(t *testing.T) {
+	called := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer receiver.Close()
+
+	queue := &mockQueue{due: []*Delivery{{ID: 3, Payload: []byte(`{}`), URL: receiver.URL}}}
+	NewDispatcher(queue, DispatcherConfig{}).dispatchDue(context.Background())
+
+	if called {
+		t.Fatalf("expected no request to reach the loopback receiver")
+	}
+	if len(queue.attempts) != 1 || !strings.Contains(queue.attempts[0].attempt.Error, ErrPrivateTarget.Error()) {
+		t.Fatalf("expected the attempt to fail as a private target, got %+v", queue.attempts)
+	}
+}
+
+func TestRetryDelayBacksOffExponentially(t *testing.T) {
+	if retryDelay(1) != baseRetryDelay {
+		t.Fatalf("expected base delay for first retry, got %s", retryDelay(1))
+	}
+	if retryDelay(3) != 4*baseRetryDelay {
+		t.Fatalf("expected 4x base delay for third retry, got %s", retryDelay(3))
+	}
+	if retryDelay(50) != maxRetryDelay {
+		t.Fatalf("expected delay to be capped, got %s", retryDelay(50))
+	}
+}
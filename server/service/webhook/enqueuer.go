@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"VyacheslavKuchumov/test-backend/service/events"
+	"context"
+	"log/slog"
+)
+
+// eventBufferSize is how many published events may wait for the delivery
+// queue insert before further events are dropped.
+const eventBufferSize = 1024
+
+type EventQueue interface {
+	Enqueue(ctx context.Context, event events.Event) (int, error)
+}
+
+// Enqueuer feeds published events into the delivery queue on its own
+// goroutine, so a publishing request never waits for the insert.
+type Enqueuer struct {
+	queue  EventQueue
+	events chan events.Event
+}
+
+func NewEnqueuer(queue EventQueue) *Enqueuer {
+	return &Enqueuer{queue: queue, events: make(chan events.Event, eventBufferSize)}
+}
+
+// HandleEvent is the events.Bus subscriber. It never blocks the publisher:
+// when the buffer is full the event is dropped and logged.
+func (e *Enqueuer) HandleEvent(event events.Event) {
+	select {
+	case e.events <- event:
+	default:
+		slog.Error("webhook event buffer is full, dropping event", "event_id", event.ID, "event_type", event.Type)
+	}
+}
+
+// Run enqueues buffered events until ctx is cancelled, then enqueues what is
+// still buffered so events of requests finished before shutdown are kept.
+func (e *Enqueuer) Run(ctx context.Context) {
+	for {
+		select {
+		case event := <-e.events:
+			e.enqueue(ctx, event)
+		case <-ctx.Done():
+			e.drain(ctx)
+			return
+		}
+	}
+}
+
+func (e *Enqueuer) drain(ctx context.Context) {
+	for {
+		select {
+		case event := <-e.events:
+			e.enqueue(ctx, event)
+		default:
+			return
+		}
+	}
+}
+
+func (e *Enqueuer) enqueue(ctx context.Context, event events.Event) {
+	// The insert has to finish even when shutdown cancels ctx meanwhile;
+	// the event would be lost otherwise.
+	if _, err := e.queue.Enqueue(context.WithoutCancel(ctx), event); err != nil {
+		slog.Error("failed to enqueue webhook deliveries", "event_id", event.ID, "event_type", event.Type, "error", err)
+	}
+}
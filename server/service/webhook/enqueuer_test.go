@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"VyacheslavKuchumov/test-backend/service/events"
+	"context"
+	"sync"
+	"testing"
+)
+
+type blockingEventQueue struct {
+	mu      sync.Mutex
+	release chan struct{}
+	events  []events.Event
+}
+
+func (q *blockingEventQueue) Enqueue(ctx context.Context, event events.Event) (int, error) {
+	<-q.release
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.events = append(q.events, event)
+	return 1, nil
+}
+
+func TestEnqueuerDoesNotBlockPublishersAndDrainsOnShutdown(t *testing.T) {
+	queue := &blockingEventQueue{release: make(chan struct{})}
+	enqueuer := NewEnqueuer(queue)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		enqueuer.Run(ctx)
+		close(done)
+	}()
+
+	// The queue insert is stuck, yet publishing returns at once; events
+	// beyond the buffer are dropped.
+	for i := 0; i < eventBufferSize+10; i++ {
+		enqueuer.HandleEvent(events.New(events.ProjectCreated))
+	}
+
+	cancel()
+	close(queue.release)
+	<-done
+
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	// One event may have been taken by Run before the buffer filled up.
+	if len(queue.events) < eventBufferSize || len(queue.events) > eventBufferSize+1 {
+		t.Fatalf("expected the buffered events enqueued on shutdown, got %d", len(queue.events))
+	}
+}
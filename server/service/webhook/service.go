@@ -0,0 +1,200 @@
+package webhook
+
+import (
+	"VyacheslavKuchumov/test-backend/service/crmhttp"
+	"VyacheslavKuchumov/test-backend/service/events"
+	"VyacheslavKuchumov/test-backend/types"
+	"VyacheslavKuchumov/test-backend/utils"
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type EndpointStore interface {
+	ListEndpoints(ctx context.Context) ([]*types.WebhookEndpoint, error)
+	GetEndpointByID(ctx context.Context, id int) (*types.WebhookEndpoint, error)
+	CreateEndpoint(ctx context.Context, payload types.WebhookEndpointPayload) (*types.WebhookEndpoint, error)
+	UpdateEndpoint(ctx context.Context, id int, payload types.WebhookEndpointPayload) (*types.WebhookEndpoint, error)
+	DeleteEndpoint(ctx context.Context, id int) error
+	SearchDeliveries(ctx context.Context, endpointID int, query types.ListQuery) ([]*types.WebhookDelivery, int, error)
+	GetDeliveryByID(ctx context.Context, id int) (*types.WebhookDelivery, error)
+	Redeliver(ctx context.Context, id int) (*types.WebhookDelivery, error)
+}
+
+type Service struct {
+	store        EndpointStore
+	allowPrivate bool
+}
+
+// NewService serves the endpoint API. Unless allowPrivateTargets is set,
+// endpoints pointing at localhost or internal IP addresses are refused.
+func NewService(store EndpointStore, allowPrivateTargets bool) *Service {
+	return &Service{store: store, allowPrivate: allowPrivateTargets}
+}
+
+func RegisterRoutes(r chi.Router, service *Service) {
+	r.Route("/webhooks", func(rt chi.Router) {
+		rt.Get("/", service.HandleGet)
+		rt.Get("/event_types", service.HandleGetEventTypes)
+		rt.Get("/{id}", service.HandleGetByID)
+		rt.Post("/", service.HandleCreate)
+		rt.Put("/{id}", service.HandleUpdate)
+		rt.Delete("/{id}", service.HandleDelete)
+		rt.Get("/{id}/deliveries", service.HandleGetDeliveries)
+		rt.Get("/deliveries/{id}", service.HandleGetDelivery)
+		rt.Post("/deliveries/{id}/redeliver", service.HandleRedeliver)
+	})
+}
+
+func (s *Service) HandleGet(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	items, err := s.store.ListEndpoints(r.Context())
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, items)
+}
+
+func (s *Service) HandleGetEventTypes(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, events.Types)
+}
+
+func (s *Service) HandleGetByID(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	item, err := s.store.GetEndpointByID(r.Context(), id)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, item)
+}
+
+func (s *Service) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	var payload types.WebhookEndpointPayload
+	if !s.parseEndpointPayload(w, r, &payload) {
+		return
+	}
+	item, err := s.store.CreateEndpoint(r.Context(), payload)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, item)
+}
+
+func (s *Service) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var payload types.WebhookEndpointPayload
+	if !s.parseEndpointPayload(w, r, &payload) {
+		return
+	}
+	item, err := s.store.UpdateEndpoint(r.Context(), id, payload)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, item)
+}
+
+func (s *Service) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteEndpoint(r.Context(), id); err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) HandleGetDeliveries(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	query := crmhttp.ParseListQuery(r)
+	items, total, err := s.store.SearchDeliveries(r.Context(), id, query)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, types.NewPaginatedResponse(items, query.Page, query.PerPage, total))
+}
+
+func (s *Service) HandleGetDelivery(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	item, err := s.store.GetDeliveryByID(r.Context(), id)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, item)
+}
+
+func (s *Service) HandleRedeliver(w http.ResponseWriter, r *http.Request) {
+	if !crmhttp.RequireAuth(w, r) {
+		return
+	}
+	id, ok := crmhttp.MustPathID(w, r, "id")
+	if !ok {
+		return
+	}
+	item, err := s.store.Redeliver(r.Context(), id)
+	if err != nil {
+		crmhttp.WriteStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusAccepted, item)
+}
+
+func (s *Service) parseEndpointPayload(w http.ResponseWriter, r *http.Request, payload *types.WebhookEndpointPayload) bool {
+	if !crmhttp.ParseAndValidate(w, r, payload) {
+		return false
+	}
+	if err := validateTargetURL(payload.URL, s.allowPrivate); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, err)
+		return false
+	}
+	for _, eventType := range payload.EventTypes {
+		if !events.IsKnownType(eventType) {
+			utils.WriteError(w, r, http.StatusBadRequest, utils.Errorf("unknown event type %q", eventType))
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,425 @@
+package webhook
+
+import (
+	"VyacheslavKuchumov/test-backend/service/events"
+	"VyacheslavKuchumov/test-backend/service/tracing"
+	"VyacheslavKuchumov/test-backend/service/tracker"
+	"VyacheslavKuchumov/test-backend/types"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+type Store struct {
+	db *tracing.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: tracing.WrapDB(db, "webhook")}
+}
+
+func (s *Store) ListEndpoints(ctx context.Context) ([]*types.WebhookEndpoint, error) {
+	return s.listEndpoints(ctx, "")
+}
+
+func (s *Store) GetEndpointByID(ctx context.Context, id int) (*types.WebhookEndpoint, error) {
+	items, err := s.listEndpoints(ctx, "WHERE endpoint_id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, tracker.ErrNotFound
+	}
+	return items[0], nil
+}
+
+// CreateEndpoint stores a new endpoint and returns it including its signing
+// secret. A secret is generated when the payload does not provide one; it is
+// not returned by any other read.
+func (s *Store) CreateEndpoint(ctx context.Context, payload types.WebhookEndpointPayload) (*types.WebhookEndpoint, error) {
+	secret := payload.Secret
+	if secret == "" {
+		secret = generateSecret()
+	}
+	eventTypes, err := json.Marshal(normalizeEventTypes(payload.EventTypes))
+	if err != nil {
+		return nil, err
+	}
+	active := payload.Active == nil || *payload.Active
+
+	var id int
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO webhook_endpoints (url, secret, event_types, description, active)
+		VALUES ($1, $2, ARRAY(SELECT jsonb_array_elements_text($3::JSONB)), NULLIF($4, ''), $5)
+		RETURNING endpoint_id
+	`, payload.URL, secret, string(eventTypes), payload.Description, active).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, err := s.GetEndpointByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	endpoint.Secret = secret
+	return endpoint, nil
+}
+
+// UpdateEndpoint replaces the endpoint settings. The secret is only rotated
+// when the payload carries a new one.
+func (s *Store) UpdateEndpoint(ctx context.Context, id int, payload types.WebhookEndpointPayload) (*types.WebhookEndpoint, error) {
+	eventTypes, err := json.Marshal(normalizeEventTypes(payload.EventTypes))
+	if err != nil {
+		return nil, err
+	}
+	active := payload.Active == nil || *payload.Active
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE webhook_endpoints
+		SET url = $1,
+			secret = COALESCE(NULLIF($2, ''), secret),
+			event_types = ARRAY(SELECT jsonb_array_elements_text($3::JSONB)),
+			description = NULLIF($4, ''),
+			active = $5
+		WHERE endpoint_id = $6
+	`, payload.URL, payload.Secret, string(eventTypes), payload.Description, active, id)
+	if err != nil {
+		return nil, err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, tracker.ErrNotFound
+	}
+	return s.GetEndpointByID(ctx, id)
+}
+
+func (s *Store) DeleteEndpoint(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM webhook_endpoints WHERE endpoint_id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return tracker.ErrNotFound
+	}
+	return nil
+}
+
+// Enqueue creates one pending delivery per active endpoint subscribed to the
+// event type. Endpoints without event filters receive every event.
+func (s *Store) Enqueue(ctx context.Context, event events.Event) (int, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload)
+		SELECT endpoint_id, $1, $2, $3::JSONB
+		FROM webhook_endpoints
+		WHERE active IS TRUE
+		  AND (CARDINALITY(event_types) = 0 OR $2 = ANY(event_types))
+	`, event.ID, string(event.Type), string(payload))
+	if err != nil {
+		return 0, err
+	}
+	rows, _ := result.RowsAffected()
+	return int(rows), nil
+}
+
+func (s *Store) SearchDeliveries(ctx context.Context, endpointID int, query types.ListQuery) ([]*types.WebhookDelivery, int, error) {
+	if _, err := s.GetEndpointByID(ctx, endpointID); err != nil {
+		return nil, 0, err
+	}
+
+	search := strings.ToLower(strings.TrimSpace(query.Search))
+	page := query.Page
+	if page < 1 {
+		page = 1
+	}
+	perPage := query.PerPage
+	if perPage <= 0 {
+		perPage = 10
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM webhook_deliveries
+		WHERE endpoint_id = $1
+		  AND ($2 = '' OR LOWER(event_type) LIKE '%' || $2 || '%' OR status = $2 OR event_id = $2)
+	`, endpointID, search).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	items, err := s.listDeliveries(ctx, `
+		WHERE d.endpoint_id = $1
+		  AND ($2 = '' OR LOWER(d.event_type) LIKE '%' || $2 || '%' OR d.status = $2 OR d.event_id = $2)
+		ORDER BY d.created_at DESC, d.delivery_id DESC
+		LIMIT $3 OFFSET $4
+	`, endpointID, search, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+func (s *Store) GetDeliveryByID(ctx context.Context, id int) (*types.WebhookDelivery, error) {
+	items, err := s.listDeliveries(ctx, "WHERE d.delivery_id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, tracker.ErrNotFound
+	}
+	delivery := items[0]
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT attempt_id, attempted_at, response_status, COALESCE(error, ''), duration_ms
+		FROM webhook_delivery_attempts
+		WHERE delivery_id = $1
+		ORDER BY attempted_at ASC, attempt_id ASC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	delivery.AttemptLog = make([]*types.WebhookDeliveryAttempt, 0)
+	for rows.Next() {
+		attempt := new(types.WebhookDeliveryAttempt)
+		var status sql.NullInt64
+		if err := rows.Scan(&attempt.AttemptID, &attempt.AttemptedAt, &status, &attempt.Error, &attempt.DurationMS); err != nil {
+			return nil, err
+		}
+		if status.Valid {
+			code := int(status.Int64)
+			attempt.ResponseStatus = &code
+		}
+		delivery.AttemptLog = append(delivery.AttemptLog, attempt)
+	}
+	return delivery, rows.Err()
+}
+
+// Redeliver queues a fresh delivery of the same event to the same endpoint,
+// keeping the original delivery and its attempt log untouched.
+func (s *Store) Redeliver(ctx context.Context, id int) (*types.WebhookDelivery, error) {
+	var newID int
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload)
+		SELECT endpoint_id, event_id, event_type, payload
+		FROM webhook_deliveries
+		WHERE delivery_id = $1
+		RETURNING delivery_id
+	`, id).Scan(&newID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, tracker.ErrNotFound
+		}
+		return nil, err
+	}
+	return s.GetDeliveryByID(ctx, newID)
+}
+
+// ClaimDue locks up to limit due deliveries for this worker by pushing their
+// next attempt time past lease, so concurrent dispatchers skip them.
+func (s *Store) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*Delivery, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + $2::INT * INTERVAL '1 second'
+		FROM webhook_endpoints we
+		WHERE we.endpoint_id = d.endpoint_id
+		  AND d.delivery_id IN (
+			SELECT delivery_id
+			FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		  )
+		RETURNING d.delivery_id, d.event_id, d.event_type, d.payload::TEXT, d.attempts, we.url, we.secret
+	`, limit, int(lease.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*Delivery, 0)
+	for rows.Next() {
+		item := new(Delivery)
+		var payload string
+		if err := rows.Scan(&item.ID, &item.EventID, &item.EventType, &payload, &item.Attempts, &item.URL, &item.Secret); err != nil {
+			return nil, err
+		}
+		item.Payload = []byte(payload)
+		result = append(result, item)
+	}
+	return result, rows.Err()
+}
+
+// RecordAttempt appends the attempt to the delivery log and moves the
+// delivery to status, scheduling the next try at nextAttemptAt.
+func (s *Store) RecordAttempt(ctx context.Context, delivery *Delivery, attempt AttemptResult, status string, nextAttemptAt time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var responseStatus any
+	if attempt.StatusCode > 0 {
+		responseStatus = attempt.StatusCode
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO webhook_delivery_attempts (delivery_id, response_status, error, duration_ms)
+		VALUES ($1, $2, NULLIF($3, ''), $4)
+	`, delivery.ID, responseStatus, attempt.Error, int(attempt.Duration.Milliseconds())); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1,
+			status = $2,
+			next_attempt_at = $3,
+			last_attempt_at = NOW(),
+			last_response_status = $4,
+			last_error = NULLIF($5, '')
+		WHERE delivery_id = $1
+	`, delivery.ID, status, nextAttemptAt, responseStatus, attempt.Error); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) listEndpoints(ctx context.Context, extraWhere string, args ...any) ([]*types.WebhookEndpoint, error) {
+	query := `
+		SELECT endpoint_id, url, TO_JSON(event_types)::TEXT, COALESCE(description, ''), active, created_at
+		FROM webhook_endpoints
+	`
+	if strings.TrimSpace(extraWhere) != "" {
+		query += " " + extraWhere
+	}
+	query += " ORDER BY endpoint_id ASC"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*types.WebhookEndpoint, 0)
+	for rows.Next() {
+		item := new(types.WebhookEndpoint)
+		var eventTypes string
+		if err := rows.Scan(&item.EndpointID, &item.URL, &eventTypes, &item.Description, &item.Active, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(eventTypes), &item.EventTypes); err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, rows.Err()
+}
+
+func (s *Store) listDeliveries(ctx context.Context, extraWhere string, args ...any) ([]*types.WebhookDelivery, error) {
+	query := `
+		SELECT
+			d.delivery_id,
+			d.endpoint_id,
+			d.event_id,
+			d.event_type,
+			d.payload::TEXT,
+			d.status,
+			d.attempts,
+			d.next_attempt_at,
+			d.last_attempt_at,
+			d.last_response_status,
+			COALESCE(d.last_error, ''),
+			d.created_at
+		FROM webhook_deliveries d
+	`
+	if strings.TrimSpace(extraWhere) != "" {
+		query += " " + extraWhere
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*types.WebhookDelivery, 0)
+	for rows.Next() {
+		item := new(types.WebhookDelivery)
+		var payload string
+		var nextAttemptAt sql.NullTime
+		var lastAttemptAt sql.NullTime
+		var lastResponseStatus sql.NullInt64
+		if err := rows.Scan(
+			&item.DeliveryID,
+			&item.EndpointID,
+			&item.EventID,
+			&item.EventType,
+			&payload,
+			&item.Status,
+			&item.Attempts,
+			&nextAttemptAt,
+			&lastAttemptAt,
+			&lastResponseStatus,
+			&item.LastError,
+			&item.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		item.Payload = json.RawMessage(payload)
+		if nextAttemptAt.Valid && item.Status == StatusPending {
+			item.NextAttemptAt = &nextAttemptAt.Time
+		}
+		if lastAttemptAt.Valid {
+			item.LastAttemptAt = &lastAttemptAt.Time
+		}
+		if lastResponseStatus.Valid {
+			code := int(lastResponseStatus.Int64)
+			item.LastResponseStatus = &code
+		}
+		result = append(result, item)
+	}
+	return result, rows.Err()
+}
+
+func normalizeEventTypes(eventTypes []string) []string {
+	seen := map[string]struct{}{}
+	result := make([]string, 0, len(eventTypes))
+	for _, eventType := range eventTypes {
+		eventType = strings.TrimSpace(eventType)
+		if eventType == "" {
+			continue
+		}
+		if _, ok := seen[eventType]; ok {
+			continue
+		}
+		seen[eventType] = struct{}{}
+		result = append(result, eventType)
+	}
+	return result
+}
+
+func generateSecret() string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return "whsec_" + hex.EncodeToString(buf)
+}
@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"VyacheslavKuchumov/test-backend/utils"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// ErrPrivateTarget is returned when a webhook would be sent to a loopback,
+// private, link-local or otherwise internal address. Any signed-in user can
+// register endpoints, so without this check the dispatcher could be used to
+// reach services that are only exposed to the server's network.
+var ErrPrivateTarget = errors.New("webhook target is not a public address")
+
+// validateTargetURL checks an endpoint URL before it is stored: only http and
+// https without credentials are accepted, and unless allowPrivate is set the
+// host must not be localhost or an internal IP literal. Host names are
+// resolved when delivering, where the dialer applies the same rule.
+func validateTargetURL(raw string, allowPrivate bool) error {
+	target, err := url.Parse(raw)
+	if err != nil {
+		return utils.Errorf("url must be an absolute http or https URL")
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return utils.Errorf("url must be an absolute http or https URL")
+	}
+	if target.User != nil {
+		return utils.Errorf("url must not contain credentials")
+	}
+	host := strings.TrimSuffix(strings.ToLower(target.Hostname()), ".")
+	if host == "" {
+		return utils.Errorf("url must be an absolute http or https URL")
+	}
+	if allowPrivate {
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return utils.Errorf("%w: %s", ErrPrivateTarget, host)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && isPrivateAddr(addr) {
+		return utils.Errorf("%w: %s", ErrPrivateTarget, host)
+	}
+	return nil
+}
+
+// isPrivateAddr reports addresses a webhook must not reach: loopback,
+// private and shared ranges, link-local (which includes cloud metadata
+// services), multicast and unspecified addresses.
+func isPrivateAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() ||
+		sharedAddressSpace.Contains(addr)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which
+// netip does not count as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// refusePrivateTargets is a net.Dialer Control function that refuses
+// connections to internal addresses after DNS resolution, so a public host
+// name that resolves to one cannot bypass validateTargetURL.
+func refusePrivateTargets(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrPrivateTarget, address)
+	}
+	if isPrivateAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrPrivateTarget, addrPort.Addr())
+	}
+	return nil
+}
+
+// newTargetDialer returns the dialer the dispatcher connects with.
+func newTargetDialer(allowPrivate bool) *net.Dialer {
+	dialer := &net.Dialer{}
+	if !allowPrivate {
+		dialer.Control = refusePrivateTargets
+	}
+	return dialer
+}
@@ -1,7 +1,31 @@
 package types
 
+// ErrorResponse is an RFC 7807 problem details object, served as
+// application/problem+json. Code is stable and meant for clients to branch on;
+// Detail is for people.
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Type       string       `json:"type"`
+	Title      string       `json:"title"`
+	Status     int          `json:"status"`
+	Detail     string       `json:"detail,omitempty"`
+	Code       string       `json:"code"`
+	Errors     []FieldError `json:"errors,omitempty"`
+	Dependents []Dependent  `json:"dependents,omitempty"`
+	RequestID  string       `json:"request_id,omitempty"`
+}
+
+// Dependent counts the rows of one kind that keep a record from being
+// deleted.
+type Dependent struct {
+	Kind  string `json:"kind"`
+	Count int    `json:"count"`
+}
+
+// FieldError points a validation or constraint failure at one payload field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
 type LoginResponse struct {
@@ -1,6 +1,10 @@
 package types
 
-import "time"
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
 
 type ListQuery struct {
 	Search  string
@@ -9,13 +13,13 @@ type ListQuery struct {
 }
 
 type UserStore interface {
-	GetUserByEmail(email string) (*User, error)
-	GetUserByID(id int) (*User, error)
-	GetUserByName(name string) (*User, error)
-	CreateUser(User) error
-	UpdateUserProfile(userID int, payload UpdateProfilePayload) (*User, error)
-	UpdateUserPassword(userID int, hashedPassword string) error
-	ListUsers() ([]*UserLookup, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUserByID(ctx context.Context, id int) (*User, error)
+	GetUserByName(ctx context.Context, name string) (*User, error)
+	CreateUser(ctx context.Context, user User) error
+	UpdateUserProfile(ctx context.Context, userID int, payload UpdateProfilePayload) (*User, error)
+	UpdateUserPassword(ctx context.Context, userID int, hashedPassword string) error
+	ListUsers(ctx context.Context) ([]*UserLookup, error)
 }
 
 type User struct {
@@ -69,18 +73,58 @@ type LoginUserPayload struct {
 }
 
 type SetType struct {
-	SetTypeID   int    `json:"set_type_id"`
-	SetTypeName string `json:"set_type_name"`
-}
-
+	SetTypeID    int                   `json:"set_type_id"`
+	SetTypeName  string                `json:"set_type_name"`
+	Attributes   []AttributeDefinition `json:"attributes,omitempty"`
+	Depreciation *Depreciation         `json:"depreciation,omitempty"`
+	Version      int                   `json:"version,omitempty"`
+}
+
+const (
+	DepreciationNone             = "none"
+	DepreciationStraightLine     = "straight_line"
+	DepreciationDecliningBalance = "declining_balance"
+)
+
+// Depreciation is how equipment of a set type loses value from its purchase
+// cost down to SalvagePercent of it over UsefulLifeMonths.
+type Depreciation struct {
+	Method           string  `json:"method" validate:"required,oneof=none straight_line declining_balance"`
+	UsefulLifeMonths int     `json:"useful_life_months,omitempty" validate:"required_unless=Method none,omitempty,min=1,max=1200"`
+	SalvagePercent   float64 `json:"salvage_percent,omitempty" validate:"min=0,max=100"`
+}
+
+const (
+	AttributeTypeString  = "string"
+	AttributeTypeNumber  = "number"
+	AttributeTypeEnum    = "enum"
+	AttributeTypeBoolean = "boolean"
+)
+
+// AttributeDefinition describes one custom attribute of the equipment of a
+// set type. Options lists the allowed values of an enum attribute.
+type AttributeDefinition struct {
+	Key      string   `json:"key" validate:"required,max=64"`
+	Label    string   `json:"label,omitempty" validate:"max=255"`
+	Type     string   `json:"type" validate:"required,oneof=string number enum boolean"`
+	Options  []string `json:"options,omitempty" validate:"max=100,dive,required,max=255"`
+	Required bool     `json:"required,omitempty"`
+}
+
+// SetTypePayload leaves the attribute schema as it is when Attributes is
+// omitted; an empty list removes it. Depreciation works the same way, with
+// method none to remove it.
 type SetTypePayload struct {
-	SetTypeName string `json:"set_type_name" validate:"required,min=1,max=255"`
+	SetTypeName  string                `json:"set_type_name" validate:"required,min=1,max=255"`
+	Attributes   []AttributeDefinition `json:"attributes" validate:"max=50,dive"`
+	Depreciation *Depreciation         `json:"depreciation"`
 }
 
 type ProjectType struct {
 	ProjectTypeID   int    `json:"project_type_id"`
 	ProjectTypeName string `json:"project_type_name"`
 	NeaktorID       string `json:"neaktor_id,omitempty"`
+	Version         int    `json:"version,omitempty"`
 }
 
 type ProjectTypePayload struct {
@@ -92,6 +136,7 @@ type Warehouse struct {
 	WarehouseID     int    `json:"warehouse_id"`
 	WarehouseName   string `json:"warehouse_name"`
 	WarehouseAdress string `json:"warehouse_adress,omitempty"`
+	Version         int    `json:"version,omitempty"`
 }
 
 type WarehousePayload struct {
@@ -99,18 +144,83 @@ type WarehousePayload struct {
 	WarehouseAdress string `json:"warehouse_adress"`
 }
 
+// Kinds of storage locations, outermost first. A location can only sit
+// inside a location of an earlier kind.
+const (
+	LocationKindZone  = "zone"
+	LocationKindRack  = "rack"
+	LocationKindShelf = "shelf"
+	LocationKindBin   = "bin"
+)
+
+var LocationKinds = []string{LocationKindZone, LocationKindRack, LocationKindShelf, LocationKindBin}
+
+// Location is a place inside a warehouse. Path spells it out with its
+// parents, outermost first, e.g. "zone A / rack 2 / shelf 3".
+type Location struct {
+	LocationID   int    `json:"location_id"`
+	WarehouseID  int    `json:"warehouse_id"`
+	ParentID     int    `json:"parent_id,omitempty"`
+	Kind         string `json:"kind"`
+	LocationName string `json:"location_name"`
+	Path         string `json:"path"`
+	Version      int    `json:"version,omitempty"`
+}
+
+type LocationPayload struct {
+	ParentID     int    `json:"parent_id" validate:"omitempty,min=1"`
+	Kind         string `json:"kind" validate:"required,oneof=zone rack shelf bin"`
+	LocationName string `json:"location_name" validate:"required,min=1,max=255"`
+}
+
+type LocationContents struct {
+	Location  *Location    `json:"location"`
+	Equipment []*Equipment `json:"equipment"`
+}
+
+// WarehouseContents lists the equipment stored in a warehouse by location.
+// Unplaced holds the items that have no location.
+type WarehouseContents struct {
+	Warehouse *Warehouse          `json:"warehouse"`
+	Locations []*LocationContents `json:"locations"`
+	Unplaced  []*Equipment        `json:"unplaced"`
+}
+
 type EquipmentSet struct {
 	EquipmentSetID   int      `json:"equipment_set_id"`
 	EquipmentSetName string   `json:"equipment_set_name"`
 	Description      string   `json:"description,omitempty"`
 	SetTypeID        int      `json:"set_type_id"`
 	Type             *SetType `json:"type,omitempty"`
+	Version          int      `json:"version,omitempty"`
 }
 
 type EquipmentSetPayload struct {
 	EquipmentSetName string `json:"equipment_set_name" validate:"required,min=1,max=255"`
 	Description      string `json:"description"`
-	SetTypeName      string `json:"set_type_name" validate:"required,min=1,max=255"`
+	SetTypeID        int    `json:"set_type_id" validate:"omitempty,min=1"`
+	SetTypeName      string `json:"set_type_name" validate:"required_without=SetTypeID,max=255"`
+}
+
+// Kinds of records that can be in the trash.
+const (
+	TrashKindEquipment = "equipment"
+	TrashKindProject   = "project"
+	TrashKindDraft     = "draft"
+)
+
+// TrashItem is a soft-deleted equipment item, project or draft.
+type TrashItem struct {
+	Kind      string    `json:"kind"`
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// MergePayload names the record that takes over the dependents of a merged
+// one.
+type MergePayload struct {
+	TargetID int `json:"target_id" validate:"required,min=1"`
 }
 
 type EquipmentSetStorageSummary struct {
@@ -126,25 +236,235 @@ type Equipment struct {
 	Description      string        `json:"description,omitempty"`
 	SerialNumber     string        `json:"serial_number"`
 	StorageID        int           `json:"storage_id"`
-	CurrentStorage   string        `json:"current_storage,omitempty"`
+	LocationID       int           `json:"location_id,omitempty"`
 	NeedsMaintenance bool          `json:"needs_maintenance"`
 	DateOfPurchase   string        `json:"date_of_purchase,omitempty"`
 	CostOfPurchase   *float64      `json:"cost_of_purchase,omitempty"`
+	Attributes       Attributes    `json:"attributes,omitempty"`
 	EquipmentSet     *EquipmentSet `json:"equipment_set,omitempty"`
 	Storage          *Warehouse    `json:"storage,omitempty"`
+	Location         *Location     `json:"location,omitempty"`
 	Projects         []*Project    `json:"projects,omitempty"`
+	Version          int           `json:"version,omitempty"`
 }
 
 type EquipmentPayload struct {
 	EquipmentName    string   `json:"equipment_name" validate:"required,min=1,max=255"`
 	SerialNumber     string   `json:"serial_number" validate:"required,min=1,max=255"`
-	EquipmentSetName string   `json:"equipment_set_name" validate:"required,min=1,max=255"`
+	EquipmentSetID   int      `json:"equipment_set_id" validate:"omitempty,min=1"`
+	EquipmentSetName string   `json:"equipment_set_name" validate:"required_without=EquipmentSetID,max=255"`
 	Description      string   `json:"description"`
-	WarehouseName    string   `json:"warehouse_name" validate:"required,min=1,max=255"`
-	CurrentStorage   string   `json:"current_storage_name"`
+	WarehouseID      int      `json:"warehouse_id" validate:"omitempty,min=1"`
+	WarehouseName    string   `json:"warehouse_name" validate:"required_without=WarehouseID,max=255"`
+	LocationID       int      `json:"location_id" validate:"omitempty,min=1"`
 	NeedsMaintenance bool     `json:"needs_maintenance"`
 	DateOfPurchase   string   `json:"date_of_purchase"`
 	CostOfPurchase   *float64 `json:"cost_of_purchase"`
+	// Attributes are checked against the schema of the set type; when
+	// omitted on update the stored values are kept.
+	Attributes Attributes `json:"attributes"`
+}
+
+// EquipmentFilter narrows equipment lists to items whose attributes have
+// the given values, keyed by attribute key.
+type EquipmentFilter struct {
+	Attributes map[string]string
+}
+
+// Attributes holds custom attribute values by key: strings, numbers
+// (float64) or booleans.
+type Attributes map[string]any
+
+// SerialDuplicate is a group of live equipment whose serial numbers are the
+// same once case and whitespace are ignored. SerialKey is that normalized
+// form.
+type SerialDuplicate struct {
+	SerialKey string       `json:"serial_key"`
+	Equipment []*Equipment `json:"equipment"`
+}
+
+// Ways to group a valuation report.
+const (
+	ValuationByWarehouse    = "warehouse"
+	ValuationBySetType      = "set_type"
+	ValuationByEquipmentSet = "equipment_set"
+)
+
+// End of life states of valued equipment. EndOfLifeFlagged only filters:
+// it matches both.
+const (
+	EndOfLifeNearing = "nearing"
+	EndOfLifeReached = "reached"
+	EndOfLifeFlagged = "flagged"
+)
+
+// ValuationQuery selects what a valuation report covers. Items whose
+// remaining useful life is NearingMonths or less count as nearing their end
+// of life. The ID filters and EndOfLife only apply to item listings.
+type ValuationQuery struct {
+	AsOf           time.Time
+	GroupBy        string
+	NearingMonths  int
+	WarehouseID    int
+	SetTypeID      int
+	EquipmentSetID int
+	EndOfLife      string
+}
+
+// ValuedItem is the book value of one piece of equipment on a date.
+// RemainingMonths is nil for set types without depreciation. Unvalued items
+// lack a purchase date or cost and carry no values.
+type ValuedItem struct {
+	EquipmentID      int     `json:"equipment_id"`
+	EquipmentName    string  `json:"equipment_name"`
+	SerialNumber     string  `json:"serial_number"`
+	EquipmentSetID   int     `json:"equipment_set_id"`
+	EquipmentSetName string  `json:"equipment_set_name"`
+	SetTypeID        int     `json:"set_type_id"`
+	SetTypeName      string  `json:"set_type_name"`
+	WarehouseID      int     `json:"warehouse_id"`
+	WarehouseName    string  `json:"warehouse_name"`
+	DateOfPurchase   string  `json:"date_of_purchase"`
+	CostOfPurchase   float64 `json:"cost_of_purchase"`
+	Method           string  `json:"method"`
+	UsefulLifeMonths int     `json:"useful_life_months,omitempty"`
+	AgeMonths        int     `json:"age_months"`
+	RemainingMonths  *int    `json:"remaining_months,omitempty"`
+	Depreciated      float64 `json:"depreciated"`
+	BookValue        float64 `json:"book_value"`
+	EndOfLife        string  `json:"end_of_life,omitempty"`
+	Unvalued         bool    `json:"unvalued,omitempty"`
+}
+
+// ValuationGroup sums the valued items of one warehouse, set type or
+// equipment set.
+type ValuationGroup struct {
+	ID               int     `json:"id"`
+	Name             string  `json:"name"`
+	Items            int     `json:"items"`
+	Cost             float64 `json:"cost"`
+	BookValue        float64 `json:"book_value"`
+	NearingEndOfLife int     `json:"nearing_end_of_life"`
+	EndOfLifeReached int     `json:"end_of_life_reached"`
+	Unvalued         int     `json:"unvalued"`
+}
+
+// ValuationReport values live equipment as of a date. Items without a
+// purchase date or cost count as unvalued and stay out of the sums.
+type ValuationReport struct {
+	AsOf    string            `json:"as_of"`
+	GroupBy string            `json:"group_by"`
+	Groups  []*ValuationGroup `json:"groups"`
+	Total   *ValuationGroup   `json:"total"`
+}
+
+// EquipmentMovement records one change of the warehouse an item is stored
+// in. A nil warehouse was deleted since, or, for From, means the item was
+// created there.
+type EquipmentMovement struct {
+	MovementID    int        `json:"movement_id"`
+	EquipmentID   int        `json:"equipment_id"`
+	FromWarehouse *Warehouse `json:"from_warehouse,omitempty"`
+	ToWarehouse   *Warehouse `json:"to_warehouse,omitempty"`
+	MovedBy       *UserShort `json:"moved_by,omitempty"`
+	Reason        string     `json:"reason,omitempty"`
+	TransferID    *int       `json:"transfer_id,omitempty"`
+	StocktakeID   *int       `json:"stocktake_id,omitempty"`
+	MovedAt       time.Time  `json:"moved_at"`
+}
+
+type EquipmentMovePayload struct {
+	EquipmentIDs  []int  `json:"equipment_ids" validate:"required,min=1,max=500,dive,min=1"`
+	WarehouseID   int    `json:"warehouse_id" validate:"omitempty,min=1"`
+	WarehouseName string `json:"warehouse_name" validate:"required_without=WarehouseID,max=255"`
+	Reason        string `json:"reason" validate:"max=1000"`
+}
+
+// Statuses of a warehouse transfer. Pending and in transit transfers are
+// open and hold on to their equipment.
+const (
+	TransferStatusPending   = "pending"
+	TransferStatusInTransit = "in_transit"
+	TransferStatusReceived  = "received"
+	TransferStatusCancelled = "cancelled"
+)
+
+type WarehouseTransfer struct {
+	TransferID    int          `json:"transfer_id"`
+	FromWarehouse *Warehouse   `json:"from_warehouse,omitempty"`
+	ToWarehouse   *Warehouse   `json:"to_warehouse,omitempty"`
+	Status        string       `json:"status"`
+	Reason        string       `json:"reason,omitempty"`
+	RequestedBy   *UserShort   `json:"requested_by,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+	ShippedAt     *time.Time   `json:"shipped_at,omitempty"`
+	ReceivedAt    *time.Time   `json:"received_at,omitempty"`
+	CancelledAt   *time.Time   `json:"cancelled_at,omitempty"`
+	Equipment     []*Equipment `json:"equipment"`
+	Version       int          `json:"version,omitempty"`
+}
+
+type WarehouseTransferPayload struct {
+	FromWarehouseID int    `json:"from_warehouse_id" validate:"required,min=1"`
+	ToWarehouseID   int    `json:"to_warehouse_id" validate:"required,min=1,nefield=FromWarehouseID"`
+	EquipmentIDs    []int  `json:"equipment_ids" validate:"required,min=1,max=500,dive,min=1"`
+	Reason          string `json:"reason" validate:"max=1000"`
+}
+
+// Statuses of a stocktake. Scans are taken while it is open; a closed
+// stocktake can have its corrections applied once.
+const (
+	StocktakeStatusOpen    = "open"
+	StocktakeStatusClosed  = "closed"
+	StocktakeStatusApplied = "applied"
+)
+
+type Stocktake struct {
+	StocktakeID  int        `json:"stocktake_id"`
+	Warehouse    *Warehouse `json:"warehouse,omitempty"`
+	Status       string     `json:"status"`
+	StartedBy    *UserShort `json:"started_by,omitempty"`
+	StartedAt    time.Time  `json:"started_at"`
+	ClosedAt     *time.Time `json:"closed_at,omitempty"`
+	AppliedAt    *time.Time `json:"applied_at,omitempty"`
+	ScannedCount int        `json:"scanned_count"`
+	Version      int        `json:"version,omitempty"`
+}
+
+type StocktakePayload struct {
+	WarehouseID int `json:"warehouse_id" validate:"required,min=1"`
+}
+
+type StocktakeScanPayload struct {
+	EquipmentIDs  []int    `json:"equipment_ids" validate:"max=500,dive,min=1"`
+	SerialNumbers []string `json:"serial_numbers" validate:"required_without=EquipmentIDs,max=500,dive,required,max=255"`
+}
+
+// StocktakeApplyPayload picks the unexpected items to move into the counted
+// warehouse; no IDs means all of them.
+type StocktakeApplyPayload struct {
+	EquipmentIDs []int `json:"equipment_ids" validate:"max=500,dive,min=1"`
+}
+
+type StocktakeBooking struct {
+	Equipment *Equipment `json:"equipment"`
+	Project   *Project   `json:"project"`
+}
+
+// StocktakeReport reconciles the scans of a stocktake with storage, current
+// while it is open and as saved at closing afterwards: Found and Missing are
+// the items stored in the warehouse that were or were not scanned,
+// Unexpected the scanned items stored elsewhere, Moved the unexpected items
+// applying the stocktake brought into the warehouse, and Booked the scanned
+// items on a project that is shooting today.
+type StocktakeReport struct {
+	Stocktake            *Stocktake          `json:"stocktake"`
+	Found                []*Equipment        `json:"found"`
+	Missing              []*Equipment        `json:"missing"`
+	Unexpected           []*Equipment        `json:"unexpected"`
+	Moved                []*Equipment        `json:"moved"`
+	Booked               []*StocktakeBooking `json:"booked"`
+	UnknownSerialNumbers []string            `json:"unknown_serial_numbers"`
 }
 
 type UserShort struct {
@@ -164,13 +484,16 @@ type Project struct {
 	Type              *ProjectType `json:"type,omitempty"`
 	ChiefEngineer     *UserShort   `json:"chiefEngineer,omitempty"`
 	Equipment         []*Equipment `json:"equipment,omitempty"`
+	Version           int          `json:"version,omitempty"`
 }
 
 type ProjectPayload struct {
 	ProjectName       string `json:"project_name" validate:"required,min=1,max=255"`
-	ProjectTypeName   string `json:"project_type_name" validate:"required,min=1,max=255"`
+	ProjectTypeID     int    `json:"project_type_id" validate:"omitempty,min=1"`
+	ProjectTypeName   string `json:"project_type_name" validate:"required_without=ProjectTypeID,max=255"`
 	Archived          bool   `json:"archived"`
-	ChiefEngineerName string `json:"chief_engineer_name" validate:"required,min=1,max=255"`
+	ChiefEngineerID   int    `json:"chief_engineer_id" validate:"omitempty,min=1"`
+	ChiefEngineerName string `json:"chief_engineer_name" validate:"required_without=ChiefEngineerID,max=255"`
 	ShootingStartDate string `json:"shooting_start_date" validate:"required,len=10"`
 	ShootingEndDate   string `json:"shooting_end_date" validate:"required,len=10"`
 }
@@ -179,6 +502,7 @@ type Draft struct {
 	DraftID   int          `json:"draft_id"`
 	DraftName string       `json:"draft_name"`
 	Equipment []*Equipment `json:"equipment,omitempty"`
+	Version   int          `json:"version,omitempty"`
 }
 
 type DraftPayload struct {
@@ -223,6 +547,9 @@ type ProjectSetDeletePayload struct {
 type AddDraftToProjectPayload struct {
 	ProjectID int `json:"project_id" validate:"required,min=1"`
 	DraftID   int `json:"draft_id" validate:"required,min=1"`
+	// Replace drops project equipment and stock that are not in the draft,
+	// so the project ends up with exactly the draft's equipment and stock.
+	Replace bool `json:"replace"`
 }
 
 type EquipmentInDraftPayload struct {
@@ -246,6 +573,80 @@ type DraftSetDeletePayload struct {
 	EquipmentSetName string `json:"equipment_set_name" validate:"required,min=1,max=255"`
 }
 
+// StockItem is a quantity-tracked consumable such as cables, tape or
+// batteries. OnHand sums its levels over all warehouses.
+type StockItem struct {
+	StockItemID   int           `json:"stock_item_id"`
+	StockItemName string        `json:"stock_item_name"`
+	Unit          string        `json:"unit"`
+	Description   string        `json:"description,omitempty"`
+	OnHand        int           `json:"on_hand"`
+	Levels        []*StockLevel `json:"levels,omitempty"`
+	Version       int           `json:"version,omitempty"`
+}
+
+type StockLevel struct {
+	Warehouse *Warehouse `json:"warehouse"`
+	Quantity  int        `json:"quantity"`
+}
+
+type StockItemPayload struct {
+	StockItemName string `json:"stock_item_name" validate:"required,min=1,max=255"`
+	Unit          string `json:"unit" validate:"max=32"`
+	Description   string `json:"description" validate:"max=1000"`
+}
+
+type StockLevelPayload struct {
+	Quantity int `json:"quantity" validate:"min=0"`
+}
+
+// StockReservation is the quantity of a stock item a project or draft holds.
+// Available is how much of it is free for the project's shooting dates,
+// this reservation included; for drafts it is the quantity on hand.
+type StockReservation struct {
+	StockItem  *StockItem `json:"stock_item"`
+	Quantity   int        `json:"quantity"`
+	Available  int        `json:"available"`
+	Consumed   int        `json:"consumed,omitempty"`
+	ReturnedAt *time.Time `json:"returned_at,omitempty"`
+}
+
+type StockInProjectResponse struct {
+	Project *Project            `json:"project"`
+	Stock   []*StockReservation `json:"stock_in_project"`
+}
+
+type StockInDraftResponse struct {
+	Draft *Draft              `json:"draft"`
+	Stock []*StockReservation `json:"stock_in_draft"`
+}
+
+// StockInProjectPayload sets the reserved quantity; 0 drops the reservation.
+type StockInProjectPayload struct {
+	ProjectID   int `json:"project_id" validate:"required,min=1"`
+	StockItemID int `json:"stock_item_id" validate:"required,min=1"`
+	Quantity    int `json:"quantity" validate:"min=0"`
+}
+
+type StockInDraftPayload struct {
+	DraftID     int `json:"draft_id" validate:"required,min=1"`
+	StockItemID int `json:"stock_item_id" validate:"required,min=1"`
+	Quantity    int `json:"quantity" validate:"min=0"`
+}
+
+// StockReturnPayload closes a project's reservations. What was consumed is
+// taken off the stock of WarehouseID; items left out were not consumed.
+type StockReturnPayload struct {
+	ProjectID   int                `json:"project_id" validate:"required,min=1"`
+	WarehouseID int                `json:"warehouse_id" validate:"required,min=1"`
+	Consumed    []StockConsumption `json:"consumed" validate:"max=500,dive"`
+}
+
+type StockConsumption struct {
+	StockItemID int `json:"stock_item_id" validate:"required,min=1"`
+	Quantity    int `json:"quantity" validate:"min=0"`
+}
+
 type EquipmentConflict struct {
 	EquipmentID      int    `json:"equipment_id"`
 	EquipmentName    string `json:"equipment_name"`
@@ -261,3 +662,109 @@ type ConflictingProject struct {
 	ShootingEndDate           string `json:"shooting_end_date"`
 	ConflictingEquipmentCount int    `json:"conflicting_equipment_count"`
 }
+
+// DomainStats are the business gauges exported on /metrics.
+type DomainStats struct {
+	ActiveProjects              int `json:"active_projects"`
+	ConflictingProjects         int `json:"conflicting_projects"`
+	EquipmentNeedingMaintenance int `json:"equipment_needing_maintenance"`
+	EquipmentCheckedOut         int `json:"equipment_checked_out"`
+}
+
+type WebhookEndpoint struct {
+	EndpointID  int       `json:"endpoint_id"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"`
+	EventTypes  []string  `json:"event_types"`
+	Description string    `json:"description,omitempty"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type WebhookEndpointPayload struct {
+	URL         string   `json:"url" validate:"required,url,max=2048"`
+	Secret      string   `json:"secret" validate:"omitempty,min=16,max=255"`
+	EventTypes  []string `json:"event_types"`
+	Description string   `json:"description"`
+	Active      *bool    `json:"active"`
+}
+
+type WebhookDelivery struct {
+	DeliveryID         int                       `json:"delivery_id"`
+	EndpointID         int                       `json:"endpoint_id"`
+	EventID            string                    `json:"event_id"`
+	EventType          string                    `json:"event_type"`
+	Payload            json.RawMessage           `json:"payload,omitempty"`
+	Status             string                    `json:"status"`
+	Attempts           int                       `json:"attempts"`
+	NextAttemptAt      *time.Time                `json:"next_attempt_at,omitempty"`
+	LastAttemptAt      *time.Time                `json:"last_attempt_at,omitempty"`
+	LastResponseStatus *int                      `json:"last_response_status,omitempty"`
+	LastError          string                    `json:"last_error,omitempty"`
+	CreatedAt          time.Time                 `json:"created_at"`
+	AttemptLog         []*WebhookDeliveryAttempt `json:"attempt_log,omitempty"`
+}
+
+type WebhookDeliveryAttempt struct {
+	AttemptID      int       `json:"attempt_id"`
+	AttemptedAt    time.Time `json:"attempted_at"`
+	ResponseStatus *int      `json:"response_status,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	DurationMS     int       `json:"duration_ms"`
+}
+
+type NeaktorProjectPayload struct {
+	NeaktorID            string
+	ProjectName          string
+	ProjectTypeNeaktorID string
+	ShootingStartDate    string
+	ShootingEndDate      string
+	// ChiefEngineer is matched against user emails when it contains "@",
+	// otherwise against full names.
+	ChiefEngineer string
+	// Archived is left untouched on existing projects when nil.
+	Archived *bool
+}
+
+type ProjectSyncChange struct {
+	NeaktorID     string   `json:"neaktor_id"`
+	ProjectID     int      `json:"project_id,omitempty"`
+	ProjectName   string   `json:"project_name,omitempty"`
+	Action        string   `json:"action"`
+	ChangedFields []string `json:"changed_fields,omitempty"`
+	Reason        string   `json:"reason,omitempty"`
+}
+
+type NeaktorSyncReport struct {
+	Trigger    string               `json:"trigger"`
+	StartedAt  time.Time            `json:"started_at"`
+	FinishedAt time.Time            `json:"finished_at"`
+	Fetched    int                  `json:"fetched"`
+	Created    int                  `json:"created"`
+	Updated    int                  `json:"updated"`
+	Unchanged  int                  `json:"unchanged"`
+	Skipped    int                  `json:"skipped"`
+	Changes    []*ProjectSyncChange `json:"changes"`
+	Error      string               `json:"error,omitempty"`
+}
+
+type InboundReview struct {
+	ReviewID   int             `json:"review_id"`
+	Source     string          `json:"source"`
+	ExternalID string          `json:"external_id"`
+	DeliveryID string          `json:"delivery_id"`
+	Reason     string          `json:"reason"`
+	Payload    json.RawMessage `json:"payload"`
+	Status     string          `json:"status"`
+	ProjectID  *int            `json:"project_id,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	ResolvedAt *time.Time      `json:"resolved_at,omitempty"`
+}
+
+type InboundWebhookResult struct {
+	DeliveryID string             `json:"delivery_id"`
+	Status     string             `json:"status"`
+	Change     *ProjectSyncChange `json:"change,omitempty"`
+	ReviewID   int                `json:"review_id,omitempty"`
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/ru"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	entranslations "github.com/go-playground/validator/v10/translations/en"
+	rutranslations "github.com/go-playground/validator/v10/translations/ru"
+)
+
+const (
+	LocaleEN = "en"
+	LocaleRU = "ru"
+
+	// DefaultLocale answers requests without a supported Accept-Language.
+	DefaultLocale = LocaleEN
+)
+
+var translators = newTranslators()
+
+func newTranslators() *ut.UniversalTranslator {
+	translators := ut.New(en.New(), en.New(), ru.New())
+	enTrans, _ := translators.GetTranslator(LocaleEN)
+	ruTrans, _ := translators.GetTranslator(LocaleRU)
+	if err := entranslations.RegisterDefaultTranslations(Validate, enTrans); err != nil {
+		panic(err)
+	}
+	if err := rutranslations.RegisterDefaultTranslations(Validate, ruTrans); err != nil {
+		panic(err)
+	}
+	return translators
+}
+
+// Locale picks the supported language the client prefers most in its
+// Accept-Language header, or DefaultLocale.
+func Locale(r *http.Request) string {
+	best, bestQ := DefaultLocale, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if (base == LocaleEN || base == LocaleRU) && q > bestQ {
+			best, bestQ = base, q
+		}
+	}
+	return best
+}
+
+// Message is an error whose text is looked up in the message catalog when it
+// is shown to a client. Error returns the English text.
+type Message struct {
+	format string
+	args   []any
+	err    error
+}
+
+// Errorf is fmt.Errorf for errors that reach clients: format is the catalog
+// key and may wrap one error with %w.
+func Errorf(format string, args ...any) error {
+	return &Message{format: format, args: args, err: fmt.Errorf(format, args...)}
+}
+
+func (m *Message) Error() string {
+	return m.err.Error()
+}
+
+func (m *Message) Unwrap() error {
+	return errors.Unwrap(m.err)
+}
+
+// T translates format from the catalog into the request's language and
+// formats it with args.
+func T(r *http.Request, format string, args ...any) string {
+	return sprintf(Locale(r), format, args)
+}
+
+// Translate renders err for a client speaking locale. Catalog messages
+// created with Errorf are translated with their arguments, other errors only
+// when their whole text is in the catalog.
+func Translate(locale string, err error) string {
+	if locale == LocaleEN {
+		return err.Error()
+	}
+	var message *Message
+	if errors.As(err, &message) {
+		return sprintf(locale, message.format, message.args)
+	}
+	return translateText(locale, err.Error())
+}
+
+func sprintf(locale, format string, args []any) string {
+	translated := make([]any, len(args))
+	for i, arg := range args {
+		if err, ok := arg.(error); ok {
+			arg = Translate(locale, err)
+		}
+		translated[i] = arg
+	}
+	format = strings.ReplaceAll(translateText(locale, format), "%w", "%v")
+	return fmt.Sprintf(format, translated...)
+}
+
+func translateText(locale, text string) string {
+	if translated, ok := catalog[locale][text]; ok {
+		return translated
+	}
+	return text
+}
+
+func validationTranslator(locale string) ut.Translator {
+	trans, _ := translators.GetTranslator(locale)
+	return trans
+}
+
+func translateFieldError(locale string, fieldErr validator.FieldError) string {
+	return fieldErr.Translate(validationTranslator(locale))
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLocalePicksPreferredSupportedLanguage(t *testing.T) {
+	testCases := map[string]string{
+		"":                                DefaultLocale,
+		"ru-RU,ru;q=0.9,en-US;q=0.8":      LocaleRU,
+		"de-DE,en;q=0.5,ru;q=0.7":         LocaleRU,
+		"en-GB,en;q=0.9":                  LocaleEN,
+		"fr":                              DefaultLocale,
+		"ru;q=bogus, en;q=0.1":            LocaleEN,
+		"EN-us;q=0.3, Ru-ru;q=0.4, *;q=1": LocaleRU,
+	}
+
+	for header, want := range testCases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Language", header)
+		if got := Locale(req); got != want {
+			t.Errorf("Accept-Language %q: expected %s, got %s", header, want, got)
+		}
+	}
+}
+
+func TestTranslateUsesCatalogWithArguments(t *testing.T) {
+	sentinel := errors.New("invalid reference")
+	err := Errorf("%w: no warehouse named %q", sentinel, "Main")
+
+	if !errors.Is(err, sentinel) {
+		t.Fatal("expected Errorf to keep the wrapped error")
+	}
+	if got := Translate(LocaleEN, err); got != `invalid reference: no warehouse named "Main"` {
+		t.Fatalf("unexpected English text %q", got)
+	}
+	if got := Translate(LocaleRU, err); got != `ссылка на несуществующую запись: нет склада с названием "Main"` {
+		t.Fatalf("unexpected Russian text %q", got)
+	}
+	if got := Translate(LocaleRU, errors.New("not in the catalog")); got != "not in the catalog" {
+		t.Fatalf("expected unknown text to pass through, got %q", got)
+	}
+}
+
+var formatVerb = regexp.MustCompile(`%[a-z]`)
+
+func TestCatalogKeepsFormatVerbs(t *testing.T) {
+	for locale, messages := range catalog {
+		for key, translated := range messages {
+			if !slices.Equal(formatVerb.FindAllString(key, -1), formatVerb.FindAllString(translated, -1)) {
+				t.Errorf("%s translation of %q changes its format verbs: %q", locale, key, translated)
+			}
+		}
+	}
+}
+
+func TestValidationProblemIsTranslated(t *testing.T) {
+	type payload struct {
+		Name string `json:"project_name" validate:"required"`
+	}
+	err := Validate.Struct(payload{})
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Accept-Language", "ru")
+	rr := httptest.NewRecorder()
+	WriteError(rr, req, http.StatusBadRequest, err)
+
+	if rr.Header().Get("Content-Language") != LocaleRU {
+		t.Fatalf("expected Content-Language ru, got %q", rr.Header().Get("Content-Language"))
+	}
+	body := rr.Body.String()
+	for _, want := range []string{"данные не прошли проверку", "project_name", "обязательное поле"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %q in %s", want, body)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package utils
+
+// catalog translates client-facing messages. Keys are the English texts or
+// Errorf/T formats exactly as written in the code; a translation must keep
+// the verbs of its key in the same order.
+var catalog = map[string]map[string]string{
+	LocaleRU: {
+		// HTTP status titles
+		"Bad Request":           "Некорректный запрос",
+		"Unauthorized":          "Требуется авторизация",
+		"Forbidden":             "Доступ запрещён",
+		"Not Found":             "Не найдено",
+		"Conflict":              "Конфликт",
+		"Precondition Failed":   "Условие запроса не выполнено",
+		"Unprocessable Entity":  "Запрос не может быть обработан",
+		"Internal Server Error": "Внутренняя ошибка сервера",
+		"Service Unavailable":   "Сервис недоступен",
+		"Gateway Timeout":       "Превышено время ожидания",
+		"Client Closed Request": "Клиент закрыл соединение",
+
+		// Requests and payloads
+		"Missing request body":                            "тело запроса отсутствует",
+		"failed to read request body":                     "не удалось прочитать тело запроса",
+		"invalid id":                                      "некорректный идентификатор",
+		"payload failed validation":                       "данные не прошли проверку",
+		"must be a %s":                                    "должно иметь тип %s",
+		"If-Match must be an ETag returned by this API":   "If-Match должен содержать ETag, полученный от этого API",
+		"If-Match must be a strong ETag":                  "If-Match должен содержать сильный ETag",
+		"%s must be at most %d characters":                "%s должен содержать не более %d символов",
+		"%s was already used for a different request":     "%s уже использован для другого запроса",
+		"a request with this %s is still being processed": "запрос с этим %s ещё выполняется",
+		"request timed out":                               "превышено время ожидания запроса",
+		"request cancelled":                               "запрос отменён",
+		"internal server error":                           "внутренняя ошибка сервера",
+
+		// Stores and constraints
+		"resource not found": "запись не найдена",
+		"invalid reference":  "ссылка на несуществующую запись",
+		"version conflict":   "версия записи устарела",
+		"resource was modified by another request, reload it and retry":                    "запись изменена другим запросом, обновите её и повторите попытку",
+		"%w: no set type named %q":                                                         "%w: нет типа комплекта с названием %q",
+		"%w: no project type named %q":                                                     "%w: нет типа проекта с названием %q",
+		"%w: no project type with neaktor_id %q":                                           "%w: нет типа проекта с neaktor_id %q",
+		"%w: no warehouse named %q":                                                        "%w: нет склада с названием %q",
+		"%w: no equipment set named %q":                                                    "%w: нет комплекта с названием %q",
+		"%w: no user named %q":                                                             "%w: нет пользователя с именем %q",
+		"%w: no user with email %q":                                                        "%w: нет пользователя с email %q",
+		"%w: no %s row with id %d":                                                         "%w: в таблице %s нет записи с id %d",
+		"ambiguous reference":                                                              "неоднозначная ссылка",
+		"%w: several users are named %q, pass the user id instead":                         "%w: несколько пользователей с именем %q, укажите id пользователя",
+		"record is in use":                                                                 "запись используется",
+		"%w: %d equipment sets of this type":                                               "%w: комплектов этого вида: %d",
+		"%w: %d projects of this type":                                                     "%w: проектов этого типа: %d",
+		"%w: %d equipment items in this warehouse":                                         "%w: единиц оборудования на этом складе: %d",
+		"%w: %d equipment items in this set":                                               "%w: единиц оборудования в этом комплекте: %d",
+		"record is in the trash":                                                           "запись в корзине",
+		"%w: the project linked to task %s":                                                "%w: проект, связанный с задачей %s",
+		"unknown trash kind %q":                                                            "неизвестный тип записи в корзине %q",
+		"equipment is on an open transfer":                                                 "оборудование участвует в незавершённом перемещении",
+		"invalid status transition":                                                        "недопустимая смена статуса",
+		"not enough stock":                                                                 "недостаточно расходников на складе",
+		"invalid attribute":                                                                "недопустимый атрибут",
+		"duplicate serial number":                                                          "повторяющийся серийный номер",
+		"%w: equipment %d is on transfer %d":                                               "%w: оборудование %d участвует в перемещении %d",
+		"%w: equipment %d is not stored in warehouse %d":                                   "%w: оборудование %d не хранится на складе %d",
+		"%w: transfer %d is %s and cannot become %s":                                       "%w: перемещение %d в статусе %s не может перейти в статус %s",
+		"%w: %d open transfers to or from this warehouse":                                  "%w: незавершённых перемещений с этого склада или на него: %d",
+		"unknown transfer status %q":                                                       "неизвестный статус перемещения %q",
+		"%w: %d locations inside this location":                                            "%w: вложенных мест хранения: %d",
+		"%w: %d equipment items in this location":                                          "%w: оборудования в этом месте хранения: %d",
+		"%w: a %s cannot be placed inside a %s":                                            "%w: %s нельзя разместить внутри %s",
+		"%w: no location %d in warehouse %d":                                               "%w: место хранения %d отсутствует на складе %d",
+		"%w: %d projects reserve this stock item":                                          "%w: проектов, резервирующих эту позицию склада: %d",
+		"%w: %d drafts reserve this stock item":                                            "%w: черновиков, резервирующих эту позицию склада: %d",
+		"%w: project %d reserves no stock":                                                 "%w: проект %d не резервирует расходники",
+		"%w: project %d does not reserve stock item %d":                                    "%w: проект %d не резервирует позицию склада %d",
+		"%w: %d %s of %s consumed but only %d reserved":                                    "%w: израсходовано %d %s позиции %s, но зарезервировано только %d",
+		"%w: warehouse %d holds less than %d %s of %s":                                     "%w: на складе %d меньше %d %s позиции %s",
+		"%w: %d %s of %s available, %d requested":                                          "%w: доступно %d %s позиции %s, запрошено %d",
+		"%w: project %d has already returned its stock":                                    "%w: проект %d уже вернул расходники",
+		"%w: %d %s of %s available for these dates, %d requested":                          "%w: на эти даты доступно %d %s позиции %s, запрошено %d",
+		"%w: %d stock items are kept in this warehouse":                                    "%w: позиций расходников на этом складе: %d",
+		"%w: attribute key %q must be lowercase letters, digits and underscores":           "%w: ключ атрибута %q может содержать только строчные латинские буквы, цифры и подчёркивания",
+		"%w: attribute %q is defined twice":                                                "%w: атрибут %q описан дважды",
+		"%w: enum attribute %q needs options":                                              "%w: для атрибута-списка %q нужны варианты",
+		"%w: only enum attributes take options, %q is a %s":                                "%w: варианты бывают только у атрибутов-списков, а %q имеет тип %s",
+		"%w: unknown attribute %q":                                                         "%w: неизвестный атрибут %q",
+		"%w: attribute %q is required":                                                     "%w: атрибут %q обязателен",
+		"%w: attribute %q must be one of %s":                                               "%w: атрибут %q должен принимать одно из значений: %s",
+		"%w: attribute %q must be a %s":                                                    "%w: атрибут %q должен иметь тип %s",
+		"equipment %d: %w":                                                                 "оборудование %d: %w",
+		"%w: serial number %q is already used by equipment %d in this set":                 "%w: серийный номер %q в этом комплекте уже занят оборудованием %d",
+		"%w: serial number %q is used in both sets":                                        "%w: серийный номер %q есть в обоих комплектах",
+		"as_of must be a date such as %s":                                                  "as_of должно быть датой вида %s",
+		"unknown valuation grouping %q":                                                    "неизвестная группировка оценки %q",
+		"unknown end of life filter %q":                                                    "неизвестный фильтр срока службы %q",
+		"%s must be a non-negative integer":                                                "%s должно быть неотрицательным целым числом",
+		"%w: warehouse %d is already counted by stocktake %d":                              "%w: склад %d уже проверяется инвентаризацией %d",
+		"%w: stocktake %d is %s and takes no more scans":                                   "%w: инвентаризация %d в статусе %s больше не принимает сканы",
+		"%w: several equipment items have serial number %q, scan the equipment id instead": "%w: серийный номер %q есть у нескольких единиц оборудования, отсканируйте id оборудования",
+		"%w: the warehouse of stocktake %d was deleted":                                    "%w: склад инвентаризации %d удалён",
+		"%w: equipment %d is not an unexpected item of stocktake %d":                       "%w: оборудование %d не относится к неожиданным находкам инвентаризации %d",
+		"%w: stocktake %d is %s and cannot become %s":                                      "%w: инвентаризация %d в статусе %s не может перейти в статус %s",
+		"%w: this warehouse is being counted by an open stocktake":                         "%w: на складе идёт незавершённая инвентаризация",
+		"unknown stocktake status %q":                                                      "неизвестный статус инвентаризации %q",
+		"%w: cannot merge a record into itself":                                            "%w: запись нельзя объединить саму с собой",
+		"a record with this %s already exists":                                             "запись с таким значением %s уже существует",
+		"is already taken":                                                                 "уже занято",
+		"record is still used by %s":                                                       "запись используется в %s",
+		"is referenced from %s":                                                            "используется в %s",
+		"payload references a record that does not exist":                                  "данные ссылаются на несуществующую запись",
+		"references a missing record":                                                      "ссылается на несуществующую запись",
+		"is required":                                                                      "обязательное поле",
+		"payload violates %s":                                                              "данные нарушают ограничение %s",
+		"has an invalid value":                                                             "недопустимое значение",
+		"database is not configured":                                                       "база данных не настроена",
+
+		// Users and auth
+		"permission denied":                         "доступ запрещён",
+		"Permission denied":                         "доступ запрещён",
+		"user not found":                            "пользователь не найден",
+		"User not found, invalid email or password": "пользователь не найден, неверный email или пароль",
+		"current password is invalid":               "текущий пароль указан неверно",
+		"user with email %s already exists":         "пользователь с email %s уже существует",
+		"invalid user id":                           "некорректный идентификатор пользователя",
+		"invalid user name":                         "некорректное имя пользователя",
+		"invalid metrics token":                     "неверный токен метрик",
+		"invalid token":                             "неверный токен",
+		"missing userID claim":                      "в токене нет userID",
+		"unexpected signing method: %v":             "неожиданный метод подписи: %v",
+
+		// Integrations
+		"unknown event type %q":                     "неизвестный тип события %q",
+		"url must be an absolute http or https URL": "url должен быть абсолютным http- или https-адресом",
+		"url must not contain credentials":          "url не должен содержать учётные данные",
+		"webhook target is not a public address":    "адрес вебхука не является публичным",
+		"invalid project_id":                        "некорректный project_id",
+		"invalid draft_id":                          "некорректный draft_id",
+		"unknown review status %q":                  "неизвестный статус проверки %q",
+		"review item is already resolved":           "элемент очереди проверки уже обработан",
+		"no importer configured for source %q":      "для источника %q не настроен импорт",
+		"neaktor integration is not configured":     "интеграция с Neaktor не настроена",
+		"neaktor sync is already running":           "синхронизация с Neaktor уже выполняется",
+		"no sync has run yet":                       "синхронизация ещё не выполнялась",
+		"no project is linked to this task":         "к этой задаче не привязан проект",
+		"invalid signature":                         "неверная подпись",
+		"missing delivery id":                       "отсутствует идентификатор доставки",
+		"payload has neither task nor taskId":       "в данных нет ни task, ни taskId",
+	},
+}
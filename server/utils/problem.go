@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"VyacheslavKuchumov/test-backend/types"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// Stable error codes of problem responses.
+const (
+	CodeBadRequest         = "bad_request"
+	CodeValidationFailed   = "validation_failed"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeInvalidReference   = "invalid_reference"
+	CodeAmbiguousReference = "ambiguous_reference"
+	CodeDuplicate          = "duplicate"
+	CodeInUse              = "in_use"
+	CodeTrashed            = "trashed"
+	CodeInTransfer         = "in_transfer"
+	CodeInvalidTransition  = "invalid_transition"
+	CodeInsufficientStock  = "insufficient_stock"
+	CodeConflict           = "conflict"
+	CodeVersionConflict    = "version_conflict"
+	CodeUnprocessable      = "unprocessable"
+	CodeTimeout            = "timeout"
+	CodeCancelled          = "cancelled"
+	CodeUnavailable        = "unavailable"
+	CodeInternal           = "internal"
+)
+
+func init() {
+	// Report validation failures under the JSON field names clients send.
+	Validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+}
+
+// WriteProblem writes problem as application/problem+json in the request's
+// language, filling in the type, title and code from the status when they are
+// empty. A detail found in the catalog is translated; details with arguments
+// should be built with T.
+func WriteProblem(w http.ResponseWriter, r *http.Request, problem types.ErrorResponse) {
+	locale := Locale(r)
+	if problem.Type == "" {
+		problem.Type = "about:blank"
+	}
+	if problem.Title == "" {
+		problem.Title = translateText(locale, statusTitle(problem.Status))
+	}
+	problem.Detail = translateText(locale, problem.Detail)
+	if problem.Code == "" {
+		problem.Code = codeForStatus(problem.Status)
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("Content-Language", locale)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// ValidationProblem describes validator errors field by field in locale.
+func ValidationProblem(locale string, errs validator.ValidationErrors) types.ErrorResponse {
+	fields := make([]types.FieldError, 0, len(errs))
+	for _, fieldErr := range errs {
+		fields = append(fields, types.FieldError{
+			Field:   fieldErr.Field(),
+			Code:    fieldErr.Tag(),
+			Message: translateFieldError(locale, fieldErr),
+		})
+	}
+	return types.ErrorResponse{
+		Status: http.StatusBadRequest,
+		Code:   CodeValidationFailed,
+		Detail: translateText(locale, "payload failed validation"),
+		Errors: fields,
+	}
+}
+
+func statusTitle(status int) string {
+	if status == 499 {
+		return "Client Closed Request"
+	}
+	return http.StatusText(status)
+}
+
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusPreconditionFailed:
+		return CodeVersionConflict
+	case http.StatusUnprocessableEntity:
+		return CodeUnprocessable
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	case 499:
+		return CodeCancelled
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+func problemFromError(locale string, status int, err error) types.ErrorResponse {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return ValidationProblem(locale, validationErrs)
+	}
+	return types.ErrorResponse{Status: status, Detail: Translate(locale, err)}
+}
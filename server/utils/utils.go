@@ -24,6 +24,9 @@ func WriteJSON(w http.ResponseWriter, status int, v any) error {
 	return json.NewEncoder(w).Encode(v)
 }
 
-func WriteError(w http.ResponseWriter, status int, err error) {
-	WriteJSON(w, status, map[string]string{"error": err.Error()})
+// WriteError answers with a problem response whose code follows from status,
+// translated into the request's language. Validator errors, also wrapped
+// ones, become a validation_failed problem listing the failing fields.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	WriteProblem(w, r, problemFromError(Locale(r), status, err))
 }
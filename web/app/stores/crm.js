@@ -8,7 +8,7 @@ let lastErrorToast = {
 function extractBackendErrorMessage(error) {
   return (
     error?.data?.statusMessage ||
-    error?.data?.error ||
+    error?.data?.data?.detail ||
     error?.data?.message ||
     error?.statusMessage ||
     error?.message ||
@@ -95,17 +95,29 @@ function applyListState(store, stateKey, paginationKey, response) {
   return normalized.items
 }
 
+const MUTATING_METHODS = new Set(['POST', 'PUT', 'PATCH', 'DELETE'])
+
 async function backendRequest(path, options = {}) {
   const auth = useAuthStore()
   const method = options.method || 'GET'
   const throwOnError = options.throwOnError !== false
+  const headers = { ...auth.authHeader() }
+
+  // One key per user action: retries of a dropped request are answered with
+  // the stored response instead of being applied twice.
+  const mutating = MUTATING_METHODS.has(method.toUpperCase())
+  if (mutating) {
+    headers['Idempotency-Key'] = crypto.randomUUID()
+  }
 
   try {
     return await $fetch(`/api/backend${path}`, {
       method,
       body: options.body,
       query: options.query,
-      headers: auth.authHeader()
+      headers,
+      retry: mutating ? 2 : undefined,
+      retryDelay: 500
     })
   } catch (error) {
     const message = extractBackendErrorMessage(error)
@@ -130,6 +142,11 @@ export const useCRMStore = defineStore('crm', {
     projects: [],
     archivedProjects: [],
     drafts: [],
+    trash: [],
+    stocktakes: [],
+    stockItems: [],
+    serialDuplicates: [],
+    valuedItems: [],
     currentProject: null,
     currentDraft: null,
     projectBoard: null,
@@ -142,7 +159,12 @@ export const useCRMStore = defineStore('crm', {
       equipment: defaultPagination(),
       projects: defaultPagination(),
       archivedProjects: defaultPagination(),
-      drafts: defaultPagination()
+      drafts: defaultPagination(),
+      trash: defaultPagination(),
+      stocktakes: defaultPagination(),
+      stockItems: defaultPagination(),
+      serialDuplicates: defaultPagination(),
+      valuedItems: defaultPagination()
     }
   }),
   actions: {
@@ -223,6 +245,10 @@ export const useCRMStore = defineStore('crm', {
       return this.warehouses
     },
 
+    async fetchWarehouseLocations(warehouseId) {
+      return backendRequest(`/warehouse/${warehouseId}/locations`, { throwOnError: false, fallback: [] })
+    },
+
     async fetchEquipmentSets(params = {}) {
       const response = await backendRequest('/equipment_set', {
         throwOnError: false,
@@ -273,6 +299,37 @@ export const useCRMStore = defineStore('crm', {
       return this.equipment
     },
 
+    async fetchSerialDuplicates(params = {}) {
+      const response = await backendRequest('/equipment/duplicates', {
+        throwOnError: false,
+        query: params,
+        fallback: fallbackListResponse(params)
+      })
+      return applyListState(this, 'serialDuplicates', 'serialDuplicates', response)
+    },
+
+    async mergeEquipment(id, targetId) {
+      return backendRequest(`/equipment/${id}/merge`, { method: 'POST', body: { target_id: targetId } })
+    },
+
+    async fetchValuationReport(params = {}) {
+      return backendRequest('/valuation', { throwOnError: false, query: params, fallback: null })
+    },
+
+    async fetchValuedItems(params = {}) {
+      const response = await backendRequest('/valuation/items', {
+        throwOnError: false,
+        query: params,
+        fallback: fallbackListResponse(params)
+      })
+      return applyListState(this, 'valuedItems', 'valuedItems', response)
+    },
+
+    // The proxy hands CSV exports back as text.
+    async downloadValuationCSV(path, params = {}) {
+      return backendRequest(path, { query: { ...params, format: 'csv' } })
+    },
+
     async fetchProjects(params = {}) {
       const response = await backendRequest('/projects', {
         throwOnError: false,
@@ -345,6 +402,109 @@ export const useCRMStore = defineStore('crm', {
       return this.drafts
     },
 
+    async fetchTrash(params = {}) {
+      const response = await backendRequest('/trash', {
+        throwOnError: false,
+        query: params,
+        fallback: fallbackListResponse(params)
+      })
+      return applyListState(this, 'trash', 'trash', response)
+    },
+
+    async restoreTrashItem(kind, id) {
+      return backendRequest(`/trash/${kind}/${id}/restore`, { method: 'POST' })
+    },
+
+    async fetchStocktakes(params = {}) {
+      const response = await backendRequest('/stocktakes', {
+        throwOnError: false,
+        query: params,
+        fallback: fallbackListResponse(params)
+      })
+      return applyListState(this, 'stocktakes', 'stocktakes', response)
+    },
+
+    async startStocktake(warehouseId) {
+      return backendRequest('/stocktakes', { method: 'POST', body: { warehouse_id: warehouseId } })
+    },
+
+    async fetchStocktakeReport(id) {
+      return backendRequest(`/stocktakes/${id}/report`, { throwOnError: false, fallback: null })
+    },
+
+    async scanStocktake(id, payload) {
+      return backendRequest(`/stocktakes/${id}/scans`, { method: 'POST', body: payload })
+    },
+
+    async closeStocktake(id) {
+      return backendRequest(`/stocktakes/${id}/close`, { method: 'POST' })
+    },
+
+    async applyStocktake(id, equipmentIds = []) {
+      return backendRequest(`/stocktakes/${id}/apply`, { method: 'POST', body: { equipment_ids: equipmentIds } })
+    },
+
+    async fetchStockItems(params = {}) {
+      const response = await backendRequest('/stock_items', {
+        throwOnError: false,
+        query: params,
+        fallback: fallbackListResponse(params)
+      })
+      return applyListState(this, 'stockItems', 'stockItems', response)
+    },
+
+    async fetchStockItem(id) {
+      return backendRequest(`/stock_items/${id}`, { throwOnError: false, fallback: null })
+    },
+
+    async createStockItem(payload) {
+      this.stockItems = await backendRequest('/stock_items', { method: 'POST', body: payload })
+      return this.stockItems
+    },
+
+    async updateStockItem(id, payload) {
+      this.stockItems = await backendRequest(`/stock_items/${id}`, { method: 'PUT', body: payload })
+      return this.stockItems
+    },
+
+    async deleteStockItem(id) {
+      this.stockItems = await backendRequest(`/stock_items/${id}`, { method: 'DELETE' })
+      return this.stockItems
+    },
+
+    async setStockLevel(id, warehouseId, quantity) {
+      return backendRequest(`/stock_items/${id}/levels/${warehouseId}`, { method: 'PUT', body: { quantity } })
+    },
+
+    async fetchStockInProject(projectId) {
+      return backendRequest(`/stock_in_project/${projectId}`, { throwOnError: false, fallback: null })
+    },
+
+    async setStockInProject(projectId, stockItemId, quantity) {
+      return backendRequest('/stock_in_project/set', {
+        method: 'POST',
+        body: { project_id: projectId, stock_item_id: stockItemId, quantity }
+      })
+    },
+
+    async returnStockFromProject(projectId, warehouseId, consumed = []) {
+      return backendRequest('/stock_in_project/return', {
+        method: 'POST',
+        body: { project_id: projectId, warehouse_id: warehouseId, consumed }
+      })
+    },
+
+    async fetchStockInDraft(draftId) {
+      return backendRequest(`/stock_in_draft/${draftId}`, { throwOnError: false, fallback: null })
+    },
+
+    async setStockInDraft(draftId, stockItemId, quantity) {
+      return backendRequest('/stock_in_draft/set', {
+        method: 'POST',
+        body: { draft_id: draftId, stock_item_id: stockItemId, quantity }
+      })
+    },
+
     async fetchProjectBoard(projectId) {
       this.projectBoard = await backendRequest(`/equipment_in_project/${projectId}`, { throwOnError: false, fallback: null })
       return this.projectBoard
@@ -9,7 +9,9 @@ export default defineNuxtConfig({
     'pinia-plugin-persistedstate'
   ],
   runtimeConfig: {
-    backendUrl: process.env.BACKEND_URL || 'http://localhost:8000'
+    backendUrl: process.env.BACKEND_URL || 'http://localhost:8000',
+    // Language of backend error messages; the UI is Russian
+    apiLocale: process.env.API_LOCALE || 'ru'
   },
   css: ['~/assets/css/main.css']
 })
@@ -15,7 +15,9 @@ export async function callBackend(
   options: RequestOptions = {}
 ) {
   const config = useRuntimeConfig(event)
-  const headers: Record<string, string> = {}
+  const headers: Record<string, string> = {
+    'Accept-Language': config.apiLocale
+  }
 
   if (options.requireAuth) {
     const authHeader = getHeader(event, 'authorization')
@@ -25,6 +27,13 @@ export async function callBackend(
     headers.Authorization = authHeader
   }
 
+  for (const name of ['If-Match', 'Idempotency-Key']) {
+    const value = getHeader(event, name.toLowerCase())
+    if (value) {
+      headers[name] = value
+    }
+  }
+
   try {
     return await $fetch(`${config.backendUrl}/api/v1${path}`, {
       method,
@@ -36,15 +45,30 @@ export async function callBackend(
     const statusCode = Number(error?.statusCode || error?.status || error?.response?.status) || 500
     const payload = error?.data || error?.response?._data || {}
     const statusMessage =
-      payload?.error ||
+      problemMessage(payload) ||
       payload?.message ||
       error?.statusMessage ||
       error?.message ||
       'Backend request failed'
 
+    // The problem details (code, per-field errors) stay available to the
+    // client as error.data.data.
     throw createError({
       statusCode,
-      statusMessage
+      statusMessage,
+      data: payload
     })
   }
 }
+
+// problemMessage renders an application/problem+json body as one line, with
+// the failing fields appended.
+function problemMessage(payload: any) {
+  const message = payload?.detail || payload?.title
+  if (!message) return ''
+
+  const fields = Array.isArray(payload?.errors)
+    ? payload.errors.map((item: any) => `${item.field}: ${item.message}`)
+    : []
+  return fields.length ? `${message} (${fields.join('; ')})` : message
+}